@@ -5,8 +5,16 @@ import (
 	"os"
 )
 
-func ParseFlags() string {
+type Flags struct {
+	ConfigPath      string
+	RotateMasterKey bool
+	EncryptSecret   bool
+}
+
+func ParseFlags() Flags {
 	configPath := flag.String("config", "./config.json", "path to config file")
+	rotateMasterKey := flag.Bool("rotate-master-key", false, "rewrap the credential encryption keys under a new master key and exit")
+	encryptSecret := flag.Bool("encrypt-secret", false, "read a value from stdin, print it encrypted for use in the config file and exit")
 	help := flag.Bool("help", false, "print help and exit")
 
 	flag.Parse()
@@ -16,5 +24,9 @@ func ParseFlags() string {
 		os.Exit(0)
 	}
 
-	return *configPath
+	return Flags{
+		ConfigPath:      *configPath,
+		RotateMasterKey: *rotateMasterKey,
+		EncryptSecret:   *encryptSecret,
+	}
 }
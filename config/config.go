@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"regexp"
+	"strings"
 
 	muxHandlers "github.com/gorilla/handlers"
 )
@@ -44,6 +46,47 @@ type GoogleOAuth struct {
 	RedirectURL  string `json:"callbackUrl"`
 }
 
+// OIDCProvider is a generic OpenID Connect provider, such as Keycloak,
+// Authentik or Okta, found through the discovery document of its issuer.
+// Name is used in the login and callback URLs.
+type OIDCProvider struct {
+	Name           string             `json:"name"`
+	DisplayName    string             `json:"displayName"`
+	Issuer         string             `json:"issuer"`
+	ClientID       string             `json:"clientId"`
+	ClientSecret   string             `json:"clientSecret"`
+	RedirectURL    string             `json:"callbackUrl"`
+	Scopes         []string           `json:"scopes"`
+	GroupsClaim    string             `json:"groupsClaim"`
+	AutoProvision  bool               `json:"autoProvision"`
+	AllowedDomains []string           `json:"allowedDomains"`
+	GroupMappings  []OIDCGroupMapping `json:"groupMappings"`
+}
+
+// OIDCGroupMapping gives the members of a group the admin flag or the
+// permissions listed. A user in several mapped groups gets all of them.
+type OIDCGroupMapping struct {
+	Group       string   `json:"group"`
+	Admin       bool     `json:"admin"`
+	Permissions []string `json:"permissions"`
+}
+
+//nolint:gochecknoglobals
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func (cfg *OIDCProvider) SetDefault() {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+}
+
 type Config struct {
 	LogSubCmd      bool           `json:"logSubCmd"`
 	Environment    string         `json:"environment"`
@@ -61,13 +104,27 @@ type Config struct {
 	GithubOAuth    GithubOAuth    `json:"githubOAuth"`
 	MicrosoftOAuth MicrosoftOAuth `json:"microsoftOAuth"`
 	GoogleOAuth    GoogleOAuth    `json:"googleOAuth"`
+	OIDCProviders  []OIDCProvider `json:"oidcProviders"`
 	BodyLimitMb    int64          `json:"bodyLimitMb"`
 	PathToSecret   string         `json:"pathToSecretFile"`
+	TrashRetention int            `json:"trashRetentionDays"` // in days
+	LinkCheck      LinkCheck      `json:"linkCheck"`
+	Email          Email          `json:"email"`
 	Secret         Secret         `json:"-"`
 }
 
+// LinkCheck configures the link checker that runs after every build.
+// External URLs are only requested when External is set.
+type LinkCheck struct {
+	External    bool `json:"external"`
+	Concurrency int  `json:"concurrency"`
+	Timeout     int  `json:"timeoutSeconds"`
+}
+
 type Security struct {
 	CORSConfig CORSConfig `json:"corsConfig"`
+	LoginLimit LoginLimit `json:"loginLimit"`
+	TwoFactor  TwoFactor  `json:"twoFactor"`
 	// TODO CFRSConfig CFRSConfig
 	// other security config here
 }
@@ -130,8 +187,100 @@ func (cfg *CORSConfig) SetDefault() {
 	}
 }
 
+// LoginLimit throttles failed logins. After MaxAttempts failures for one
+// account, or MaxAttemptsPerIP from one address, within WindowMinutes,
+// further logins are refused for LockoutMinutes.
+type LoginLimit struct {
+	MaxAttempts      int `json:"maxAttempts"`
+	MaxAttemptsPerIP int `json:"maxAttemptsPerIp"`
+	WindowMinutes    int `json:"windowMinutes"`
+	LockoutMinutes   int `json:"lockoutMinutes"`
+	// TrustProxy takes the client address from X-Forwarded-For, for
+	// deployments behind a reverse proxy. ProxyHops is the number of
+	// proxies in front of Kalmia, each of which appends an entry; anything
+	// further left was sent by the client and is ignored.
+	TrustProxy bool `json:"trustProxy"`
+	ProxyHops  int  `json:"proxyHops"`
+}
+
+func (cfg *LoginLimit) SetDefault() {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.MaxAttemptsPerIP <= 0 {
+		cfg.MaxAttemptsPerIP = 20
+	}
+	if cfg.WindowMinutes <= 0 {
+		cfg.WindowMinutes = 15
+	}
+	if cfg.LockoutMinutes <= 0 {
+		cfg.LockoutMinutes = 15
+	}
+	if cfg.ProxyHops <= 0 {
+		cfg.ProxyHops = 1
+	}
+}
+
+// Email configures the SMTP server emails are sent through and the links
+// in them. Without a host, emails stay queued in the outbox.
+type Email struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Security is "starttls", "tls" or "none".
+	Security string `json:"security"`
+	From     string `json:"from"`
+	// PublicURL is where Kalmia is reached, e.g. https://docs.example.com.
+	// Password reset and invitation emails are refused without it.
+	PublicURL string `json:"publicUrl"`
+	// TemplatesPath holds templates that replace the built-in ones.
+	TemplatesPath      string `json:"templatesPath"`
+	MaxAttempts        int    `json:"maxAttempts"`
+	ResetExpiryMinutes int    `json:"resetExpiryMinutes"`
+	InviteExpiryHours  int    `json:"inviteExpiryHours"`
+}
+
+func (cfg *Email) SetDefault() {
+	if cfg.Port <= 0 {
+		cfg.Port = 587
+	}
+	if cfg.Security == "" {
+		cfg.Security = "starttls"
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.ResetExpiryMinutes <= 0 {
+		cfg.ResetExpiryMinutes = 60
+	}
+	if cfg.InviteExpiryHours <= 0 {
+		cfg.InviteExpiryHours = 72
+	}
+}
+
+// TwoFactor configures TOTP two-factor authentication. Users can always
+// enrol; RequireForAdmins makes it mandatory for admins, and SkipForOAuth
+// lets OAuth logins through without a code.
+type TwoFactor struct {
+	RequireForAdmins bool   `json:"requireForAdmins"`
+	SkipForOAuth     bool   `json:"skipForOAuth"`
+	Issuer           string `json:"issuer"`
+}
+
+func (cfg *TwoFactor) SetDefault() {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "Kalmia"
+	}
+}
+
 type Secret struct {
 	JwtSecretKey string `json:"JwtSecretKey"`
+	// MasterKey (base64, 32 bytes) wraps the keys that encrypt credentials
+	// at rest. PreviousMasterKey is only set while a rotation is under way.
+	MasterKey         string `json:"MasterKey,omitempty"`
+	PreviousMasterKey string `json:"PreviousMasterKey,omitempty"`
+	MasterKeyFromEnv  bool   `json:"-"`
 }
 
 //nolint:gochecknoglobals
@@ -172,8 +321,35 @@ func ParseConfig(path string) *Config {
 		ParsedConfig.BodyLimitMb = 50
 	}
 
+	// deleted documentations, page groups and pages are kept for 30 days
+	if ParsedConfig.TrashRetention == 0 {
+		ParsedConfig.TrashRetention = 30
+	}
+
+	// external links are checked 8 at a time and given 10 seconds each
+	if ParsedConfig.LinkCheck.Concurrency <= 0 {
+		ParsedConfig.LinkCheck.Concurrency = 8
+	}
+
+	if ParsedConfig.LinkCheck.Timeout <= 0 {
+		ParsedConfig.LinkCheck.Timeout = 10
+	}
+
 	// sensible defaualt for cors
 	ParsedConfig.Security.CORSConfig.SetDefault()
+	ParsedConfig.Security.LoginLimit.SetDefault()
+	ParsedConfig.Security.TwoFactor.SetDefault()
+	ParsedConfig.Email.SetDefault()
+
+	oidcNames := map[string]bool{}
+	for i := range ParsedConfig.OIDCProviders {
+		provider := &ParsedConfig.OIDCProviders[i]
+		provider.SetDefault()
+		if !oidcProviderName.MatchString(provider.Name) || oidcNames[provider.Name] {
+			panic("oidc provider names must be unique and use only a-z, 0-9 and -: " + provider.Name)
+		}
+		oidcNames[provider.Name] = true
+	}
 
 	if ParsedConfig.PathToSecret == "" {
 		panic("path to secret file is empty")
@@ -192,9 +368,30 @@ func ParseConfig(path string) *Config {
 		panic(err)
 	}
 
+	if masterKey := os.Getenv("KAL_MASTER_KEY"); masterKey != "" {
+		ParsedConfig.Secret.MasterKey = masterKey
+		ParsedConfig.Secret.MasterKeyFromEnv = true
+	}
+
 	return ParsedConfig
 }
 
+// SaveSecret writes the secret file back, such as after a master key was
+// generated or rotated. A master key from the environment is not written.
+func (cfg *Config) SaveSecret() error {
+	secret := cfg.Secret
+	if secret.MasterKeyFromEnv {
+		secret.MasterKey = ""
+	}
+
+	data, err := json.MarshalIndent(secret, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cfg.PathToSecret, data, 0600)
+}
+
 func SetupDataPath() error {
 	if ParsedConfig.DataPath == "" {
 		ParsedConfig.DataPath = "./data"
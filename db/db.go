@@ -52,6 +52,21 @@ func SetupDatabase(env string, database string, dataPath string) *gorm.DB {
 		&models.PageGroup{},
 		&models.Page{},
 		&models.File{},
+		&models.TrashItem{},
+		&models.PageTranslation{},
+		&models.PageGroupTranslation{},
+		&models.LinkReport{},
+		&models.Redirect{},
+		&models.Tag{},
+		&models.Snippet{},
+		&models.Template{},
+		&models.PageRevision{},
+		&models.EncryptionKey{},
+		&models.LoginThrottle{},
+		&models.OutboxEmail{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.OIDCLogin{},
 	)
 	if err != nil {
 		logger.Panic("failed to migrate database", zap.Error(err))
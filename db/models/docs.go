@@ -22,6 +22,21 @@ type Page struct {
 	LastEditorID    *uint      `json:"lastEditorId,omitempty"`
 	IsIntroPage     bool       `json:"isIntroPage,omitempty" gorm:"default:false"`
 	IsPage          bool       `json:"isPage" gorm:"default:true"`
+	Revision        uint       `json:"revision" gorm:"not null;default:1"`
+	Tags            []Tag      `gorm:"many2many:page_tags;constraint:OnDelete:CASCADE" json:"tags,omitempty"`
+	PageSEO         `gorm:"embedded"`
+}
+
+// PageSEO holds the per-page settings written to a page's front matter.
+// Empty values fall back to the documentation's.
+type PageSEO struct {
+	MetaTitle       string `json:"metaTitle,omitempty"`
+	MetaDescription string `json:"metaDescription,omitempty"`
+	MetaImage       string `json:"metaImage,omitempty"`
+	CanonicalURL    string `json:"canonicalURL,omitempty"`
+	NoIndex         bool   `json:"noIndex" gorm:"default:false"`
+	HideSidebar     bool   `json:"hideSidebar" gorm:"default:false"`
+	PageType        string `json:"pageType,omitempty"`
 }
 
 func (s Page) MarshalJSON() ([]byte, error) {
@@ -44,6 +59,7 @@ type PageGroup struct {
 	LastEditorID    *uint      `json:"lastEditorId,omitempty"`
 	Pages           []Page     `json:"pages,omitempty" gorm:"foreignKey:PageGroupID;constraint:OnDelete:CASCADE"`
 	IsPageGroup     bool       `json:"isPagGroup" gorm:"default:true"`
+	Revision        uint       `json:"revision" gorm:"not null;default:1"`
 }
 
 func (s PageGroup) MarshalJSON() ([]byte, error) {
@@ -67,6 +83,7 @@ type Documentation struct {
 	NavImage         string      `json:"navImage,omitempty"`
 	NavImageDark     string      `json:"navImageDark,omitempty"`
 	CustomCSS        string      `json:"customCSS,omitempty"`
+	RobotsTxt        string      `json:"robotsTxt,omitempty"`
 	FooterLabelLinks string      `json:"footerLabelLinks,omitempty"`
 	MoreLabelLinks   string      `json:"moreLabelLinks,omitempty"`
 	CopyrightText    string      `json:"copyrightText,omitempty"`
@@ -82,9 +99,17 @@ type Documentation struct {
 	GitRepo          string      `json:"gitRepo,omitempty"`
 	GitEmail         string      `json:"gitEmail,omitempty"`
 	GitUser          string      `json:"gitUser,omitempty"`
-	GitPassword      string      `json:"gitPassword,omitempty"`
+	GitPassword      string      `gorm:"serializer:secret" json:"-"`
 	GitBranch        string      `json:"gitBranch,omitempty"`
-	TokenSecret      string      `json:"tokenSecret,omitempty"`
+	TokenSecret      string      `gorm:"serializer:secret" json:"-"`
+	Locales          string      `json:"locales,omitempty"`
+	DefaultLocale    string      `json:"defaultLocale,omitempty"`
+	Variables        string      `json:"variables,omitempty"`
+	DefaultVersion   bool        `json:"defaultVersion" gorm:"default:false"` // pinned as the default version
+	Prerelease       bool        `json:"prerelease" gorm:"default:false"`
+	Hidden           bool        `json:"hidden" gorm:"default:false"`
+	Deprecated       bool        `json:"deprecated" gorm:"default:false"`
+	Revision         uint        `json:"revision" gorm:"not null;default:1"`
 }
 
 func (s Documentation) MarshalJSON() ([]byte, error) {
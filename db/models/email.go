@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// OutboxEmail is an email waiting to be sent, or the record of one that was.
+// The bodies hold single-use links, so they are encrypted and cleared once
+// the email is sent.
+type OutboxEmail struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	Recipient     string     `gorm:"not null" json:"recipient"`
+	Subject       string     `json:"subject"`
+	Text          string     `gorm:"serializer:secret" json:"-"`
+	HTML          string     `gorm:"serializer:secret" json:"-"`
+	Status        string     `gorm:"index;default:pending" json:"status"` // "pending", "sent" or "failed"
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"lastError,omitempty"`
+	NextAttemptAt time.Time  `gorm:"index" json:"nextAttemptAt"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+	CreatedAt     *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+}
+
+func (s OutboxEmail) MarshalJSON() ([]byte, error) {
+	type TmpStruct OutboxEmail
+	return jsonx.Marshal(TmpStruct(s))
+}
+
+// UserToken is a single-use link sent to a user, to reset a password or to
+// accept an invitation. Only the SHA-256 of the token is stored.
+type UserToken struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index" json:"userId"`
+	Kind      string     `gorm:"index" json:"kind"` // "password_reset" or "invitation"
+	TokenHash string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+}
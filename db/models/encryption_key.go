@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// EncryptionKey is a data key that encrypts credentials at rest. It is
+// stored wrapped by the master key, so rotating the master key only rewraps
+// these rows. The newest key encrypts new values.
+type EncryptionKey struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	WrappedKey string     `gorm:"not null" json:"-"`
+	CreatedAt  *time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// LinkReport is the outcome of the last link check of a documentation and
+// all of its versions. Broken holds the broken links as a JSON array and is
+// returned next to the report rather than in it.
+type LinkReport struct {
+	ID              uint       `gorm:"primarykey" json:"id,omitempty"`
+	DocumentationID uint       `gorm:"uniqueIndex" json:"documentationId,omitempty"`
+	Status          string     `json:"status,omitempty"` // "running", "completed" or "failed"
+	Error           string     `json:"error,omitempty"`
+	PagesChecked    int        `json:"pagesChecked"`
+	FilesChecked    int        `json:"filesChecked"`
+	LinksChecked    int        `json:"linksChecked"`
+	ExternalChecked int        `json:"externalChecked"`
+	BrokenCount     int        `json:"brokenCount"`
+	Broken          string     `json:"-"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	CheckedAt       *time.Time `json:"checkedAt,omitempty"`
+}
+
+func (s LinkReport) MarshalJSON() ([]byte, error) {
+	type TmpStruct LinkReport
+	return jsonx.Marshal(TmpStruct(s))
+}
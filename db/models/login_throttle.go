@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// LoginThrottle counts the failed logins of one account or one client
+// address within the current window, and how long logins stay locked.
+type LoginThrottle struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	Kind        string     `gorm:"uniqueIndex:idx_login_throttle" json:"kind"`       // "account" or "ip"
+	Identifier  string     `gorm:"uniqueIndex:idx_login_throttle" json:"identifier"` // username or address
+	Failures    int        `json:"failures"`
+	WindowStart time.Time  `json:"windowStart"`
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+	UpdatedAt   *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
+}
+
+func (s LoginThrottle) MarshalJSON() ([]byte, error) {
+	type TmpStruct LoginThrottle
+	return jsonx.Marshal(TmpStruct(s))
+}
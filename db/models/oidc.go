@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// OIDCLogin is an OpenID Connect or OAuth login waiting for its callback.
+// It keeps the nonce, for OIDC, and the PKCE verifier sent with the
+// authorization request; only the SHA-256 of the state is stored.
+type OIDCLogin struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	Provider  string     `json:"provider"`
+	StateHash string     `gorm:"uniqueIndex" json:"-"`
+	Nonce     string     `gorm:"serializer:secret" json:"-"`
+	Verifier  string     `gorm:"serializer:secret" json:"-"`
+	ExpiresAt time.Time  `gorm:"index" json:"expiresAt"`
+	CreatedAt *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+}
+
+func (s OIDCLogin) MarshalJSON() ([]byte, error) {
+	type TmpStruct OIDCLogin
+	return jsonx.Marshal(TmpStruct(s))
+}
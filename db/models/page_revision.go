@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// PageRevision is a page as it was saved at one of its revisions, kept so a
+// change can be told apart from what it was made on.
+type PageRevision struct {
+	ID        uint       `gorm:"primarykey" json:"id,omitempty"`
+	PageID    uint       `gorm:"uniqueIndex:idx_page_revision" json:"pageId,omitempty"`
+	Revision  uint       `gorm:"uniqueIndex:idx_page_revision" json:"revision"`
+	Title     string     `json:"title,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	AuthorID  *uint      `json:"authorId,omitempty"`
+	CreatedAt *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+}
+
+func (s PageRevision) MarshalJSON() ([]byte, error) {
+	type TmpStruct PageRevision
+	return jsonx.Marshal(TmpStruct(s))
+}
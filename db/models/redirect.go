@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// Redirect sends requests for a path that is no longer served to where its
+// content lives now. Paths are relative to the base URL of the documentation,
+// except for base URL redirects, which hold the old and new base URL.
+type Redirect struct {
+	ID              uint       `gorm:"primarykey" json:"id,omitempty"`
+	DocumentationID uint       `gorm:"uniqueIndex:idx_redirect_from" json:"documentationId,omitempty"`
+	FromPath        string     `gorm:"uniqueIndex:idx_redirect_from" json:"from,omitempty"`
+	ToPath          string     `json:"to,omitempty"`
+	Wildcard        bool       `json:"wildcard"`
+	Source          string     `json:"source,omitempty"` // "manual", "page", "page_group", "version" or "base_url"
+	CreatedAt       *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
+}
+
+func (s Redirect) MarshalJSON() ([]byte, error) {
+	type TmpStruct Redirect
+	return jsonx.Marshal(TmpStruct(s))
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// Snippet is reusable BlockNote content that pages embed with a snippet
+// block. A snippet without a documentation is global and can be used by
+// every documentation.
+type Snippet struct {
+	ID              uint       `gorm:"primarykey" json:"id,omitempty"`
+	DocumentationID *uint      `gorm:"index" json:"documentationId"`
+	Name            string     `json:"name,omitempty"`
+	Content         string     `json:"content,omitempty"`
+	AuthorID        uint       `json:"authorId,omitempty"`
+	LastEditorID    *uint      `json:"lastEditorId,omitempty"`
+	CreatedAt       *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
+}
+
+func (s Snippet) MarshalJSON() ([]byte, error) {
+	type TmpStruct Snippet
+	return jsonx.Marshal(TmpStruct(s))
+}
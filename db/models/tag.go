@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// Tag classifies pages across the page group tree, such as by product area,
+// audience or API surface. Tags belong to the root documentation and are
+// shared by all of its versions.
+type Tag struct {
+	ID              uint       `gorm:"primarykey" json:"id,omitempty"`
+	DocumentationID uint       `gorm:"uniqueIndex:idx_tag_slug" json:"documentationId,omitempty"`
+	Name            string     `json:"name,omitempty"`
+	Slug            string     `gorm:"uniqueIndex:idx_tag_slug" json:"slug,omitempty"`
+	Category        string     `json:"category,omitempty"`
+	Description     string     `json:"description,omitempty"`
+	CreatedAt       *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
+}
+
+func (s Tag) MarshalJSON() ([]byte, error) {
+	type TmpStruct Tag
+	return jsonx.Marshal(TmpStruct(s))
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// Template is what a new page or documentation starts from. The content of
+// a page template is BlockNote JSON; the content of a documentation
+// blueprint is the JSON of its settings and its tree of page groups and
+// pages. Built-in templates are created at startup and cannot be deleted.
+type Template struct {
+	ID          uint       `gorm:"primarykey" json:"id,omitempty"`
+	Kind        string     `gorm:"index" json:"kind,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Content     string     `json:"content,omitempty"`
+	Builtin     bool       `json:"builtin" gorm:"default:false"`
+	AuthorID    *uint      `json:"authorId,omitempty"`
+	CreatedAt   *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
+}
+
+func (s Template) MarshalJSON() ([]byte, error) {
+	type TmpStruct Template
+	return jsonx.Marshal(TmpStruct(s))
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// PageTranslation holds the title and content of a page in one of the
+// non-default locales of its documentation. The slug is shared with the page.
+type PageTranslation struct {
+	ID             uint       `gorm:"primarykey" json:"id,omitempty"`
+	PageID         uint       `gorm:"uniqueIndex:idx_page_locale" json:"pageId,omitempty"`
+	Locale         string     `gorm:"uniqueIndex:idx_page_locale" json:"locale,omitempty"`
+	Title          string     `json:"title,omitempty"`
+	Content        string     `json:"content,omitempty"`
+	Status         string     `gorm:"default:current" json:"status,omitempty"` // "current", "outdated" or "missing"
+	SourceRevision uint       `json:"sourceRevision"`
+	LastEditorID   *uint      `json:"lastEditorId,omitempty"`
+	CreatedAt      *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+	UpdatedAt      *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
+}
+
+func (s PageTranslation) MarshalJSON() ([]byte, error) {
+	type TmpStruct PageTranslation
+	return jsonx.Marshal(TmpStruct(s))
+}
+
+// PageGroupTranslation holds the label of a page group in one of the
+// non-default locales of its documentation. The folder name is shared.
+type PageGroupTranslation struct {
+	ID             uint       `gorm:"primarykey" json:"id,omitempty"`
+	PageGroupID    uint       `gorm:"uniqueIndex:idx_page_group_locale" json:"pageGroupId,omitempty"`
+	Locale         string     `gorm:"uniqueIndex:idx_page_group_locale" json:"locale,omitempty"`
+	Label          string     `json:"label,omitempty"`
+	Status         string     `gorm:"default:current" json:"status,omitempty"` // "current", "outdated" or "missing"
+	SourceRevision uint       `json:"sourceRevision"`
+	LastEditorID   *uint      `json:"lastEditorId,omitempty"`
+	CreatedAt      *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+	UpdatedAt      *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
+}
+
+func (s PageGroupTranslation) MarshalJSON() ([]byte, error) {
+	type TmpStruct PageGroupTranslation
+	return jsonx.Marshal(TmpStruct(s))
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	jsonx "github.com/clarketm/json"
+)
+
+// TrashItem keeps a deleted documentation, page group or page together with
+// everything beneath it, so that the whole subtree can be restored later.
+type TrashItem struct {
+	ID                  uint       `gorm:"primarykey" json:"id,omitempty"`
+	ItemType            string     `gorm:"index" json:"itemType,omitempty"` // "documentation", "page_group" or "page"
+	ItemID              uint       `json:"itemId,omitempty"`
+	Title               string     `json:"title,omitempty"`
+	DocumentationID     uint       `gorm:"index" json:"documentationId,omitempty"`
+	RootDocumentationID uint       `gorm:"index" json:"rootDocumentationId,omitempty"`
+	Snapshot            string     `json:"-"`
+	PageCount           int        `json:"pageCount"`
+	PageGroupCount      int        `json:"pageGroupCount"`
+	DeletedByID         *uint      `json:"deletedById,omitempty"`
+	DeletedAt           *time.Time `gorm:"autoCreateTime" json:"deletedAt,omitempty"`
+}
+
+func (s TrashItem) MarshalJSON() ([]byte, error) {
+	type TmpStruct TrashItem
+	return jsonx.Marshal(TmpStruct(s))
+}
@@ -20,20 +20,36 @@ func (s Token) MarshalJSON() ([]byte, error) {
 	return jsonx.Marshal(TmpStruct(s))
 }
 
+// User keeps its TOTP secret while enrolment is pending and sets
+// TOTPEnabled once the first code is confirmed. TOTPLastStep stops codes
+// from being used twice.
 type User struct {
-	ID          uint       `gorm:"primarykey" json:"id,omitempty"`
-	Admin       bool       `json:"admin,omitempty"`
-	Photo       string     `json:"photo,omitempty"`
-	Username    string     `gorm:"unique" json:"username,omitempty"`
-	Email       string     `gorm:"unique" json:"email,omitempty"`
-	Password    string     `json:"password,omitempty"`
-	Tokens      []Token    `json:"tokens,omitempty"`
-	Permissions string     `json:"permissions,omitempty"`
-	CreatedAt   *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
-	UpdatedAt   *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
+	ID                uint       `gorm:"primarykey" json:"id,omitempty"`
+	Admin             bool       `json:"admin,omitempty"`
+	Photo             string     `json:"photo,omitempty"`
+	Username          string     `gorm:"unique" json:"username,omitempty"`
+	Email             string     `gorm:"unique" json:"email,omitempty"`
+	Password          string     `json:"-"`
+	Tokens            []Token    `json:"-"`
+	Permissions       string     `json:"permissions,omitempty"`
+	TOTPSecret        string     `gorm:"serializer:secret" json:"-"`
+	TOTPEnabled       bool       `json:"totpEnabled,omitempty"`
+	TOTPLastStep      int64      `json:"-"`
+	TwoFactorRequired bool       `json:"twoFactorRequired,omitempty"`
+	CreatedAt         *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+	UpdatedAt         *time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
 }
 
 func (s User) MarshalJSON() ([]byte, error) {
 	type TmpStruct User
 	return jsonx.Marshal(TmpStruct(s))
 }
+
+// RecoveryCode stands in for a TOTP code once. Only its SHA-256 is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index" json:"userId"`
+	CodeHash  string     `gorm:"index" json:"-"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt *time.Time `gorm:"autoCreateTime" json:"createdAt,omitempty"`
+}
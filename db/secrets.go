@@ -0,0 +1,431 @@
+package db
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Credentials are encrypted at rest with envelope encryption: values are
+// sealed with AES-256-GCM under a data key from the encryption_keys table,
+// and the data keys are sealed under the master key from the secret file or
+// KAL_MASTER_KEY. An encrypted value reads "enc:v1:<key id>:<base64>".
+const secretPrefix = "enc:v1:"
+
+// encryptedColumns are stored through the "secret" serializer and are
+// encrypted in place on startup when they still hold plaintext.
+var encryptedColumns = []struct{ table, column string }{
+	{"documentations", "git_password"},
+	{"documentations", "token_secret"},
+	{"users", "totp_secret"},
+}
+
+type keyring struct {
+	mu     sync.RWMutex
+	keys   map[uint][]byte
+	active uint
+}
+
+var secretKeys = &keyring{}
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+// SecretSerializer encrypts a string field on write and decrypts it on
+// read. Plaintext left from before encryption reads as it is.
+type SecretSerializer struct{}
+
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	}
+
+	plain, err := DecryptSecret(value, field.DBName)
+	if err != nil {
+		return err
+	}
+
+	field.ReflectValueOf(ctx, dst).SetString(plain)
+	return nil
+}
+
+func (SecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	return EncryptSecret(value, field.DBName)
+}
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// EncryptSecret seals a value with the newest data key. The context, such
+// as the column name, must be given again to decrypt it.
+func EncryptSecret(plain string, context string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+
+	secretKeys.mu.RLock()
+	id, key := secretKeys.active, secretKeys.keys[secretKeys.active]
+	secretKeys.mu.RUnlock()
+
+	if key == nil {
+		return "", fmt.Errorf("secrets_not_configured")
+	}
+
+	sealed, err := seal(key, []byte(plain), context)
+	if err != nil {
+		return "", err
+	}
+
+	return secretPrefix + strconv.FormatUint(uint64(id), 10) + ":" + sealed, nil
+}
+
+func DecryptSecret(value string, context string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+
+	idPart, sealed, found := strings.Cut(strings.TrimPrefix(value, secretPrefix), ":")
+	id, err := strconv.ParseUint(idPart, 10, 32)
+	if !found || err != nil {
+		return "", fmt.Errorf("invalid_encrypted_secret")
+	}
+
+	secretKeys.mu.RLock()
+	key := secretKeys.keys[uint(id)]
+	secretKeys.mu.RUnlock()
+
+	if key == nil {
+		return "", fmt.Errorf("encryption_key_not_found")
+	}
+
+	plain, err := open(key, sealed, context)
+	if err != nil {
+		return "", fmt.Errorf("failed_to_decrypt_secret")
+	}
+
+	return string(plain), nil
+}
+
+func seal(key []byte, plain []byte, context string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, []byte(context))), nil
+}
+
+func open(key []byte, sealed string, context string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid_encrypted_secret")
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(context))
+}
+
+func newKey() ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// NewMasterKey returns a random master key in the form the secret file
+// holds it.
+func NewMasterKey() (string, error) {
+	key, err := newKey()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func decodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid_master_key")
+	}
+	return key, nil
+}
+
+const wrappedKeyContext = "encryption_key"
+
+// SetupSecrets loads the data keys, encrypts credentials still stored as
+// plaintext and decrypts the encrypted values of the config. A master key is
+// generated into the secret file on first start.
+func SetupSecrets(db *gorm.DB, cfg *config.Config) error {
+	if cfg.Secret.MasterKey == "" {
+		masterKey, err := NewMasterKey()
+		if err != nil {
+			return err
+		}
+
+		cfg.Secret.MasterKey = masterKey
+		if err := cfg.SaveSecret(); err != nil {
+			return fmt.Errorf("failed_to_save_master_key")
+		}
+		logger.Info("Generated a master key for credentials at rest")
+	}
+
+	if err := loadKeys(db, cfg); err != nil {
+		return err
+	}
+
+	if err := encryptPlaintextColumns(db); err != nil {
+		return err
+	}
+
+	return decryptConfigSecrets(cfg)
+}
+
+func loadKeys(db *gorm.DB, cfg *config.Config) error {
+	master, err := decodeMasterKey(cfg.Secret.MasterKey)
+	if err != nil {
+		return err
+	}
+
+	var rows []models.EncryptionKey
+	if err := db.Order("id").Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed_to_get_encryption_keys")
+	}
+
+	if len(rows) == 0 {
+		key, err := newKey()
+		if err != nil {
+			return err
+		}
+
+		wrapped, err := seal(master, key, wrappedKeyContext)
+		if err != nil {
+			return err
+		}
+
+		row := models.EncryptionKey{WrappedKey: wrapped}
+		if err := db.Create(&row).Error; err != nil {
+			return fmt.Errorf("failed_to_create_encryption_key")
+		}
+		rows = append(rows, row)
+	}
+
+	keys := make(map[uint][]byte, len(rows))
+	for _, row := range rows {
+		key, err := open(master, row.WrappedKey, wrappedKeyContext)
+		if err != nil {
+			// a rotation that was interrupted before the keys were rewrapped
+			if cfg.Secret.PreviousMasterKey != "" {
+				return finishRotation(db, cfg)
+			}
+			return fmt.Errorf("invalid_master_key")
+		}
+		keys[row.ID] = key
+	}
+
+	secretKeys.mu.Lock()
+	secretKeys.keys = keys
+	secretKeys.active = rows[len(rows)-1].ID
+	secretKeys.mu.Unlock()
+
+	return nil
+}
+
+func finishRotation(db *gorm.DB, cfg *config.Config) error {
+	previous, err := decodeMasterKey(cfg.Secret.PreviousMasterKey)
+	if err != nil {
+		return err
+	}
+
+	master, err := decodeMasterKey(cfg.Secret.MasterKey)
+	if err != nil {
+		return err
+	}
+
+	if err := rewrapKeys(db, previous, master); err != nil {
+		return err
+	}
+
+	cfg.Secret.PreviousMasterKey = ""
+	if err := cfg.SaveSecret(); err != nil {
+		return fmt.Errorf("failed_to_save_master_key")
+	}
+
+	logger.Info("Finished an interrupted master key rotation")
+	return loadKeys(db, cfg)
+}
+
+func rewrapKeys(db *gorm.DB, from []byte, to []byte) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []models.EncryptionKey
+		if err := tx.Find(&rows).Error; err != nil {
+			return fmt.Errorf("failed_to_get_encryption_keys")
+		}
+
+		for _, row := range rows {
+			key, err := open(from, row.WrappedKey, wrappedKeyContext)
+			if err != nil {
+				return fmt.Errorf("invalid_master_key")
+			}
+
+			wrapped, err := seal(to, key, wrappedKeyContext)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Model(&row).Update("wrapped_key", wrapped).Error; err != nil {
+				return fmt.Errorf("failed_to_update_encryption_key")
+			}
+		}
+
+		return nil
+	})
+}
+
+// RotateMasterKey rewraps the data keys under a new master key, generated
+// when none is given, and returns it. The secret file is updated before and
+// after the rewrap, so an interrupted rotation finishes on the next start.
+// A master key from the environment has to be replaced by the caller.
+func RotateMasterKey(db *gorm.DB, cfg *config.Config, newMasterKey string) (string, error) {
+	if newMasterKey == "" {
+		var err error
+		if newMasterKey, err = NewMasterKey(); err != nil {
+			return "", err
+		}
+	}
+
+	newMaster, err := decodeMasterKey(newMasterKey)
+	if err != nil {
+		return "", err
+	}
+
+	oldMaster, err := decodeMasterKey(cfg.Secret.MasterKey)
+	if err != nil {
+		return "", err
+	}
+
+	if !cfg.Secret.MasterKeyFromEnv {
+		cfg.Secret.PreviousMasterKey = cfg.Secret.MasterKey
+		cfg.Secret.MasterKey = newMasterKey
+		if err := cfg.SaveSecret(); err != nil {
+			return "", fmt.Errorf("failed_to_save_master_key")
+		}
+	}
+
+	if err := rewrapKeys(db, oldMaster, newMaster); err != nil {
+		return "", err
+	}
+
+	cfg.Secret.MasterKey = newMasterKey
+	cfg.Secret.PreviousMasterKey = ""
+	if !cfg.Secret.MasterKeyFromEnv {
+		if err := cfg.SaveSecret(); err != nil {
+			return "", fmt.Errorf("failed_to_save_master_key")
+		}
+	}
+
+	return newMasterKey, nil
+}
+
+func encryptPlaintextColumns(db *gorm.DB) error {
+	for _, c := range encryptedColumns {
+		var rows []struct {
+			ID    uint
+			Value string
+		}
+
+		if err := db.Table(c.table).Select("id, "+c.column+" AS value").
+			Where(c.column+" <> '' AND "+c.column+" NOT LIKE ?", secretPrefix+"%").
+			Scan(&rows).Error; err != nil {
+			return fmt.Errorf("failed_to_read_plaintext_secrets")
+		}
+
+		for _, row := range rows {
+			encrypted, err := EncryptSecret(row.Value, c.column)
+			if err != nil {
+				return err
+			}
+
+			if err := db.Table(c.table).Where("id = ?", row.ID).UpdateColumn(c.column, encrypted).Error; err != nil {
+				return fmt.Errorf("failed_to_encrypt_plaintext_secrets")
+			}
+		}
+
+		if len(rows) > 0 {
+			logger.Info("Encrypted plaintext credentials", zap.String("table", c.table), zap.String("column", c.column), zap.Int("rows", len(rows)))
+		}
+	}
+
+	return nil
+}
+
+// ConfigSecretContext is the context config values are encrypted with.
+const ConfigSecretContext = "config"
+
+// decryptConfigSecrets replaces encrypted config values, made with the
+// -encrypt-secret flag, by their plaintext.
+func decryptConfigSecrets(cfg *config.Config) error {
+	values := []*string{
+		&cfg.SessionSecret,
+		&cfg.S3.SecretAccessKey,
+		&cfg.GithubOAuth.ClientSecret,
+		&cfg.MicrosoftOAuth.ClientSecret,
+		&cfg.GoogleOAuth.ClientSecret,
+		&cfg.Email.Password,
+	}
+	for i := range cfg.OIDCProviders {
+		values = append(values, &cfg.OIDCProviders[i].ClientSecret)
+	}
+
+	for _, value := range values {
+		plain, err := DecryptSecret(*value, ConfigSecretContext)
+		if err != nil {
+			return fmt.Errorf("failed_to_decrypt_config_secret")
+		}
+		*value = plain
+	}
+
+	return nil
+}
@@ -16,6 +16,11 @@ import (
 //go:embed rspress
 var RspressFS embed.FS
 
+// EmailsFS holds the built-in email templates.
+//
+//go:embed emails
+var EmailsFS embed.FS
+
 func ReadEmbeddedFile(path string) ([]byte, error) {
 	content, err := RspressFS.ReadFile("rspress/" + path)
 	if err != nil {
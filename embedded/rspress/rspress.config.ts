@@ -14,6 +14,7 @@ export default defineConfig({
     dark: '__LOGO_DARK__',
   },
   __MULTI_VERSIONS__,
+  __LOCALES__
   themeConfig: {
     socialLinks: __SOCIAL_LINKS__,
     footer: { message:`__FOOTER_CONTENT__` },
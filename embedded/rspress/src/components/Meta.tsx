@@ -5,7 +5,9 @@ import { usePageData } from 'rspress/runtime';
 interface MetaData {
   title: string;
   description: string;
-  image: string;
+  image?: string;
+  canonicalURL?: string;
+  noIndex?: boolean;
 }
 
 interface MetaProps {
@@ -15,7 +17,8 @@ interface MetaProps {
 export const Meta: React.FC<MetaProps> = ({ rawJson }) => {
   const pageData = usePageData();
 
-  let title: string, description: string, image: string;
+  let title: string, description: string, image: string | undefined;
+  let canonicalURL: string | undefined, noIndex = false;
 
   try {
     const parsedJson: MetaData = JSON.parse(rawJson);
@@ -28,6 +31,8 @@ export const Meta: React.FC<MetaProps> = ({ rawJson }) => {
     
     description = parsedJson.description;
     image = parsedJson.image;
+    canonicalURL = parsedJson.canonicalURL;
+    noIndex = parsedJson.noIndex ?? false;
   } catch (error) {
     title = '';
     description = '';
@@ -40,7 +45,10 @@ export const Meta: React.FC<MetaProps> = ({ rawJson }) => {
 
       <meta property="og:title" content={title} />
       <meta property="og:description" content={description} />
-      <meta property="og:image" content={image} />
+      {image && <meta property="og:image" content={image} />}
+
+      {canonicalURL && <link rel="canonical" href={canonicalURL} />}
+      {noIndex && <meta name="robots" content="noindex" />}
     </Helmet>
   );
 }
@@ -4,9 +4,10 @@ import { useDark, useLocation } from 'rspress/runtime';
 
 interface OldVersionProps {
     newVersion: string;
+    deprecated?: boolean;
 }
 
-export const OldVersion: React.FC<OldVersionProps> = ({ newVersion }) => {
+export const OldVersion: React.FC<OldVersionProps> = ({ newVersion, deprecated }) => {
   const isDarkMode = useDark();
 
   const containerStyles = {
@@ -46,9 +47,9 @@ export const OldVersion: React.FC<OldVersionProps> = ({ newVersion }) => {
     <div style={containerStyles}>
       <div style={headingStyles}>
         <AlertTriangleIcon style={iconStyles} />
-        <span>WARNING</span>
+        <span>{deprecated ? 'DEPRECATED' : 'WARNING'}</span>
       </div>
-      <p style={textStyles}>This is <b>not</b> the latest version of this documentation, for the one that is upto date, please see the <a className='font-bold' style={{textDecoration:"underline"}} href={latestPath}>latest version</a> ({newVersion})</p>
+      <p style={textStyles}>{deprecated && <>This version is <b>deprecated</b> and no longer maintained. </>}This is <b>not</b> the latest version of this documentation, for the one that is upto date, please see the <a className='font-bold' style={{textDecoration:"underline"}} href={latestPath}>latest version</a> ({newVersion})</p>
     </div>
   );
 };
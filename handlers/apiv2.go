@@ -0,0 +1,1047 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/services"
+	"github.com/gorilla/mux"
+)
+
+// Problem is an RFC 7807 error body. Code is the error the v1 API would
+// return as its message.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+func problemStatus(code string) int {
+	switch {
+	case code == "invalid_token":
+		return http.StatusUnauthorized
+	case code == "user_unauthorized_route":
+		return http.StatusForbidden
+	case strings.HasSuffix(code, "_not_found"):
+		return http.StatusNotFound
+	case code == "revision_conflict", strings.HasSuffix(code, "_already_exists"), strings.HasPrefix(code, "last_"),
+		strings.HasSuffix(code, "_cannot_be_deleted"), strings.HasSuffix(code, "_cannot_be_hidden"),
+		strings.HasSuffix(code, "_cannot_be_default"), strings.HasSuffix(code, "_cannot_be_moved"):
+		return http.StatusConflict
+	case strings.HasPrefix(code, "invalid_"), strings.HasSuffix(code, "_cycle"), strings.HasSuffix(code, "_cannot_be_its_own_parent"):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// SendProblem writes an RFC 7807 error. A status of 0 is derived from the
+// code.
+func SendProblem(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	if status == 0 {
+		status = problemStatus(code)
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     "urn:kalmia:problem:" + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	})
+}
+
+type V2Documentation struct {
+	ID               uint       `json:"id"`
+	Name             string     `json:"name"`
+	Description      string     `json:"description"`
+	Version          string     `json:"version"`
+	URL              string     `json:"url"`
+	BaseURL          string     `json:"baseURL"`
+	OrganizationName string     `json:"organizationName"`
+	ProjectName      string     `json:"projectName"`
+	RequireAuth      bool       `json:"requireAuth"`
+	DefaultLocale    string     `json:"defaultLocale"`
+	GitPasswordSet   bool       `json:"gitPasswordSet"`
+	TokenSecretSet   bool       `json:"tokenSecretSet"`
+	CreatedAt        *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt        *time.Time `json:"updatedAt,omitempty"`
+}
+
+type V2Page struct {
+	ID              uint           `json:"id"`
+	DocumentationID uint           `json:"documentationId"`
+	PageGroupID     *uint          `json:"pageGroupId"`
+	Title           string         `json:"title"`
+	Slug            string         `json:"slug"`
+	Content         string         `json:"content,omitempty"` // not listed
+	Order           *uint          `json:"order"`
+	IsIntroPage     bool           `json:"isIntroPage"`
+	Revision        uint           `json:"revision"`
+	SEO             models.PageSEO `json:"seo"`
+	CreatedAt       *time.Time     `json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time     `json:"updatedAt,omitempty"`
+}
+
+type V2PageGroup struct {
+	ID              uint       `json:"id"`
+	DocumentationID uint       `json:"documentationId"`
+	ParentID        *uint      `json:"parentId"`
+	Name            string     `json:"name"`
+	Label           string     `json:"label"`
+	Order           *uint      `json:"order"`
+	Revision        uint       `json:"revision"`
+	CreatedAt       *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time `json:"updatedAt,omitempty"`
+}
+
+// V2PageInput creates (POST), replaces (PUT) or updates (PATCH) a page.
+// Title, slug and content are required unless patching. A pageGroupId of 0
+// moves the page out of its page group.
+type V2PageInput struct {
+	Title       *string         `json:"title"`
+	Slug        *string         `json:"slug"`
+	Content     *string         `json:"content"`
+	PageGroupID *uint           `json:"pageGroupId"`
+	Order       *uint           `json:"order"`
+	SEO         *models.PageSEO `json:"seo"`
+	Revision    uint            `json:"revision"` // or an If-Match header; 0 skips the check
+}
+
+// V2PageGroupInput creates, replaces or updates a page group. A parentId of
+// 0 moves it to the top level.
+type V2PageGroupInput struct {
+	Name     *string `json:"name"`
+	Label    *string `json:"label"`
+	ParentID *uint   `json:"parentId"`
+	Order    *uint   `json:"order"`
+	Revision uint    `json:"revision"`
+}
+
+type V2VersionInput struct {
+	Version    *string `json:"version"`
+	From       string  `json:"from"` // version to create a new one from
+	Prerelease *bool   `json:"prerelease"`
+	Hidden     *bool   `json:"hidden"`
+	Deprecated *bool   `json:"deprecated"`
+	Pinned     *bool   `json:"pinned"` // pinned as the default
+}
+
+func v2Documentation(doc models.Documentation) V2Documentation {
+	return V2Documentation{
+		ID:               doc.ID,
+		Name:             doc.Name,
+		Description:      doc.Description,
+		Version:          doc.Version,
+		URL:              doc.URL,
+		BaseURL:          doc.BaseURL,
+		OrganizationName: doc.OrganizationName,
+		ProjectName:      doc.ProjectName,
+		RequireAuth:      doc.RequireAuth,
+		DefaultLocale:    doc.DefaultLocale,
+		GitPasswordSet:   doc.GitPassword != "",
+		TokenSecretSet:   doc.TokenSecret != "",
+		CreatedAt:        doc.CreatedAt,
+		UpdatedAt:        doc.UpdatedAt,
+	}
+}
+
+func v2Page(page models.Page) V2Page {
+	return V2Page{
+		ID:              page.ID,
+		DocumentationID: page.DocumentationID,
+		PageGroupID:     page.PageGroupID,
+		Title:           page.Title,
+		Slug:            page.Slug,
+		Content:         page.Content,
+		Order:           page.Order,
+		IsIntroPage:     page.IsIntroPage,
+		Revision:        page.Revision,
+		SEO:             page.PageSEO,
+		CreatedAt:       page.CreatedAt,
+		UpdatedAt:       page.UpdatedAt,
+	}
+}
+
+func v2PageGroup(group models.PageGroup) V2PageGroup {
+	return V2PageGroup{
+		ID:              group.ID,
+		DocumentationID: group.DocumentationID,
+		ParentID:        group.ParentID,
+		Name:            group.Name,
+		Label:           group.Label,
+		Order:           group.Order,
+		Revision:        group.Revision,
+		CreatedAt:       group.CreatedAt,
+		UpdatedAt:       group.UpdatedAt,
+	}
+}
+
+// sparse keeps only the requested fields of an item, from ?fields=a,b.
+func sparse(r *http.Request, item interface{}) interface{} {
+	fields := r.URL.Query().Get("fields")
+	if fields == "" {
+		return item
+	}
+
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return item
+	}
+
+	var all map[string]interface{}
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return item
+	}
+
+	kept := make(map[string]interface{})
+	for _, field := range strings.Split(fields, ",") {
+		if value, ok := all[strings.TrimSpace(field)]; ok {
+			kept[strings.TrimSpace(field)] = value
+		}
+	}
+
+	return kept
+}
+
+func sendV2(w http.ResponseWriter, r *http.Request, status int, item interface{}) {
+	SendJSONResponse(status, w, sparse(r, item))
+}
+
+func encodeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+func listOptions(r *http.Request) (services.ListOptions, error) {
+	var opts services.ListOptions
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("invalid_limit")
+		}
+		opts.Limit = n
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return opts, fmt.Errorf("invalid_cursor")
+		}
+		after, err := strconv.ParseUint(string(raw), 10, 32)
+		if err != nil {
+			return opts, fmt.Errorf("invalid_cursor")
+		}
+		opts.After = uint(after)
+	}
+
+	return opts, nil
+}
+
+// sendV2List writes a page of a list; nextCursor is set when there are more.
+func sendV2List[T any](w http.ResponseWriter, r *http.Request, items []T, ids []uint, more bool) {
+	data := make([]interface{}, len(items))
+	for i, item := range items {
+		data[i] = sparse(r, item)
+	}
+
+	body := map[string]interface{}{"data": data}
+	if more && len(ids) > 0 {
+		body["nextCursor"] = encodeCursor(ids[len(ids)-1])
+	}
+
+	SendJSONResponse(http.StatusOK, w, body)
+}
+
+func pathUint(r *http.Request, name string) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)[name], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid_id")
+	}
+	return uint(id), nil
+}
+
+func queryUint(r *http.Request, name string) (*uint, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid_query_parameter")
+	}
+
+	result := uint(id)
+	return &result, nil
+}
+
+func v2User(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	token, err := GetTokenFromHeader(r)
+	if err == nil {
+		if user, err := srv.AuthService.GetUserFromToken(token); err == nil {
+			return user, true
+		}
+	}
+
+	SendProblem(w, r, http.StatusUnauthorized, "invalid_token", "")
+	return models.User{}, false
+}
+
+func decodeV2[T any](w http.ResponseWriter, r *http.Request) (T, bool) {
+	var input T
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		SendProblem(w, r, http.StatusBadRequest, "invalid_request_format", err.Error())
+		return input, false
+	}
+	return input, true
+}
+
+// baseRevision is the revision an update was made on, from the body or an
+// If-Match header holding the ETag the item was read with.
+func baseRevision(r *http.Request, bodyRevision uint, current uint) (uint, error) {
+	if bodyRevision != 0 {
+		return bodyRevision, nil
+	}
+
+	if match := strings.Trim(r.Header.Get("If-Match"), `W/"`); match != "" {
+		revision, err := strconv.ParseUint(match, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid_if_match")
+		}
+		return uint(revision), nil
+	}
+
+	return current, nil
+}
+
+func setETag(w http.ResponseWriter, revision uint) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, revision))
+}
+
+// v2Version resolves the {id} and {version} of a path to the version's
+// documentation.
+func v2Version(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) (models.Documentation, bool) {
+	id, err := pathUint(r, "id")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return models.Documentation{}, false
+	}
+
+	doc, err := srv.DocService.ResolveVersion(id, mux.Vars(r)["version"])
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return models.Documentation{}, false
+	}
+
+	return doc, true
+}
+
+// v2SlugFree checks that no other page of the version has the slug.
+func v2SlugFree(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request, docId uint, slug string, pageId uint) bool {
+	existing, _, err := srv.DocService.ListPages(docId, services.PageFilter{Slug: slug}, services.ListOptions{Limit: 1})
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return false
+	}
+
+	if len(existing) > 0 && existing[0].ID != pageId {
+		SendProblem(w, r, 0, "page_slug_already_exists", "")
+		return false
+	}
+
+	return true
+}
+
+func V2ListDocumentations(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(r)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	docs, more, err := srv.DocService.ListDocumentations(r.URL.Query().Get("name"), opts)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	items, ids := make([]V2Documentation, len(docs)), make([]uint, len(docs))
+	for i, doc := range docs {
+		items[i], ids[i] = v2Documentation(doc), doc.ID
+	}
+
+	sendV2List(w, r, items, ids, more)
+}
+
+func V2GetDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	id, err := pathUint(r, "id")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	doc, err := srv.DocService.GetDocumentation(id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	sendV2(w, r, http.StatusOK, v2Documentation(doc))
+}
+
+func V2DeleteDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	id, err := pathUint(r, "id")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	if err := srv.DocService.DeleteDocumentation(user, id); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func V2ListVersions(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	id, err := pathUint(r, "id")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	versions, err := srv.DocService.GetVersions(id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	ids := make([]uint, len(versions))
+	for i, version := range versions {
+		ids[i] = version.ID
+	}
+
+	sendV2List(w, r, versions, ids, false)
+}
+
+func findVersionDetails(srv *services.ServiceRegistry, docId uint, version string) (services.VersionDetails, error) {
+	versions, err := srv.DocService.GetVersions(docId)
+	if err != nil {
+		return services.VersionDetails{}, err
+	}
+
+	for _, details := range versions {
+		if details.Version == version {
+			return details, nil
+		}
+	}
+
+	return services.VersionDetails{}, fmt.Errorf("version_not_found")
+}
+
+func V2GetVersion(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	details, err := findVersionDetails(srv, doc.ID, doc.Version)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	sendV2(w, r, http.StatusOK, details)
+}
+
+func V2CreateVersion(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	id, err := pathUint(r, "id")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	input, ok := decodeV2[V2VersionInput](w, r)
+	if !ok {
+		return
+	}
+
+	if input.Version == nil || strings.TrimSpace(*input.Version) == "" || input.From == "" {
+		SendProblem(w, r, http.StatusBadRequest, "invalid_request_data", "version and from are required")
+		return
+	}
+
+	from, err := srv.DocService.ResolveVersion(id, input.From)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	if _, err := srv.DocService.ResolveVersion(id, *input.Version); err == nil {
+		SendProblem(w, r, 0, "version_already_exists", "")
+		return
+	}
+
+	if err := srv.DocService.CreateDocumentationVersion(from.ID, *input.Version); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	details, err := findVersionDetails(srv, id, *input.Version)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/kal-api/v2/documentations/%d/versions/%s", id, details.Version))
+	sendV2(w, r, http.StatusCreated, details)
+}
+
+func V2UpdateVersion(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	input, ok := decodeV2[V2VersionInput](w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	if input.Prerelease != nil || input.Hidden != nil || input.Deprecated != nil {
+		if err := srv.DocService.SetVersionStatus(user, doc.ID, input.Prerelease, input.Hidden, input.Deprecated); err != nil {
+			SendProblem(w, r, 0, err.Error(), "")
+			return
+		}
+	}
+
+	if input.Pinned != nil {
+		if err := srv.DocService.SetDefaultVersion(user, doc.ID, *input.Pinned); err != nil {
+			SendProblem(w, r, 0, err.Error(), "")
+			return
+		}
+	}
+
+	version := doc.Version
+	if input.Version != nil && *input.Version != doc.Version {
+		if err := srv.DocService.RenameVersion(user, doc.ID, *input.Version); err != nil {
+			SendProblem(w, r, 0, err.Error(), "")
+			return
+		}
+		version = strings.TrimSpace(*input.Version)
+	}
+
+	details, err := findVersionDetails(srv, doc.ID, version)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	sendV2(w, r, http.StatusOK, details)
+}
+
+func V2DeleteVersion(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	if err := srv.DocService.DeleteVersion(user, doc.ID); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func V2ListPages(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	opts, err := listOptions(r)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	filter := services.PageFilter{Slug: r.URL.Query().Get("slug"), Query: r.URL.Query().Get("q")}
+	if filter.PageGroupID, err = queryUint(r, "pageGroupId"); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+	tagId, err := queryUint(r, "tagId")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+	if tagId != nil {
+		filter.TagID = *tagId
+	}
+
+	pages, more, err := srv.DocService.ListPages(doc.ID, filter, opts)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	items, ids := make([]V2Page, len(pages)), make([]uint, len(pages))
+	for i, page := range pages {
+		items[i], ids[i] = v2Page(page), page.ID
+	}
+
+	sendV2List(w, r, items, ids, more)
+}
+
+func V2GetPage(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	id, err := pathUint(r, "pageId")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	page, err := srv.DocService.GetPageOfVersion(doc.ID, id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	setETag(w, page.Revision)
+	sendV2(w, r, http.StatusOK, v2Page(page))
+}
+
+func V2CreatePage(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	input, ok := decodeV2[V2PageInput](w, r)
+	if !ok {
+		return
+	}
+
+	if input.Title == nil || input.Slug == nil || input.Content == nil || *input.Title == "" || *input.Slug == "" {
+		SendProblem(w, r, http.StatusBadRequest, "invalid_request_data", "title, slug and content are required")
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	page := models.Page{
+		Title:           *input.Title,
+		Slug:            *input.Slug,
+		Content:         *input.Content,
+		DocumentationID: doc.ID,
+		Order:           input.Order,
+		AuthorID:        user.ID,
+		Editors:         []models.User{user},
+		LastEditorID:    &user.ID,
+	}
+
+	if input.PageGroupID != nil && *input.PageGroupID != 0 {
+		if _, err := srv.DocService.GetPageGroupOfVersion(doc.ID, *input.PageGroupID); err != nil {
+			SendProblem(w, r, http.StatusBadRequest, "invalid_page_group_id", "")
+			return
+		}
+		page.PageGroupID = input.PageGroupID
+	}
+
+	if input.SEO != nil {
+		page.PageSEO = *input.SEO
+	}
+
+	if !v2SlugFree(srv, w, r, doc.ID, page.Slug, 0) {
+		return
+	}
+
+	if err := srv.DocService.CreatePage(&page); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/kal-api/v2/documentations/%s/versions/%s/pages/%d", mux.Vars(r)["id"], doc.Version, page.ID))
+	setETag(w, page.Revision)
+	sendV2(w, r, http.StatusCreated, v2Page(page))
+}
+
+// V2UpdatePage replaces a page (PUT) or changes the fields given (PATCH).
+func V2UpdatePage(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	id, err := pathUint(r, "pageId")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	input, ok := decodeV2[V2PageInput](w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodPut && (input.Title == nil || input.Slug == nil || input.Content == nil) {
+		SendProblem(w, r, http.StatusBadRequest, "invalid_request_data", "title, slug and content are required")
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	page, err := srv.DocService.GetPageOfVersion(doc.ID, id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	revision, err := baseRevision(r, input.Revision, page.Revision)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	title, slug, content := page.Title, page.Slug, ""
+	if input.Title != nil {
+		title = *input.Title
+	}
+	if input.Slug != nil {
+		slug = *input.Slug
+	}
+	if input.Content != nil {
+		content = *input.Content
+	}
+
+	if slug != page.Slug && !v2SlugFree(srv, w, r, doc.ID, slug, id) {
+		return
+	}
+
+	var groupId *uint
+	if input.PageGroupID != nil && *input.PageGroupID != 0 {
+		if _, err := srv.DocService.GetPageGroupOfVersion(doc.ID, *input.PageGroupID); err != nil {
+			SendProblem(w, r, http.StatusBadRequest, "invalid_page_group_id", "")
+			return
+		}
+		groupId = input.PageGroupID
+	}
+
+	if err := srv.DocService.EditPage(user, id, revision, title, slug, content, input.Order, groupId, input.SEO); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	if input.PageGroupID != nil && *input.PageGroupID == 0 && page.PageGroupID != nil {
+		order := page.Order
+		if input.Order != nil {
+			order = input.Order
+		}
+		if err := srv.DocService.ReorderPage(id, nil, order); err != nil {
+			SendProblem(w, r, 0, err.Error(), "")
+			return
+		}
+	}
+
+	page, err = srv.DocService.GetPageOfVersion(doc.ID, id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	setETag(w, page.Revision)
+	sendV2(w, r, http.StatusOK, v2Page(page))
+}
+
+func V2DeletePage(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	id, err := pathUint(r, "pageId")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := srv.DocService.GetPageOfVersion(doc.ID, id); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	if err := srv.DocService.DeletePage(user, id); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func V2ListPageGroups(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	opts, err := listOptions(r)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	parentId, err := queryUint(r, "parentId")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	groups, more, err := srv.DocService.ListPageGroups(doc.ID, parentId, opts)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	items, ids := make([]V2PageGroup, len(groups)), make([]uint, len(groups))
+	for i, group := range groups {
+		items[i], ids[i] = v2PageGroup(group), group.ID
+	}
+
+	sendV2List(w, r, items, ids, more)
+}
+
+func V2GetPageGroup(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	id, err := pathUint(r, "groupId")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	group, err := srv.DocService.GetPageGroupOfVersion(doc.ID, id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	setETag(w, group.Revision)
+	sendV2(w, r, http.StatusOK, v2PageGroup(group))
+}
+
+func V2CreatePageGroup(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	input, ok := decodeV2[V2PageGroupInput](w, r)
+	if !ok {
+		return
+	}
+
+	if input.Name == nil || *input.Name == "" {
+		SendProblem(w, r, http.StatusBadRequest, "invalid_request_data", "name is required")
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	group := models.PageGroup{
+		Name:            *input.Name,
+		DocumentationID: doc.ID,
+		Order:           input.Order,
+		AuthorID:        user.ID,
+		Editors:         []models.User{user},
+		LastEditorID:    &user.ID,
+	}
+
+	if input.Label != nil {
+		group.Label = *input.Label
+	}
+
+	if input.ParentID != nil && *input.ParentID != 0 {
+		if _, err := srv.DocService.GetPageGroupOfVersion(doc.ID, *input.ParentID); err != nil {
+			SendProblem(w, r, http.StatusBadRequest, "invalid_parent_page_group_id", "")
+			return
+		}
+		group.ParentID = input.ParentID
+	}
+
+	id, err := srv.DocService.CreatePageGroup(&group)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	created, err := srv.DocService.GetPageGroupOfVersion(doc.ID, id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/kal-api/v2/documentations/%s/versions/%s/page-groups/%d", mux.Vars(r)["id"], doc.Version, id))
+	setETag(w, created.Revision)
+	sendV2(w, r, http.StatusCreated, v2PageGroup(created))
+}
+
+// V2UpdatePageGroup replaces a page group (PUT) or changes the fields given
+// (PATCH).
+func V2UpdatePageGroup(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	id, err := pathUint(r, "groupId")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	input, ok := decodeV2[V2PageGroupInput](w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodPut && input.Name == nil {
+		SendProblem(w, r, http.StatusBadRequest, "invalid_request_data", "name is required")
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	group, err := srv.DocService.GetPageGroupOfVersion(doc.ID, id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	revision, err := baseRevision(r, input.Revision, group.Revision)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	name, label, parentId, order := group.Name, group.Label, group.ParentID, group.Order
+	if input.Name != nil {
+		name = *input.Name
+	}
+	if input.Label != nil {
+		label = *input.Label
+	}
+	if input.ParentID != nil {
+		parentId = input.ParentID
+		if *input.ParentID == 0 {
+			parentId = nil
+		}
+	}
+	if input.Order != nil {
+		order = input.Order
+	}
+
+	if parentId != nil {
+		if _, err := srv.DocService.GetPageGroupOfVersion(doc.ID, *parentId); err != nil {
+			SendProblem(w, r, http.StatusBadRequest, "invalid_parent_page_group_id", "")
+			return
+		}
+	}
+
+	if err := srv.DocService.EditPageGroup(user, id, revision, name, label, doc.ID, parentId, order); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	group, err = srv.DocService.GetPageGroupOfVersion(doc.ID, id)
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	setETag(w, group.Revision)
+	sendV2(w, r, http.StatusOK, v2PageGroup(group))
+}
+
+func V2DeletePageGroup(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	doc, ok := v2Version(srv, w, r)
+	if !ok {
+		return
+	}
+
+	id, err := pathUint(r, "groupId")
+	if err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	user, ok := v2User(srv, w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := srv.DocService.GetPageGroupOfVersion(doc.ID, id); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	if err := srv.DocService.DeletePageGroup(user, id); err != nil {
+		SendProblem(w, r, 0, err.Error(), "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 
 	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/logger"
 	"git.difuse.io/Difuse/kalmia/services"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
@@ -99,7 +102,7 @@ func GetUsers(authService *services.AuthService, w http.ResponseWriter, r *http.
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, users)
+	SendJSONResponse(http.StatusOK, w, userResponses(users))
 }
 
 func GetUser(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
@@ -133,7 +136,7 @@ func GetUser(authService *services.AuthService, w http.ResponseWriter, r *http.R
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, user)
+	SendJSONResponse(http.StatusOK, w, userResponse(user))
 }
 
 func CreateJWT(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
@@ -147,12 +150,39 @@ func CreateJWT(authService *services.AuthService, w http.ResponseWriter, r *http
 		return
 	}
 
+	ip := ClientIP(r)
+	if err := authService.CheckLogin(ip, req.Username); err != nil {
+		if locked, ok := lockedError(err); ok {
+			sendLocked(w, locked)
+			return
+		}
+	}
+
 	tokenDetails, err := authService.CreateJWT(req.Username, req.Password)
 	if err != nil {
+		if err.Error() == "invalid_credentials" {
+			if err := authService.RecordLoginFailure(ip, req.Username); err != nil {
+				logger.Error(err.Error())
+			}
+			SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": err.Error()})
+			return
+		}
+
 		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
 		return
 	}
 
+	// the password was right, the second factor is still to come
+	if _, ok := tokenDetails["challenge"]; ok {
+		tokenDetails["status"] = "two_factor_required"
+		SendJSONResponse(http.StatusOK, w, tokenDetails)
+		return
+	}
+
+	if err := authService.RecordLoginSuccess(req.Username); err != nil {
+		logger.Error(err.Error())
+	}
+
 	tokenDetails["status"] = "success"
 
 	SendJSONResponse(http.StatusOK, w, tokenDetails)
@@ -208,6 +238,91 @@ func RevokeJWT(authService *services.AuthService, w http.ResponseWriter, r *http
 	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "token_revoked"})
 }
 
+// finishOAuthLogin hands the JWT of the user to the login page of the
+// provider, or a challenge to the second-factor page when one is needed.
+func finishOAuthLogin(aS *services.AuthService, w http.ResponseWriter, r *http.Request, email string, provider string) {
+	challenge, err := aS.OAuthTwoFactorChallenge(email)
+	if err != nil {
+		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if challenge != nil {
+		query := url.Values{}
+		query.Set("challenge", challenge["challenge"].(string))
+		query.Set("enroll", fmt.Sprint(challenge["enroll"]))
+		http.Redirect(w, r, "/admin/login/2fa?"+query.Encode(), http.StatusTemporaryRedirect)
+		return
+	}
+
+	tokenDetails, err := aS.CreateJWTFromEmail(email)
+	if err != nil {
+		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/login/%s?token=%s", provider, tokenDetails), http.StatusTemporaryRedirect)
+}
+
+// oauthStateCookie ties the callback of an OAuth or OIDC login to the
+// browser that started it.
+const oauthStateCookie = "kalmia_oauth_state"
+
+func setOAuthStateCookie(w http.ResponseWriter, r *http.Request, path string, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func stateCookieMatches(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oauthStateCookie)
+	return err == nil && state != "" && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+func oauthStatePath(provider string) string {
+	return "/kal-api/oauth/" + provider + "/"
+}
+
+// beginOAuthLogin sends the browser to a built-in provider with a state
+// that works once and a PKCE challenge.
+func beginOAuthLogin(aS *services.AuthService, w http.ResponseWriter, r *http.Request, provider string, cfg *oauth2.Config, opts ...oauth2.AuthCodeOption) {
+	state, verifier, err := aS.BeginOAuthLogin(provider)
+	if err != nil {
+		http.Error(w, "Failed to start the OAuth login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	setOAuthStateCookie(w, r, oauthStatePath(provider), state, 600)
+	http.Redirect(w, r, cfg.AuthCodeURL(state, append(opts, oauth2.S256ChallengeOption(verifier))...), http.StatusTemporaryRedirect)
+}
+
+// oauthVerifier checks that a callback comes back to the browser that
+// started the login, with a state that was issued and not used yet, and
+// returns the PKCE verifier of the login.
+func oauthVerifier(aS *services.AuthService, w http.ResponseWriter, r *http.Request, provider string) (string, bool) {
+	state := r.FormValue("state")
+	setOAuthStateCookie(w, r, oauthStatePath(provider), "", -1)
+
+	if !stateCookieMatches(r, state) {
+		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
+		return "", false
+	}
+
+	verifier, err := aS.FinishOAuthLogin(provider, state)
+	if err != nil {
+		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
+		return "", false
+	}
+
+	return verifier, true
+}
+
 func getGithubOauthConfig() *oauth2.Config {
 	if githubOauthConfig == nil {
 		githubOauthConfig = &oauth2.Config{
@@ -228,10 +343,7 @@ func GithubLogin(aS *services.AuthService, w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	githubOauthCfg := getGithubOauthConfig()
-
-	url := githubOauthCfg.AuthCodeURL("")
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	beginOAuthLogin(aS, w, r, "github", getGithubOauthConfig())
 }
 
 func GithubCallback(aS *services.AuthService, w http.ResponseWriter, r *http.Request) {
@@ -240,9 +352,14 @@ func GithubCallback(aS *services.AuthService, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	verifier, ok := oauthVerifier(aS, w, r, "github")
+	if !ok {
+		return
+	}
+
 	githubOauthCfg := getGithubOauthConfig()
 	code := r.FormValue("code")
-	token, err := githubOauthCfg.Exchange(context.Background(), code)
+	token, err := githubOauthCfg.Exchange(context.Background(), code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -281,13 +398,7 @@ func GithubCallback(aS *services.AuthService, w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	tokenDetails, err := aS.CreateJWTFromEmail(foundEmail)
-	if err != nil {
-		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
-		return
-	}
-
-	http.Redirect(w, r, fmt.Sprintf("/admin/login/gh?token=%s", tokenDetails), http.StatusTemporaryRedirect)
+	finishOAuthLogin(aS, w, r, foundEmail, "gh")
 }
 
 func getMicrosoftOauthConfig() *oauth2.Config {
@@ -309,9 +420,7 @@ func MicrosoftLogin(aS *services.AuthService, w http.ResponseWriter, r *http.Req
 		http.Error(w, "Microsoft OAuth not configured", http.StatusInternalServerError)
 		return
 	}
-	microsoftOauthCfg := getMicrosoftOauthConfig()
-	url := microsoftOauthCfg.AuthCodeURL("")
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	beginOAuthLogin(aS, w, r, "microsoft", getMicrosoftOauthConfig())
 }
 
 func MicrosoftCallback(aS *services.AuthService, w http.ResponseWriter, r *http.Request) {
@@ -319,9 +428,14 @@ func MicrosoftCallback(aS *services.AuthService, w http.ResponseWriter, r *http.
 		http.Error(w, "Microsoft OAuth not configured", http.StatusInternalServerError)
 		return
 	}
+	verifier, ok := oauthVerifier(aS, w, r, "microsoft")
+	if !ok {
+		return
+	}
+
 	microsoftOauthCfg := getMicrosoftOauthConfig()
 	code := r.FormValue("code")
-	token, err := microsoftOauthCfg.Exchange(context.Background(), code)
+	token, err := microsoftOauthCfg.Exchange(context.Background(), code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -361,13 +475,7 @@ func MicrosoftCallback(aS *services.AuthService, w http.ResponseWriter, r *http.
 		return
 	}
 
-	tokenDetails, err := aS.CreateJWTFromEmail(dbUser.Email)
-	if err != nil {
-		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
-		return
-	}
-
-	http.Redirect(w, r, fmt.Sprintf("/admin/login/ms?token=%s", tokenDetails), http.StatusTemporaryRedirect)
+	finishOAuthLogin(aS, w, r, dbUser.Email, "ms")
 }
 
 func getGoogleOAuthConfig() *oauth2.Config {
@@ -388,9 +496,7 @@ func GoogleLogin(aS *services.AuthService, w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Google OAuth not configured", http.StatusInternalServerError)
 		return
 	}
-	googleOAuthCfg := getGoogleOAuthConfig()
-	url := googleOAuthCfg.AuthCodeURL("state", oauth2.AccessTypeOffline)
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	beginOAuthLogin(aS, w, r, "google", getGoogleOAuthConfig(), oauth2.AccessTypeOffline)
 }
 
 func GoogleCallback(aS *services.AuthService, w http.ResponseWriter, r *http.Request) {
@@ -399,9 +505,14 @@ func GoogleCallback(aS *services.AuthService, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	verifier, ok := oauthVerifier(aS, w, r, "google")
+	if !ok {
+		return
+	}
+
 	googleOAuthCfg := getGoogleOAuthConfig()
 	code := r.FormValue("code")
-	token, err := googleOAuthCfg.Exchange(context.Background(), code)
+	token, err := googleOAuthCfg.Exchange(context.Background(), code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -424,13 +535,7 @@ func GoogleCallback(aS *services.AuthService, w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	tokenDetails, err := aS.CreateJWTFromEmail(dbUser.Email)
-	if err != nil {
-		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
-		return
-	}
-
-	http.Redirect(w, r, fmt.Sprintf("/admin/login/gg?token=%s", tokenDetails), http.StatusTemporaryRedirect)
+	finishOAuthLogin(aS, w, r, dbUser.Email, "gg")
 }
 
 func getGoogleUserEmail(accessToken string) (string, error) {
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"git.difuse.io/Difuse/kalmia/services"
+	"git.difuse.io/Difuse/kalmia/utils"
+)
+
+func batchErrorStatus(err error) int {
+	switch err.Error() {
+	case "page_not_found", "page_group_not_found", "documentation_not_found":
+		return http.StatusNotFound
+	case "invalid_operation", "invalid_ref", "duplicate_ref", "invalid_page_group_id", "page_group_cycle",
+		"invalid_page_type", "invalid_canonical_url":
+		return http.StatusBadRequest
+	case "page_slug_already_exists", "revision_conflict":
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func RunBatch(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Operations []services.BatchOperation `json:"operations" validate:"required,min=1,max=1000,dive"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	// The route needs write permission; deleting through it needs delete
+	// permission as well.
+	if !srv.AuthService.IsTokenAdmin(token) {
+		for _, op := range req.Operations {
+			if op.Op != services.BatchDelete {
+				continue
+			}
+
+			permissions, err := srv.AuthService.GetUserPermissions(token)
+			if err != nil || !utils.ArrayContains(permissions, "delete") {
+				SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"error": "user_unauthorized_route"})
+				return
+			}
+			break
+		}
+	}
+
+	result, err := srv.DocService.RunBatch(user, req.Operations)
+	if err != nil {
+		var batchErr services.BatchError
+		if errors.As(err, &batchErr) {
+			SendJSONResponse(batchErrorStatus(batchErr.Err), w, map[string]interface{}{"status": "error", "message": err.Error(), "index": batchErr.Index})
+			return
+		}
+
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, result)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/services"
+	"golang.org/x/net/websocket"
+)
+
+// collabIdleTimeout closes connections of editors that have gone quiet. The
+// Yjs awareness protocol renews its state well within this period.
+const collabIdleTimeout = 2 * time.Minute
+
+const collabWriteTimeout = 10 * time.Second
+
+// CollabTicket hands out the ticket the editor opens the collab WebSocket
+// with, since a browser cannot send the Authorization header there.
+func CollabTicket(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	if _, err := srv.DocService.GetPage(req.ID); err != nil {
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	ticket, err := srv.DocService.IssueCollabTicket(user, req.ID)
+	if err != nil {
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "ticket": ticket})
+}
+
+// collabOriginAllowed accepts handshakes from the site itself, the
+// configured public URL and the configured CORS origins, so another site
+// cannot open a session in the name of a logged in editor.
+func collabOriginAllowed(r *http.Request) bool {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil || origin.Host == "" {
+		return false
+	}
+
+	if strings.EqualFold(origin.Host, r.Host) {
+		return true
+	}
+
+	if config.ParsedConfig == nil {
+		return false
+	}
+
+	if public, err := url.Parse(config.ParsedConfig.Email.PublicURL); err == nil && public.Host != "" && strings.EqualFold(origin.Host, public.Host) {
+		return true
+	}
+
+	for _, allowed := range config.ParsedConfig.Security.CORSConfig.AllowedOrigins {
+		if allowed != "*" && strings.EqualFold(strings.TrimRight(allowed, "/"), origin.Scheme+"://"+origin.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func PageCollab(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	var user models.User
+	server := websocket.Server{
+		// The session acts for whoever the ticket was issued to, so only
+		// the origins the editor is served from may open it.
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if !collabOriginAllowed(r) {
+				return fmt.Errorf("origin_not_allowed")
+			}
+
+			user, err = srv.DocService.RedeemCollabTicket(r.URL.Query().Get("ticket"), uint(id))
+			return err
+		},
+		Handler: func(ws *websocket.Conn) {
+			serveCollab(srv.DocService, uint(id), user, ws)
+		},
+	}
+
+	server.ServeHTTP(w, r)
+}
+
+func serveCollab(service *services.DocService, pageID uint, user models.User, ws *websocket.Conn) {
+	defer ws.Close()
+
+	// The hijacked connection keeps the deadlines of the http.Server.
+	ws.SetDeadline(time.Time{})
+	ws.MaxPayloadBytes = int(config.ParsedConfig.BodyLimitMb) * 1024 * 1024
+
+	peer := services.NewCollabPeer(user)
+	if err := service.JoinCollabSession(pageID, peer); err != nil {
+		websocket.JSON.Send(ws, services.CollabMessage{Type: "error", Message: err.Error()})
+		return
+	}
+	defer service.LeaveCollabSession(pageID, peer)
+
+	go func() {
+		for msg := range peer.Send {
+			ws.SetWriteDeadline(time.Now().Add(collabWriteTimeout))
+			if err := websocket.JSON.Send(ws, msg); err != nil {
+				break
+			}
+		}
+		ws.Close()
+	}()
+
+	for {
+		ws.SetReadDeadline(time.Now().Add(collabIdleTimeout))
+
+		var msg services.CollabMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return
+		}
+
+		var err error
+		switch msg.Type {
+		case "update":
+			err = service.RelayCollabUpdate(pageID, peer, msg.Update)
+		case "awareness":
+			err = service.RelayCollabAwareness(pageID, peer, msg.State)
+		case "snapshot":
+			err = service.QueueCollabSnapshot(pageID, peer, msg)
+		}
+
+		if err != nil {
+			if err.Error() == "collab_session_not_found" {
+				return
+			}
+			service.NotifyCollabPeer(pageID, peer, services.CollabMessage{Type: "error", Message: err.Error()})
+		}
+	}
+}
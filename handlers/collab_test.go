@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/services"
+	"golang.org/x/net/websocket"
+)
+
+func TestPageCollabHandshake(t *testing.T) {
+	var admin models.User
+	if err := TestServices.AuthService.DB.Where("username = ?", "admin").First(&admin).Error; err != nil {
+		t.Fatalf("Failed to get the admin: %v", err)
+	}
+
+	doc := models.Documentation{Name: "Collab Handshake Doc", Version: "1.0.0", BaseURL: "/collab-handshake", AuthorID: admin.ID}
+	TestServices.DocService.DB.Create(&doc)
+	page := models.Page{DocumentationID: doc.ID, AuthorID: admin.ID, Title: "Collab", Slug: "/collab", Content: "[]"}
+	TestServices.DocService.DB.Create(&page)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		PageCollab(TestServices, w, r)
+	}))
+	defer server.Close()
+
+	dial := func(origin string, ticket string) (*websocket.Conn, error) {
+		url := fmt.Sprintf("%s?id=%d&ticket=%s", strings.Replace(server.URL, "http", "ws", 1), page.ID, ticket)
+		return websocket.Dial(url, "", origin)
+	}
+
+	ticket, _ := TestServices.DocService.IssueCollabTicket(admin, page.ID)
+	if _, err := dial("https://attacker.example.com", ticket); err == nil {
+		t.Fatalf("Expected a handshake from another origin to be refused")
+	}
+
+	if _, err := dial(server.URL, "not-a-ticket"); err == nil {
+		t.Fatalf("Expected a handshake without a valid ticket to be refused")
+	}
+
+	ticket, _ = TestServices.DocService.IssueCollabTicket(admin, page.ID)
+	ws, err := dial(server.URL, ticket)
+	if err != nil {
+		t.Fatalf("Expected the handshake to succeed: %v", err)
+	}
+	defer ws.Close()
+
+	var msg services.CollabMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != "sync" {
+		t.Fatalf("Expected a sync message, got %+v: %v", msg, err)
+	}
+}
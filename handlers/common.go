@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"git.difuse.io/Difuse/kalmia/utils"
 	"github.com/go-playground/validator/v10"
@@ -48,3 +50,48 @@ func GetTokenFromHeader(r *http.Request) (string, error) {
 
 	return token, nil
 }
+
+// GetBaseRevision returns the revision an edit was based on. It is read from
+// the If-Match header when present, otherwise from the baseRevision field of
+// the request body.
+func GetBaseRevision(r *http.Request, baseRevision *uint) (uint, error) {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		etag := strings.Trim(strings.TrimPrefix(strings.TrimSpace(ifMatch), "W/"), "\"")
+		revision, err := strconv.ParseUint(etag, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid_if_match")
+		}
+		return uint(revision), nil
+	}
+
+	if baseRevision == nil {
+		return 0, fmt.Errorf("revision_required")
+	}
+
+	return *baseRevision, nil
+}
+
+// SendBaseRevisionError responds to a missing or malformed base revision.
+func SendBaseRevisionError(w http.ResponseWriter, err error) {
+	if err.Error() == "revision_required" {
+		SendJSONResponse(http.StatusPreconditionRequired, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+}
+
+func SetETag(w http.ResponseWriter, revision uint) {
+	w.Header().Set("ETag", fmt.Sprintf("\"%d\"", revision))
+}
+
+// SendRevisionConflict responds with 409 and the current server state, so the
+// client can merge its changes instead of losing them.
+func SendRevisionConflict(w http.ResponseWriter, current interface{}, revision uint) {
+	SetETag(w, revision)
+	SendJSONResponse(http.StatusConflict, w, map[string]interface{}{
+		"status":  "error",
+		"message": "revision_conflict",
+		"current": current,
+	})
+}
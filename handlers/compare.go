@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+// CompareVersions reports what changed between two versions, as JSON or, with
+// format=markdown, as the Markdown summary for release notes.
+func CompareVersions(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	fromId, err := strconv.ParseUint(r.URL.Query().Get("from"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	toId, err := strconv.ParseUint(r.URL.Query().Get("to"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	comparison, err := service.CompareVersions(uint(fromId), uint(toId))
+	if err != nil {
+		switch err.Error() {
+		case "documentation_not_found":
+			SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+		case "versions_not_related":
+			SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+		default:
+			SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		}
+		return
+	}
+
+	if r.URL.Query().Get("format") == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(comparison.Summary))
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, comparison)
+}
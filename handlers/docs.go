@@ -23,7 +23,7 @@ func GetDocumentations(service *services.DocService, w http.ResponseWriter, r *h
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, docs)
+	SendJSONResponse(http.StatusOK, w, documentationResponses(docs))
 }
 
 func GetDocumentation(service *services.DocService, w http.ResponseWriter, r *http.Request) {
@@ -45,7 +45,8 @@ func GetDocumentation(service *services.DocService, w http.ResponseWriter, r *ht
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, doc)
+	SetETag(w, doc.Revision)
+	SendJSONResponse(http.StatusOK, w, documentationResponse(doc))
 }
 
 func CreateDocumentation(service *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
@@ -75,6 +76,7 @@ func CreateDocumentation(service *services.ServiceRegistry, w http.ResponseWrite
 		NavImage         string `json:"navImage"`
 		NavImageDark     string `json:"navImageDark"`
 		CustomCSS        string `json:"customCSS" validate:"required"`
+		RobotsTxt        string `json:"robotsTxt"`
 		FooterLabelLinks string `json:"footerLabelLinks"`
 		MoreLabelLinks   string `json:"moreLabelLinks"`
 		CopyrightText    string `json:"copyrightText" validate:"required"`
@@ -90,6 +92,7 @@ func CreateDocumentation(service *services.ServiceRegistry, w http.ResponseWrite
 		BucketNavImage     string `json:"bucketNavImage"`
 		BucketNavImageDark string `json:"bucketNavImageDark"`
 		TokenSecret        string `json:"tokenSecret"`
+		TemplateID         uint   `json:"templateId"`
 	}
 
 	req, err := ValidateRequest[Request](w, r)
@@ -115,6 +118,7 @@ func CreateDocumentation(service *services.ServiceRegistry, w http.ResponseWrite
 		NavImage:         req.NavImage,
 		NavImageDark:     req.NavImageDark,
 		CustomCSS:        req.CustomCSS,
+		RobotsTxt:        req.RobotsTxt,
 		FooterLabelLinks: req.FooterLabelLinks,
 		MoreLabelLinks:   req.MoreLabelLinks,
 		CopyrightText:    req.CopyrightText,
@@ -127,14 +131,14 @@ func CreateDocumentation(service *services.ServiceRegistry, w http.ResponseWrite
 		TokenSecret:      req.TokenSecret,
 	}
 
-	err = service.DocService.CreateDocumentation(documentation, user, map[string]string{
+	err = service.DocService.CreateDocumentation(documentation, user, req.TemplateID, map[string]string{
 		"favicon":      req.BucketFavicon,
 		"metaImage":    req.BucketMetaImage,
 		"navImage":     req.BucketNavImage,
 		"navImageDark": req.BucketNavImageDark,
 	})
 	if err != nil {
-		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		sendTemplateError(w, err)
 		return
 	}
 
@@ -157,6 +161,7 @@ func EditDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *
 		NavImage         string `json:"navImage"`
 		NavImageDark     string `json:"navImageDark"`
 		CustomCSS        string `json:"customCSS" validate:"required"`
+		RobotsTxt        string `json:"robotsTxt"`
 		FooterLabelLinks string `json:"footerLabelLinks"`
 		MoreLabelLinks   string `json:"moreLabelLinks"`
 		CopyrightText    string `json:"copyrightText" validate:"required"`
@@ -172,6 +177,9 @@ func EditDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *
 		BucketNavImage     string `json:"bucketNavImage"`
 		BucketNavImageDark string `json:"bucketNavImageDark"`
 		TokenSecret        string `json:"tokenSecret"`
+		ClearGitPassword   bool   `json:"clearGitPassword"`
+		ClearTokenSecret   bool   `json:"clearTokenSecret"`
+		BaseRevision       *uint  `json:"baseRevision"`
 	}
 
 	req, err := ValidateRequest[Request](w, r)
@@ -179,6 +187,12 @@ func EditDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *
 		return
 	}
 
+	baseRevision, err := GetBaseRevision(r, req.BaseRevision)
+	if err != nil {
+		SendBaseRevisionError(w, err)
+		return
+	}
+
 	token, err := GetTokenFromHeader(r)
 	if err != nil {
 		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
@@ -195,6 +209,7 @@ func EditDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *
 		services.EditDocumentationParams{
 			User:             user,
 			ID:               req.ID,
+			BaseRevision:     baseRevision,
 			Name:             req.Name,
 			Description:      req.Description,
 			Version:          req.Version,
@@ -215,6 +230,7 @@ func EditDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *
 			NavImage:         req.NavImage,
 			NavImageDark:     req.NavImageDark,
 			CustomCSS:        req.CustomCSS,
+			RobotsTxt:        req.RobotsTxt,
 			FooterLabelLinks: req.FooterLabelLinks,
 			MoreLabelLinks:   req.MoreLabelLinks,
 			BucketUploadedFiles: map[string]string{
@@ -223,17 +239,31 @@ func EditDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *
 				"navImage":     req.BucketNavImage,
 				"navImageDark": req.BucketNavImageDark,
 			},
-			TokenSecret: req.TokenSecret,
+			TokenSecret:      req.TokenSecret,
+			ClearGitPassword: req.ClearGitPassword,
+			ClearTokenSecret: req.ClearTokenSecret,
 		})
 	if err != nil {
-		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		switch err.Error() {
+		case "revision_conflict":
+			if current, err := srv.DocService.GetDocumentation(req.ID); err == nil {
+				SendRevisionConflict(w, documentationResponse(current), current.Revision)
+				return
+			}
+			SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": "revision_conflict"})
+		case "documentation_not_found":
+			SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+		default:
+			SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		}
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "documentation_updated", "id": fmt.Sprint(req.ID)})
+	SetETag(w, baseRevision+1)
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "documentation_updated", "id": fmt.Sprint(req.ID), "revision": fmt.Sprint(baseRevision + 1)})
 }
 
-func DeleteDocumentation(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+func DeleteDocumentation(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
 	type Request struct {
 		ID uint `json:"id" validate:"required"`
 	}
@@ -243,7 +273,19 @@ func DeleteDocumentation(service *services.DocService, w http.ResponseWriter, r
 		return
 	}
 
-	err = service.DeleteDocumentation(req.ID)
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	err = srv.DocService.DeleteDocumentation(user, req.ID)
 	if err != nil {
 		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
 		return
@@ -273,13 +315,23 @@ func CreateDocumentationVersion(service *services.DocService, w http.ResponseWri
 }
 
 func GetPages(service *services.DocService, w http.ResponseWriter, r *http.Request) {
-	pages, err := service.GetPages()
+	var tagId uint64
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		var err error
+		tagId, err = strconv.ParseUint(tag, 10, 32)
+		if err != nil {
+			SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid tag format"})
+			return
+		}
+	}
+
+	pages, err := service.GetPages(uint(tagId))
 	if err != nil {
 		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, pages)
+	SendJSONResponse(http.StatusOK, w, pageResponses(pages))
 }
 
 func GetPage(service *services.DocService, w http.ResponseWriter, r *http.Request) {
@@ -298,17 +350,20 @@ func GetPage(service *services.DocService, w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, page)
+	SetETag(w, page.Revision)
+	SendJSONResponse(http.StatusOK, w, pageResponse(page))
 }
 
 func CreatePage(services *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
 	type Request struct {
-		Title           string `json:"title" validate:"required"`
-		Slug            string `json:"slug" validate:"required"`
-		Content         string `json:"content" validate:"required"`
-		DocumentationID uint   `json:"documentationId" validate:"required"`
-		PageGroupID     *uint  `json:"pageGroupId"`
-		Order           *uint  `json:"order"`
+		Title           string          `json:"title" validate:"required"`
+		Slug            string          `json:"slug" validate:"required"`
+		Content         string          `json:"content" validate:"required_without=TemplateID"`
+		DocumentationID uint            `json:"documentationId" validate:"required"`
+		PageGroupID     *uint           `json:"pageGroupId"`
+		Order           *uint           `json:"order"`
+		SEO             *models.PageSEO `json:"seo"`
+		TemplateID      uint            `json:"templateId"`
 	}
 
 	req, err := ValidateRequest[Request](w, r)
@@ -347,9 +402,25 @@ func CreatePage(services *services.ServiceRegistry, w http.ResponseWriter, r *ht
 		page.Order = req.Order
 	}
 
+	if req.SEO != nil {
+		page.PageSEO = *req.SEO
+	}
+
+	if req.TemplateID != 0 {
+		if err := services.DocService.ApplyPageTemplate(&page, req.TemplateID); err != nil {
+			sendTemplateError(w, err)
+			return
+		}
+	}
+
 	err = services.DocService.CreatePage(&page)
 	if err != nil {
-		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		switch err.Error() {
+		case "invalid_page_type", "invalid_canonical_url":
+			SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+		default:
+			SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		}
 		return
 	}
 
@@ -358,12 +429,14 @@ func CreatePage(services *services.ServiceRegistry, w http.ResponseWriter, r *ht
 
 func EditPage(services *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
 	type Request struct {
-		ID          uint   `json:"id" validate:"required"`
-		Title       string `json:"title" validate:"required"`
-		Slug        string `json:"slug" validate:"required"`
-		Content     string `json:"content"`
-		Order       *uint  `json:"order"`
-		PageGroupId *uint  `json:"pageGroupId"`
+		ID           uint            `json:"id" validate:"required"`
+		Title        string          `json:"title" validate:"required"`
+		Slug         string          `json:"slug" validate:"required"`
+		Content      string          `json:"content"`
+		Order        *uint           `json:"order"`
+		PageGroupId  *uint           `json:"pageGroupId"`
+		BaseRevision *uint           `json:"baseRevision"`
+		SEO          *models.PageSEO `json:"seo"`
 	}
 
 	req, err := ValidateRequest[Request](w, r)
@@ -371,6 +444,12 @@ func EditPage(services *services.ServiceRegistry, w http.ResponseWriter, r *http
 		return
 	}
 
+	baseRevision, err := GetBaseRevision(r, req.BaseRevision)
+	if err != nil {
+		SendBaseRevisionError(w, err)
+		return
+	}
+
 	token, err := GetTokenFromHeader(r)
 	if err != nil {
 		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
@@ -383,16 +462,30 @@ func EditPage(services *services.ServiceRegistry, w http.ResponseWriter, r *http
 		return
 	}
 
-	err = services.DocService.EditPage(user, req.ID, req.Title, req.Slug, req.Content, req.Order, req.PageGroupId)
+	err = services.DocService.EditPage(user, req.ID, baseRevision, req.Title, req.Slug, req.Content, req.Order, req.PageGroupId, req.SEO)
 	if err != nil {
-		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		switch err.Error() {
+		case "revision_conflict":
+			if current, err := services.DocService.GetPage(req.ID); err == nil {
+				SendRevisionConflict(w, pageResponse(current), current.Revision)
+				return
+			}
+			SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": "revision_conflict"})
+		case "page_not_found":
+			SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+		case "invalid_page_type", "invalid_canonical_url":
+			SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+		default:
+			SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		}
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "page_updated", "id": fmt.Sprint(req.ID)})
+	SetETag(w, baseRevision+1)
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "page_updated", "id": fmt.Sprint(req.ID), "revision": fmt.Sprint(baseRevision + 1)})
 }
 
-func DeletePage(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+func DeletePage(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
 	type Request struct {
 		ID uint `json:"id" validate:"required"`
 	}
@@ -402,7 +495,19 @@ func DeletePage(service *services.DocService, w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = service.DeletePage(req.ID)
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	err = srv.DocService.DeletePage(user, req.ID)
 	if err != nil {
 		switch err.Error() {
 		case "page_not_found":
@@ -450,6 +555,8 @@ func GetPageGroup(service *services.DocService, w http.ResponseWriter, r *http.R
 		return
 	}
 
+	revision, _ := pageGroup["revision"].(uint)
+	SetETag(w, revision)
 	SendJSONResponse(http.StatusOK, w, pageGroup)
 }
 
@@ -514,6 +621,7 @@ func EditPageGroup(services *services.ServiceRegistry, w http.ResponseWriter, r
 		DocumentationID uint   `json:"documentationId" validate:"required"`
 		ParentID        *uint  `json:"parentId"`
 		Order           *uint  `json:"order"`
+		BaseRevision    *uint  `json:"baseRevision"`
 	}
 
 	req, err := ValidateRequest[Request](w, r)
@@ -521,6 +629,12 @@ func EditPageGroup(services *services.ServiceRegistry, w http.ResponseWriter, r
 		return
 	}
 
+	baseRevision, err := GetBaseRevision(r, req.BaseRevision)
+	if err != nil {
+		SendBaseRevisionError(w, err)
+		return
+	}
+
 	token, err := GetTokenFromHeader(r)
 	if err != nil {
 		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
@@ -533,16 +647,29 @@ func EditPageGroup(services *services.ServiceRegistry, w http.ResponseWriter, r
 		return
 	}
 
-	err = services.DocService.EditPageGroup(user, req.ID, req.Name, req.Label, req.DocumentationID, req.ParentID, req.Order)
+	err = services.DocService.EditPageGroup(user, req.ID, baseRevision, req.Name, req.Label, req.DocumentationID, req.ParentID, req.Order)
 	if err != nil {
-		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		switch err.Error() {
+		case "revision_conflict":
+			if current, err := services.DocService.GetPageGroup(req.ID); err == nil {
+				revision, _ := current["revision"].(uint)
+				SendRevisionConflict(w, current, revision)
+				return
+			}
+			SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": "revision_conflict"})
+		case "page_group_not_found":
+			SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+		default:
+			SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		}
 		return
 	}
 
-	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "page_group_updated", "id": fmt.Sprint(req.ID)})
+	SetETag(w, baseRevision+1)
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "page_group_updated", "id": fmt.Sprint(req.ID), "revision": fmt.Sprint(baseRevision + 1)})
 }
 
-func DeletePageGroup(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+func DeletePageGroup(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
 	type Request struct {
 		ID uint `json:"id" validate:"required"`
 	}
@@ -552,7 +679,19 @@ func DeletePageGroup(service *services.DocService, w http.ResponseWriter, r *htt
 		return
 	}
 
-	err = service.DeletePageGroup(req.ID)
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	err = srv.DocService.DeletePageGroup(user, req.ID)
 	if err != nil {
 		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
 		return
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+// publicURL is the base of links in emails. It only ever comes from the
+// configuration: a link built from the Host header of a request would let
+// anyone send reset links that point to their own server.
+func publicURL() (string, error) {
+	if config.ParsedConfig == nil || config.ParsedConfig.Email.PublicURL == "" {
+		return "", fmt.Errorf("email_public_url_not_configured")
+	}
+
+	return config.ParsedConfig.Email.PublicURL, nil
+}
+
+func ForgotPassword(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := authService.CheckLogin(ClientIP(r), ""); err != nil {
+		if locked, ok := lockedError(err); ok {
+			sendLocked(w, locked)
+			return
+		}
+	}
+
+	baseURL, err := publicURL()
+	if err != nil {
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	// the answer is the same whether or not the email belongs to an account
+	if err := authService.RequestPasswordReset(req.Email, baseURL); err != nil {
+		logger.Error(err.Error())
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "reset_email_sent"})
+}
+
+func setPasswordWithToken(authService *services.AuthService, kind string, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required,min=8,max=32"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := authService.SetPasswordWithToken(kind, req.Token, req.Password); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "invalid_or_expired_link" {
+			status = http.StatusBadRequest
+		}
+		SendJSONResponse(status, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "password_set"})
+}
+
+func ResetPassword(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	setPasswordWithToken(authService, services.UserTokenPasswordReset, w, r)
+}
+
+func AcceptInvitation(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	setPasswordWithToken(authService, services.UserTokenInvitation, w, r)
+}
+
+func InviteUser(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Username    string   `json:"username" validate:"required,alphanum"`
+		Email       string   `json:"email" validate:"required,email"`
+		Admin       bool     `json:"admin"`
+		Permissions []string `json:"permissions" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	baseURL, err := publicURL()
+	if err != nil {
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	invitedBy := ""
+	if token, err := GetTokenFromHeader(r); err == nil {
+		if user, err := authService.GetUserFromToken(token); err == nil {
+			invitedBy = user.Username
+		}
+	}
+
+	if err := authService.InviteUser(req.Username, req.Email, req.Admin, req.Permissions, invitedBy, baseURL); err != nil {
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "invitation_sent"})
+}
+
+func GetOutbox(mailService *services.MailService, w http.ResponseWriter, r *http.Request) {
+	emails, err := mailService.GetOutbox()
+	if err != nil {
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, emails)
+}
+
+func RetryEmail(mailService *services.MailService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := mailService.RetryEmail(req.ID); err != nil {
+		status := http.StatusInternalServerError
+		switch err.Error() {
+		case "email_not_found":
+			status = http.StatusNotFound
+		case "email_already_sent":
+			status = http.StatusBadRequest
+		}
+		SendJSONResponse(status, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "email_queued"})
+}
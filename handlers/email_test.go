@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestEmailLinksUseConfiguredURL(t *testing.T) {
+	previous := config.ParsedConfig.Email.PublicURL
+	t.Cleanup(func() { config.ParsedConfig.Email.PublicURL = previous })
+
+	forgotPassword := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/kal-api/auth/forgot-password", strings.NewReader(`{"email": "user@kalmia.difuse.io"}`))
+		req.Host = "attacker.example.com"
+		req.Header.Set("X-Forwarded-Proto", "https")
+
+		rr := httptest.NewRecorder()
+		ForgotPassword(TestServices.AuthService, rr, req)
+		return rr
+	}
+
+	config.ParsedConfig.Email.PublicURL = ""
+	if rr := forgotPassword(); rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "email_public_url_not_configured") {
+		t.Fatalf("Expected the request to be refused without a public URL, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	var count int64
+	TestServices.AuthService.DB.Model(&models.OutboxEmail{}).Where("recipient = ?", "user@kalmia.difuse.io").Count(&count)
+	if count != 0 {
+		t.Fatalf("Expected no email to be queued, got %d", count)
+	}
+
+	config.ParsedConfig.Email.PublicURL = "https://docs.example.com"
+	if rr := forgotPassword(); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the reset email to be queued, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	var email models.OutboxEmail
+	if err := TestServices.AuthService.DB.Where("recipient = ?", "user@kalmia.difuse.io").Last(&email).Error; err != nil {
+		t.Fatalf("Failed to get the queued email: %v", err)
+	}
+	if !strings.Contains(email.Text, "https://docs.example.com/admin/reset-password?token=") || strings.Contains(email.Text, "attacker.example.com") {
+		t.Errorf("Expected the link to use the configured URL, got %s", email.Text)
+	}
+}
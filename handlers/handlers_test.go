@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/services"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"go.uber.org/zap"
+)
+
+var TestConfig *config.Config
+var TestServices *services.ServiceRegistry
+
+func TestMain(m *testing.M) {
+	configJson := `{
+		"environment": "debug",
+		"port": 3737,
+		"logLevel": "debug",
+		"database": "sqlite",
+		"sessionSecret": "test",
+		"dataPath": "./handler_test_dir",
+		"pathToSecretFile": "./secret.json",
+		"users": [{"username": "admin", "email": "admin@kalmia.difuse.io", "password": "admin", "admin": true},
+				  {"username": "user", "email": "user@kalmia.difuse.io", "password": "user", "admin": false}]
+	}`
+
+	err := utils.WriteToFile("./secret.json", `{"JwtSecretKey": "test"}`)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = utils.TouchFile("./config.json")
+
+	if err != nil {
+		panic(err)
+	}
+
+	prettyJson, err := utils.PrettyJSON(configJson)
+
+	if err != nil {
+		prettyJson = configJson
+	}
+
+	err = utils.WriteToFile("./config.json", prettyJson)
+
+	if err != nil {
+		panic(err)
+	}
+
+	TestConfig = config.ParseConfig("./config.json")
+
+	logger.InitializeLogger("test", TestConfig.LogLevel, TestConfig.DataPath)
+
+	d := db.SetupDatabase(TestConfig.Environment, TestConfig.Database, TestConfig.DataPath)
+	if err := db.SetupSecrets(d, TestConfig); err != nil {
+		panic(err)
+	}
+	db.SetupBasicData(d, TestConfig.Admins)
+	db.InitCache()
+
+	TestServices = services.NewServiceRegistry(d, false, TestConfig.Secret)
+
+	code := m.Run()
+
+	err = utils.RemovePath(TestConfig.DataPath)
+
+	if err != nil {
+		logger.Error("Failed to remove test data path", zap.Error(err))
+	}
+
+	err = utils.RemovePath("./config.json")
+
+	if err != nil {
+		logger.Error("Failed to remove test config file: %v", zap.Error(err))
+	}
+
+	err = utils.RemovePath("./secret.json")
+
+	if err != nil {
+		logger.Error("Failed to remove test secret file", zap.Error(err))
+	}
+
+	os.Exit(code)
+}
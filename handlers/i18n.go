@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendTranslationError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "documentation_not_found", "page_not_found", "page_group_not_found", "translation_not_found":
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+	case "invalid_locale", "invalid_default_locale", "locale_is_default", "invalid_translation_status",
+		"invalid_translation_format", "invalid_translation_file", "locale_mismatch", "invalid_page_content":
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+	default:
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+	}
+}
+
+func SetDocumentationLocales(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID            uint              `json:"id" validate:"required"`
+		DefaultLocale string            `json:"defaultLocale"`
+		Locales       []services.Locale `json:"locales"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	if err := srv.DocService.SetDocumentationLocales(user, req.ID, req.DefaultLocale, req.Locales); err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "documentation_locales_updated", "id": fmt.Sprint(req.ID)})
+}
+
+func GetPageTranslations(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	translations, err := service.GetPageTranslations(req.ID)
+	if err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, translations)
+}
+
+func SavePageTranslation(services *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID      uint   `json:"id" validate:"required"`
+		Locale  string `json:"locale" validate:"required"`
+		Title   string `json:"title" validate:"required"`
+		Content string `json:"content" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := services.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	translation, err := services.DocService.SavePageTranslation(user, req.ID, req.Locale, req.Title, req.Content)
+	if err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, translation)
+}
+
+func SetPageTranslationStatus(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID     uint   `json:"id" validate:"required"`
+		Locale string `json:"locale" validate:"required"`
+		Status string `json:"status" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := service.SetPageTranslationStatus(req.ID, req.Locale, req.Status); err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "translation_status_updated", "id": fmt.Sprint(req.ID)})
+}
+
+func GetPageGroupTranslations(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	translations, err := service.GetPageGroupTranslations(req.ID)
+	if err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, translations)
+}
+
+func SavePageGroupTranslation(services *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID     uint   `json:"id" validate:"required"`
+		Locale string `json:"locale" validate:"required"`
+		Label  string `json:"label" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := services.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	translation, err := services.DocService.SavePageGroupTranslation(user, req.ID, req.Locale, req.Label)
+	if err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, translation)
+}
+
+func SetPageGroupTranslationStatus(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID     uint   `json:"id" validate:"required"`
+		Locale string `json:"locale" validate:"required"`
+		Status string `json:"status" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := service.SetPageGroupTranslationStatus(req.ID, req.Locale, req.Status); err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "translation_status_updated", "id": fmt.Sprint(req.ID)})
+}
+
+// translationFormat picks the exchange format from an explicit format value
+// or, failing that, from the extension of an uploaded file.
+func translationFormat(format string, filename string) string {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+
+	switch format {
+	case "xlf", "xliff":
+		return services.TranslationFormatXLIFF
+	case "po":
+		return services.TranslationFormatPO
+	default:
+		return format
+	}
+}
+
+func ExportTranslations(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	locale := r.URL.Query().Get("locale")
+	format := translationFormat(r.URL.Query().Get("format"), "")
+
+	data, err := service.ExportTranslations(uint(id), locale, format)
+	if err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	contentType, extension := "application/xliff+xml", "xlf"
+	if format == services.TranslationFormatPO {
+		contentType, extension = "text/x-gettext-translation; charset=utf-8", "po"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="documentation-%d.%s.%s"`, id, locale, extension))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func ImportTranslations(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	if err := r.ParseMultipartForm(config.ParsedConfig.MaxFileSize << 20); err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "failed_to_parse_form"})
+		return
+	}
+
+	id, err := strconv.ParseUint(r.FormValue("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "failed_to_get_file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": "failed_to_read_file"})
+		return
+	}
+
+	format := translationFormat(r.FormValue("format"), header.Filename)
+
+	report, err := srv.DocService.ImportTranslations(user, uint(id), r.FormValue("locale"), format, data)
+	if err != nil {
+		sendTranslationError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, report)
+}
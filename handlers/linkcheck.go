@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendLinkCheckError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "documentation_not_found", "link_report_not_found":
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+	case "link_check_running":
+		SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": err.Error()})
+	default:
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+	}
+}
+
+func StartLinkCheck(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := service.StartLinkCheck(req.ID); err != nil {
+		sendLinkCheckError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusAccepted, w, map[string]string{"status": "success", "message": "link_check_started", "id": fmt.Sprint(req.ID)})
+}
+
+func GetLinkReport(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	report, err := service.GetLinkReport(uint(id))
+	if err != nil {
+		sendLinkCheckError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, report)
+}
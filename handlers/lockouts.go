@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+// ClientIP is the address logins are throttled by. X-Forwarded-For is only
+// trusted when Kalmia is configured to run behind a proxy, and then only the
+// entries the configured proxies appended: the client can put anything at
+// the start of the header.
+func ClientIP(r *http.Request) string {
+	if config.ParsedConfig != nil && config.ParsedConfig.Security.LoginLimit.TrustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			entries := strings.Split(strings.Join(forwarded, ","), ",")
+
+			hops := max(config.ParsedConfig.Security.LoginLimit.ProxyHops, 1)
+			if ip := strings.TrimSpace(entries[max(len(entries)-hops, 0)]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func sendLocked(w http.ResponseWriter, locked services.LockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	SendJSONResponse(http.StatusTooManyRequests, w, map[string]string{"status": "error", "message": locked.Error()})
+}
+
+// loginRecorder notes whether an OAuth callback ended in a login.
+type loginRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *loginRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *loginRecorder) loggedIn() bool {
+	return rec.status == http.StatusTemporaryRedirect && strings.HasPrefix(rec.Header().Get("Location"), "/admin/login/")
+}
+
+// ThrottleOAuth refuses OAuth callbacks from a locked address and counts
+// every callback that does not log in as a failed login.
+func ThrottleOAuth(aS *services.AuthService, callback func(*services.AuthService, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+
+		if err := aS.CheckLogin(ip, ""); err != nil {
+			http.Redirect(w, r, "/admin/error/429", http.StatusTemporaryRedirect)
+			return
+		}
+
+		recorder := &loginRecorder{ResponseWriter: w}
+		callback(aS, recorder, r)
+
+		if !recorder.loggedIn() {
+			if err := aS.RecordLoginFailure(ip, ""); err != nil {
+				logger.Error(err.Error())
+			}
+		}
+	}
+}
+
+func GetLockouts(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	throttles, err := authService.GetLoginThrottles()
+	if err != nil {
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, throttles)
+}
+
+func ClearLockout(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := authService.ClearLoginThrottle(req.ID); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "login_throttle_not_found" {
+			status = http.StatusNotFound
+		}
+		SendJSONResponse(status, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "lockout_cleared"})
+}
+
+// lockedError unwraps a lockout from the auth service.
+func lockedError(err error) (services.LockedError, bool) {
+	var locked services.LockedError
+	ok := errors.As(err, &locked)
+	return locked, ok
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestClientIPIgnoresSpoofedForwards(t *testing.T) {
+	previous := config.ParsedConfig.Security.LoginLimit
+	t.Cleanup(func() {
+		config.ParsedConfig.Security.LoginLimit = previous
+		TestServices.AuthService.DB.Where("1 = 1").Delete(&models.LoginThrottle{})
+	})
+	config.ParsedConfig.Security.LoginLimit.TrustProxy = true
+	config.ParsedConfig.Security.LoginLimit.ProxyHops = 1
+
+	login := func(spoofed string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/kal-api/auth/jwt/create", strings.NewReader(`{"username": "nobody-`+spoofed+`", "password": "wrong"}`))
+		req.RemoteAddr = "10.0.0.2:443"
+		req.Header.Set("X-Forwarded-For", spoofed+", 198.51.100.20")
+
+		rr := httptest.NewRecorder()
+		CreateJWT(TestServices.AuthService, rr, req)
+		return rr
+	}
+
+	for i := 0; i < config.ParsedConfig.Security.LoginLimit.MaxAttemptsPerIP; i++ {
+		if rr := login(fmt.Sprintf("203.0.113.%d", i)); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected attempt %d to fail as a bad login, got %d %s", i+1, rr.Code, rr.Body.String())
+		}
+	}
+
+	if rr := login("203.0.113.250"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a new leading address to still be throttled, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	config.ParsedConfig.Security.LoginLimit.ProxyHops = 2
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("X-Forwarded-For", "203.0.113.1, 198.51.100.20")
+	req.Header.Add("X-Forwarded-For", "10.0.0.1")
+	if ip := ClientIP(req); ip != "198.51.100.20" {
+		t.Errorf("Expected the address the outer proxy saw, got %s", ip)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendTransferError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "page_not_found", "page_group_not_found", "documentation_not_found":
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+	case "invalid_page_group_id", "page_group_cycle":
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+	case "page_slug_already_exists", "intro_page_cannot_be_moved":
+		SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": err.Error()})
+	default:
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+	}
+}
+
+type transferRequest struct {
+	ID              uint   `json:"id" validate:"required"`
+	DocumentationID uint   `json:"documentationId" validate:"required"`
+	PageGroupID     *uint  `json:"pageGroupId"` // the page group, or for a page group its parent, to put it in
+	Order           *uint  `json:"order"`
+	OnSlugConflict  string `json:"onSlugConflict" validate:"omitempty,oneof=rename fail"`
+}
+
+func transferPage(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request, duplicate bool) {
+	req, err := ValidateRequest[transferRequest](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	result, err := srv.DocService.TransferPage(user, req.ID, req.DocumentationID, req.PageGroupID, req.Order, duplicate, req.OnSlugConflict)
+	if err != nil {
+		sendTransferError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, result)
+}
+
+func transferPageGroup(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request, duplicate bool) {
+	req, err := ValidateRequest[transferRequest](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	result, err := srv.DocService.TransferPageGroup(user, req.ID, req.DocumentationID, req.PageGroupID, req.Order, duplicate, req.OnSlugConflict)
+	if err != nil {
+		sendTransferError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, result)
+}
+
+func MovePage(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	transferPage(srv, w, r, false)
+}
+
+func CopyPage(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	transferPage(srv, w, r, true)
+}
+
+func MovePageGroup(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	transferPageGroup(srv, w, r, false)
+}
+
+func CopyPageGroup(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	transferPageGroup(srv, w, r, true)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/config"
+)
+
+func TestOAuthLoginState(t *testing.T) {
+	previous := config.ParsedConfig.GithubOAuth
+	t.Cleanup(func() { config.ParsedConfig.GithubOAuth = previous })
+	config.ParsedConfig.GithubOAuth.ClientID = "client"
+	config.ParsedConfig.GithubOAuth.ClientSecret = "secret"
+
+	aS := TestServices.AuthService
+
+	rr := httptest.NewRecorder()
+	GithubLogin(aS, rr, httptest.NewRequest("GET", "/kal-api/oauth/github", nil))
+
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	state := location.Query().Get("state")
+	if state == "" || location.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("Expected a state and a PKCE challenge in %s", location)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oauthStateCookie || cookies[0].Value != state || !cookies[0].HttpOnly {
+		t.Fatalf("Expected the state in an HttpOnly cookie, got %+v", cookies)
+	}
+
+	callback := func(cookie string, state string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/kal-api/oauth/github/callback?code=code&state="+url.QueryEscape(state), nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: cookie})
+		}
+
+		rr := httptest.NewRecorder()
+		GithubCallback(aS, rr, req)
+		return rr
+	}
+
+	for name, rr := range map[string]*httptest.ResponseRecorder{
+		"no cookie":       callback("", state),
+		"other cookie":    callback("other", state),
+		"forged state":    callback("forged", "forged"),
+		"no state at all": callback("", ""),
+	} {
+		if rr.Code != http.StatusTemporaryRedirect || rr.Header().Get("Location") != "/admin/error/401" {
+			t.Errorf("%s: expected a redirect to the 401 page, got %d %s", name, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+
+	verifier, err := aS.FinishOAuthLogin("github", state)
+	if err != nil {
+		t.Fatalf("FinishOAuthLogin returned an error: %v", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != location.Query().Get("code_challenge") {
+		t.Errorf("Expected the verifier of the login to match its challenge")
+	}
+
+	if rr := callback(state, state); rr.Header().Get("Location") != "/admin/error/401" {
+		t.Errorf("Expected a used state to be refused, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if _, err := aS.FinishOAuthLogin("github", state); err == nil {
+		t.Errorf("Expected the state to work only once")
+	}
+}
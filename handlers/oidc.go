@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/services"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const oidcStatePath = "/kal-api/oauth/oidc/"
+
+func GetOIDCProviders(aS *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(http.StatusOK, w, aS.OIDCProviders())
+}
+
+func OIDCLogin(aS *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := aS.BeginOIDCLogin(r.Context(), mux.Vars(r)["provider"])
+	if err != nil {
+		if err.Error() == "oidc_provider_not_found" {
+			http.Error(w, "OIDC provider not configured", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to start the OIDC login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	setOAuthStateCookie(w, r, oidcStatePath, state, 600)
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+}
+
+func OIDCCallback(aS *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	state := r.FormValue("state")
+	setOAuthStateCookie(w, r, oidcStatePath, "", -1)
+
+	if errorCode := r.FormValue("error"); errorCode != "" {
+		logger.Warn("OIDC provider refused the login", zap.String("provider", provider), zap.String("error", errorCode))
+		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
+		return
+	}
+
+	if !stateCookieMatches(r, state) {
+		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
+		return
+	}
+
+	email, err := aS.FinishOIDCLogin(r.Context(), provider, state, r.FormValue("code"))
+	if err != nil {
+		logger.Warn("OIDC login failed", zap.String("provider", provider), zap.Error(err))
+		http.Redirect(w, r, "/admin/error/401", http.StatusTemporaryRedirect)
+		return
+	}
+
+	finishOAuthLogin(aS, w, r, email, "oidc")
+}
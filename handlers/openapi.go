@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/services"
+	"github.com/gorilla/mux"
+)
+
+// V2Param is a query parameter of a v2 route.
+type V2Param struct {
+	Name        string
+	Type        string // "string" or "integer"
+	Description string
+}
+
+// V2Route is a route of the v2 API. The routes are registered and described
+// in the OpenAPI document from this one table, so the two cannot drift apart.
+type V2Route struct {
+	Method   string
+	Path     string // relative to /kal-api/v2
+	Summary  string
+	Query    []V2Param
+	Body     interface{} // request body type, if any
+	Response interface{} // response type, or the item type of a list
+	List     bool
+	Status   int // success status
+	Handle   func(*services.ServiceRegistry, http.ResponseWriter, *http.Request)
+}
+
+var (
+	listParams = []V2Param{
+		{Name: "limit", Type: "integer", Description: "Items per page, at most 200"},
+		{Name: "cursor", Type: "string", Description: "nextCursor of the previous page"},
+		{Name: "fields", Type: "string", Description: "Comma-separated fields to return"},
+	}
+	fieldsParam = []V2Param{{Name: "fields", Type: "string", Description: "Comma-separated fields to return"}}
+)
+
+func withParams(params ...[]V2Param) []V2Param {
+	var all []V2Param
+	for _, list := range params {
+		all = append(all, list...)
+	}
+	return all
+}
+
+const (
+	documentationPath = "/documentations/{id}"
+	versionPath       = documentationPath + "/versions/{version}"
+	pagePath          = versionPath + "/pages/{pageId}"
+	pageGroupPath     = versionPath + "/page-groups/{groupId}"
+)
+
+var V2Routes = []V2Route{
+	{Method: "GET", Path: "/documentations", Summary: "List documentations", List: true, Response: V2Documentation{}, Status: http.StatusOK,
+		Query: withParams([]V2Param{{Name: "name", Type: "string", Description: "Only documentations with this name"}}, listParams), Handle: V2ListDocumentations},
+	{Method: "GET", Path: documentationPath, Summary: "Get a documentation", Response: V2Documentation{}, Status: http.StatusOK, Query: fieldsParam, Handle: V2GetDocumentation},
+	{Method: "DELETE", Path: documentationPath, Summary: "Delete a documentation with all its versions", Status: http.StatusNoContent, Handle: V2DeleteDocumentation},
+
+	{Method: "GET", Path: documentationPath + "/versions", Summary: "List the versions of a documentation", List: true, Response: services.VersionDetails{}, Status: http.StatusOK, Query: fieldsParam, Handle: V2ListVersions},
+	{Method: "POST", Path: documentationPath + "/versions", Summary: "Create a version from another", Body: V2VersionInput{}, Response: services.VersionDetails{}, Status: http.StatusCreated, Handle: V2CreateVersion},
+	{Method: "GET", Path: versionPath, Summary: "Get a version", Response: services.VersionDetails{}, Status: http.StatusOK, Query: fieldsParam, Handle: V2GetVersion},
+	{Method: "PATCH", Path: versionPath, Summary: "Rename a version, change its status or pin it as the default", Body: V2VersionInput{}, Response: services.VersionDetails{}, Status: http.StatusOK, Handle: V2UpdateVersion},
+	{Method: "DELETE", Path: versionPath, Summary: "Delete a version", Status: http.StatusNoContent, Handle: V2DeleteVersion},
+
+	{Method: "GET", Path: versionPath + "/pages", Summary: "List the pages of a version, without their content", List: true, Response: V2Page{}, Status: http.StatusOK,
+		Query: withParams([]V2Param{
+			{Name: "pageGroupId", Type: "integer", Description: "Only pages in this page group; 0 for pages outside any"},
+			{Name: "slug", Type: "string", Description: "Only the page with this slug"},
+			{Name: "tagId", Type: "integer", Description: "Only pages with this tag"},
+			{Name: "q", Type: "string", Description: "Only pages whose title contains this"},
+		}, listParams), Handle: V2ListPages},
+	{Method: "POST", Path: versionPath + "/pages", Summary: "Create a page", Body: V2PageInput{}, Response: V2Page{}, Status: http.StatusCreated, Handle: V2CreatePage},
+	{Method: "GET", Path: pagePath, Summary: "Get a page", Response: V2Page{}, Status: http.StatusOK, Query: fieldsParam, Handle: V2GetPage},
+	{Method: "PUT", Path: pagePath, Summary: "Replace a page", Body: V2PageInput{}, Response: V2Page{}, Status: http.StatusOK, Handle: V2UpdatePage},
+	{Method: "PATCH", Path: pagePath, Summary: "Update a page", Body: V2PageInput{}, Response: V2Page{}, Status: http.StatusOK, Handle: V2UpdatePage},
+	{Method: "DELETE", Path: pagePath, Summary: "Move a page to the trash", Status: http.StatusNoContent, Handle: V2DeletePage},
+
+	{Method: "GET", Path: versionPath + "/page-groups", Summary: "List the page groups of a version", List: true, Response: V2PageGroup{}, Status: http.StatusOK,
+		Query: withParams([]V2Param{{Name: "parentId", Type: "integer", Description: "Only page groups in this one; 0 for top-level ones"}}, listParams), Handle: V2ListPageGroups},
+	{Method: "POST", Path: versionPath + "/page-groups", Summary: "Create a page group", Body: V2PageGroupInput{}, Response: V2PageGroup{}, Status: http.StatusCreated, Handle: V2CreatePageGroup},
+	{Method: "GET", Path: pageGroupPath, Summary: "Get a page group", Response: V2PageGroup{}, Status: http.StatusOK, Query: fieldsParam, Handle: V2GetPageGroup},
+	{Method: "PUT", Path: pageGroupPath, Summary: "Replace a page group", Body: V2PageGroupInput{}, Response: V2PageGroup{}, Status: http.StatusOK, Handle: V2UpdatePageGroup},
+	{Method: "PATCH", Path: pageGroupPath, Summary: "Update a page group", Body: V2PageGroupInput{}, Response: V2PageGroup{}, Status: http.StatusOK, Handle: V2UpdatePageGroup},
+	{Method: "DELETE", Path: pageGroupPath, Summary: "Move a page group and everything in it to the trash", Status: http.StatusNoContent, Handle: V2DeletePageGroup},
+}
+
+// RegisterV2Routes adds the v2 routes and the OpenAPI document describing
+// them to a router.
+func RegisterV2Routes(router *mux.Router, srv *services.ServiceRegistry) {
+	for _, route := range V2Routes {
+		handle := route.Handle
+		router.HandleFunc(route.Path, func(w http.ResponseWriter, r *http.Request) { handle(srv, w, r) }).Methods(route.Method)
+	}
+
+	router.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		SendJSONResponse(http.StatusOK, w, OpenAPISpec())
+	}).Methods("GET")
+
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SendProblem(w, r, http.StatusNotFound, "route_not_found", "")
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SendProblem(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "")
+	})
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes a Go type as a JSON schema. Named structs are added to
+// the components and referred to.
+func schemaOf(t reflect.Type, components map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), components)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), components)}
+	case t.Kind() != reflect.Struct:
+		return map[string]interface{}{}
+	}
+
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	if _, done := components[t.Name()]; done {
+		return ref
+	}
+	components[t.Name()] = nil
+
+	properties := make(map[string]interface{})
+	structProperties(t, properties, components)
+	components[t.Name()] = map[string]interface{}{"type": "object", "properties": properties}
+
+	return ref
+}
+
+func structProperties(t reflect.Type, properties map[string]interface{}, components map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			structProperties(field.Type, properties, components)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = schemaOf(field.Type, components)
+	}
+}
+
+// OpenAPISpec is the OpenAPI 3 document of the v2 API.
+func OpenAPISpec() map[string]interface{} {
+	components := make(map[string]interface{})
+	problem := schemaOf(reflect.TypeOf(Problem{}), components)
+
+	problemResponse := map[string]interface{}{
+		"description": "Error",
+		"content":     map[string]interface{}{"application/problem+json": map[string]interface{}{"schema": problem}},
+	}
+
+	paths := make(map[string]interface{})
+	for _, route := range V2Routes {
+		parameters := []interface{}{}
+		for _, match := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+			paramType := "integer"
+			if match[1] == "version" {
+				paramType = "string"
+			}
+			parameters = append(parameters, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": paramType},
+			})
+		}
+		for _, param := range route.Query {
+			parameters = append(parameters, map[string]interface{}{
+				"name": param.Name, "in": "query", "description": param.Description, "schema": map[string]interface{}{"type": param.Type},
+			})
+		}
+
+		success := map[string]interface{}{"description": http.StatusText(route.Status)}
+		if route.Response != nil {
+			schema := schemaOf(reflect.TypeOf(route.Response), components)
+			if route.List {
+				schema = map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"data":       map[string]interface{}{"type": "array", "items": schema},
+						"nextCursor": map[string]interface{}{"type": "string"},
+					},
+				}
+			}
+			success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+		}
+
+		operation := map[string]interface{}{
+			"summary":    route.Summary,
+			"parameters": parameters,
+			"responses": map[string]interface{}{
+				strconv.Itoa(route.Status): success,
+				"default":                  problemResponse,
+			},
+		}
+
+		if route.Body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(route.Body), components)}},
+			}
+		}
+
+		item, _ := paths[route.Path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Kalmia API",
+			"version": "2.0.0",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": "/kal-api/v2"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []interface{}{}}},
+	}
+}
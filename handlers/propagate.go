@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendPropagateError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "page_not_found", "revision_not_found", "documentation_not_found":
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+	case "versions_not_related":
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+	case "revision_conflict":
+		SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": err.Error()})
+	default:
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+	}
+}
+
+func GetPageRevisions(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	revisions, err := service.GetPageRevisions(uint(id))
+	if err != nil {
+		sendPropagateError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, revisions)
+}
+
+func PropagatePageChange(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		PageID           uint   `json:"pageId" validate:"required"`
+		Revision         uint   `json:"revision" validate:"required"`
+		DocumentationIDs []uint `json:"documentationIds" validate:"required,min=1"`
+		DryRun           bool   `json:"dryRun"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	results, err := srv.DocService.PropagatePageChange(user, req.PageID, req.Revision, req.DocumentationIDs, req.DryRun)
+	if err != nil {
+		sendPropagateError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, results)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendRedirectError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "documentation_not_found", "redirect_not_found":
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+	case "invalid_redirect":
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+	case "redirect_already_exists":
+		SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": err.Error()})
+	default:
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+	}
+}
+
+func GetRedirects(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	redirects, err := service.GetRedirects(uint(id))
+	if err != nil {
+		sendRedirectError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, redirects)
+}
+
+func CreateRedirect(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		DocumentationID uint   `json:"documentationId" validate:"required"`
+		From            string `json:"from" validate:"required"`
+		To              string `json:"to" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	redirect, err := service.CreateRedirect(req.DocumentationID, req.From, req.To)
+	if err != nil {
+		sendRedirectError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, redirect)
+}
+
+func EditRedirect(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID   uint   `json:"id" validate:"required"`
+		From string `json:"from" validate:"required"`
+		To   string `json:"to" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	redirect, err := service.EditRedirect(req.ID, req.From, req.To)
+	if err != nil {
+		sendRedirectError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, redirect)
+}
+
+func DeleteRedirect(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := service.DeleteRedirect(req.ID); err != nil {
+		sendRedirectError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "redirect_deleted", "id": fmt.Sprint(req.ID)})
+}
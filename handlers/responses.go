@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+// The response types below are what the v1 endpoints return in place of the
+// models. Password hashes, tokens and documentation credentials have no
+// field here; secrets are write-only and only reported as set or not set.
+
+type UserResponse struct {
+	ID                uint       `json:"id"`
+	Admin             bool       `json:"admin"`
+	Photo             string     `json:"photo,omitempty"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	Permissions       string     `json:"permissions,omitempty"`
+	PasswordSet       bool       `json:"passwordSet"`
+	TwoFactorEnabled  bool       `json:"twoFactorEnabled"`
+	TwoFactorRequired bool       `json:"twoFactorRequired"`
+	CreatedAt         *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt         *time.Time `json:"updatedAt,omitempty"`
+}
+
+// AuthorResponse is a user as shown next to what they wrote or edited.
+type AuthorResponse struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Photo    string `json:"photo,omitempty"`
+}
+
+type PageResponse struct {
+	ID              uint             `json:"id"`
+	AuthorID        uint             `json:"authorId,omitempty"`
+	Author          *AuthorResponse  `json:"author,omitempty"`
+	DocumentationID uint             `json:"documentationId,omitempty"`
+	PageGroupID     *uint            `json:"pageGroupId,omitempty"`
+	Title           string           `json:"title,omitempty"`
+	Slug            string           `json:"slug,omitempty"`
+	Content         string           `json:"content,omitempty"`
+	CreatedAt       *time.Time       `json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time       `json:"updatedAt,omitempty"`
+	Order           *uint            `json:"order,omitempty"`
+	Editors         []AuthorResponse `json:"editors,omitempty"`
+	LastEditorID    *uint            `json:"lastEditorId,omitempty"`
+	IsIntroPage     bool             `json:"isIntroPage,omitempty"`
+	IsPage          bool             `json:"isPage"`
+	Revision        uint             `json:"revision"`
+	Tags            []models.Tag     `json:"tags,omitempty"`
+	models.PageSEO
+}
+
+type PageGroupResponse struct {
+	ID              uint             `json:"id"`
+	DocumentationID uint             `json:"documentationId,omitempty"`
+	ParentID        *uint            `json:"parentId,omitempty"`
+	AuthorID        uint             `json:"authorId,omitempty"`
+	Author          *AuthorResponse  `json:"author,omitempty"`
+	Name            string           `json:"name,omitempty"`
+	Label           string           `json:"label,omitempty"`
+	CreatedAt       *time.Time       `json:"createdAt,omitempty"`
+	UpdatedAt       *time.Time       `json:"updatedAt,omitempty"`
+	Order           *uint            `json:"order,omitempty"`
+	Editors         []AuthorResponse `json:"editors,omitempty"`
+	LastEditorID    *uint            `json:"lastEditorId,omitempty"`
+	Pages           []PageResponse   `json:"pages,omitempty"`
+	IsPageGroup     bool             `json:"isPagGroup"`
+	Revision        uint             `json:"revision"`
+}
+
+type DocumentationResponse struct {
+	ID               uint                `json:"id"`
+	Name             string              `json:"name,omitempty"`
+	Version          string              `json:"version,omitempty"`
+	URL              string              `json:"url,omitempty"`
+	OrganizationName string              `json:"organizationName,omitempty"`
+	ProjectName      string              `json:"projectName,omitempty"`
+	LanderDetails    string              `json:"landerDetails,omitempty"`
+	BaseURL          string              `json:"baseURL,omitempty"`
+	ClonedFrom       *uint               `json:"clonedFrom"`
+	Description      string              `json:"description,omitempty"`
+	Favicon          string              `json:"favicon,omitempty"`
+	MetaImage        string              `json:"metaImage,omitempty"`
+	NavImage         string              `json:"navImage,omitempty"`
+	NavImageDark     string              `json:"navImageDark,omitempty"`
+	CustomCSS        string              `json:"customCSS,omitempty"`
+	RobotsTxt        string              `json:"robotsTxt,omitempty"`
+	FooterLabelLinks string              `json:"footerLabelLinks,omitempty"`
+	MoreLabelLinks   string              `json:"moreLabelLinks,omitempty"`
+	CopyrightText    string              `json:"copyrightText,omitempty"`
+	AuthorID         uint                `json:"authorId,omitempty"`
+	Author           *AuthorResponse     `json:"author,omitempty"`
+	CreatedAt        *time.Time          `json:"createdAt,omitempty"`
+	UpdatedAt        *time.Time          `json:"updatedAt,omitempty"`
+	Editors          []AuthorResponse    `json:"editors,omitempty"`
+	LastEditorID     *uint               `json:"lastEditorId,omitempty"`
+	PageGroups       []PageGroupResponse `json:"pageGroups,omitempty"`
+	Pages            []PageResponse      `json:"pages,omitempty"`
+	RequireAuth      bool                `json:"requireAuth"`
+	GitRepo          string              `json:"gitRepo,omitempty"`
+	GitEmail         string              `json:"gitEmail,omitempty"`
+	GitUser          string              `json:"gitUser,omitempty"`
+	GitPasswordSet   bool                `json:"gitPasswordSet"`
+	GitBranch        string              `json:"gitBranch,omitempty"`
+	TokenSecretSet   bool                `json:"tokenSecretSet"`
+	Locales          string              `json:"locales,omitempty"`
+	DefaultLocale    string              `json:"defaultLocale,omitempty"`
+	Variables        string              `json:"variables,omitempty"`
+	DefaultVersion   bool                `json:"defaultVersion"`
+	Prerelease       bool                `json:"prerelease"`
+	Hidden           bool                `json:"hidden"`
+	Deprecated       bool                `json:"deprecated"`
+	Revision         uint                `json:"revision"`
+}
+
+func userResponse(user models.User) UserResponse {
+	return UserResponse{
+		ID:                user.ID,
+		Admin:             user.Admin,
+		Photo:             user.Photo,
+		Username:          user.Username,
+		Email:             user.Email,
+		Permissions:       user.Permissions,
+		PasswordSet:       user.Password != "",
+		TwoFactorEnabled:  user.TOTPEnabled,
+		TwoFactorRequired: user.TwoFactorRequired,
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
+	}
+}
+
+func userResponses(users []models.User) []UserResponse {
+	responses := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, userResponse(user))
+	}
+	return responses
+}
+
+// authorResponse is nil for an author that was not loaded.
+func authorResponse(user models.User) *AuthorResponse {
+	if user.ID == 0 {
+		return nil
+	}
+
+	return &AuthorResponse{ID: user.ID, Username: user.Username, Email: user.Email, Photo: user.Photo}
+}
+
+func authorResponses(users []models.User) []AuthorResponse {
+	responses := make([]AuthorResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, *authorResponse(user))
+	}
+	return responses
+}
+
+func pageResponse(page models.Page) PageResponse {
+	return PageResponse{
+		ID:              page.ID,
+		AuthorID:        page.AuthorID,
+		Author:          authorResponse(page.Author),
+		DocumentationID: page.DocumentationID,
+		PageGroupID:     page.PageGroupID,
+		Title:           page.Title,
+		Slug:            page.Slug,
+		Content:         page.Content,
+		CreatedAt:       page.CreatedAt,
+		UpdatedAt:       page.UpdatedAt,
+		Order:           page.Order,
+		Editors:         authorResponses(page.Editors),
+		LastEditorID:    page.LastEditorID,
+		IsIntroPage:     page.IsIntroPage,
+		IsPage:          page.IsPage,
+		Revision:        page.Revision,
+		Tags:            page.Tags,
+		PageSEO:         page.PageSEO,
+	}
+}
+
+func pageResponses(pages []models.Page) []PageResponse {
+	responses := make([]PageResponse, 0, len(pages))
+	for _, page := range pages {
+		responses = append(responses, pageResponse(page))
+	}
+	return responses
+}
+
+func pageGroupResponse(group models.PageGroup) PageGroupResponse {
+	return PageGroupResponse{
+		ID:              group.ID,
+		DocumentationID: group.DocumentationID,
+		ParentID:        group.ParentID,
+		AuthorID:        group.AuthorID,
+		Author:          authorResponse(group.Author),
+		Name:            group.Name,
+		Label:           group.Label,
+		CreatedAt:       group.CreatedAt,
+		UpdatedAt:       group.UpdatedAt,
+		Order:           group.Order,
+		Editors:         authorResponses(group.Editors),
+		LastEditorID:    group.LastEditorID,
+		Pages:           pageResponses(group.Pages),
+		IsPageGroup:     group.IsPageGroup,
+		Revision:        group.Revision,
+	}
+}
+
+func documentationResponse(doc models.Documentation) DocumentationResponse {
+	groups := make([]PageGroupResponse, 0, len(doc.PageGroups))
+	for _, group := range doc.PageGroups {
+		groups = append(groups, pageGroupResponse(group))
+	}
+
+	return DocumentationResponse{
+		ID:               doc.ID,
+		Name:             doc.Name,
+		Version:          doc.Version,
+		URL:              doc.URL,
+		OrganizationName: doc.OrganizationName,
+		ProjectName:      doc.ProjectName,
+		LanderDetails:    doc.LanderDetails,
+		BaseURL:          doc.BaseURL,
+		ClonedFrom:       doc.ClonedFrom,
+		Description:      doc.Description,
+		Favicon:          doc.Favicon,
+		MetaImage:        doc.MetaImage,
+		NavImage:         doc.NavImage,
+		NavImageDark:     doc.NavImageDark,
+		CustomCSS:        doc.CustomCSS,
+		RobotsTxt:        doc.RobotsTxt,
+		FooterLabelLinks: doc.FooterLabelLinks,
+		MoreLabelLinks:   doc.MoreLabelLinks,
+		CopyrightText:    doc.CopyrightText,
+		AuthorID:         doc.AuthorID,
+		Author:           authorResponse(doc.Author),
+		CreatedAt:        doc.CreatedAt,
+		UpdatedAt:        doc.UpdatedAt,
+		Editors:          authorResponses(doc.Editors),
+		LastEditorID:     doc.LastEditorID,
+		PageGroups:       groups,
+		Pages:            pageResponses(doc.Pages),
+		RequireAuth:      doc.RequireAuth,
+		GitRepo:          doc.GitRepo,
+		GitEmail:         doc.GitEmail,
+		GitUser:          doc.GitUser,
+		GitPasswordSet:   doc.GitPassword != "",
+		GitBranch:        doc.GitBranch,
+		TokenSecretSet:   doc.TokenSecret != "",
+		Locales:          doc.Locales,
+		DefaultLocale:    doc.DefaultLocale,
+		Variables:        doc.Variables,
+		DefaultVersion:   doc.DefaultVersion,
+		Prerelease:       doc.Prerelease,
+		Hidden:           doc.Hidden,
+		Deprecated:       doc.Deprecated,
+		Revision:         doc.Revision,
+	}
+}
+
+func documentationResponses(docs []models.Documentation) []DocumentationResponse {
+	responses := make([]DocumentationResponse, 0, len(docs))
+	for _, doc := range docs {
+		responses = append(responses, documentationResponse(doc))
+	}
+	return responses
+}
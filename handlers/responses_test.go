@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"github.com/gorilla/mux"
+)
+
+func TestResponsesHaveNoSecrets(t *testing.T) {
+	db := TestServices.DocService.DB
+
+	tokenDetails, err := TestServices.AuthService.CreateJWT("admin", "admin")
+	if err != nil {
+		t.Fatalf("CreateJWT returned an error: %v", err)
+	}
+	token := tokenDetails["token"].(string)
+
+	var admin models.User
+	if err := db.Preload("Tokens").Where("username = ?", "admin").First(&admin).Error; err != nil {
+		t.Fatalf("Failed to get the admin: %v", err)
+	}
+
+	doc := models.Documentation{
+		Name:        "Secret Doc",
+		Version:     "1.0.0",
+		BaseURL:     "/secret-doc",
+		AuthorID:    admin.ID,
+		GitUser:     "deployer",
+		GitPassword: "git-password-secret",
+		TokenSecret: "token-secret-value",
+		Editors:     []models.User{admin},
+	}
+	if err := db.Create(&doc).Error; err != nil {
+		t.Fatalf("Failed to create documentation: %v", err)
+	}
+
+	group := models.PageGroup{DocumentationID: doc.ID, AuthorID: admin.ID, Name: "group"}
+	if err := db.Create(&group).Error; err != nil {
+		t.Fatalf("Failed to create page group: %v", err)
+	}
+
+	page := models.Page{DocumentationID: doc.ID, PageGroupID: &group.ID, AuthorID: admin.ID, Title: "Page", Slug: "/page", Content: "[]"}
+	if err := db.Create(&page).Error; err != nil {
+		t.Fatalf("Failed to create page: %v", err)
+	}
+
+	secrets := []string{admin.Password, token, doc.GitPassword, doc.TokenSecret}
+	for _, stored := range admin.Tokens {
+		secrets = append(secrets, stored.Token)
+	}
+
+	v2 := mux.NewRouter()
+	RegisterV2Routes(v2.PathPrefix("/kal-api/v2").Subrouter(), TestServices)
+
+	docs := TestServices.DocService
+	auth := TestServices.AuthService
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		handler http.HandlerFunc
+		marker  string // expected in the body
+	}{
+		{"users", "GET", "/kal-api/auth/users", "", func(w http.ResponseWriter, r *http.Request) { GetUsers(auth, w, r) }, `"passwordSet":true`},
+		{"user", "POST", "/kal-api/auth/user", fmt.Sprintf(`{"id": %d}`, admin.ID), func(w http.ResponseWriter, r *http.Request) { GetUser(auth, w, r) }, `"passwordSet":true`},
+		{"documentations", "GET", "/kal-api/docs/documentations", "", func(w http.ResponseWriter, r *http.Request) { GetDocumentations(docs, w, r) }, `"gitPasswordSet":true`},
+		{"documentation", "POST", "/kal-api/docs/documentation", fmt.Sprintf(`{"id": %d}`, doc.ID), func(w http.ResponseWriter, r *http.Request) { GetDocumentation(docs, w, r) }, `"tokenSecretSet":true`},
+		{"pages", "GET", "/kal-api/docs/pages", "", func(w http.ResponseWriter, r *http.Request) { GetPages(docs, w, r) }, `"username":"admin"`},
+		{"page", "POST", "/kal-api/docs/page", fmt.Sprintf(`{"id": %d}`, page.ID), func(w http.ResponseWriter, r *http.Request) { GetPage(docs, w, r) }, `"username":"admin"`},
+		{"page groups", "GET", "/kal-api/docs/page-groups", "", func(w http.ResponseWriter, r *http.Request) { GetPageGroups(docs, w, r) }, `"username":"admin"`},
+		{"page group", "POST", "/kal-api/docs/page-group", fmt.Sprintf(`{"id": %d}`, group.ID), func(w http.ResponseWriter, r *http.Request) { GetPageGroup(docs, w, r) }, `"username":"admin"`},
+		{"v2 documentations", "GET", "/kal-api/v2/documentations", "", v2.ServeHTTP, `"gitPasswordSet":true`},
+		{"v2 documentation", "GET", fmt.Sprintf("/kal-api/v2/documentations/%d", doc.ID), "", v2.ServeHTTP, `"tokenSecretSet":true`},
+		{"v2 page", "GET", fmt.Sprintf("/kal-api/v2/documentations/%d/versions/1.0.0/pages/%d", doc.ID, page.ID), "", v2.ServeHTTP, `"slug":"/page"`},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+
+		c.handler(rec, req)
+
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d: %s", c.name, rec.Code, body)
+			continue
+		}
+		if !strings.Contains(body, c.marker) {
+			t.Errorf("%s: expected %s in %s", c.name, c.marker, body)
+		}
+		for _, secret := range secrets {
+			if secret != "" && strings.Contains(body, secret) {
+				t.Errorf("%s: response contains secret %q", c.name, secret)
+			}
+		}
+		for _, field := range []string{`"password"`, `"tokens"`, `"gitPassword"`, `"tokenSecret"`} {
+			if strings.Contains(body, field) {
+				t.Errorf("%s: response contains the %s field", c.name, field)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendSnippetError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "documentation_not_found", "snippet_not_found":
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+	case "invalid_snippet_content":
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+	case "global_snippet_requires_admin":
+		SendJSONResponse(http.StatusForbidden, w, map[string]string{"status": "error", "message": err.Error()})
+	case "snippet_in_use":
+		SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": err.Error()})
+	default:
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+	}
+}
+
+func GetSnippets(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	var docId uint64
+	if id := r.URL.Query().Get("documentationId"); id != "" {
+		var err error
+		docId, err = strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+			return
+		}
+	}
+
+	snippets, err := service.GetSnippets(uint(docId))
+	if err != nil {
+		sendSnippetError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, snippets)
+}
+
+func GetSnippet(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	snippet, err := service.GetSnippet(uint(id))
+	if err != nil {
+		sendSnippetError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, snippet)
+}
+
+func GetSnippetUsage(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	usage, err := service.GetSnippetUsage(uint(id))
+	if err != nil {
+		sendSnippetError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, usage)
+}
+
+func CreateSnippet(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		DocumentationID uint   `json:"documentationId"`
+		Name            string `json:"name" validate:"required"`
+		Content         string `json:"content" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	snippet, err := srv.DocService.CreateSnippet(user, req.DocumentationID, req.Name, req.Content)
+	if err != nil {
+		sendSnippetError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, snippet)
+}
+
+func EditSnippet(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID      uint   `json:"id" validate:"required"`
+		Name    string `json:"name" validate:"required"`
+		Content string `json:"content" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	snippet, err := srv.DocService.EditSnippet(user, req.ID, req.Name, req.Content)
+	if err != nil {
+		sendSnippetError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, snippet)
+}
+
+func DeleteSnippet(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	if err := srv.DocService.DeleteSnippet(user, req.ID); err != nil {
+		sendSnippetError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "snippet_deleted", "id": fmt.Sprint(req.ID)})
+}
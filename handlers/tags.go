@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendTagError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "documentation_not_found", "page_not_found", "tag_not_found":
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+	case "invalid_tag_name":
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+	case "tag_already_exists":
+		SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": err.Error()})
+	default:
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+	}
+}
+
+func GetTags(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	tags, err := service.GetTags(uint(id))
+	if err != nil {
+		sendTagError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, tags)
+}
+
+func CreateTag(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		DocumentationID uint   `json:"documentationId" validate:"required"`
+		Name            string `json:"name" validate:"required"`
+		Category        string `json:"category"`
+		Description     string `json:"description"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	tag, err := service.CreateTag(req.DocumentationID, req.Name, req.Category, req.Description)
+	if err != nil {
+		sendTagError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, tag)
+}
+
+func EditTag(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID          uint   `json:"id" validate:"required"`
+		Name        string `json:"name" validate:"required"`
+		Category    string `json:"category"`
+		Description string `json:"description"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	tag, err := service.EditTag(req.ID, req.Name, req.Category, req.Description)
+	if err != nil {
+		sendTagError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, tag)
+}
+
+func DeleteTag(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := service.DeleteTag(req.ID); err != nil {
+		sendTagError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "tag_deleted", "id": fmt.Sprint(req.ID)})
+}
+
+func SetPageTags(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID     uint   `json:"id" validate:"required"`
+		TagIDs []uint `json:"tagIds"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := service.SetPageTags(req.ID, req.TagIDs); err != nil {
+		sendTagError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "page_tags_updated", "id": fmt.Sprint(req.ID)})
+}
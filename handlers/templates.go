@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendTemplateError(w http.ResponseWriter, err error) {
+	switch err.Error() {
+	case "template_not_found", "page_not_found", "documentation_not_found":
+		SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+	case "invalid_template_kind", "invalid_template_content", "invalid_page_type", "invalid_canonical_url":
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+	case "builtin_template_cannot_be_deleted":
+		SendJSONResponse(http.StatusForbidden, w, map[string]string{"status": "error", "message": err.Error()})
+	default:
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+	}
+}
+
+func GetTemplates(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	templates, err := service.GetTemplates(r.URL.Query().Get("kind"))
+	if err != nil {
+		sendTemplateError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, templates)
+}
+
+func GetTemplate(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+		return
+	}
+
+	template, err := service.GetTemplate(uint(id))
+	if err != nil {
+		sendTemplateError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, template)
+}
+
+func SavePageAsTemplate(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		PageID      uint   `json:"pageId" validate:"required"`
+		Name        string `json:"name" validate:"required"`
+		Description string `json:"description"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	template, err := srv.DocService.SavePageAsTemplate(user, req.PageID, req.Name, req.Description)
+	if err != nil {
+		sendTemplateError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, template)
+}
+
+func SaveDocumentationAsTemplate(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		DocumentationID uint   `json:"documentationId" validate:"required"`
+		Name            string `json:"name" validate:"required"`
+		Description     string `json:"description"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	template, err := srv.DocService.SaveDocumentationAsTemplate(user, req.DocumentationID, req.Name, req.Description)
+	if err != nil {
+		sendTemplateError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, template)
+}
+
+func DeleteTemplate(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := service.DeleteTemplate(req.ID); err != nil {
+		sendTemplateError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "template_deleted", "id": fmt.Sprint(req.ID)})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func GetTrashItems(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	var documentationID uint
+
+	if idStr := r.URL.Query().Get("documentationId"); idStr != "" {
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": "invalid id format"})
+			return
+		}
+		documentationID = uint(id)
+	}
+
+	items, err := service.GetTrashItems(documentationID)
+	if err != nil {
+		SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, items)
+}
+
+func RestoreTrashItem(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	item, renamed, err := service.RestoreTrashItem(req.ID)
+	if err != nil {
+		switch err.Error() {
+		case "trash_item_not_found":
+			SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+		case "documentation_not_found":
+			SendJSONResponse(http.StatusConflict, w, map[string]string{"status": "error", "message": err.Error()})
+		default:
+			SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		}
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]interface{}{
+		"status":   "success",
+		"message":  "trash_item_restored",
+		"itemType": item.ItemType,
+		"id":       fmt.Sprint(item.ItemID),
+		"renamed":  renamed,
+	})
+}
+
+func DeleteTrashItem(service *services.DocService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	err = service.DeleteTrashItem(req.ID)
+	if err != nil {
+		switch err.Error() {
+		case "trash_item_not_found":
+			SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+		default:
+			SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		}
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "trash_item_deleted", "id": fmt.Sprint(req.ID)})
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"net/http"
+
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func sendTwoFactorError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch err.Error() {
+	case "invalid_two_factor_code", "invalid_or_expired_challenge":
+		status = http.StatusUnauthorized
+	case "two_factor_already_enabled", "two_factor_not_enabled", "two_factor_not_started", "two_factor_required":
+		status = http.StatusBadRequest
+	case "user_not_found":
+		status = http.StatusNotFound
+	}
+
+	SendJSONResponse(status, w, map[string]string{"status": "error", "message": err.Error()})
+}
+
+// tokenUser is the user the request is authenticated as.
+func tokenUser(authService *services.AuthService, w http.ResponseWriter, r *http.Request) (uint, bool) {
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_token"})
+		return 0, false
+	}
+
+	user, err := authService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_token"})
+		return 0, false
+	}
+
+	return user.ID, true
+}
+
+func EnrollChallenge(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Challenge string `json:"challenge" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	enrolment, err := authService.BeginChallengeEnrolment(req.Challenge)
+	if err != nil {
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "secret": enrolment["secret"], "uri": enrolment["uri"]})
+}
+
+// VerifyChallenge is the second step of a login. Wrong codes count as
+// failed logins of the account.
+func VerifyChallenge(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Challenge string `json:"challenge" validate:"required"`
+		Code      string `json:"code" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	user, err := authService.ChallengeUser(req.Challenge)
+	if err != nil {
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	ip := ClientIP(r)
+	if err := authService.CheckLogin(ip, user.Username); err != nil {
+		if locked, ok := lockedError(err); ok {
+			sendLocked(w, locked)
+			return
+		}
+	}
+
+	tokenDetails, err := authService.VerifyTwoFactor(req.Challenge, req.Code)
+	if err != nil {
+		if err.Error() == "invalid_two_factor_code" {
+			if err := authService.RecordLoginFailure(ip, user.Username); err != nil {
+				logger.Error(err.Error())
+			}
+		}
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	if err := authService.RecordLoginSuccess(user.Username); err != nil {
+		logger.Error(err.Error())
+	}
+
+	tokenDetails["status"] = "success"
+
+	SendJSONResponse(http.StatusOK, w, tokenDetails)
+}
+
+func BeginTOTPEnrolment(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	userID, ok := tokenUser(authService, w, r)
+	if !ok {
+		return
+	}
+
+	enrolment, err := authService.BeginTOTPEnrolment(userID)
+	if err != nil {
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "secret": enrolment["secret"], "uri": enrolment["uri"]})
+}
+
+func ConfirmTOTPEnrolment(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Code string `json:"code" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	userID, ok := tokenUser(authService, w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := authService.ConfirmTOTPEnrolment(userID, req.Code)
+	if err != nil {
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]interface{}{"status": "success", "recoveryCodes": codes})
+}
+
+func DisableTOTP(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Code string `json:"code" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	userID, ok := tokenUser(authService, w, r)
+	if !ok {
+		return
+	}
+
+	if err := authService.DisableTOTP(userID, req.Code); err != nil {
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "two_factor_disabled"})
+}
+
+func RegenerateRecoveryCodes(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Code string `json:"code" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	userID, ok := tokenUser(authService, w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := authService.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]interface{}{"status": "success", "recoveryCodes": codes})
+}
+
+func ResetTwoFactor(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID uint `json:"id" validate:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := authService.ResetTwoFactor(req.ID); err != nil {
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "two_factor_reset"})
+}
+
+func RequireTwoFactor(authService *services.AuthService, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID       uint `json:"id" validate:"required"`
+		Required bool `json:"required"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	if err := authService.SetTwoFactorRequired(req.ID, req.Required); err != nil {
+		sendTwoFactorError(w, err)
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success"})
+}
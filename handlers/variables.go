@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"git.difuse.io/Difuse/kalmia/services"
+)
+
+func SetDocumentationVariables(srv *services.ServiceRegistry, w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		ID        uint              `json:"id" validate:"required"`
+		Variables map[string]string `json:"variables"`
+	}
+
+	req, err := ValidateRequest[Request](w, r)
+	if err != nil {
+		return
+	}
+
+	token, err := GetTokenFromHeader(r)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	user, err := srv.AuthService.GetUserFromToken(token)
+	if err != nil {
+		SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"status": "error", "message": "invalid_request"})
+		return
+	}
+
+	if err := srv.DocService.SetDocumentationVariables(user, req.ID, req.Variables); err != nil {
+		switch err.Error() {
+		case "documentation_not_found":
+			SendJSONResponse(http.StatusNotFound, w, map[string]string{"status": "error", "message": err.Error()})
+		case "invalid_variable_name":
+			SendJSONResponse(http.StatusBadRequest, w, map[string]string{"status": "error", "message": err.Error()})
+		default:
+			SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"status": "error", "message": err.Error()})
+		}
+		return
+	}
+
+	SendJSONResponse(http.StatusOK, w, map[string]string{"status": "success", "message": "documentation_variables_updated", "id": fmt.Sprint(req.ID)})
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"embed"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"git.difuse.io/Difuse/kalmia/cmd"
@@ -19,18 +21,33 @@ import (
 	muxHandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 //go:embed web/build
 var adminFS embed.FS
 
 func main() {
-	cfgPath := cmd.ParseFlags()
-	cfg := config.ParseConfig(cfgPath)
+	flags := cmd.ParseFlags()
+	cfg := config.ParseConfig(flags.ConfigPath)
 	logger.InitializeLogger(cfg.Environment, cfg.LogLevel, cfg.DataPath)
 
 	/* Setup database */
 	d := db.SetupDatabase(cfg.Environment, cfg.Database, cfg.DataPath)
+	if err := db.SetupSecrets(d, cfg); err != nil {
+		logger.Panic("failed to set up encrypted credentials", zap.Error(err))
+	}
+
+	if flags.RotateMasterKey {
+		rotateMasterKey(d, cfg)
+		return
+	}
+
+	if flags.EncryptSecret {
+		encryptSecret()
+		return
+	}
+
 	db.SetupBasicData(d, cfg.Admins)
 
 	db.InitCache()
@@ -38,19 +55,33 @@ func main() {
 	serviceRegistry := services.NewServiceRegistry(d, cfg.LogSubCmd, cfg.Secret)
 	authSrvc := serviceRegistry.AuthService
 	docSrvc := serviceRegistry.DocService
+	mailSrvc := serviceRegistry.MailService
+
+	if err := docSrvc.EnsureBuiltinTemplates(); err != nil {
+		logger.Error("failed to create built-in templates", zap.Error(err))
+	}
 
 	go func() {
 		if err := docSrvc.StartupCheck(); err != nil {
 			logger.Error("doc service failed startup check", zap.Error(err))
 		}
-		// start delete job and build job process every 10 seconds
+		// start delete job, trash purge job and build job process every 10 seconds
 		for {
 			docSrvc.DeleteJob()
+			docSrvc.TrashPurgeJob()
 			docSrvc.BuildJob()
 			time.Sleep(10 * time.Second)
 		}
 	}()
 
+	// emails are sent apart from builds, which can take a while
+	go func() {
+		for {
+			mailSrvc.SendJob()
+			time.Sleep(10 * time.Second)
+		}
+	}()
+
 	/* Setup router */
 	router := mux.NewRouter()
 	router.Use(middleware.RecoverWithLog(logger.Logger))
@@ -71,12 +102,15 @@ func main() {
 
 	oAuthRouter := kRouter.PathPrefix("/oauth").Subrouter()
 	oAuthRouter.HandleFunc("/github", func(w http.ResponseWriter, r *http.Request) { handlers.GithubLogin(authSrvc, w, r) }).Methods("GET")
-	oAuthRouter.HandleFunc("/github/callback", func(w http.ResponseWriter, r *http.Request) { handlers.GithubCallback(authSrvc, w, r) }).Methods("GET")
+	oAuthRouter.HandleFunc("/github/callback", handlers.ThrottleOAuth(authSrvc, handlers.GithubCallback)).Methods("GET")
 	oAuthRouter.HandleFunc("/microsoft", func(w http.ResponseWriter, r *http.Request) { handlers.MicrosoftLogin(authSrvc, w, r) }).Methods("GET")
-	oAuthRouter.HandleFunc("/microsoft/callback", func(w http.ResponseWriter, r *http.Request) { handlers.MicrosoftCallback(authSrvc, w, r) }).Methods("GET")
+	oAuthRouter.HandleFunc("/microsoft/callback", handlers.ThrottleOAuth(authSrvc, handlers.MicrosoftCallback)).Methods("GET")
 	oAuthRouter.HandleFunc("/google", func(w http.ResponseWriter, r *http.Request) { handlers.GoogleLogin(authSrvc, w, r) }).Methods("GET")
-	oAuthRouter.HandleFunc("/google/callback", func(w http.ResponseWriter, r *http.Request) { handlers.GoogleCallback(authSrvc, w, r) }).Methods("GET")
+	oAuthRouter.HandleFunc("/google/callback", handlers.ThrottleOAuth(authSrvc, handlers.GoogleCallback)).Methods("GET")
 	oAuthRouter.HandleFunc("/providers", func(w http.ResponseWriter, r *http.Request) { handlers.GetOAuthProviders(authSrvc, w, r) }).Methods("GET")
+	oAuthRouter.HandleFunc("/oidc", func(w http.ResponseWriter, r *http.Request) { handlers.GetOIDCProviders(authSrvc, w, r) }).Methods("GET")
+	oAuthRouter.HandleFunc("/oidc/{provider}", func(w http.ResponseWriter, r *http.Request) { handlers.OIDCLogin(authSrvc, w, r) }).Methods("GET")
+	oAuthRouter.HandleFunc("/oidc/{provider}/callback", handlers.ThrottleOAuth(authSrvc, handlers.OIDCCallback)).Methods("GET")
 
 	authRouter := kRouter.PathPrefix("/auth").Subrouter()
 	authRouter.Use(middleware.EnsureAuthenticated(authSrvc))
@@ -95,6 +129,26 @@ func main() {
 		handlers.UploadAssetsFile(serviceRegistry, d, w, r, config.ParsedConfig)
 	}).Methods("POST")
 
+	authRouter.HandleFunc("/user/invite", func(w http.ResponseWriter, r *http.Request) { handlers.InviteUser(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/invite/accept", func(w http.ResponseWriter, r *http.Request) { handlers.AcceptInvitation(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/password/forgot", func(w http.ResponseWriter, r *http.Request) { handlers.ForgotPassword(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/password/reset", func(w http.ResponseWriter, r *http.Request) { handlers.ResetPassword(authSrvc, w, r) }).Methods("POST")
+
+	authRouter.HandleFunc("/2fa/challenge/enroll", func(w http.ResponseWriter, r *http.Request) { handlers.EnrollChallenge(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/2fa/challenge/verify", func(w http.ResponseWriter, r *http.Request) { handlers.VerifyChallenge(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/2fa/enroll", func(w http.ResponseWriter, r *http.Request) { handlers.BeginTOTPEnrolment(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/2fa/confirm", func(w http.ResponseWriter, r *http.Request) { handlers.ConfirmTOTPEnrolment(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/2fa/disable", func(w http.ResponseWriter, r *http.Request) { handlers.DisableTOTP(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/2fa/recovery-codes", func(w http.ResponseWriter, r *http.Request) { handlers.RegenerateRecoveryCodes(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/user/2fa/reset", func(w http.ResponseWriter, r *http.Request) { handlers.ResetTwoFactor(authSrvc, w, r) }).Methods("POST")
+	authRouter.HandleFunc("/user/2fa/require", func(w http.ResponseWriter, r *http.Request) { handlers.RequireTwoFactor(authSrvc, w, r) }).Methods("POST")
+
+	authRouter.HandleFunc("/outbox", func(w http.ResponseWriter, r *http.Request) { handlers.GetOutbox(mailSrvc, w, r) }).Methods("GET")
+	authRouter.HandleFunc("/outbox/retry", func(w http.ResponseWriter, r *http.Request) { handlers.RetryEmail(mailSrvc, w, r) }).Methods("POST")
+
+	authRouter.HandleFunc("/lockouts", func(w http.ResponseWriter, r *http.Request) { handlers.GetLockouts(authSrvc, w, r) }).Methods("GET")
+	authRouter.HandleFunc("/lockout/clear", func(w http.ResponseWriter, r *http.Request) { handlers.ClearLockout(authSrvc, w, r) }).Methods("POST")
+
 	authRouter.HandleFunc("/jwt/create", func(w http.ResponseWriter, r *http.Request) { handlers.CreateJWT(authSrvc, w, r) }).Methods("POST")
 	authRouter.HandleFunc("/jwt/refresh", func(w http.ResponseWriter, r *http.Request) { handlers.RefreshJWT(authSrvc, w, r) }).Methods("POST")
 	authRouter.HandleFunc("/jwt/validate", func(w http.ResponseWriter, r *http.Request) { handlers.ValidateJWT(authSrvc, w, r) }).Methods("POST")
@@ -106,10 +160,46 @@ func main() {
 	docsRouter.HandleFunc("/documentation", func(w http.ResponseWriter, r *http.Request) { handlers.GetDocumentation(docSrvc, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/documentation/create", func(w http.ResponseWriter, r *http.Request) { handlers.CreateDocumentation(serviceRegistry, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/documentation/edit", func(w http.ResponseWriter, r *http.Request) { handlers.EditDocumentation(serviceRegistry, w, r) }).Methods("POST")
-	docsRouter.HandleFunc("/documentation/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeleteDocumentation(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeleteDocumentation(serviceRegistry, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/documentation/version", func(w http.ResponseWriter, r *http.Request) { handlers.CreateDocumentationVersion(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/versions", func(w http.ResponseWriter, r *http.Request) { handlers.GetVersions(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/documentation/version/rename", func(w http.ResponseWriter, r *http.Request) { handlers.RenameVersion(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/version/status", func(w http.ResponseWriter, r *http.Request) { handlers.SetVersionStatus(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/version/default", func(w http.ResponseWriter, r *http.Request) { handlers.SetDefaultVersion(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/version/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeleteVersion(serviceRegistry, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/documentation/reorder-bulk", func(w http.ResponseWriter, r *http.Request) { handlers.BulkReorderPageOrPageGroup(docSrvc, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/documentation/root-parent-id", func(w http.ResponseWriter, r *http.Request) { handlers.GetRootParentId(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/documentation/locales", func(w http.ResponseWriter, r *http.Request) { handlers.SetDocumentationLocales(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/variables", func(w http.ResponseWriter, r *http.Request) { handlers.SetDocumentationVariables(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/compare", func(w http.ResponseWriter, r *http.Request) { handlers.CompareVersions(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/documentation/translations/export", func(w http.ResponseWriter, r *http.Request) { handlers.ExportTranslations(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/documentation/translations/import", func(w http.ResponseWriter, r *http.Request) { handlers.ImportTranslations(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/link-check", func(w http.ResponseWriter, r *http.Request) { handlers.StartLinkCheck(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/link-report", func(w http.ResponseWriter, r *http.Request) { handlers.GetLinkReport(docSrvc, w, r) }).Methods("GET")
+
+	docsRouter.HandleFunc("/documentation/tags", func(w http.ResponseWriter, r *http.Request) { handlers.GetTags(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/documentation/tag/create", func(w http.ResponseWriter, r *http.Request) { handlers.CreateTag(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/tag/edit", func(w http.ResponseWriter, r *http.Request) { handlers.EditTag(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/tag/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeleteTag(docSrvc, w, r) }).Methods("POST")
+
+	docsRouter.HandleFunc("/snippets", func(w http.ResponseWriter, r *http.Request) { handlers.GetSnippets(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/snippet", func(w http.ResponseWriter, r *http.Request) { handlers.GetSnippet(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/snippet/usage", func(w http.ResponseWriter, r *http.Request) { handlers.GetSnippetUsage(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/snippet/create", func(w http.ResponseWriter, r *http.Request) { handlers.CreateSnippet(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/snippet/edit", func(w http.ResponseWriter, r *http.Request) { handlers.EditSnippet(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/snippet/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeleteSnippet(serviceRegistry, w, r) }).Methods("POST")
+
+	docsRouter.HandleFunc("/templates", func(w http.ResponseWriter, r *http.Request) { handlers.GetTemplates(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/template", func(w http.ResponseWriter, r *http.Request) { handlers.GetTemplate(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/template/from-page", func(w http.ResponseWriter, r *http.Request) { handlers.SavePageAsTemplate(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/template/from-documentation", func(w http.ResponseWriter, r *http.Request) { handlers.SaveDocumentationAsTemplate(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/template/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeleteTemplate(docSrvc, w, r) }).Methods("POST")
+
+	// redirect rules are admin only, so they are left out of the route permissions
+	docsRouter.HandleFunc("/documentation/redirects", func(w http.ResponseWriter, r *http.Request) { handlers.GetRedirects(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/documentation/redirect/create", func(w http.ResponseWriter, r *http.Request) { handlers.CreateRedirect(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/redirect/edit", func(w http.ResponseWriter, r *http.Request) { handlers.EditRedirect(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/documentation/redirect/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeleteRedirect(docSrvc, w, r) }).Methods("POST")
 
 	importRouter := docsRouter.PathPrefix("/import").Subrouter()
 	importRouter.Use(middleware.EnsureAuthenticated(authSrvc))
@@ -117,17 +207,43 @@ func main() {
 		handlers.ImportGitbook(serviceRegistry, w, r, config.ParsedConfig)
 	}).Methods("POST")
 
+	docsRouter.HandleFunc("/batch", func(w http.ResponseWriter, r *http.Request) { handlers.RunBatch(serviceRegistry, w, r) }).Methods("POST")
+
 	docsRouter.HandleFunc("/pages", func(w http.ResponseWriter, r *http.Request) { handlers.GetPages(docSrvc, w, r) }).Methods("GET")
 	docsRouter.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) { handlers.GetPage(docSrvc, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/page/create", func(w http.ResponseWriter, r *http.Request) { handlers.CreatePage(serviceRegistry, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/page/edit", func(w http.ResponseWriter, r *http.Request) { handlers.EditPage(serviceRegistry, w, r) }).Methods("POST")
-	docsRouter.HandleFunc("/page/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeletePage(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeletePage(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page/collab/ticket", func(w http.ResponseWriter, r *http.Request) { handlers.CollabTicket(serviceRegistry, w, r) }).Methods("POST")
+	// the WebSocket authenticates with a ticket from /page/collab/ticket instead of the token
+	docsRouter.HandleFunc("/page/collab", func(w http.ResponseWriter, r *http.Request) { handlers.PageCollab(serviceRegistry, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/page/tags", func(w http.ResponseWriter, r *http.Request) { handlers.SetPageTags(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page/revisions", func(w http.ResponseWriter, r *http.Request) { handlers.GetPageRevisions(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/page/propagate", func(w http.ResponseWriter, r *http.Request) { handlers.PropagatePageChange(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page/move", func(w http.ResponseWriter, r *http.Request) { handlers.MovePage(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page/copy", func(w http.ResponseWriter, r *http.Request) { handlers.CopyPage(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page/translations", func(w http.ResponseWriter, r *http.Request) { handlers.GetPageTranslations(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page/translation/edit", func(w http.ResponseWriter, r *http.Request) { handlers.SavePageTranslation(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page/translation/status", func(w http.ResponseWriter, r *http.Request) { handlers.SetPageTranslationStatus(docSrvc, w, r) }).Methods("POST")
 
 	docsRouter.HandleFunc("/page-groups", func(w http.ResponseWriter, r *http.Request) { handlers.GetPageGroups(docSrvc, w, r) }).Methods("GET")
 	docsRouter.HandleFunc("/page-group", func(w http.ResponseWriter, r *http.Request) { handlers.GetPageGroup(docSrvc, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/page-group/create", func(w http.ResponseWriter, r *http.Request) { handlers.CreatePageGroup(serviceRegistry, w, r) }).Methods("POST")
 	docsRouter.HandleFunc("/page-group/edit", func(w http.ResponseWriter, r *http.Request) { handlers.EditPageGroup(serviceRegistry, w, r) }).Methods("POST")
-	docsRouter.HandleFunc("/page-group/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeletePageGroup(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page-group/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeletePageGroup(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page-group/move", func(w http.ResponseWriter, r *http.Request) { handlers.MovePageGroup(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page-group/copy", func(w http.ResponseWriter, r *http.Request) { handlers.CopyPageGroup(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page-group/translations", func(w http.ResponseWriter, r *http.Request) { handlers.GetPageGroupTranslations(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page-group/translation/edit", func(w http.ResponseWriter, r *http.Request) { handlers.SavePageGroupTranslation(serviceRegistry, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/page-group/translation/status", func(w http.ResponseWriter, r *http.Request) { handlers.SetPageGroupTranslationStatus(docSrvc, w, r) }).Methods("POST")
+
+	docsRouter.HandleFunc("/trash", func(w http.ResponseWriter, r *http.Request) { handlers.GetTrashItems(docSrvc, w, r) }).Methods("GET")
+	docsRouter.HandleFunc("/trash/restore", func(w http.ResponseWriter, r *http.Request) { handlers.RestoreTrashItem(docSrvc, w, r) }).Methods("POST")
+	docsRouter.HandleFunc("/trash/delete", func(w http.ResponseWriter, r *http.Request) { handlers.DeleteTrashItem(docSrvc, w, r) }).Methods("POST")
+
+	v2Router := kRouter.PathPrefix("/v2").Subrouter()
+	v2Router.Use(middleware.EnsureAuthenticated(authSrvc))
+	handlers.RegisterV2Routes(v2Router, serviceRegistry)
 
 	rsPressMiddleware := middleware.RsPressMiddleware(docSrvc)
 	router.Use(rsPressMiddleware)
@@ -157,6 +273,39 @@ func main() {
 	os.Exit(0)
 }
 
+// rotateMasterKey rewraps the credential encryption keys under a new master
+// key, from KAL_NEW_MASTER_KEY or generated.
+func rotateMasterKey(d *gorm.DB, cfg *config.Config) {
+	newMasterKey, err := db.RotateMasterKey(d, cfg, os.Getenv("KAL_NEW_MASTER_KEY"))
+	if err != nil {
+		logger.Fatal("failed to rotate the master key", zap.Error(err))
+	}
+
+	if cfg.Secret.MasterKeyFromEnv {
+		fmt.Println("Master key rotated. Set KAL_MASTER_KEY to the new key before the next start:")
+		fmt.Println(newMasterKey)
+		return
+	}
+
+	logger.Info("Master key rotated", zap.String("secretFile", cfg.PathToSecret))
+}
+
+// encryptSecret prints a value read from stdin encrypted, for secrets in the
+// config file such as OAuth client secrets.
+func encryptSecret() {
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		logger.Fatal("failed to read the secret", zap.Error(err))
+	}
+
+	encrypted, err := db.EncryptSecret(strings.TrimRight(value, "\r\n"), db.ConfigSecretContext)
+	if err != nil {
+		logger.Fatal("failed to encrypt the secret", zap.Error(err))
+	}
+
+	fmt.Println(encrypted)
+}
+
 func createSPAHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 
 	"git.difuse.io/Difuse/kalmia/handlers"
 	"git.difuse.io/Difuse/kalmia/services"
@@ -13,6 +14,12 @@ func EnsureAuthenticated(authService *services.AuthService) func(http.Handler) h
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path == "/kal-api/auth/jwt/create" ||
 				r.URL.Path == "/kal-api/auth/jwt/validate" ||
+				r.URL.Path == "/kal-api/auth/password/forgot" ||
+				r.URL.Path == "/kal-api/auth/password/reset" ||
+				r.URL.Path == "/kal-api/auth/invite/accept" ||
+				r.URL.Path == "/kal-api/auth/2fa/challenge/enroll" ||
+				r.URL.Path == "/kal-api/auth/2fa/challenge/verify" ||
+				r.URL.Path == "/kal-api/docs/page/collab" ||
 				r.URL.Path == "/admin/error" ||
 				r.URL.Path == "/admin/404" {
 				next.ServeHTTP(w, r)
@@ -22,7 +29,7 @@ func EnsureAuthenticated(authService *services.AuthService) func(http.Handler) h
 			token, err := handlers.GetTokenFromHeader(r)
 
 			if err != nil || !authService.VerifyTokenInDb(token, false) {
-				handlers.SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"error": "invalid_token"})
+				sendAuthError(w, r, http.StatusUnauthorized, "invalid_token")
 				return
 			}
 
@@ -30,12 +37,19 @@ func EnsureAuthenticated(authService *services.AuthService) func(http.Handler) h
 			permissions, err := authService.GetUserPermissions(token)
 
 			if err != nil {
-				handlers.SendJSONResponse(http.StatusInternalServerError, w, map[string]string{"error": "user_permissions_error"})
+				sendAuthError(w, r, http.StatusInternalServerError, "user_permissions_error")
 				return
 			}
 
-			if !hasPermissionForRoute(r.URL.Path, permissions, isAdminToken) {
-				handlers.SendJSONResponse(http.StatusUnauthorized, w, map[string]string{"error": "user_unauthorized_route"})
+			allowed := false
+			if isV2Route(r.URL.Path) {
+				allowed = hasPermissionForMethod(r.Method, permissions, isAdminToken)
+			} else {
+				allowed = hasPermissionForRoute(r.URL.Path, permissions, isAdminToken)
+			}
+
+			if !allowed {
+				sendAuthError(w, r, http.StatusUnauthorized, "user_unauthorized_route")
 				return
 			}
 
@@ -44,35 +58,129 @@ func EnsureAuthenticated(authService *services.AuthService) func(http.Handler) h
 	}
 }
 
+const v2Prefix = "/kal-api/v2/"
+
+func isV2Route(path string) bool {
+	return strings.HasPrefix(path, v2Prefix)
+}
+
+// sendAuthError answers v2 routes with a problem document and the older
+// routes with their usual error body.
+func sendAuthError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	if isV2Route(r.URL.Path) {
+		if status == http.StatusUnauthorized && code == "user_unauthorized_route" {
+			status = http.StatusForbidden
+		}
+		handlers.SendProblem(w, r, status, code, "")
+		return
+	}
+
+	handlers.SendJSONResponse(status, w, map[string]string{"error": code})
+}
+
+// hasPermissionForMethod checks v2 routes, which are resources whose
+// required permission follows from the method.
+func hasPermissionForMethod(method string, permissions []string, isAdmin bool) bool {
+	if isAdmin {
+		return true
+	}
+
+	methodPermissions := map[string]string{
+		http.MethodGet:    "read",
+		http.MethodHead:   "read",
+		http.MethodPost:   "write",
+		http.MethodPut:    "write",
+		http.MethodPatch:  "write",
+		http.MethodDelete: "delete",
+	}
+
+	requiredPermission, exists := methodPermissions[method]
+
+	if !exists {
+		return false
+	}
+
+	return utils.ArrayContains(permissions, requiredPermission)
+}
+
 func hasPermissionForRoute(path string, permissions []string, isAdmin bool) bool {
 	if isAdmin {
 		return true
 	}
 
 	routePermissions := map[string]string{
-		"/kal-api/auth/user":                       "read",
-		"/kal-api/auth/users":                      "read",
-		"/kal-api/auth/user/edit":                  "read",
-		"/kal-api/auth/jwt/revoke":                 "read",
-		"/kal-api/auth/jwt/validate":               "read",
-		"/kal-api/auth/user/upload-file":           "read",
-		"/kal-api/docs/documentations":             "read",
-		"/kal-api/docs/pages":                      "read",
-		"/kal-api/docs/page-groups":                "read",
-		"/kal-api/docs/documentation":              "read",
-		"/kal-api/docs/page":                       "read",
-		"/kal-api/docs/page-group":                 "read",
-		"/kal-api/docs/documentation/create":       "write",
-		"/kal-api/docs/documentation/edit":         "write",
-		"/kal-api/docs/documentation/version":      "write",
-		"/kal-api/docs/documentation/reorder-bulk": "write",
-		"/kal-api/docs/page/create":                "write",
-		"/kal-api/docs/page/edit":                  "write",
-		"/kal-api/docs/page-group/create":          "write",
-		"/kal-api/docs/page-group/edit":            "write",
-		"/kal-api/docs/documentation/delete":       "delete",
-		"/kal-api/docs/page/delete":                "delete",
-		"/kal-api/docs/page-group/delete":          "delete",
+		"/kal-api/auth/user":                              "read",
+		"/kal-api/auth/users":                             "read",
+		"/kal-api/auth/user/edit":                         "read",
+		"/kal-api/auth/jwt/revoke":                        "read",
+		"/kal-api/auth/jwt/validate":                      "read",
+		"/kal-api/auth/user/upload-file":                  "read",
+		"/kal-api/auth/2fa/enroll":                        "read",
+		"/kal-api/auth/2fa/confirm":                       "read",
+		"/kal-api/auth/2fa/disable":                       "read",
+		"/kal-api/auth/2fa/recovery-codes":                "read",
+		"/kal-api/docs/documentations":                    "read",
+		"/kal-api/docs/pages":                             "read",
+		"/kal-api/docs/page-groups":                       "read",
+		"/kal-api/docs/documentation":                     "read",
+		"/kal-api/docs/page":                              "read",
+		"/kal-api/docs/page-group":                        "read",
+		"/kal-api/docs/trash":                             "read",
+		"/kal-api/docs/page/translations":                 "read",
+		"/kal-api/docs/page/revisions":                    "read",
+		"/kal-api/docs/page-group/translations":           "read",
+		"/kal-api/docs/documentation/translations/export": "read",
+		"/kal-api/docs/documentation/link-report":         "read",
+		"/kal-api/docs/documentation/tags":                "read",
+		"/kal-api/docs/documentation/versions":            "read",
+		"/kal-api/docs/documentation/compare":             "read",
+		"/kal-api/docs/snippets":                          "read",
+		"/kal-api/docs/snippet":                           "read",
+		"/kal-api/docs/snippet/usage":                     "read",
+		"/kal-api/docs/templates":                         "read",
+		"/kal-api/docs/template":                          "read",
+		"/kal-api/docs/documentation/create":              "write",
+		"/kal-api/docs/documentation/edit":                "write",
+		"/kal-api/docs/documentation/version":             "write",
+		"/kal-api/docs/documentation/version/rename":      "write",
+		"/kal-api/docs/documentation/version/status":      "write",
+		"/kal-api/docs/documentation/version/default":     "write",
+		"/kal-api/docs/documentation/reorder-bulk":        "write",
+		"/kal-api/docs/documentation/locales":             "write",
+		"/kal-api/docs/documentation/variables":           "write",
+		"/kal-api/docs/documentation/translations/import": "write",
+		"/kal-api/docs/documentation/link-check":          "write",
+		"/kal-api/docs/documentation/tag/create":          "write",
+		"/kal-api/docs/documentation/tag/edit":            "write",
+		"/kal-api/docs/documentation/tag/delete":          "write",
+		"/kal-api/docs/page/tags":                         "write",
+		"/kal-api/docs/snippet/create":                    "write",
+		"/kal-api/docs/snippet/edit":                      "write",
+		"/kal-api/docs/template/from-page":                "write",
+		"/kal-api/docs/template/from-documentation":       "write",
+		"/kal-api/docs/snippet/delete":                    "delete",
+		"/kal-api/docs/template/delete":                   "delete",
+		"/kal-api/docs/batch":                             "write",
+		"/kal-api/docs/page/create":                       "write",
+		"/kal-api/docs/page/edit":                         "write",
+		"/kal-api/docs/page/collab/ticket":                "write",
+		"/kal-api/docs/page/propagate":                    "write",
+		"/kal-api/docs/page/move":                         "write",
+		"/kal-api/docs/page/copy":                         "write",
+		"/kal-api/docs/page/translation/edit":             "write",
+		"/kal-api/docs/page/translation/status":           "write",
+		"/kal-api/docs/page-group/create":                 "write",
+		"/kal-api/docs/page-group/edit":                   "write",
+		"/kal-api/docs/page-group/move":                   "write",
+		"/kal-api/docs/page-group/copy":                   "write",
+		"/kal-api/docs/page-group/translation/edit":       "write",
+		"/kal-api/docs/page-group/translation/status":     "write",
+		"/kal-api/docs/trash/restore":                     "write",
+		"/kal-api/docs/documentation/delete":              "delete",
+		"/kal-api/docs/documentation/version/delete":      "delete",
+		"/kal-api/docs/page/delete":                       "delete",
+		"/kal-api/docs/page-group/delete":                 "delete",
+		"/kal-api/docs/trash/delete":                      "delete",
 	}
 
 	requiredPermission, exists := routePermissions[path]
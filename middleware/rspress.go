@@ -16,6 +16,15 @@ func RsPressMiddleware(dS *services.DocService) func(http.Handler) http.Handler
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			urlPath := r.URL.Path
+
+			if urlPath == "/robots.txt" {
+				if robots, err := dS.RobotsTxt(); err == nil {
+					w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+					w.Write([]byte(robots))
+					return
+				}
+			}
+
 			docId, docPath, baseURL, reqAuth, err := dS.GetRsPress(urlPath)
 			cookieToken := ""
 
@@ -27,6 +36,13 @@ func RsPressMiddleware(dS *services.DocService) func(http.Handler) http.Handler
 			}
 
 			if err != nil {
+				if !strings.HasPrefix(urlPath, "/kal-api/") && !strings.HasPrefix(urlPath, "/admin") {
+					if target, ok := dS.ResolveRedirect(0, "", urlPath); ok {
+						redirectPermanently(w, r, target)
+						return
+					}
+				}
+
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -58,16 +74,35 @@ func RsPressMiddleware(dS *services.DocService) func(http.Handler) http.Handler
 				return
 			}
 
+			notFound := false
 			if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 				fullPath = filepath.Join(docPath, "build", "index.html")
+				notFound = true
 			}
 
 			if reqAuth && cookieToken == "" {
 				http.Redirect(w, r, "/admin/login?docAuth="+utils.ToBase64(r.URL.Path), http.StatusTemporaryRedirect)
 				return
-			} else {
-				http.ServeFile(w, r, fullPath)
 			}
+
+			if notFound {
+				if target, ok := dS.ResolveRedirect(docId, baseURL, urlPath); ok {
+					redirectPermanently(w, r, target)
+					return
+				}
+			}
+
+			http.ServeFile(w, r, fullPath)
 		})
 	}
 }
+
+// redirectPermanently sends a 301 to target, keeping the query string of the
+// request.
+func redirectPermanently(w http.ResponseWriter, r *http.Request, target string) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
@@ -35,14 +35,24 @@ func (service *AuthService) GetUsers() ([]models.User, error) {
 func (service *AuthService) CreateJWT(username, password string) (map[string]interface{}, error) {
 	var user models.User
 
+	// unknown users and wrong passwords fail alike, in about the same time
 	if err := service.DB.Where("username = ?", username).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("user_not_found")
+		utils.CheckPasswordHash(password, dummyPasswordHash())
+		return nil, fmt.Errorf("invalid_credentials")
 	}
 
 	if !utils.CheckPasswordHash(password, user.Password) {
-		return nil, fmt.Errorf("invalid_password")
+		return nil, fmt.Errorf("invalid_credentials")
 	}
 
+	if needsTwoFactor(user) {
+		return service.twoFactorChallenge(user)
+	}
+
+	return service.issueJWT(user)
+}
+
+func (service *AuthService) issueJWT(user models.User) (map[string]interface{}, error) {
 	tokenString, expiry, err := utils.GenerateJWTAccessToken(
 		user.ID,
 		user.Username,
@@ -251,6 +261,10 @@ func (service *AuthService) DeleteUser(username string) error {
 		return fmt.Errorf("failed_to_delete_user")
 	}
 
+	// pending links and recovery codes die with the account
+	service.DB.Where("user_id = ?", user.ID).Delete(&models.UserToken{})
+	service.DB.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+
 	return nil
 }
 
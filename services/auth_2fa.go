@@ -0,0 +1,384 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"gorm.io/gorm"
+)
+
+// A password login of a user with two-factor authentication yields a
+// challenge token instead of a JWT; the JWT is issued once a TOTP or
+// recovery code is given with the challenge.
+const (
+	UserTokenTwoFactor    = "two_factor_challenge"
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+func twoFactorConfig() config.TwoFactor {
+	cfg := config.TwoFactor{}
+	if config.ParsedConfig != nil {
+		cfg = config.ParsedConfig.Security.TwoFactor
+	}
+	cfg.SetDefault()
+	return cfg
+}
+
+// twoFactorRequired tells whether the user may not log in without a second
+// factor, whether or not they have enrolled yet.
+func twoFactorRequired(user models.User) bool {
+	return user.TwoFactorRequired || (user.Admin && twoFactorConfig().RequireForAdmins)
+}
+
+func needsTwoFactor(user models.User) bool {
+	return user.TOTPEnabled || twoFactorRequired(user)
+}
+
+// twoFactorChallenge stands for a passed password check. Users who must use
+// two-factor authentication but have not enrolled are asked to enrol.
+func (service *AuthService) twoFactorChallenge(user models.User) (map[string]interface{}, error) {
+	token, err := newUserToken(service.DB, user.ID, UserTokenTwoFactor, twoFactorChallengeTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed_to_create_challenge")
+	}
+
+	return map[string]interface{}{
+		"challenge": token,
+		"enroll":    !user.TOTPEnabled,
+		"expiry":    time.Now().Add(twoFactorChallengeTTL).String(),
+	}, nil
+}
+
+// OAuthTwoFactorChallenge returns a challenge when an OAuth login of the
+// user with this email needs a second step, and nothing when OAuth logins
+// skip it or the user has no second factor.
+func (service *AuthService) OAuthTwoFactorChallenge(email string) (map[string]interface{}, error) {
+	if twoFactorConfig().SkipForOAuth {
+		return nil, nil
+	}
+
+	user, err := service.FindUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	if !needsTwoFactor(user) {
+		return nil, nil
+	}
+
+	return service.twoFactorChallenge(user)
+}
+
+func (service *AuthService) challengeToken(tx *gorm.DB, challenge string) (models.UserToken, error) {
+	var userToken models.UserToken
+	if err := tx.Where("token_hash = ? AND kind = ?", hashUserToken(challenge), UserTokenTwoFactor).First(&userToken).Error; err != nil {
+		return models.UserToken{}, fmt.Errorf("invalid_or_expired_challenge")
+	}
+
+	if userToken.UsedAt != nil || userToken.ExpiresAt.Before(time.Now()) {
+		return models.UserToken{}, fmt.Errorf("invalid_or_expired_challenge")
+	}
+
+	return userToken, nil
+}
+
+// ChallengeUser is the user an unexpired challenge was issued to.
+func (service *AuthService) ChallengeUser(challenge string) (models.User, error) {
+	userToken, err := service.challengeToken(service.DB, challenge)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return service.GetUser(userToken.UserID)
+}
+
+// BeginTOTPEnrolment gives the user a new secret, which only takes effect
+// once a code from it is confirmed.
+func (service *AuthService) BeginTOTPEnrolment(userID uint) (map[string]string, error) {
+	user, err := service.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two_factor_already_enabled")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed_to_generate_secret")
+	}
+
+	if err := service.DB.Model(&user).Select("totp_secret").Updates(models.User{TOTPSecret: secret}).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_begin_enrolment")
+	}
+
+	return map[string]string{
+		"secret": secret,
+		"uri":    utils.TOTPProvisioningURI(twoFactorConfig().Issuer, user.Username, secret),
+	}, nil
+}
+
+// BeginChallengeEnrolment lets a user who has to enrol before logging in
+// do so with the challenge of their password login.
+func (service *AuthService) BeginChallengeEnrolment(challenge string) (map[string]string, error) {
+	user, err := service.ChallengeUser(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.BeginTOTPEnrolment(user.ID)
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// newRecoveryCodes replaces the recovery codes of the user and returns the
+// new ones, which are not shown again.
+func newRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_create_recovery_codes")
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed_to_create_recovery_codes")
+		}
+
+		code := base32.StdEncoding.EncodeToString(raw)[:10]
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hashUserToken(code)}).Error; err != nil {
+			return nil, fmt.Errorf("failed_to_create_recovery_codes")
+		}
+
+		codes = append(codes, strings.ToLower(code[:5]+"-"+code[5:]))
+	}
+
+	return codes, nil
+}
+
+// confirmTOTP enables a pending secret with its first code.
+func confirmTOTP(tx *gorm.DB, user models.User, code string) ([]string, error) {
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("two_factor_not_started")
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return nil, fmt.Errorf("invalid_two_factor_code")
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_enabled":   true,
+		"totp_last_step": step,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_enable_two_factor")
+	}
+
+	return newRecoveryCodes(tx, user.ID)
+}
+
+// checkSecondFactor accepts a TOTP code or an unused recovery code. Either
+// is claimed in one statement, so it works only once.
+func checkSecondFactor(tx *gorm.DB, user models.User, code string) error {
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		result := tx.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+		if result.Error != nil {
+			return fmt.Errorf("failed_to_verify_two_factor")
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+		return fmt.Errorf("invalid_two_factor_code")
+	}
+
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashUserToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed_to_verify_two_factor")
+	}
+	if result.RowsAffected != 1 {
+		return fmt.Errorf("invalid_two_factor_code")
+	}
+
+	return nil
+}
+
+// ConfirmTOTPEnrolment enables two-factor authentication and returns the
+// recovery codes.
+func (service *AuthService) ConfirmTOTPEnrolment(userID uint, code string) ([]string, error) {
+	user, err := service.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two_factor_already_enabled")
+	}
+
+	var codes []string
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		codes, err = confirmTOTP(tx, user, code)
+		return err
+	})
+
+	return codes, err
+}
+
+// VerifyTwoFactor completes a login with the challenge of its password
+// check and a TOTP or recovery code. A user enrolling at login confirms
+// their secret with the code and gets their recovery codes in the result.
+func (service *AuthService) VerifyTwoFactor(challenge string, code string) (map[string]interface{}, error) {
+	var user models.User
+	var recoveryCodes []string
+
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := service.challengeToken(tx, challenge)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, userToken.UserID).Error; err != nil {
+			return fmt.Errorf("user_not_found")
+		}
+
+		if user.TOTPEnabled {
+			err = checkSecondFactor(tx, user, code)
+		} else {
+			recoveryCodes, err = confirmTOTP(tx, user, code)
+		}
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.UserToken{}).Where("id = ? AND used_at IS NULL", userToken.ID).Update("used_at", time.Now())
+		if result.Error != nil || result.RowsAffected != 1 {
+			return fmt.Errorf("invalid_or_expired_challenge")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tokenDetails, err := service.issueJWT(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if recoveryCodes != nil {
+		tokenDetails["recoveryCodes"] = recoveryCodes
+	}
+
+	return tokenDetails, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user who proves
+// they hold the second factor.
+func (service *AuthService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	user, err := service.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TOTPEnabled {
+		return nil, fmt.Errorf("two_factor_not_enabled")
+	}
+
+	var codes []string
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkSecondFactor(tx, user, code); err != nil {
+			return err
+		}
+
+		codes, err = newRecoveryCodes(tx, user.ID)
+		return err
+	})
+
+	return codes, err
+}
+
+func clearTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Where("user_id = ? AND kind = ?", userID, UserTokenTwoFactor).Delete(&models.UserToken{}).Error
+}
+
+// DisableTOTP turns two-factor authentication off for a user who proves
+// they hold the second factor, unless it is required of them.
+func (service *AuthService) DisableTOTP(userID uint, code string) error {
+	user, err := service.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.TOTPEnabled {
+		return fmt.Errorf("two_factor_not_enabled")
+	}
+
+	if twoFactorRequired(user) {
+		return fmt.Errorf("two_factor_required")
+	}
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkSecondFactor(tx, user, code); err != nil {
+			return err
+		}
+
+		if err := clearTwoFactor(tx, user.ID); err != nil {
+			return fmt.Errorf("failed_to_disable_two_factor")
+		}
+
+		return nil
+	})
+}
+
+// ResetTwoFactor is for admins to let a user who lost their second factor
+// back in. A user who is required to use it enrols again at the next login.
+func (service *AuthService) ResetTwoFactor(userID uint) error {
+	if _, err := service.GetUser(userID); err != nil {
+		return err
+	}
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearTwoFactor(tx, userID); err != nil {
+			return fmt.Errorf("failed_to_reset_two_factor")
+		}
+		return nil
+	})
+}
+
+func (service *AuthService) SetTwoFactorRequired(userID uint, required bool) error {
+	user, err := service.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := service.DB.Model(&user).Update("two_factor_required", required).Error; err != nil {
+		return fmt.Errorf("failed_to_edit_user")
+	}
+
+	return nil
+}
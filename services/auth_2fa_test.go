@@ -0,0 +1,157 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+)
+
+func totpCodeAt(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("TOTPCode returned an error: %v", err)
+	}
+	return code
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	if err := TestAuthService.CreateUser("twofactor", "twofactor@kalmia.difuse.io", "twofactor-pass", false, []string{"read"}); err != nil {
+		t.Fatalf("CreateUser returned an error: %v", err)
+	}
+
+	var user models.User
+	TestAuthService.DB.Where("username = ?", "twofactor").First(&user)
+	t.Cleanup(func() {
+		TestAuthService.DB.Where("user_id = ?", user.ID).Delete(&models.Token{})
+		if err := TestAuthService.DeleteUser("twofactor"); err != nil {
+			t.Errorf("Failed to delete the user: %v", err)
+		}
+	})
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("Enrolment needs a confirmed code", func(t *testing.T) {
+		enrolment, err := TestAuthService.BeginTOTPEnrolment(user.ID)
+		if err != nil {
+			t.Fatalf("BeginTOTPEnrolment returned an error: %v", err)
+		}
+		secret = enrolment["secret"]
+
+		var raw string
+		TestAuthService.DB.Table("users").Select("totp_secret").Where("id = ?", user.ID).Row().Scan(&raw)
+		if !db.IsEncryptedSecret(raw) {
+			t.Errorf("Expected the TOTP secret to be encrypted, got %q", raw)
+		}
+
+		if result, err := TestAuthService.CreateJWT("twofactor", "twofactor-pass"); err != nil || result["token"] == nil {
+			t.Errorf("Expected a pending enrolment not to change logins, got %v (%v)", result, err)
+		}
+
+		if _, err := TestAuthService.ConfirmTOTPEnrolment(user.ID, "000000"); err == nil && totpCodeAt(t, secret, 0) != "000000" {
+			t.Errorf("Expected a wrong code to be refused")
+		}
+
+		recoveryCodes, err = TestAuthService.ConfirmTOTPEnrolment(user.ID, totpCodeAt(t, secret, 0))
+		if err != nil {
+			t.Fatalf("ConfirmTOTPEnrolment returned an error: %v", err)
+		}
+		if len(recoveryCodes) != recoveryCodeCount {
+			t.Errorf("Expected %d recovery codes, got %d", recoveryCodeCount, len(recoveryCodes))
+		}
+	})
+
+	t.Run("Password logins need a second step", func(t *testing.T) {
+		result, err := TestAuthService.CreateJWT("twofactor", "twofactor-pass")
+		if err != nil {
+			t.Fatalf("CreateJWT returned an error: %v", err)
+		}
+		if result["token"] != nil || result["challenge"] == nil || result["enroll"] != false {
+			t.Fatalf("Expected a challenge instead of a token, got %v", result)
+		}
+		challenge := result["challenge"].(string)
+
+		if _, err := TestAuthService.VerifyTwoFactor(challenge, totpCodeAt(t, secret, 0)); err == nil || err.Error() != "invalid_two_factor_code" {
+			t.Errorf("Expected the code used for enrolment to be refused, got %v", err)
+		}
+
+		tokenDetails, err := TestAuthService.VerifyTwoFactor(challenge, totpCodeAt(t, secret, 1))
+		if err != nil || tokenDetails["token"] == nil {
+			t.Fatalf("Expected a token for the next code, got %v (%v)", tokenDetails, err)
+		}
+
+		if _, err := TestAuthService.VerifyTwoFactor(challenge, recoveryCodes[0]); err == nil || err.Error() != "invalid_or_expired_challenge" {
+			t.Errorf("Expected the challenge to work only once, got %v", err)
+		}
+	})
+
+	t.Run("Recovery codes work once", func(t *testing.T) {
+		result, _ := TestAuthService.CreateJWT("twofactor", "twofactor-pass")
+		if _, err := TestAuthService.VerifyTwoFactor(result["challenge"].(string), recoveryCodes[0]); err != nil {
+			t.Fatalf("Expected the recovery code to work, got %v", err)
+		}
+
+		result, _ = TestAuthService.CreateJWT("twofactor", "twofactor-pass")
+		if _, err := TestAuthService.VerifyTwoFactor(result["challenge"].(string), recoveryCodes[0]); err == nil {
+			t.Errorf("Expected a used recovery code to be refused")
+		}
+
+		TestAuthService.DB.Model(&models.UserToken{}).Where("kind = ?", UserTokenTwoFactor).Update("expires_at", time.Now().Add(-time.Minute))
+		if _, err := TestAuthService.VerifyTwoFactor(result["challenge"].(string), recoveryCodes[1]); err == nil || err.Error() != "invalid_or_expired_challenge" {
+			t.Errorf("Expected an expired challenge to be refused, got %v", err)
+		}
+	})
+
+	t.Run("Required users cannot disable it", func(t *testing.T) {
+		if err := TestAuthService.SetTwoFactorRequired(user.ID, true); err != nil {
+			t.Fatalf("SetTwoFactorRequired returned an error: %v", err)
+		}
+
+		if err := TestAuthService.DisableTOTP(user.ID, recoveryCodes[1]); err == nil || err.Error() != "two_factor_required" {
+			t.Errorf("Expected two_factor_required, got %v", err)
+		}
+	})
+
+	t.Run("Admins reset it and required users enrol at login", func(t *testing.T) {
+		if err := TestAuthService.ResetTwoFactor(user.ID); err != nil {
+			t.Fatalf("ResetTwoFactor returned an error: %v", err)
+		}
+
+		result, err := TestAuthService.CreateJWT("twofactor", "twofactor-pass")
+		if err != nil || result["enroll"] != true {
+			t.Fatalf("Expected a challenge to enrol, got %v (%v)", result, err)
+		}
+		challenge := result["challenge"].(string)
+
+		enrolment, err := TestAuthService.BeginChallengeEnrolment(challenge)
+		if err != nil {
+			t.Fatalf("BeginChallengeEnrolment returned an error: %v", err)
+		}
+
+		tokenDetails, err := TestAuthService.VerifyTwoFactor(challenge, totpCodeAt(t, enrolment["secret"], 0))
+		if err != nil || tokenDetails["token"] == nil || tokenDetails["recoveryCodes"] == nil {
+			t.Fatalf("Expected a token and recovery codes, got %v (%v)", tokenDetails, err)
+		}
+	})
+
+	t.Run("OAuth logins can skip it", func(t *testing.T) {
+		challenge, err := TestAuthService.OAuthTwoFactorChallenge("twofactor@kalmia.difuse.io")
+		if err != nil || challenge == nil {
+			t.Errorf("Expected an OAuth login to need a challenge, got %v (%v)", challenge, err)
+		}
+
+		previous := config.ParsedConfig.Security.TwoFactor
+		t.Cleanup(func() { config.ParsedConfig.Security.TwoFactor = previous })
+		config.ParsedConfig.Security.TwoFactor.SkipForOAuth = true
+
+		if challenge, err := TestAuthService.OAuthTwoFactorChallenge("twofactor@kalmia.difuse.io"); err != nil || challenge != nil {
+			t.Errorf("Expected OAuth logins to skip the challenge, got %v (%v)", challenge, err)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	UserTokenPasswordReset = "password_reset"
+	UserTokenInvitation    = "invitation"
+)
+
+// resetRequestInterval is how often a reset email can be asked for one
+// account.
+const resetRequestInterval = time.Minute
+
+type linkEmailData struct {
+	Username  string
+	InvitedBy string
+	Link      string
+	Expires   string
+}
+
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newUserToken replaces the unused tokens of a kind for the user with a
+// new one, so only the latest link works.
+func newUserToken(tx *gorm.DB, userID uint, kind string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed_to_create_link")
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := tx.Where("user_id = ? AND kind = ? AND used_at IS NULL", userID, kind).Delete(&models.UserToken{}).Error; err != nil {
+		return "", fmt.Errorf("failed_to_create_link")
+	}
+
+	userToken := models.UserToken{
+		UserID:    userID,
+		Kind:      kind,
+		TokenHash: hashUserToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if err := tx.Create(&userToken).Error; err != nil {
+		return "", fmt.Errorf("failed_to_create_link")
+	}
+
+	return token, nil
+}
+
+func emailLink(baseURL string, path string, token string) string {
+	return strings.TrimRight(baseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func formatExpiry(ttl time.Duration) string {
+	if ttl%time.Hour == 0 {
+		if hours := int(ttl / time.Hour); hours != 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d minutes", int(ttl/time.Minute))
+}
+
+// RequestPasswordReset queues a reset link for the account with this
+// email. Unknown addresses are ignored, so the caller cannot tell which
+// accounts exist.
+func (service *AuthService) RequestPasswordReset(email string, baseURL string) error {
+	var user models.User
+	if err := service.DB.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error; err != nil {
+		return nil
+	}
+
+	var recent int64
+	service.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND kind = ? AND created_at > ?", user.ID, UserTokenPasswordReset, time.Now().Add(-resetRequestInterval)).
+		Count(&recent)
+	if recent > 0 {
+		return nil
+	}
+
+	ttl := time.Duration(emailConfig().ResetExpiryMinutes) * time.Minute
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := newUserToken(tx, user.ID, UserTokenPasswordReset, ttl)
+		if err != nil {
+			return err
+		}
+
+		return enqueueEmail(tx, user.Email, "password_reset", linkEmailData{
+			Username: user.Username,
+			Link:     emailLink(baseURL, "/admin/reset-password", token),
+			Expires:  formatExpiry(ttl),
+		})
+	})
+}
+
+// InviteUser creates an account without a password and emails its owner a
+// link to choose one.
+func (service *AuthService) InviteUser(username, email string, admin bool, permissions []string, invitedBy string, baseURL string) error {
+	if len(permissions) == 0 {
+		permissions = append(permissions, "read")
+	}
+
+	jsonPermissions, err := json.Marshal(permissions)
+	if err != nil {
+		return fmt.Errorf("failed_to_marshal_permissions")
+	}
+
+	ttl := time.Duration(emailConfig().InviteExpiryHours) * time.Hour
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		user := models.User{
+			Username:    username,
+			Email:       email,
+			Admin:       admin,
+			Permissions: string(jsonPermissions),
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed_to_create_user")
+		}
+
+		token, err := newUserToken(tx, user.ID, UserTokenInvitation, ttl)
+		if err != nil {
+			return err
+		}
+
+		return enqueueEmail(tx, user.Email, "invitation", linkEmailData{
+			Username:  user.Username,
+			InvitedBy: invitedBy,
+			Link:      emailLink(baseURL, "/admin/invite", token),
+			Expires:   formatExpiry(ttl),
+		})
+	})
+}
+
+// SetPasswordWithToken sets the password of the user a reset or invitation
+// link was sent to. Each link works once and only until it expires; a reset
+// also signs the user out everywhere and lifts a lockout of the account.
+func (service *AuthService) SetPasswordWithToken(kind string, token string, password string) error {
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed_to_hash_password")
+	}
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		var userToken models.UserToken
+		if err := tx.Where("token_hash = ? AND kind = ?", hashUserToken(token), kind).First(&userToken).Error; err != nil {
+			return fmt.Errorf("invalid_or_expired_link")
+		}
+
+		now := time.Now()
+		if userToken.UsedAt != nil || userToken.ExpiresAt.Before(now) {
+			return fmt.Errorf("invalid_or_expired_link")
+		}
+
+		// claimed in one statement, so two requests cannot both use the link
+		result := tx.Model(&models.UserToken{}).Where("id = ? AND used_at IS NULL", userToken.ID).Update("used_at", now)
+		if result.Error != nil {
+			return fmt.Errorf("failed_to_set_password")
+		}
+		if result.RowsAffected != 1 {
+			return fmt.Errorf("invalid_or_expired_link")
+		}
+
+		var user models.User
+		if err := tx.First(&user, userToken.UserID).Error; err != nil {
+			return fmt.Errorf("user_not_found")
+		}
+
+		if err := tx.Model(&user).Update("password", hashedPassword).Error; err != nil {
+			return fmt.Errorf("failed_to_set_password")
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Token{}).Error; err != nil {
+			return fmt.Errorf("failed_to_set_password")
+		}
+
+		if err := tx.Where("kind = ? AND identifier = ?", ThrottleAccount, strings.ToLower(user.Username)).Delete(&models.LoginThrottle{}).Error; err != nil {
+			return fmt.Errorf("failed_to_set_password")
+		}
+
+		return nil
+	})
+}
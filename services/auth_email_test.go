@@ -0,0 +1,112 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+var linkTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// lastLinkToken returns the token in the newest queued email to recipient.
+func lastLinkToken(t *testing.T, recipient string) string {
+	t.Helper()
+
+	var email models.OutboxEmail
+	if err := TestMailService.DB.Where("recipient = ?", recipient).Order("id DESC").First(&email).Error; err != nil {
+		t.Fatalf("Expected an email to %s: %v", recipient, err)
+	}
+
+	match := linkTokenPattern.FindStringSubmatch(email.Text)
+	if match == nil {
+		t.Fatalf("Expected a link in the email, got %q", email.Text)
+	}
+	return match[1]
+}
+
+func TestInvitationAndPasswordReset(t *testing.T) {
+	clearOutbox(t)
+	t.Cleanup(func() {
+		clearOutbox(t)
+		var invitee models.User
+		if TestAuthService.DB.Where("username = ?", "invitee").First(&invitee).Error == nil {
+			TestAuthService.DB.Where("user_id = ?", invitee.ID).Delete(&models.Token{})
+			if err := TestAuthService.DeleteUser("invitee"); err != nil {
+				t.Errorf("Failed to delete the invitee: %v", err)
+			}
+		}
+	})
+
+	const email = "invitee@kalmia.difuse.io"
+
+	t.Run("Invitees choose their own password", func(t *testing.T) {
+		if err := TestAuthService.InviteUser("invitee", email, false, []string{"read"}, "admin", "http://localhost:2727"); err != nil {
+			t.Fatalf("InviteUser returned an error: %v", err)
+		}
+
+		if _, err := TestAuthService.CreateJWT("invitee", ""); err == nil {
+			t.Fatalf("Expected an invited user without a password not to log in")
+		}
+
+		token := lastLinkToken(t, email)
+		if err := TestAuthService.SetPasswordWithToken(UserTokenPasswordReset, token, "invited-pass"); err == nil {
+			t.Errorf("Expected an invitation not to work as a reset link")
+		}
+
+		if err := TestAuthService.SetPasswordWithToken(UserTokenInvitation, token, "invited-pass"); err != nil {
+			t.Fatalf("SetPasswordWithToken returned an error: %v", err)
+		}
+
+		if _, err := TestAuthService.CreateJWT("invitee", "invited-pass"); err != nil {
+			t.Errorf("Expected the invitee to log in, got %v", err)
+		}
+
+		if err := TestAuthService.SetPasswordWithToken(UserTokenInvitation, token, "another-pass"); err == nil || err.Error() != "invalid_or_expired_link" {
+			t.Errorf("Expected the link to work only once, got %v", err)
+		}
+	})
+
+	t.Run("Reset links are single-use and expire", func(t *testing.T) {
+		if err := TestAuthService.RequestPasswordReset("nobody@kalmia.difuse.io", "http://localhost:2727"); err != nil {
+			t.Errorf("Expected unknown addresses to be ignored, got %v", err)
+		}
+
+		if err := TestAuthService.RequestPasswordReset("Invitee@Kalmia.Difuse.io", "http://localhost:2727"); err != nil {
+			t.Fatalf("RequestPasswordReset returned an error: %v", err)
+		}
+		token := lastLinkToken(t, email)
+
+		session, err := TestAuthService.CreateJWT("invitee", "invited-pass")
+		if err != nil {
+			t.Fatalf("CreateJWT returned an error: %v", err)
+		}
+
+		if err := TestAuthService.SetPasswordWithToken(UserTokenPasswordReset, token, "reset-pass"); err != nil {
+			t.Fatalf("SetPasswordWithToken returned an error: %v", err)
+		}
+
+		if _, err := TestAuthService.CreateJWT("invitee", "reset-pass"); err != nil {
+			t.Errorf("Expected the new password to work, got %v", err)
+		}
+		if TestAuthService.VerifyTokenInDb(session["token"].(string), false) {
+			t.Errorf("Expected a reset to sign out existing sessions")
+		}
+		if err := TestAuthService.SetPasswordWithToken(UserTokenPasswordReset, token, "again-pass"); err == nil {
+			t.Errorf("Expected the reset link to work only once")
+		}
+
+		// requests are spaced out per account
+		TestAuthService.DB.Model(&models.UserToken{}).Where("kind = ?", UserTokenPasswordReset).Update("created_at", time.Now().Add(-time.Hour))
+		if err := TestAuthService.RequestPasswordReset(email, "http://localhost:2727"); err != nil {
+			t.Fatalf("RequestPasswordReset returned an error: %v", err)
+		}
+		token = lastLinkToken(t, email)
+
+		TestAuthService.DB.Model(&models.UserToken{}).Where("token_hash = ?", hashUserToken(token)).Update("expires_at", time.Now().Add(-time.Minute))
+		if err := TestAuthService.SetPasswordWithToken(UserTokenPasswordReset, token, "late-pass"); err == nil || err.Error() != "invalid_or_expired_link" {
+			t.Errorf("Expected an expired link to be refused, got %v", err)
+		}
+	})
+}
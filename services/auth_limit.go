@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash is compared against for unknown users, so that they
+// take as long to reject as wrong passwords.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = utils.HashPassword("kalmia-dummy-password")
+	})
+	return dummyHash
+}
+
+// LockedError is returned while logins are locked; RetryAfter is how long
+// until they are allowed again.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e LockedError) Error() string {
+	return "too_many_attempts"
+}
+
+func loginLimit() config.LoginLimit {
+	limit := config.LoginLimit{}
+	if config.ParsedConfig != nil {
+		limit = config.ParsedConfig.Security.LoginLimit
+	}
+	limit.SetDefault()
+	return limit
+}
+
+func throttleKeys(ip string, account string) map[string]string {
+	keys := make(map[string]string)
+	if ip != "" {
+		keys[ThrottleIP] = ip
+	}
+	if account = strings.ToLower(strings.TrimSpace(account)); account != "" {
+		keys[ThrottleAccount] = account
+	}
+	return keys
+}
+
+// CheckLogin refuses a login while the account or the address is locked.
+// An empty account only checks the address.
+func (service *AuthService) CheckLogin(ip string, account string) error {
+	now := time.Now()
+	var retryAfter time.Duration
+
+	for kind, key := range throttleKeys(ip, account) {
+		var throttle models.LoginThrottle
+		if err := service.DB.Where("kind = ? AND identifier = ?", kind, key).First(&throttle).Error; err != nil {
+			continue
+		}
+
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			if wait := throttle.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	if retryAfter > 0 {
+		return LockedError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// RecordLoginFailure counts a failed login against the account and the
+// address, and locks whichever reached its limit.
+func (service *AuthService) RecordLoginFailure(ip string, account string) error {
+	limit := loginLimit()
+	window := time.Duration(limit.WindowMinutes) * time.Minute
+	now := time.Now()
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		// counters that have run out are of no further use
+		if err := tx.Where("window_start < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-window), now).
+			Delete(&models.LoginThrottle{}).Error; err != nil {
+			return fmt.Errorf("failed_to_record_login_failure")
+		}
+
+		for kind, key := range throttleKeys(ip, account) {
+			allowed := limit.MaxAttempts
+			if kind == ThrottleIP {
+				allowed = limit.MaxAttemptsPerIP
+			}
+
+			var throttle models.LoginThrottle
+			err := tx.Where("kind = ? AND identifier = ?", kind, key).First(&throttle).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("failed_to_record_login_failure")
+			}
+
+			if throttle.ID == 0 || now.Sub(throttle.WindowStart) > window {
+				throttle.Kind, throttle.Identifier = kind, key
+				throttle.Failures = 0
+				throttle.WindowStart = now
+			}
+
+			throttle.Failures++
+			if throttle.Failures >= allowed {
+				lockedUntil := now.Add(time.Duration(limit.LockoutMinutes) * time.Minute)
+				throttle.LockedUntil = &lockedUntil
+				throttle.Failures = 0
+				throttle.WindowStart = now
+			}
+
+			if err := tx.Save(&throttle).Error; err != nil {
+				return fmt.Errorf("failed_to_record_login_failure")
+			}
+		}
+
+		return nil
+	})
+}
+
+// RecordLoginSuccess forgets the failures of the account. Those of the
+// address stay, so one good account does not reset a guessing client.
+func (service *AuthService) RecordLoginSuccess(account string) error {
+	keys := throttleKeys("", account)
+	if keys[ThrottleAccount] == "" {
+		return nil
+	}
+
+	if err := service.DB.Where("kind = ? AND identifier = ? AND (locked_until IS NULL OR locked_until < ?)", ThrottleAccount, keys[ThrottleAccount], time.Now()).
+		Delete(&models.LoginThrottle{}).Error; err != nil {
+		return fmt.Errorf("failed_to_record_login_success")
+	}
+
+	return nil
+}
+
+// GetLoginThrottles lists the accounts and addresses with recent failures
+// or a lockout.
+func (service *AuthService) GetLoginThrottles() ([]models.LoginThrottle, error) {
+	window := time.Duration(loginLimit().WindowMinutes) * time.Minute
+	now := time.Now()
+
+	var throttles []models.LoginThrottle
+	if err := service.DB.Where("window_start >= ? OR locked_until > ?", now.Add(-window), now).
+		Order("updated_at DESC").
+		Find(&throttles).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_login_throttles")
+	}
+
+	return throttles, nil
+}
+
+// ClearLoginThrottle lifts a lockout and resets its failures.
+func (service *AuthService) ClearLoginThrottle(id uint) error {
+	result := service.DB.Delete(&models.LoginThrottle{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed_to_clear_login_throttle")
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("login_throttle_not_found")
+	}
+
+	return nil
+}
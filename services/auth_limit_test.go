@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	if TestAuthService == nil {
+		t.Fatal("TestAuthService is nil")
+	}
+
+	limit := loginLimit()
+	ip := "192.0.2.10"
+
+	t.Run("Unknown user and wrong password look alike", func(t *testing.T) {
+		_, unknownErr := TestAuthService.CreateJWT("nobody-here", "password")
+		_, wrongErr := TestAuthService.CreateJWT("admin", "not-the-password")
+		if unknownErr == nil || wrongErr == nil || unknownErr.Error() != wrongErr.Error() {
+			t.Errorf("Expected the same error for both, got %v and %v", unknownErr, wrongErr)
+		}
+	})
+
+	t.Run("Account locks after the allowed failures", func(t *testing.T) {
+		for i := 0; i < limit.MaxAttempts; i++ {
+			if err := TestAuthService.CheckLogin(ip, "Admin"); err != nil {
+				t.Fatalf("Expected attempt %d to be allowed, got %v", i+1, err)
+			}
+			if err := TestAuthService.RecordLoginFailure(ip, "Admin"); err != nil {
+				t.Fatalf("RecordLoginFailure returned an error: %v", err)
+			}
+		}
+
+		err := TestAuthService.CheckLogin("198.51.100.7", "admin")
+		var locked LockedError
+		if !errors.As(err, &locked) || locked.RetryAfter <= 0 {
+			t.Fatalf("Expected the account to be locked from any address, got %v", err)
+		}
+
+		if err := TestAuthService.CheckLogin(ip, "user"); err != nil {
+			t.Errorf("Expected the address to stay below its own limit, got %v", err)
+		}
+	})
+
+	t.Run("A success does not lift a lockout", func(t *testing.T) {
+		if err := TestAuthService.RecordLoginSuccess("admin"); err != nil {
+			t.Fatalf("RecordLoginSuccess returned an error: %v", err)
+		}
+		if err := TestAuthService.CheckLogin(ip, "admin"); err == nil {
+			t.Errorf("Expected the account to stay locked")
+		}
+	})
+
+	t.Run("Admins can list and clear lockouts", func(t *testing.T) {
+		throttles, err := TestAuthService.GetLoginThrottles()
+		if err != nil {
+			t.Fatalf("GetLoginThrottles returned an error: %v", err)
+		}
+
+		var account *models.LoginThrottle
+		for i := range throttles {
+			if throttles[i].Kind == ThrottleAccount && throttles[i].Identifier == "admin" {
+				account = &throttles[i]
+			}
+		}
+		if account == nil || account.LockedUntil == nil {
+			t.Fatalf("Expected a lockout for admin, got %+v", throttles)
+		}
+
+		if err := TestAuthService.ClearLoginThrottle(account.ID); err != nil {
+			t.Fatalf("ClearLoginThrottle returned an error: %v", err)
+		}
+		if err := TestAuthService.CheckLogin(ip, "admin"); err != nil {
+			t.Errorf("Expected the account to be unlocked, got %v", err)
+		}
+		if err := TestAuthService.ClearLoginThrottle(account.ID); err == nil || err.Error() != "login_throttle_not_found" {
+			t.Errorf("Expected login_throttle_not_found, got %v", err)
+		}
+	})
+
+	t.Run("Address locks after its own limit", func(t *testing.T) {
+		other := "203.0.113.5"
+		for i := 0; i < limit.MaxAttemptsPerIP; i++ {
+			if err := TestAuthService.RecordLoginFailure(other, ""); err != nil {
+				t.Fatalf("RecordLoginFailure returned an error: %v", err)
+			}
+		}
+
+		if err := TestAuthService.CheckLogin(other, "admin"); err == nil {
+			t.Errorf("Expected the address to be locked")
+		}
+
+		TestAuthService.DB.Where("1 = 1").Delete(&models.LoginThrottle{})
+	})
+}
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	// a login has to come back from the provider within 10 minutes
+	oidcLoginTTL = 10 * time.Minute
+	// discovery documents are read again after an hour, and key sets when
+	// a token names a key they lack, at most once a minute
+	oidcDiscoveryTTL = time.Hour
+	oidcKeysMinAge   = time.Minute
+)
+
+type oidcProviderCache struct {
+	discovery     utils.OIDCDiscovery
+	fetchedAt     time.Time
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+var (
+	//nolint:gochecknoglobals
+	oidcCacheMu sync.Mutex
+	//nolint:gochecknoglobals
+	oidcCache = map[string]*oidcProviderCache{}
+	//nolint:gochecknoglobals
+	oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+	//nolint:gochecknoglobals
+	usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9]`)
+)
+
+func oidcProvider(name string) (config.OIDCProvider, error) {
+	for _, provider := range config.ParsedConfig.OIDCProviders {
+		if provider.Name == name {
+			return provider, nil
+		}
+	}
+
+	return config.OIDCProvider{}, fmt.Errorf("oidc_provider_not_found")
+}
+
+// OIDCProviders lists the configured OpenID Connect providers for the
+// login page.
+func (service *AuthService) OIDCProviders() []map[string]string {
+	providers := []map[string]string{}
+	for _, provider := range config.ParsedConfig.OIDCProviders {
+		providers = append(providers, map[string]string{"name": provider.Name, "displayName": provider.DisplayName})
+	}
+
+	return providers
+}
+
+func oidcCacheEntry(provider config.OIDCProvider) *oidcProviderCache {
+	key := provider.Name + " " + provider.Issuer
+	if oidcCache[key] == nil {
+		oidcCache[key] = &oidcProviderCache{}
+	}
+	return oidcCache[key]
+}
+
+func oidcDiscover(ctx context.Context, provider config.OIDCProvider) (utils.OIDCDiscovery, error) {
+	oidcCacheMu.Lock()
+	defer oidcCacheMu.Unlock()
+
+	entry := oidcCacheEntry(provider)
+	if time.Since(entry.fetchedAt) < oidcDiscoveryTTL {
+		return entry.discovery, nil
+	}
+
+	discovery, err := utils.FetchOIDCDiscovery(ctx, oidcHTTPClient, provider.Issuer)
+	if err != nil {
+		logger.Error("Failed to read the OIDC discovery document", zap.String("provider", provider.Name), zap.Error(err))
+		return utils.OIDCDiscovery{}, fmt.Errorf("oidc_discovery_failed")
+	}
+
+	entry.discovery = discovery
+	entry.fetchedAt = time.Now()
+	entry.keys = nil
+
+	return discovery, nil
+}
+
+func oidcKey(ctx context.Context, provider config.OIDCProvider, discovery utils.OIDCDiscovery, kid string) (crypto.PublicKey, error) {
+	oidcCacheMu.Lock()
+	defer oidcCacheMu.Unlock()
+
+	entry := oidcCacheEntry(provider)
+	if key, ok := entry.keys[kid]; ok {
+		return key, nil
+	}
+
+	if entry.keys != nil && time.Since(entry.keysFetchedAt) < oidcKeysMinAge {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	keys, err := utils.FetchJWKS(ctx, oidcHTTPClient, discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	entry.keys = keys
+	entry.keysFetchedAt = time.Now()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	// a provider with one key may leave out its kid
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func oidcOAuthConfig(provider config.OIDCProvider, discovery utils.OIDCDiscovery) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  provider.RedirectURL,
+		Scopes:       provider.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}
+}
+
+func randomOIDCValue() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// storeLogin keeps a login until its callback and returns the state that
+// identifies it.
+func (service *AuthService) storeLogin(provider string, nonce string, verifier string) (string, error) {
+	state, err := randomOIDCValue()
+	if err != nil {
+		return "", err
+	}
+
+	service.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLogin{})
+
+	login := models.OIDCLogin{
+		Provider:  provider,
+		StateHash: hashUserToken(state),
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ExpiresAt: time.Now().Add(oidcLoginTTL),
+	}
+	if err := service.DB.Create(&login).Error; err != nil {
+		return "", err
+	}
+
+	return state, nil
+}
+
+// BeginOIDCLogin returns the URL to send the browser to and the state the
+// callback has to come back with. The nonce and PKCE verifier stay in the
+// database until then.
+func (service *AuthService) BeginOIDCLogin(ctx context.Context, name string) (string, string, error) {
+	provider, err := oidcProvider(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	discovery, err := oidcDiscover(ctx, provider)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := randomOIDCValue()
+	if err != nil {
+		return "", "", fmt.Errorf("failed_to_start_oidc_login")
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	state, err := service.storeLogin(provider.Name, nonce, verifier)
+	if err != nil {
+		return "", "", fmt.Errorf("failed_to_start_oidc_login")
+	}
+
+	authURL := oidcOAuthConfig(provider, discovery).AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	)
+
+	return authURL, state, nil
+}
+
+// takeOIDCLogin returns the pending login of a state and removes it, so a
+// state works once.
+func (service *AuthService) takeOIDCLogin(provider string, state string) (models.OIDCLogin, error) {
+	var login models.OIDCLogin
+	if err := service.DB.Where("state_hash = ? AND provider = ?", hashUserToken(state), provider).First(&login).Error; err != nil {
+		return models.OIDCLogin{}, fmt.Errorf("invalid_oidc_state")
+	}
+
+	result := service.DB.Where("id = ?", login.ID).Delete(&models.OIDCLogin{})
+	if result.Error != nil || result.RowsAffected != 1 || time.Now().After(login.ExpiresAt) {
+		return models.OIDCLogin{}, fmt.Errorf("invalid_oidc_state")
+	}
+
+	return login, nil
+}
+
+// oauthLoginProvider keeps the logins of the built-in OAuth providers apart
+// from OIDC providers, whose names could be the same.
+func oauthLoginProvider(provider string) string {
+	return "oauth:" + provider
+}
+
+// BeginOAuthLogin starts a login with GitHub, Microsoft or Google. It
+// returns the state to send and the PKCE verifier to derive the challenge
+// from; the callback has to come back with the state.
+func (service *AuthService) BeginOAuthLogin(provider string) (string, string, error) {
+	verifier := oauth2.GenerateVerifier()
+
+	state, err := service.storeLogin(oauthLoginProvider(provider), "", verifier)
+	if err != nil {
+		return "", "", fmt.Errorf("failed_to_start_oauth_login")
+	}
+
+	return state, verifier, nil
+}
+
+// FinishOAuthLogin returns the PKCE verifier of the login a callback's
+// state belongs to. Like with OIDC, a state works once.
+func (service *AuthService) FinishOAuthLogin(provider string, state string) (string, error) {
+	login, err := service.takeOIDCLogin(oauthLoginProvider(provider), state)
+	if err != nil {
+		return "", fmt.Errorf("invalid_oauth_state")
+	}
+
+	return login.Verifier, nil
+}
+
+// FinishOIDCLogin redeems the code of a callback, checks the ID token and
+// returns the email of the Kalmia user it signs in, provisioning the user
+// or updating their roles from their groups as configured.
+func (service *AuthService) FinishOIDCLogin(ctx context.Context, name string, state string, code string) (string, error) {
+	provider, err := oidcProvider(name)
+	if err != nil {
+		return "", err
+	}
+
+	login, err := service.takeOIDCLogin(provider.Name, state)
+	if err != nil {
+		return "", err
+	}
+
+	discovery, err := oidcDiscover(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, oidcHTTPClient)
+	token, err := oidcOAuthConfig(provider, discovery).Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		logger.Error("Failed to redeem the OIDC code", zap.String("provider", provider.Name), zap.Error(err))
+		return "", fmt.Errorf("oidc_exchange_failed")
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return "", fmt.Errorf("invalid_oidc_id_token")
+	}
+
+	claims, err := utils.VerifyIDToken(rawIDToken, func(kid string) (crypto.PublicKey, error) {
+		return oidcKey(ctx, provider, discovery, kid)
+	}, discovery.Issuer, provider.ClientID, login.Nonce)
+	if err != nil {
+		logger.Error("Rejected an OIDC ID token", zap.String("provider", provider.Name), zap.Error(err))
+		return "", fmt.Errorf("invalid_oidc_id_token")
+	}
+
+	// providers may leave the email or groups out of the ID token and only
+	// answer them from the userinfo endpoint
+	if discovery.UserinfoEndpoint != "" && (claims["email"] == nil || claims["email_verified"] == nil || utils.ClaimStrings(claims, provider.GroupsClaim) == nil) {
+		userinfo, err := utils.FetchOIDCUserinfo(ctx, oidcHTTPClient, discovery.UserinfoEndpoint, token.AccessToken)
+		if err != nil {
+			logger.Warn("Failed to read OIDC userinfo", zap.String("provider", provider.Name), zap.Error(err))
+		} else if claims["sub"] != nil && userinfo["sub"] == claims["sub"] {
+			for claim, value := range userinfo {
+				if _, ok := claims[claim]; !ok {
+					claims[claim] = value
+				}
+			}
+		}
+	}
+
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", fmt.Errorf("oidc_email_missing")
+	}
+	// accounts are linked by email, so an address the provider has not
+	// verified could take over the account of whoever owns it
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return "", fmt.Errorf("oidc_email_not_verified")
+	}
+
+	preferredUsername, _ := claims["preferred_username"].(string)
+	user, err := service.syncOIDCUser(provider, email, preferredUsername, utils.ClaimStrings(claims, provider.GroupsClaim))
+	if err != nil {
+		return "", err
+	}
+
+	return user.Email, nil
+}
+
+// oidcRoles merges the mappings of the groups a user is in. matched is
+// false when none of the groups is mapped.
+func oidcRoles(provider config.OIDCProvider, groups []string) (admin bool, permissions []string, matched bool) {
+	for _, mapping := range provider.GroupMappings {
+		if !slices.Contains(groups, mapping.Group) {
+			continue
+		}
+
+		matched = true
+		admin = admin || mapping.Admin
+		for _, permission := range mapping.Permissions {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	if admin {
+		permissions = []string{"all"}
+	} else if len(permissions) == 0 {
+		permissions = []string{"read"}
+	}
+
+	return admin, permissions, matched
+}
+
+func emailDomainAllowed(allowedDomains []string, email string) bool {
+	if len(allowedDomains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	for _, allowed := range allowedDomains {
+		if strings.ToLower(allowed) == domain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// oidcUsername picks a free username from the preferred username or the
+// email, keeping only letters and digits as the user form does.
+func (service *AuthService) oidcUsername(tx *gorm.DB, preferredUsername string, email string) string {
+	base := usernameInvalidChars.ReplaceAllString(preferredUsername, "")
+	if base == "" {
+		base = usernameInvalidChars.ReplaceAllString(strings.Split(email, "@")[0], "")
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	username := base
+	for i := 2; ; i++ {
+		var count int64
+		tx.Model(&models.User{}).Where("username = ?", username).Count(&count)
+		if count == 0 {
+			return username
+		}
+		username = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// syncOIDCUser finds the user of an OIDC login by email, or creates them
+// when the provider may provision users of that email domain. Users in a
+// mapped group get the roles of their groups on every login; users in
+// none keep theirs.
+func (service *AuthService) syncOIDCUser(provider config.OIDCProvider, email string, preferredUsername string, groups []string) (models.User, error) {
+	admin, permissions, matched := oidcRoles(provider, groups)
+	jsonPermissions, err := json.Marshal(permissions)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed_to_marshal_permissions")
+	}
+
+	var user models.User
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ?", email).First(&user).Error; err != nil {
+			if !provider.AutoProvision {
+				return fmt.Errorf("user_not_found")
+			}
+			if !emailDomainAllowed(provider.AllowedDomains, email) {
+				return fmt.Errorf("oidc_domain_not_allowed")
+			}
+
+			user = models.User{
+				Username:    service.oidcUsername(tx, preferredUsername, email),
+				Email:       email,
+				Admin:       admin,
+				Permissions: string(jsonPermissions),
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("failed_to_create_user")
+			}
+
+			logger.Info("Provisioned an OIDC user", zap.String("provider", provider.Name), zap.String("username", user.Username))
+			return nil
+		}
+
+		if !matched || (user.Admin == admin && user.Permissions == string(jsonPermissions)) {
+			return nil
+		}
+
+		user.Admin = admin
+		user.Permissions = string(jsonPermissions)
+		if err := tx.Model(&user).Select("admin", "permissions").Updates(&user).Error; err != nil {
+			return fmt.Errorf("failed_to_edit_user")
+		}
+
+		return nil
+	})
+
+	return user, err
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// testIdentityProvider is an OpenID Connect provider that issues an ID
+// token with the claims registered for a code, once the PKCE verifier of
+// the login matches.
+type testIdentityProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	mu       sync.Mutex
+	codes    map[string]jwt.MapClaims
+	userinfo map[string]interface{}
+}
+
+func startTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate a key: %v", err)
+	}
+
+	idp := &testIdentityProvider{key: key, codes: map[string]jwt.MapClaims{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"userinfo_endpoint":      idp.server.URL + "/userinfo",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "test",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		claims, ok := idp.codes[r.FormValue("code")]
+		delete(idp.codes, r.FormValue("code"))
+		idp.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != claims["challenge"] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		delete(claims, "challenge")
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, _ := token.SignedString(key)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		json.NewEncoder(w).Encode(idp.userinfo)
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// login runs a login through the provider, which signs the user in with
+// the given claims.
+func (idp *testIdentityProvider) login(t *testing.T, claims jwt.MapClaims) (string, error) {
+	t.Helper()
+
+	authURL, state, err := TestAuthService.BeginOIDCLogin(context.Background(), "test-idp")
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin returned an error: %v", err)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if query.Get("state") != state || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("Expected the state and a PKCE challenge in %s", authURL)
+	}
+
+	claims["iss"] = idp.server.URL
+	claims["aud"] = "kalmia"
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	claims["nonce"] = query.Get("nonce")
+	claims["challenge"] = query.Get("code_challenge")
+
+	idp.mu.Lock()
+	idp.codes["code-"+state] = claims
+	idp.mu.Unlock()
+
+	return TestAuthService.FinishOIDCLogin(context.Background(), "test-idp", state, "code-"+state)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := startTestIdentityProvider(t)
+
+	previous := config.ParsedConfig.OIDCProviders
+	t.Cleanup(func() { config.ParsedConfig.OIDCProviders = previous })
+
+	provider := config.OIDCProvider{
+		Name:           "test-idp",
+		Issuer:         idp.server.URL,
+		ClientID:       "kalmia",
+		ClientSecret:   "secret",
+		RedirectURL:    "http://localhost/kal-api/oauth/oidc/test-idp/callback",
+		AutoProvision:  true,
+		AllowedDomains: []string{"sso.example.com"},
+		GroupMappings: []config.OIDCGroupMapping{
+			{Group: "docs-admins", Admin: true},
+			{Group: "docs-writers", Permissions: []string{"read", "write"}},
+			{Group: "docs-cleaners", Permissions: []string{"delete"}},
+		},
+	}
+	provider.SetDefault()
+	config.ParsedConfig.OIDCProviders = []config.OIDCProvider{provider}
+
+	t.Cleanup(func() {
+		for _, email := range []string{"writer@sso.example.com", "writer2@sso.example.com"} {
+			if user, err := TestAuthService.FindUserByEmail(email); err == nil {
+				TestAuthService.DeleteUser(user.Username)
+			}
+		}
+	})
+
+	t.Run("Provisions users with the roles of their groups", func(t *testing.T) {
+		email, err := idp.login(t, jwt.MapClaims{
+			"sub":                "writer",
+			"email":              "writer@sso.example.com",
+			"email_verified":     true,
+			"preferred_username": "writer.one",
+			"groups":             []string{"docs-writers", "docs-cleaners", "unmapped"},
+		})
+		if err != nil || email != "writer@sso.example.com" {
+			t.Fatalf("Expected the user to be provisioned, got %q (%v)", email, err)
+		}
+
+		user, _ := TestAuthService.FindUserByEmail(email)
+		if user.Username != "writerone" || user.Admin || user.Permissions != `["read","write","delete"]` {
+			t.Errorf("Unexpected user %s, admin %v, permissions %s", user.Username, user.Admin, user.Permissions)
+		}
+	})
+
+	t.Run("Updates roles and picks a free username", func(t *testing.T) {
+		if _, err := idp.login(t, jwt.MapClaims{
+			"sub":                "writer",
+			"email":              "writer@sso.example.com",
+			"email_verified":     true,
+			"preferred_username": "writer.one",
+			"groups":             []string{"docs-admins"},
+		}); err != nil {
+			t.Fatalf("FinishOIDCLogin returned an error: %v", err)
+		}
+
+		user, _ := TestAuthService.FindUserByEmail("writer@sso.example.com")
+		if !user.Admin || user.Permissions != `["all"]` {
+			t.Errorf("Expected the user to become an admin, got %v %s", user.Admin, user.Permissions)
+		}
+
+		// claims from the userinfo endpoint count when the ID token has none
+		idp.userinfo = map[string]interface{}{"sub": "writer2", "email_verified": true, "groups": []string{"docs-writers"}}
+		if _, err := idp.login(t, jwt.MapClaims{
+			"sub":                "writer2",
+			"email":              "writer2@sso.example.com",
+			"preferred_username": "writer.one",
+		}); err != nil {
+			t.Fatalf("FinishOIDCLogin returned an error: %v", err)
+		}
+
+		second, _ := TestAuthService.FindUserByEmail("writer2@sso.example.com")
+		if second.Username != "writerone2" || second.Permissions != `["read","write"]` {
+			t.Errorf("Unexpected user %s with permissions %s", second.Username, second.Permissions)
+		}
+	})
+
+	t.Run("Users in no mapped group keep their roles", func(t *testing.T) {
+		idp.userinfo = nil
+		if _, err := idp.login(t, jwt.MapClaims{"sub": "writer", "email": "writer@sso.example.com", "email_verified": true, "groups": []string{"unmapped"}}); err != nil {
+			t.Fatalf("FinishOIDCLogin returned an error: %v", err)
+		}
+
+		user, _ := TestAuthService.FindUserByEmail("writer@sso.example.com")
+		if !user.Admin {
+			t.Errorf("Expected the user to stay an admin")
+		}
+	})
+
+	t.Run("Refuses other domains and unverified emails", func(t *testing.T) {
+		if _, err := idp.login(t, jwt.MapClaims{"sub": "outsider", "email": "outsider@example.org", "email_verified": true}); err == nil || err.Error() != "oidc_domain_not_allowed" {
+			t.Errorf("Expected oidc_domain_not_allowed, got %v", err)
+		}
+
+		if _, err := idp.login(t, jwt.MapClaims{"sub": "writer", "email": "writer@sso.example.com", "email_verified": false}); err == nil || err.Error() != "oidc_email_not_verified" {
+			t.Errorf("Expected oidc_email_not_verified, got %v", err)
+		}
+
+		// an email the provider says nothing about is not trusted either
+		if _, err := idp.login(t, jwt.MapClaims{"sub": "writer", "email": "writer@sso.example.com"}); err == nil || err.Error() != "oidc_email_not_verified" {
+			t.Errorf("Expected oidc_email_not_verified without the claim, got %v", err)
+		}
+	})
+
+	t.Run("Only provisions when enabled", func(t *testing.T) {
+		config.ParsedConfig.OIDCProviders[0].AutoProvision = false
+		t.Cleanup(func() { config.ParsedConfig.OIDCProviders[0].AutoProvision = true })
+
+		if _, err := idp.login(t, jwt.MapClaims{"sub": "new", "email": "new@sso.example.com", "email_verified": true}); err == nil || err.Error() != "user_not_found" {
+			t.Errorf("Expected user_not_found, got %v", err)
+		}
+
+		if email, err := idp.login(t, jwt.MapClaims{"sub": "user", "email": "user@kalmia.difuse.io", "email_verified": true}); err != nil || email != "user@kalmia.difuse.io" {
+			t.Errorf("Expected an existing user to sign in, got %q (%v)", email, err)
+		}
+	})
+
+	t.Run("States work once", func(t *testing.T) {
+		_, state, err := TestAuthService.BeginOIDCLogin(context.Background(), "test-idp")
+		if err != nil {
+			t.Fatalf("BeginOIDCLogin returned an error: %v", err)
+		}
+
+		if _, err := TestAuthService.FinishOIDCLogin(context.Background(), "test-idp", state, "unknown"); err == nil || err.Error() != "oidc_exchange_failed" {
+			t.Errorf("Expected oidc_exchange_failed, got %v", err)
+		}
+
+		if _, err := TestAuthService.FinishOIDCLogin(context.Background(), "test-idp", state, "unknown"); err == nil || err.Error() != "invalid_oidc_state" {
+			t.Errorf("Expected invalid_oidc_state, got %v", err)
+		}
+
+		var count int64
+		TestAuthService.DB.Model(&models.OIDCLogin{}).Count(&count)
+		if count != 0 {
+			t.Errorf("Expected no pending logins, got %d", count)
+		}
+	})
+}
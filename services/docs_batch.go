@@ -0,0 +1,535 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+
+	BatchPage      = "page"
+	BatchPageGroup = "page_group"
+)
+
+// BatchOperation creates, updates or deletes a page or a page group. Items
+// created earlier in the same batch are referred to by the ref they were
+// created with instead of an id.
+type BatchOperation struct {
+	Op              string          `json:"op" validate:"required,oneof=create update delete"`
+	Type            string          `json:"type" validate:"required,oneof=page page_group"`
+	Ref             string          `json:"ref"`   // temporary id for the item created
+	ID              uint            `json:"id"`    // item to update or delete
+	IDRef           string          `json:"idRef"` // or the ref of one created earlier
+	DocumentationID uint            `json:"documentationId"`
+	ParentID        *uint           `json:"parentId"`  // page group of a page, or parent of a page group
+	ParentRef       string          `json:"parentRef"` // or the ref of one created earlier
+	Revision        uint            `json:"revision"`  // revision an update was made on; 0 skips the check
+	Title           *string         `json:"title"`
+	Slug            *string         `json:"slug"`
+	Content         *string         `json:"content"`
+	Name            *string         `json:"name"`
+	Label           *string         `json:"label"`
+	Order           *uint           `json:"order"`
+	SEO             *models.PageSEO `json:"seo"`
+}
+
+type BatchResult struct {
+	IDs     map[string]uint   `json:"ids"` // ref to the id of the item created
+	Results []BatchItemResult `json:"results"`
+}
+
+type BatchItemResult struct {
+	Op   string `json:"op"`
+	Type string `json:"type"`
+	ID   uint   `json:"id"`
+}
+
+// BatchError is the error of the operation that failed a batch.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e BatchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e BatchError) Unwrap() error {
+	return e.Err
+}
+
+type batchRun struct {
+	service *DocService
+	tx      *gorm.DB
+	user    models.User
+	refs    map[string]map[string]uint // type to ref to id
+	docIds  map[uint]bool              // documentations changed
+}
+
+func (run *batchRun) resolve(itemType string, id uint, ref string) (uint, error) {
+	if ref == "" {
+		return id, nil
+	}
+
+	resolved, ok := run.refs[itemType][ref]
+	if !ok {
+		return 0, fmt.Errorf("invalid_ref")
+	}
+
+	return resolved, nil
+}
+
+func (run *batchRun) parent(op BatchOperation) (*uint, error) {
+	if op.ParentRef == "" {
+		return op.ParentID, nil
+	}
+
+	id, err := run.resolve(BatchPageGroup, 0, op.ParentRef)
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+func (run *batchRun) remember(itemType string, ref string, id uint) error {
+	if ref == "" {
+		return nil
+	}
+
+	if _, exists := run.refs[itemType][ref]; exists {
+		return fmt.Errorf("duplicate_ref")
+	}
+
+	run.refs[itemType][ref] = id
+	return nil
+}
+
+// rootOf is GetRootParentID within the batch's transaction.
+func (run *batchRun) rootOf(docId uint) (uint, error) {
+	for {
+		var doc models.Documentation
+		if err := run.tx.Unscoped().Select("id", "cloned_from").First(&doc, docId).Error; err != nil {
+			return 0, err
+		}
+
+		if doc.ClonedFrom == nil || *doc.ClonedFrom == 0 || *doc.ClonedFrom == doc.ID {
+			return doc.ID, nil
+		}
+
+		docId = *doc.ClonedFrom
+	}
+}
+
+func (run *batchRun) slugTaken(docId uint, slug string, exceptId uint) error {
+	var count int64
+	if err := run.tx.Model(&models.Page{}).Where("documentation_id = ? AND slug = ? AND id <> ?", docId, slug, exceptId).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed_to_verify_page_slug")
+	}
+	if count > 0 {
+		return fmt.Errorf("page_slug_already_exists")
+	}
+	return nil
+}
+
+func (run *batchRun) apply(op BatchOperation) (uint, error) {
+	if op.Op != BatchCreate && op.Ref != "" {
+		return 0, fmt.Errorf("invalid_operation")
+	}
+
+	switch op.Type + ":" + op.Op {
+	case BatchPage + ":" + BatchCreate:
+		return run.createPage(op)
+	case BatchPage + ":" + BatchUpdate:
+		return run.updatePage(op)
+	case BatchPage + ":" + BatchDelete:
+		return run.deletePage(op)
+	case BatchPageGroup + ":" + BatchCreate:
+		return run.createPageGroup(op)
+	case BatchPageGroup + ":" + BatchUpdate:
+		return run.updatePageGroup(op)
+	case BatchPageGroup + ":" + BatchDelete:
+		return run.deletePageGroup(op)
+	}
+
+	return 0, fmt.Errorf("invalid_operation")
+}
+
+func (run *batchRun) createPage(op BatchOperation) (uint, error) {
+	if op.Title == nil || op.Slug == nil || *op.Title == "" || *op.Slug == "" {
+		return 0, fmt.Errorf("invalid_operation")
+	}
+
+	groupId, err := run.parent(op)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkTransferTarget(run.tx, op.DocumentationID, groupId, 0); err != nil {
+		return 0, err
+	}
+
+	if err := run.slugTaken(op.DocumentationID, *op.Slug, 0); err != nil {
+		return 0, err
+	}
+
+	page := models.Page{
+		Title:           *op.Title,
+		Slug:            *op.Slug,
+		Content:         "[]",
+		DocumentationID: op.DocumentationID,
+		PageGroupID:     groupId,
+		Order:           op.Order,
+		AuthorID:        run.user.ID,
+		Editors:         []models.User{run.user},
+		LastEditorID:    &run.user.ID,
+	}
+
+	if op.Content != nil {
+		page.Content = *op.Content
+	}
+
+	if op.SEO != nil {
+		if err := validatePageSEO(*op.SEO); err != nil {
+			return 0, err
+		}
+		page.PageSEO = *op.SEO
+	}
+
+	if err := run.tx.Create(&page).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_create_page")
+	}
+
+	run.docIds[page.DocumentationID] = true
+	return page.ID, run.remember(BatchPage, op.Ref, page.ID)
+}
+
+func (run *batchRun) updatePage(op BatchOperation) (uint, error) {
+	id, err := run.resolve(BatchPage, op.ID, op.IDRef)
+	if err != nil {
+		return 0, err
+	}
+
+	var page models.Page
+	if err := run.tx.First(&page, id).Error; err != nil {
+		return 0, fmt.Errorf("page_not_found")
+	}
+
+	if op.Revision != 0 {
+		if err := claimRevision(run.tx, &models.Page{}, id, op.Revision, "page_not_found"); err != nil {
+			return 0, err
+		}
+	} else if err := run.tx.Model(&models.Page{}).Where("id = ?", id).UpdateColumn("revision", gorm.Expr("revision + 1")).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_update_revision")
+	}
+
+	before := page
+	page.Revision++
+
+	groupId, err := run.parent(op)
+	if err != nil {
+		return 0, err
+	}
+
+	if groupId != nil {
+		if err := checkTransferTarget(run.tx, page.DocumentationID, groupId, 0); err != nil {
+			return 0, err
+		}
+		page.PageGroupID = groupId
+	}
+
+	if op.Title != nil && *op.Title != "" {
+		page.Title = *op.Title
+	}
+	if op.Slug != nil && *op.Slug != "" {
+		if err := run.slugTaken(page.DocumentationID, *op.Slug, page.ID); err != nil {
+			return 0, err
+		}
+		page.Slug = *op.Slug
+	}
+	if op.Content != nil {
+		page.Content = *op.Content
+	}
+	if op.Order != nil {
+		page.Order = op.Order
+	}
+	if op.SEO != nil {
+		if err := validatePageSEO(*op.SEO); err != nil {
+			return 0, err
+		}
+		page.PageSEO = *op.SEO
+	}
+	page.LastEditorID = &run.user.ID
+
+	if err := run.tx.Omit("Editors", "Tags", "Author").Save(&page).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_update_page")
+	}
+
+	if err := run.tx.Model(&page).Association("Editors").Append(&run.user); err != nil {
+		return 0, fmt.Errorf("failed_to_add_editor")
+	}
+
+	if err := savePageRevision(run.tx, before, page, run.user.ID); err != nil {
+		return 0, fmt.Errorf("failed_to_save_page_revision")
+	}
+
+	run.docIds[page.DocumentationID] = true
+	return page.ID, nil
+}
+
+func (run *batchRun) deletePage(op BatchOperation) (uint, error) {
+	id, err := run.resolve(BatchPage, op.ID, op.IDRef)
+	if err != nil {
+		return 0, err
+	}
+
+	var page models.Page
+	if err := run.tx.Preload("Editors").First(&page, id).Error; err != nil {
+		return 0, fmt.Errorf("page_not_found")
+	}
+
+	rootId, err := run.rootOf(page.DocumentationID)
+	if err != nil {
+		return 0, fmt.Errorf("failed_to_get_documentation_id")
+	}
+
+	var snapshot trashSnapshot
+	snapshot.addPage(page)
+
+	if err := run.service.moveToTrash(run.tx, &run.user, TrashItemPage, page.ID, page.Title, page.DocumentationID, rootId, snapshot); err != nil {
+		return 0, err
+	}
+
+	if err := run.tx.Model(&page).Association("Editors").Clear(); err != nil {
+		return 0, fmt.Errorf("failed_to_clear_page_associations")
+	}
+
+	if err := run.tx.Delete(&page).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_delete_page")
+	}
+
+	run.docIds[page.DocumentationID] = true
+	return page.ID, nil
+}
+
+func (run *batchRun) createPageGroup(op BatchOperation) (uint, error) {
+	if op.Name == nil || *op.Name == "" {
+		return 0, fmt.Errorf("invalid_operation")
+	}
+
+	parentId, err := run.parent(op)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkTransferTarget(run.tx, op.DocumentationID, parentId, 0); err != nil {
+		return 0, err
+	}
+
+	group := models.PageGroup{
+		Name:            *op.Name,
+		DocumentationID: op.DocumentationID,
+		ParentID:        parentId,
+		Order:           op.Order,
+		AuthorID:        run.user.ID,
+		Editors:         []models.User{run.user},
+		LastEditorID:    &run.user.ID,
+	}
+
+	if op.Label != nil {
+		group.Label = *op.Label
+	}
+
+	if err := run.tx.Create(&group).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_create_page_group")
+	}
+
+	run.docIds[group.DocumentationID] = true
+	return group.ID, run.remember(BatchPageGroup, op.Ref, group.ID)
+}
+
+func (run *batchRun) updatePageGroup(op BatchOperation) (uint, error) {
+	id, err := run.resolve(BatchPageGroup, op.ID, op.IDRef)
+	if err != nil {
+		return 0, err
+	}
+
+	var group models.PageGroup
+	if err := run.tx.First(&group, id).Error; err != nil {
+		return 0, fmt.Errorf("page_group_not_found")
+	}
+
+	if op.Revision != 0 {
+		if err := claimRevision(run.tx, &models.PageGroup{}, id, op.Revision, "page_group_not_found"); err != nil {
+			return 0, err
+		}
+	} else if err := run.tx.Model(&models.PageGroup{}).Where("id = ?", id).UpdateColumn("revision", gorm.Expr("revision + 1")).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_update_revision")
+	}
+	group.Revision++
+
+	parentId, err := run.parent(op)
+	if err != nil {
+		return 0, err
+	}
+
+	if parentId != nil {
+		if err := checkTransferTarget(run.tx, group.DocumentationID, parentId, group.ID); err != nil {
+			return 0, err
+		}
+		group.ParentID = parentId
+	}
+
+	if op.Name != nil && *op.Name != "" {
+		group.Name = *op.Name
+	}
+	if op.Label != nil {
+		group.Label = *op.Label
+	}
+	if op.Order != nil {
+		group.Order = op.Order
+	}
+	group.LastEditorID = &run.user.ID
+
+	if err := run.tx.Omit("Editors", "Pages", "Author").Save(&group).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_update_page_group")
+	}
+
+	if err := run.tx.Model(&group).Association("Editors").Append(&run.user); err != nil {
+		return 0, fmt.Errorf("failed_to_add_editor")
+	}
+
+	run.docIds[group.DocumentationID] = true
+	return group.ID, nil
+}
+
+func (run *batchRun) deletePageGroup(op BatchOperation) (uint, error) {
+	id, err := run.resolve(BatchPageGroup, op.ID, op.IDRef)
+	if err != nil {
+		return 0, err
+	}
+
+	var group models.PageGroup
+	if err := run.tx.Select("id", "documentation_id").First(&group, id).Error; err != nil {
+		return 0, fmt.Errorf("page_group_not_found")
+	}
+
+	rootId, err := run.rootOf(group.DocumentationID)
+	if err != nil {
+		return 0, fmt.Errorf("failed_to_get_documentation_id")
+	}
+
+	var snapshot trashSnapshot
+	if err := collectPageGroupTree(run.tx, id, &snapshot); err != nil {
+		return 0, err
+	}
+
+	if err := run.service.moveToTrash(run.tx, &run.user, TrashItemPageGroup, id, snapshot.PageGroups[0].Label, group.DocumentationID, rootId, snapshot); err != nil {
+		return 0, err
+	}
+
+	if err := run.service.deletePageGroupRecursive(run.tx, id); err != nil {
+		return 0, err
+	}
+
+	run.docIds[group.DocumentationID] = true
+	return id, nil
+}
+
+// RunBatch applies operations in order in one transaction: either all of
+// them are applied or, when one fails, none is. Each documentation changed
+// is rebuilt once.
+func (service *DocService) RunBatch(user models.User, operations []BatchOperation) (BatchResult, error) {
+	// Redirects are recorded for what existing items the batch moves, so
+	// their paths are taken before it runs. They are written once the batch
+	// is committed, and failing to write them does not undo it.
+	oldPagePaths := make(map[uint][]string)
+	oldGroupPaths := make(map[uint][]string)
+	for _, op := range operations {
+		if op.Op != BatchUpdate || op.ID == 0 {
+			continue
+		}
+		if op.Type == BatchPage {
+			oldPagePaths[op.ID], _ = service.pagePaths(op.ID)
+		} else {
+			oldGroupPaths[op.ID], _ = service.pageGroupPaths(op.ID)
+		}
+	}
+
+	run := batchRun{
+		service: service,
+		user:    user,
+		refs:    map[string]map[string]uint{BatchPage: {}, BatchPageGroup: {}},
+		docIds:  make(map[uint]bool),
+	}
+
+	result := BatchResult{IDs: make(map[string]uint), Results: []BatchItemResult{}}
+
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		run.tx = tx
+
+		for i, op := range operations {
+			id, err := run.apply(op)
+			if err != nil {
+				return BatchError{Index: i, Err: err}
+			}
+
+			if op.Ref != "" {
+				result.IDs[op.Ref] = id
+			}
+			result.Results = append(result.Results, BatchItemResult{Op: op.Op, Type: op.Type, ID: id})
+		}
+
+		return nil
+	})
+	if err != nil {
+		var batchErr BatchError
+		if !errors.As(err, &batchErr) {
+			err = fmt.Errorf("failed_to_run_batch")
+		}
+		return BatchResult{}, err
+	}
+
+	for id, oldPaths := range oldPagePaths {
+		if newPaths, err := service.pagePaths(id); err == nil {
+			docId, _ := service.GetDocumentationIDOfPage(id)
+			if err := service.recordMovedPaths(docId, oldPaths, newPaths, false, RedirectPage); err != nil {
+				logger.Error("failed to record redirects of a batch", zap.Uint("page_id", id), zap.Error(err))
+			}
+		}
+	}
+
+	for id, oldPaths := range oldGroupPaths {
+		if newPaths, err := service.pageGroupPaths(id); err == nil {
+			docId, _ := service.GetDocumentationIDOfPageGroup(id)
+			if err := service.recordMovedPaths(docId, oldPaths, newPaths, true, RedirectPageGroup); err != nil {
+				logger.Error("failed to record redirects of a batch", zap.Uint("page_group_id", id), zap.Error(err))
+			}
+		}
+	}
+
+	roots := make(map[uint]bool)
+	for docId := range run.docIds {
+		rootId, err := service.GetRootParentID(docId)
+		if err != nil {
+			return BatchResult{}, fmt.Errorf("failed_to_get_documentation_id")
+		}
+		roots[rootId] = true
+	}
+
+	for rootId := range roots {
+		if err := service.AddBuildTrigger(rootId, false); err != nil {
+			return BatchResult{}, fmt.Errorf("failed_to_add_build_trigger")
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestRunBatch(t *testing.T) {
+	admin := getTestAdmin(t)
+
+	v1 := createTestDocumentation(t, "Batch Doc", "1.0.0", nil)
+	v2 := createTestDocumentation(t, "Batch Doc", "2.0.0", &v1.ID)
+	existing := createTestPage(t, v1.ID, nil, "/existing", 1)
+	obsolete := createTestPage(t, v2.ID, nil, "/obsolete", 2)
+
+	var triggersBefore int64
+	TestDocService.DB.Model(&models.BuildTriggers{}).Where("documentation_id = ?", v1.ID).Count(&triggersBefore)
+
+	result, err := TestDocService.RunBatch(admin, []BatchOperation{
+		{Op: BatchCreate, Type: BatchPageGroup, Ref: "guides", DocumentationID: v2.ID, Name: stringPtr("guides")},
+		{Op: BatchCreate, Type: BatchPageGroup, Ref: "advanced", DocumentationID: v2.ID, ParentRef: "guides", Name: stringPtr("advanced")},
+		{Op: BatchCreate, Type: BatchPage, Ref: "tuning", DocumentationID: v2.ID, ParentRef: "advanced", Title: stringPtr("Tuning"), Slug: stringPtr("/tuning")},
+		{Op: BatchUpdate, Type: BatchPage, IDRef: "tuning", Content: stringPtr("[" + snippetTestBlock("Tune") + "]")},
+		{Op: BatchUpdate, Type: BatchPage, ID: existing.ID, Revision: 1, Title: stringPtr("Existing")},
+		{Op: BatchDelete, Type: BatchPage, ID: obsolete.ID},
+	})
+	if err != nil {
+		t.Fatalf("RunBatch returned an error: %v", err)
+	}
+
+	if len(result.IDs) != 3 || len(result.Results) != 6 {
+		t.Fatalf("Unexpected batch result: %+v", result)
+	}
+
+	var tuning models.Page
+	if err := TestDocService.DB.First(&tuning, result.IDs["tuning"]).Error; err != nil {
+		t.Fatalf("Expected the page to be created: %v", err)
+	}
+	if tuning.PageGroupID == nil || *tuning.PageGroupID != result.IDs["advanced"] || tuning.Content != "["+snippetTestBlock("Tune")+"]" {
+		t.Errorf("Unexpected created page: %+v", tuning)
+	}
+
+	var advanced models.PageGroup
+	TestDocService.DB.First(&advanced, result.IDs["advanced"])
+	if advanced.ParentID == nil || *advanced.ParentID != result.IDs["guides"] {
+		t.Errorf("Expected the nested group to be created under its parent, got %+v", advanced)
+	}
+
+	var updated models.Page
+	TestDocService.DB.First(&updated, existing.ID)
+	if updated.Title != "Existing" || updated.Revision != 2 {
+		t.Errorf("Unexpected updated page: %+v", updated)
+	}
+
+	var obsoleteCount int64
+	TestDocService.DB.Model(&models.Page{}).Where("id = ?", obsolete.ID).Count(&obsoleteCount)
+	if obsoleteCount != 0 {
+		t.Errorf("Expected the page to be deleted")
+	}
+
+	var triggersAfter int64
+	TestDocService.DB.Model(&models.BuildTriggers{}).Where("documentation_id = ?", v1.ID).Count(&triggersAfter)
+	if triggersAfter-triggersBefore != 1 {
+		t.Errorf("Expected one build trigger for the root documentation, got %d", triggersAfter-triggersBefore)
+	}
+
+	var pagesBefore int64
+	TestDocService.DB.Model(&models.Page{}).Where("documentation_id = ?", v2.ID).Count(&pagesBefore)
+
+	_, err = TestDocService.RunBatch(admin, []BatchOperation{
+		{Op: BatchCreate, Type: BatchPage, DocumentationID: v2.ID, Title: stringPtr("Fresh"), Slug: stringPtr("/fresh")},
+		{Op: BatchCreate, Type: BatchPage, DocumentationID: v2.ID, Title: stringPtr("Duplicate"), Slug: stringPtr("/tuning")},
+	})
+
+	var batchErr BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || batchErr.Error() != "page_slug_already_exists" {
+		t.Fatalf("Expected page_slug_already_exists for the second operation, got %v", err)
+	}
+
+	var pagesAfter int64
+	TestDocService.DB.Model(&models.Page{}).Where("documentation_id = ?", v2.ID).Count(&pagesAfter)
+	if pagesAfter != pagesBefore {
+		t.Errorf("Expected a failed batch to create nothing, got %d pages instead of %d", pagesAfter, pagesBefore)
+	}
+
+	if _, err := TestDocService.RunBatch(admin, []BatchOperation{
+		{Op: BatchCreate, Type: BatchPage, DocumentationID: v2.ID, ParentRef: "missing", Title: stringPtr("Orphan"), Slug: stringPtr("/orphan")},
+	}); err == nil || err.Error() != "invalid_ref" {
+		t.Errorf("Expected invalid_ref, got %v", err)
+	}
+}
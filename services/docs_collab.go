@@ -0,0 +1,432 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"go.uber.org/zap"
+)
+
+// collabSaveDelay is how long a session waits after the last snapshot before
+// writing it to the page, so a burst of typing results in a single save.
+const collabSaveDelay = 3 * time.Second
+
+// collabSendBuffer is how many messages may queue up for a slow peer before
+// it is dropped from the session.
+const collabSendBuffer = 256
+
+// collabHistoryLimit and collabHistoryBytes bound the updates a session keeps
+// for late joiners. Once either is reached, further updates are refused until
+// an editor sends a snapshot that replaces them.
+const (
+	collabHistoryLimit = 1000
+	collabHistoryBytes = 8 * 1024 * 1024
+)
+
+// collabTicketTTL is how long a ticket from IssueCollabTicket can be used to
+// open the WebSocket.
+const collabTicketTTL = 30 * time.Second
+
+type CollabUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Photo    string `json:"photo,omitempty"`
+}
+
+// CollabUpdate is a base64 encoded Yjs update together with the sequence
+// number the session assigned to it.
+type CollabUpdate struct {
+	Seq    uint64 `json:"seq"`
+	Update string `json:"update"`
+}
+
+// CollabMessage is the envelope exchanged with editors over the WebSocket.
+//
+// Editors send "update" (an incremental Yjs update), "awareness" (cursor and
+// selection state) and "snapshot" (the merged document, both as a full Yjs
+// state in Update and as BlockNote JSON in Content, with Seq set to the last
+// update they applied). The server sends "sync" on join, relays "update" and
+// "awareness", acknowledges own updates with "ack", and reports "presence",
+// "saved", "conflict" and "error". An update refused with
+// "collab_snapshot_required" is sent again after the editor sends a snapshot.
+type CollabMessage struct {
+	Type     string          `json:"type"`
+	Seq      uint64          `json:"seq,omitempty"`
+	Update   string          `json:"update,omitempty"`
+	Updates  []CollabUpdate  `json:"updates,omitempty"`
+	State    json.RawMessage `json:"state,omitempty"`
+	Title    string          `json:"title,omitempty"`
+	Slug     string          `json:"slug,omitempty"`
+	Content  string          `json:"content,omitempty"`
+	UserID   uint            `json:"userId,omitempty"`
+	Users    []CollabUser    `json:"users,omitempty"`
+	Revision uint            `json:"revision,omitempty"`
+	Message  string          `json:"message,omitempty"`
+}
+
+// CollabPeer is one connected editor. Messages for it are queued on Send,
+// which is closed once the peer has left the session.
+type CollabPeer struct {
+	User models.User
+	Send chan CollabMessage
+}
+
+func NewCollabPeer(user models.User) *CollabPeer {
+	return &CollabPeer{User: user, Send: make(chan CollabMessage, collabSendBuffer)}
+}
+
+type collabSnapshot struct {
+	seq     uint64
+	user    models.User
+	title   string
+	slug    string
+	content string
+}
+
+type collabRoom struct {
+	mu       sync.Mutex
+	pageID   uint
+	peers    map[*CollabPeer]struct{}
+	history  []CollabUpdate
+	size     int
+	seq      uint64
+	revision uint
+	pending  *collabSnapshot
+	timer    *time.Timer
+	saving   bool
+}
+
+// deliver queues msg for peer. A peer that cannot keep up is dropped, its
+// connection is closed and the reader leaves the session.
+func (room *collabRoom) deliver(peer *CollabPeer, msg CollabMessage) {
+	select {
+	case peer.Send <- msg:
+	default:
+		delete(room.peers, peer)
+		close(peer.Send)
+	}
+}
+
+// send queues msg for every peer except skip.
+func (room *collabRoom) send(msg CollabMessage, skip *CollabPeer) {
+	for peer := range room.peers {
+		if peer != skip {
+			room.deliver(peer, msg)
+		}
+	}
+}
+
+// setHistory replaces the updates kept for late joiners.
+func (room *collabRoom) setHistory(history []CollabUpdate) {
+	room.history = history
+	room.size = 0
+	for _, update := range history {
+		room.size += len(update.Update)
+	}
+}
+
+func (room *collabRoom) presence() CollabMessage {
+	seen := make(map[uint]bool)
+	users := []CollabUser{}
+	for peer := range room.peers {
+		if seen[peer.User.ID] {
+			continue
+		}
+		seen[peer.User.ID] = true
+		users = append(users, CollabUser{ID: peer.User.ID, Username: peer.User.Username, Photo: peer.User.Photo})
+	}
+
+	return CollabMessage{Type: "presence", Users: users}
+}
+
+type collabTicket struct {
+	user      models.User
+	pageID    uint
+	expiresAt time.Time
+}
+
+// IssueCollabTicket returns a single-use ticket that lets user open the
+// editing session of a page. Browsers cannot send an Authorization header
+// with a WebSocket handshake, and the ticket keeps the JWT out of the URL.
+func (service *DocService) IssueCollabTicket(user models.User, pageID uint) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed_to_create_ticket")
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(raw)
+
+	service.collabMu.Lock()
+	defer service.collabMu.Unlock()
+
+	now := time.Now()
+	for key, issued := range service.collabTickets {
+		if now.After(issued.expiresAt) {
+			delete(service.collabTickets, key)
+		}
+	}
+
+	if service.collabTickets == nil {
+		service.collabTickets = make(map[string]collabTicket)
+	}
+	service.collabTickets[ticket] = collabTicket{user: user, pageID: pageID, expiresAt: now.Add(collabTicketTTL)}
+
+	return ticket, nil
+}
+
+// RedeemCollabTicket returns the user a ticket was issued to, if it is still
+// valid for the page. A ticket works only once.
+func (service *DocService) RedeemCollabTicket(ticket string, pageID uint) (models.User, error) {
+	service.collabMu.Lock()
+	defer service.collabMu.Unlock()
+
+	issued, ok := service.collabTickets[ticket]
+	if !ok {
+		return models.User{}, fmt.Errorf("invalid_ticket")
+	}
+	delete(service.collabTickets, ticket)
+
+	if issued.pageID != pageID || time.Now().After(issued.expiresAt) {
+		return models.User{}, fmt.Errorf("invalid_ticket")
+	}
+
+	return issued.user, nil
+}
+
+// lockCollabRoom returns the locked session of a page that peer is part of.
+func (service *DocService) lockCollabRoom(pageID uint, peer *CollabPeer) (*collabRoom, error) {
+	service.collabMu.Lock()
+	defer service.collabMu.Unlock()
+
+	room, ok := service.collabRooms[pageID]
+	if !ok {
+		return nil, fmt.Errorf("collab_session_not_found")
+	}
+
+	room.mu.Lock()
+	if _, ok := room.peers[peer]; !ok {
+		room.mu.Unlock()
+		return nil, fmt.Errorf("collab_session_not_found")
+	}
+
+	return room, nil
+}
+
+// JoinCollabSession adds peer to the editing session of a page, starting one
+// if needed. The peer first receives a "sync" message with the updates made
+// so far, and everyone is told about the new presence list.
+func (service *DocService) JoinCollabSession(pageID uint, peer *CollabPeer) error {
+	service.collabMu.Lock()
+	defer service.collabMu.Unlock()
+
+	room, ok := service.collabRooms[pageID]
+	if !ok {
+		var page models.Page
+		if err := service.DB.Select("id", "revision").First(&page, pageID).Error; err != nil {
+			return fmt.Errorf("page_not_found")
+		}
+
+		room = &collabRoom{pageID: pageID, peers: make(map[*CollabPeer]struct{}), revision: page.Revision}
+		if service.collabRooms == nil {
+			service.collabRooms = make(map[uint]*collabRoom)
+		}
+		service.collabRooms[pageID] = room
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	room.peers[peer] = struct{}{}
+	peer.Send <- CollabMessage{
+		Type:     "sync",
+		Seq:      room.seq,
+		Updates:  append([]CollabUpdate(nil), room.history...),
+		Revision: room.revision,
+	}
+	room.send(room.presence(), nil)
+
+	return nil
+}
+
+// LeaveCollabSession removes peer from the session. When the last editor
+// leaves, any pending snapshot is saved right away and the session ends.
+func (service *DocService) LeaveCollabSession(pageID uint, peer *CollabPeer) {
+	service.collabMu.Lock()
+	room, ok := service.collabRooms[pageID]
+	if !ok {
+		service.collabMu.Unlock()
+		return
+	}
+
+	room.mu.Lock()
+	if _, ok := room.peers[peer]; ok {
+		delete(room.peers, peer)
+		close(peer.Send)
+	}
+
+	empty := len(room.peers) == 0
+	if empty {
+		delete(service.collabRooms, pageID)
+		if room.timer != nil {
+			room.timer.Stop()
+			room.timer = nil
+		}
+	} else {
+		room.send(room.presence(), nil)
+	}
+	room.mu.Unlock()
+	service.collabMu.Unlock()
+
+	if empty {
+		service.saveCollabSnapshot(room)
+	}
+}
+
+// RelayCollabUpdate records a Yjs update from peer and forwards it to the
+// other editors of the page. When the history is full the update is refused
+// and peer is asked for a snapshot instead.
+func (service *DocService) RelayCollabUpdate(pageID uint, peer *CollabPeer, update string) error {
+	if update == "" {
+		return fmt.Errorf("invalid_update")
+	}
+
+	room, err := service.lockCollabRoom(pageID, peer)
+	if err != nil {
+		return err
+	}
+	defer room.mu.Unlock()
+
+	if len(room.history) >= collabHistoryLimit || room.size+len(update) > collabHistoryBytes {
+		return fmt.Errorf("collab_snapshot_required")
+	}
+
+	room.seq++
+	room.history = append(room.history, CollabUpdate{Seq: room.seq, Update: update})
+	room.size += len(update)
+	room.send(CollabMessage{Type: "update", Seq: room.seq, Update: update, UserID: peer.User.ID}, peer)
+
+	room.deliver(peer, CollabMessage{Type: "ack", Seq: room.seq})
+
+	return nil
+}
+
+// NotifyCollabPeer queues msg for peer if it is still part of the session.
+func (service *DocService) NotifyCollabPeer(pageID uint, peer *CollabPeer, msg CollabMessage) {
+	room, err := service.lockCollabRoom(pageID, peer)
+	if err != nil {
+		return
+	}
+	defer room.mu.Unlock()
+
+	room.deliver(peer, msg)
+}
+
+// RelayCollabAwareness forwards awareness state, such as cursors, to the
+// other editors. It is not kept for late joiners.
+func (service *DocService) RelayCollabAwareness(pageID uint, peer *CollabPeer, state json.RawMessage) error {
+	room, err := service.lockCollabRoom(pageID, peer)
+	if err != nil {
+		return err
+	}
+	defer room.mu.Unlock()
+
+	room.send(CollabMessage{Type: "awareness", UserID: peer.User.ID, State: state}, peer)
+
+	return nil
+}
+
+// QueueCollabSnapshot takes the merged document from peer. The full Yjs state
+// replaces every update it already covers, which keeps the history short, and
+// the content is saved to the page once editing settles down.
+func (service *DocService) QueueCollabSnapshot(pageID uint, peer *CollabPeer, msg CollabMessage) error {
+	if msg.Title == "" || msg.Slug == "" {
+		return fmt.Errorf("invalid_snapshot")
+	}
+
+	room, err := service.lockCollabRoom(pageID, peer)
+	if err != nil {
+		return err
+	}
+	defer room.mu.Unlock()
+
+	if msg.Update != "" && msg.Seq <= room.seq {
+		history := []CollabUpdate{{Seq: msg.Seq, Update: msg.Update}}
+		for _, update := range room.history {
+			if update.Seq > msg.Seq {
+				history = append(history, update)
+			}
+		}
+		room.setHistory(history)
+	}
+
+	room.pending = &collabSnapshot{seq: msg.Seq, user: peer.User, title: msg.Title, slug: msg.Slug, content: msg.Content}
+	if room.timer != nil {
+		room.timer.Stop()
+	}
+	room.timer = time.AfterFunc(collabSaveDelay, func() { service.saveCollabSnapshot(room) })
+
+	return nil
+}
+
+// saveCollabSnapshot writes the pending snapshot through EditPage, so the
+// usual revision check and build trigger apply to collaborative edits too.
+// Once saved, the updates it covers are dropped and late joiners start from
+// the page content instead.
+func (service *DocService) saveCollabSnapshot(room *collabRoom) {
+	room.mu.Lock()
+	if room.saving {
+		if room.pending != nil && room.timer == nil {
+			room.timer = time.AfterFunc(collabSaveDelay, func() { service.saveCollabSnapshot(room) })
+		}
+		room.mu.Unlock()
+		return
+	}
+
+	snapshot := room.pending
+	revision := room.revision
+	room.pending = nil
+	room.timer = nil
+	if snapshot == nil {
+		room.mu.Unlock()
+		return
+	}
+	room.saving = true
+	room.mu.Unlock()
+
+	err := service.EditPage(snapshot.user, room.pageID, revision, snapshot.title, snapshot.slug, snapshot.content, nil, nil, nil)
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	room.saving = false
+
+	if err == nil {
+		var history []CollabUpdate
+		for _, update := range room.history {
+			if update.Seq > snapshot.seq {
+				history = append(history, update)
+			}
+		}
+		room.setHistory(history)
+
+		room.revision = revision + 1
+		room.send(CollabMessage{Type: "saved", Revision: room.revision}, nil)
+		return
+	}
+
+	if err.Error() == "revision_conflict" {
+		var page models.Page
+		if err := service.DB.Select("id", "revision").First(&page, room.pageID).Error; err == nil {
+			room.revision = page.Revision
+		}
+		room.send(CollabMessage{Type: "conflict", Revision: room.revision, Message: "revision_conflict"}, nil)
+		return
+	}
+
+	logger.Error("failed to save collaborative edit", zap.Uint("page_id", room.pageID), zap.Error(err))
+	room.send(CollabMessage{Type: "error", Message: err.Error()}, nil)
+}
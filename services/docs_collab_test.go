@@ -0,0 +1,185 @@
+package services
+
+import (
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func nextCollabMessage(t *testing.T, peer *CollabPeer, msgType string) CollabMessage {
+	t.Helper()
+
+	for {
+		select {
+		case msg, ok := <-peer.Send:
+			if !ok {
+				t.Fatalf("Peer channel closed while waiting for %q", msgType)
+			}
+			if msg.Type == msgType {
+				return msg
+			}
+		default:
+			t.Fatalf("No %q message queued", msgType)
+		}
+	}
+}
+
+func TestCollabSessionRelayAndSave(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Collab Doc", "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/collab", 1)
+
+	first := NewCollabPeer(admin)
+	second := NewCollabPeer(admin)
+
+	if err := TestDocService.JoinCollabSession(page.ID, first); err != nil {
+		t.Fatalf("JoinCollabSession returned an error: %v", err)
+	}
+
+	if err := TestDocService.RelayCollabUpdate(page.ID, first, "AQID"); err != nil {
+		t.Fatalf("RelayCollabUpdate returned an error: %v", err)
+	}
+
+	if err := TestDocService.JoinCollabSession(page.ID, second); err != nil {
+		t.Fatalf("JoinCollabSession returned an error: %v", err)
+	}
+
+	sync := nextCollabMessage(t, second, "sync")
+	if len(sync.Updates) != 1 || sync.Updates[0].Update != "AQID" || sync.Revision != 1 {
+		t.Fatalf("Unexpected sync message: %+v", sync)
+	}
+
+	presence := nextCollabMessage(t, first, "presence")
+	if len(presence.Users) != 1 || presence.Users[0].ID != admin.ID {
+		t.Errorf("Expected one present user, got %+v", presence.Users)
+	}
+
+	if err := TestDocService.RelayCollabUpdate(page.ID, second, "BAUG"); err != nil {
+		t.Fatalf("RelayCollabUpdate returned an error: %v", err)
+	}
+
+	update := nextCollabMessage(t, first, "update")
+	if update.Update != "BAUG" || update.Seq != 2 {
+		t.Errorf("Unexpected relayed update: %+v", update)
+	}
+
+	err := TestDocService.QueueCollabSnapshot(page.ID, second, CollabMessage{
+		Type:    "snapshot",
+		Seq:     2,
+		Update:  "FULL",
+		Title:   "Collab",
+		Slug:    "/collab",
+		Content: `[{"type":"paragraph"}]`,
+	})
+	if err != nil {
+		t.Fatalf("QueueCollabSnapshot returned an error: %v", err)
+	}
+
+	TestDocService.LeaveCollabSession(page.ID, first)
+	for range first.Send {
+	}
+
+	room, err := TestDocService.lockCollabRoom(page.ID, second)
+	if err != nil {
+		t.Fatalf("Expected session to stay open: %v", err)
+	}
+	if len(room.history) != 1 || room.history[0].Update != "FULL" {
+		t.Errorf("Expected history to be compacted to the snapshot, got %+v", room.history)
+	}
+	room.mu.Unlock()
+
+	TestDocService.LeaveCollabSession(page.ID, second)
+
+	var saved models.Page
+	TestDocService.DB.First(&saved, page.ID)
+	if saved.Content != `[{"type":"paragraph"}]` || saved.Title != "Collab" || saved.Revision != 2 {
+		t.Errorf("Expected snapshot to be saved at revision 2, got %q (%q) at revision %d", saved.Content, saved.Title, saved.Revision)
+	}
+
+	if err := TestDocService.RelayCollabUpdate(page.ID, second, "BAUG"); err == nil {
+		t.Errorf("Expected closed session to reject updates")
+	}
+}
+
+func TestCollabHistoryLimit(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Collab Limit Doc", "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/collab-limit", 1)
+
+	peer := NewCollabPeer(admin)
+	if err := TestDocService.JoinCollabSession(page.ID, peer); err != nil {
+		t.Fatalf("JoinCollabSession returned an error: %v", err)
+	}
+	defer TestDocService.LeaveCollabSession(page.ID, peer)
+
+	for i := 0; i < collabHistoryLimit; i++ {
+		if err := TestDocService.RelayCollabUpdate(page.ID, peer, "AQID"); err != nil {
+			t.Fatalf("RelayCollabUpdate returned an error after %d updates: %v", i, err)
+		}
+		<-peer.Send
+	}
+
+	if err := TestDocService.RelayCollabUpdate(page.ID, peer, "AQID"); err == nil || err.Error() != "collab_snapshot_required" {
+		t.Fatalf("Expected a full history to ask for a snapshot, got %v", err)
+	}
+
+	err := TestDocService.QueueCollabSnapshot(page.ID, peer, CollabMessage{
+		Type:    "snapshot",
+		Seq:     collabHistoryLimit,
+		Update:  "FULL",
+		Title:   "Collab Limit",
+		Slug:    "/collab-limit",
+		Content: `[{"type":"paragraph"}]`,
+	})
+	if err != nil {
+		t.Fatalf("QueueCollabSnapshot returned an error: %v", err)
+	}
+
+	if err := TestDocService.RelayCollabUpdate(page.ID, peer, string(make([]byte, collabHistoryBytes))); err == nil {
+		t.Errorf("Expected an update over the byte limit to be refused")
+	}
+	if err := TestDocService.RelayCollabUpdate(page.ID, peer, "BAUG"); err != nil {
+		t.Fatalf("Expected the snapshot to make room, got %v", err)
+	}
+
+	room, err := TestDocService.lockCollabRoom(page.ID, peer)
+	if err != nil {
+		t.Fatalf("Expected session to stay open: %v", err)
+	}
+	room.timer.Stop()
+	room.timer = nil
+	room.mu.Unlock()
+
+	TestDocService.saveCollabSnapshot(room)
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if len(room.history) != 1 || room.history[0].Update != "BAUG" || room.size != len("BAUG") {
+		t.Errorf("Expected the save to drop the updates it covers, got %+v", room.history)
+	}
+}
+
+func TestCollabTickets(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Collab Ticket Doc", "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/collab-ticket", 1)
+
+	ticket, err := TestDocService.IssueCollabTicket(admin, page.ID)
+	if err != nil {
+		t.Fatalf("IssueCollabTicket returned an error: %v", err)
+	}
+
+	if _, err := TestDocService.RedeemCollabTicket(ticket, page.ID+1); err == nil {
+		t.Errorf("Expected a ticket to work only for its page")
+	}
+
+	ticket, _ = TestDocService.IssueCollabTicket(admin, page.ID)
+	user, err := TestDocService.RedeemCollabTicket(ticket, page.ID)
+	if err != nil || user.ID != admin.ID {
+		t.Fatalf("Expected the ticket to belong to the admin, got %d: %v", user.ID, err)
+	}
+
+	if _, err := TestDocService.RedeemCollabTicket(ticket, page.ID); err == nil {
+		t.Errorf("Expected a ticket to work only once")
+	}
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+// VersionComparison is what changed between two versions of a documentation.
+// Pages are matched by page-group path and slug; a page whose slug is found
+// under another page group moved.
+type VersionComparison struct {
+	FromID    uint         `json:"fromId"`
+	ToID      uint         `json:"toId"`
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Added     []PageChange `json:"added"`
+	Removed   []PageChange `json:"removed"`
+	Moved     []PageChange `json:"moved"`
+	Reordered []PageChange `json:"reordered"`
+	Changed   []PageChange `json:"changed"`
+	Summary   string       `json:"summary"`
+}
+
+type PageChange struct {
+	FromPageID uint          `json:"fromPageId,omitempty"`
+	ToPageID   uint          `json:"toPageId,omitempty"`
+	Title      string        `json:"title"`
+	FromTitle  string        `json:"fromTitle,omitempty"` // set when the title changed
+	Slug       string        `json:"slug"`
+	FromPath   string        `json:"fromPath,omitempty"`
+	ToPath     string        `json:"toPath,omitempty"`
+	FromOrder  *uint         `json:"fromOrder,omitempty"`
+	ToOrder    *uint         `json:"toOrder,omitempty"`
+	Blocks     []BlockChange `json:"blocks,omitempty"`
+}
+
+// BlockChange is a top-level block that was added, removed or changed.
+// Blocks are matched by their BlockNote id, which is kept when a version is
+// created from another.
+type BlockChange struct {
+	BlockID string `json:"blockId"`
+	Type    string `json:"type"`
+	Change  string `json:"change"`
+	Before  string `json:"before,omitempty"`
+	After   string `json:"after,omitempty"`
+}
+
+type comparedPage struct {
+	page models.Page
+	path string
+}
+
+func (service *DocService) comparedPages(docId uint) ([]comparedPage, error) {
+	var pages []models.Page
+	if err := service.DB.Where("documentation_id = ?", docId).Order("id").Find(&pages).Error; err != nil {
+		return nil, err
+	}
+
+	compared := make([]comparedPage, 0, len(pages))
+	for _, page := range pages {
+		path := "/guides"
+		if page.PageGroupID != nil {
+			dir, err := service.pageGroupDir(*page.PageGroupID)
+			if err != nil {
+				return nil, err
+			}
+			path = dir
+		}
+		compared = append(compared, comparedPage{page: page, path: path})
+	}
+
+	return compared, nil
+}
+
+func blockKey(block map[string]interface{}, index int) string {
+	if id, ok := block["id"].(string); ok && id != "" {
+		return id
+	}
+	return fmt.Sprintf("#%d", index)
+}
+
+// blockText is the text of a block and of the blocks nested in it.
+func blockText(block map[string]interface{}) string {
+	texts := []string{}
+	if text := strings.TrimSpace(inlineText(block["content"])); text != "" {
+		texts = append(texts, text)
+	}
+
+	children, _ := block["children"].([]interface{})
+	for _, child := range children {
+		if childBlock, ok := child.(map[string]interface{}); ok {
+			if text := blockText(childBlock); text != "" {
+				texts = append(texts, text)
+			}
+		}
+	}
+
+	return strings.Join(texts, " ")
+}
+
+// diffBlocks compares the top-level blocks of two versions of a page.
+func diffBlocks(fromContent string, toContent string) []BlockChange {
+	fromBlocks, _ := parseBlocks(fromContent)
+	toBlocks, _ := parseBlocks(toContent)
+
+	fromByKey := make(map[string]map[string]interface{})
+	var fromKeys []string
+	for i, item := range fromBlocks {
+		if block, ok := item.(map[string]interface{}); ok {
+			key := blockKey(block, i)
+			fromByKey[key] = block
+			fromKeys = append(fromKeys, key)
+		}
+	}
+
+	changes := []BlockChange{}
+	seen := make(map[string]bool)
+
+	for i, item := range toBlocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		key := blockKey(block, i)
+		blockType, _ := block["type"].(string)
+		seen[key] = true
+
+		before, existed := fromByKey[key]
+		if !existed {
+			changes = append(changes, BlockChange{BlockID: key, Type: blockType, Change: "added", After: blockText(block)})
+			continue
+		}
+
+		beforeJSON, _ := json.Marshal(before)
+		afterJSON, _ := json.Marshal(block)
+		if string(beforeJSON) != string(afterJSON) {
+			changes = append(changes, BlockChange{BlockID: key, Type: blockType, Change: "changed", Before: blockText(before), After: blockText(block)})
+		}
+	}
+
+	for _, key := range fromKeys {
+		if !seen[key] {
+			block := fromByKey[key]
+			blockType, _ := block["type"].(string)
+			changes = append(changes, BlockChange{BlockID: key, Type: blockType, Change: "removed", Before: blockText(block)})
+		}
+	}
+
+	return changes
+}
+
+func orderChanged(from *uint, to *uint) bool {
+	if from == nil || to == nil {
+		return from != to
+	}
+	return *from != *to
+}
+
+// CompareVersions compares two versions of the same documentation.
+func (service *DocService) CompareVersions(fromId uint, toId uint) (VersionComparison, error) {
+	var fromDoc, toDoc models.Documentation
+	if err := service.DB.Select("id", "version").First(&fromDoc, fromId).Error; err != nil {
+		return VersionComparison{}, fmt.Errorf("documentation_not_found")
+	}
+	if err := service.DB.Select("id", "version").First(&toDoc, toId).Error; err != nil {
+		return VersionComparison{}, fmt.Errorf("documentation_not_found")
+	}
+
+	fromRoot, err := service.GetRootParentID(fromId)
+	if err != nil {
+		return VersionComparison{}, fmt.Errorf("documentation_not_found")
+	}
+	toRoot, err := service.GetRootParentID(toId)
+	if err != nil {
+		return VersionComparison{}, fmt.Errorf("documentation_not_found")
+	}
+
+	if fromRoot != toRoot {
+		return VersionComparison{}, fmt.Errorf("versions_not_related")
+	}
+
+	fromPages, err := service.comparedPages(fromId)
+	if err != nil {
+		return VersionComparison{}, fmt.Errorf("failed_to_compare_versions")
+	}
+	toPages, err := service.comparedPages(toId)
+	if err != nil {
+		return VersionComparison{}, fmt.Errorf("failed_to_compare_versions")
+	}
+
+	comparison := VersionComparison{
+		FromID:    fromId,
+		ToID:      toId,
+		From:      fromDoc.Version,
+		To:        toDoc.Version,
+		Added:     []PageChange{},
+		Removed:   []PageChange{},
+		Moved:     []PageChange{},
+		Reordered: []PageChange{},
+		Changed:   []PageChange{},
+	}
+
+	// Match pages at the same path first, then pages whose slug is only
+	// found once among the rest, which moved to another page group.
+	matched := make(map[int]int)
+	used := make(map[int]bool)
+
+	for i, to := range toPages {
+		for j, from := range fromPages {
+			if !used[j] && from.path == to.path && from.page.Slug == to.page.Slug {
+				matched[i], used[j] = j, true
+				break
+			}
+		}
+	}
+
+	for i, to := range toPages {
+		if _, ok := matched[i]; ok {
+			continue
+		}
+
+		candidate, candidates := -1, 0
+		for j, from := range fromPages {
+			if !used[j] && from.page.Slug == to.page.Slug {
+				candidate, candidates = j, candidates+1
+			}
+		}
+
+		others := 0
+		for k, other := range toPages {
+			if _, ok := matched[k]; !ok && other.page.Slug == to.page.Slug {
+				others++
+			}
+		}
+
+		if candidates == 1 && others == 1 {
+			matched[i], used[candidate] = candidate, true
+		}
+	}
+
+	for i, to := range toPages {
+		j, ok := matched[i]
+		if !ok {
+			comparison.Added = append(comparison.Added, PageChange{
+				ToPageID: to.page.ID,
+				Title:    to.page.Title,
+				Slug:     to.page.Slug,
+				ToPath:   to.path,
+				ToOrder:  to.page.Order,
+			})
+			continue
+		}
+
+		from := fromPages[j]
+		change := PageChange{
+			FromPageID: from.page.ID,
+			ToPageID:   to.page.ID,
+			Title:      to.page.Title,
+			Slug:       to.page.Slug,
+			FromPath:   from.path,
+			ToPath:     to.path,
+			FromOrder:  from.page.Order,
+			ToOrder:    to.page.Order,
+		}
+
+		if from.path != to.path {
+			comparison.Moved = append(comparison.Moved, change)
+		} else if orderChanged(from.page.Order, to.page.Order) {
+			comparison.Reordered = append(comparison.Reordered, change)
+		}
+
+		change.Blocks = diffBlocks(from.page.Content, to.page.Content)
+		if from.page.Title != to.page.Title {
+			change.FromTitle = from.page.Title
+		}
+
+		if len(change.Blocks) > 0 || change.FromTitle != "" {
+			comparison.Changed = append(comparison.Changed, change)
+		}
+	}
+
+	for j, from := range fromPages {
+		if !used[j] {
+			comparison.Removed = append(comparison.Removed, PageChange{
+				FromPageID: from.page.ID,
+				Title:      from.page.Title,
+				Slug:       from.page.Slug,
+				FromPath:   from.path,
+				FromOrder:  from.page.Order,
+			})
+		}
+	}
+
+	comparison.Summary = comparison.summary()
+
+	return comparison, nil
+}
+
+// summary is a Markdown "what changed" list for release notes.
+func (comparison VersionComparison) summary() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("## What changed from %s to %s\n", comparison.From, comparison.To))
+
+	section := func(title string, changes []PageChange, line func(PageChange) string) {
+		if len(changes) == 0 {
+			return
+		}
+
+		lines := make([]string, len(changes))
+		for i, change := range changes {
+			lines[i] = "- " + line(change)
+		}
+		sort.Strings(lines)
+
+		builder.WriteString("\n### " + title + "\n\n")
+		builder.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+
+	section("New pages", comparison.Added, func(change PageChange) string {
+		return change.Title
+	})
+	section("Removed pages", comparison.Removed, func(change PageChange) string {
+		return change.Title
+	})
+	section("Moved pages", comparison.Moved, func(change PageChange) string {
+		return fmt.Sprintf("%s, from %s to %s", change.Title, change.FromPath, change.ToPath)
+	})
+	section("Updated pages", comparison.Changed, func(change PageChange) string {
+		counts := map[string]int{}
+		for _, block := range change.Blocks {
+			counts[block.Change]++
+		}
+
+		var details []string
+		if change.FromTitle != "" {
+			details = append(details, fmt.Sprintf("renamed from %s", change.FromTitle))
+		}
+		for _, kind := range []string{"added", "changed", "removed"} {
+			if counts[kind] == 1 {
+				details = append(details, fmt.Sprintf("1 block %s", kind))
+			} else if counts[kind] > 1 {
+				details = append(details, fmt.Sprintf("%d blocks %s", counts[kind], kind))
+			}
+		}
+
+		return change.Title + " (" + strings.Join(details, ", ") + ")"
+	})
+
+	if len(comparison.Added)+len(comparison.Removed)+len(comparison.Moved)+len(comparison.Changed) == 0 {
+		builder.WriteString("\nNo changes.\n")
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	v1 := createTestDocumentation(t, "Compare Doc", "1.0.0", nil)
+	v2 := createTestDocumentation(t, "Compare Doc", "2.0.0", &v1.ID)
+
+	oldGuides := createTestPageGroup(t, v1.ID, nil, "guides", 1)
+	newGuides := createTestPageGroup(t, v2.ID, nil, "guides", 1)
+	reference := createTestPageGroup(t, v2.ID, nil, "reference", 2)
+
+	oldInstall := createTestPage(t, v1.ID, &oldGuides.ID, "/install", 1)
+	newInstall := createTestPage(t, v2.ID, &newGuides.ID, "/install", 1)
+	TestDocService.DB.Model(&oldInstall).Update("content", "["+snippetTestBlock("Download")+","+snippetTestBlock("Unpack")+"]")
+	TestDocService.DB.Model(&newInstall).Update("content", "["+snippetTestBlock("Download")+`,{"id":"Unpack","type":"paragraph","props":{},"content":[{"type":"text","text":"Extract","styles":{}}],"children":[]},`+snippetTestBlock("Run")+"]")
+
+	createTestPage(t, v1.ID, nil, "/legacy", 2)
+	createTestPage(t, v2.ID, nil, "/whats-new", 2)
+	createTestPage(t, v1.ID, nil, "/faq", 3)
+	createTestPage(t, v2.ID, nil, "/faq", 4)
+	createTestPage(t, v1.ID, &oldGuides.ID, "/api", 2)
+	createTestPage(t, v2.ID, &reference.ID, "/api", 1)
+
+	comparison, err := TestDocService.CompareVersions(v1.ID, v2.ID)
+	if err != nil {
+		t.Fatalf("CompareVersions returned an error: %v", err)
+	}
+
+	if len(comparison.Added) != 1 || comparison.Added[0].Slug != "/whats-new" {
+		t.Errorf("Expected /whats-new to be added, got %+v", comparison.Added)
+	}
+
+	if len(comparison.Removed) != 1 || comparison.Removed[0].Slug != "/legacy" {
+		t.Errorf("Expected /legacy to be removed, got %+v", comparison.Removed)
+	}
+
+	if len(comparison.Moved) != 1 || comparison.Moved[0].Slug != "/api" || comparison.Moved[0].ToPath != "/guides/reference" {
+		t.Errorf("Expected /api to move to the reference group, got %+v", comparison.Moved)
+	}
+
+	if len(comparison.Reordered) != 1 || comparison.Reordered[0].Slug != "/faq" {
+		t.Errorf("Expected /faq to be reordered, got %+v", comparison.Reordered)
+	}
+
+	if len(comparison.Changed) != 1 || comparison.Changed[0].Slug != "/install" {
+		t.Fatalf("Expected /install to be changed, got %+v", comparison.Changed)
+	}
+
+	blocks := comparison.Changed[0].Blocks
+	if len(blocks) != 2 || blocks[0].Change != "changed" || blocks[0].Before != "Unpack" || blocks[0].After != "Extract" ||
+		blocks[1].Change != "added" || blocks[1].After != "Run" {
+		t.Errorf("Unexpected block changes: %+v", blocks)
+	}
+
+	for _, line := range []string{"## What changed from 1.0.0 to 2.0.0", "- /whats-new", "- /legacy", "- /api, from /guides/guides to /guides/reference", "- /install (1 block added, 1 block changed)"} {
+		if !strings.Contains(comparison.Summary, line) {
+			t.Errorf("Expected the summary to contain %q:\n%s", line, comparison.Summary)
+		}
+	}
+
+	other := createTestDocumentation(t, "Other Compare Doc", "1.0.0", nil)
+	if _, err := TestDocService.CompareVersions(v1.ID, other.ID); err == nil || err.Error() != "versions_not_related" {
+		t.Errorf("Expected 'versions_not_related' error, got %v", err)
+	}
+}
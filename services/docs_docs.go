@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 
 	"git.difuse.io/Difuse/kalmia/config"
@@ -32,19 +31,19 @@ func (service *DocService) GetDocumentations() ([]models.Documentation, error) {
 	}).Preload("Editors", func(db *gorm.DB) *gorm.DB {
 		return db.Select("ID", "Username", "Email", "Photo")
 	}).Preload("PageGroups", func(db *gorm.DB) *gorm.DB {
-		return db.Select("ID", "DocumentationID", "Name", "Label", "CreatedAt", "UpdatedAt", "AuthorID", "Order")
+		return db.Select("ID", "DocumentationID", "Name", "Label", "CreatedAt", "UpdatedAt", "AuthorID", "Order", "Revision")
 	}).Preload("PageGroups.Author", func(db *gorm.DB) *gorm.DB {
 		return db.Select("ID", "Username", "Email", "Photo")
 	}).Preload("PageGroups.Editors", func(db *gorm.DB) *gorm.DB {
 		return db.Select("users.ID", "users.Username", "users.Email", "users.Photo")
 	}).Preload("PageGroups.Pages", func(db *gorm.DB) *gorm.DB {
-		return db.Select("ID", "PageGroupID", "Title", "Slug", "CreatedAt", "UpdatedAt", "AuthorID", "Order")
+		return db.Select("ID", "PageGroupID", "Title", "Slug", "CreatedAt", "UpdatedAt", "AuthorID", "Order", "Revision")
 	}).Preload("PageGroups.Pages.Author", func(db *gorm.DB) *gorm.DB {
 		return db.Select("ID", "Username", "Email", "Photo")
 	}).Preload("PageGroups.Pages.Editors", func(db *gorm.DB) *gorm.DB {
 		return db.Select("users.ID", "users.Username", "users.Email", "users.Photo")
 	}).Preload("Pages", func(db *gorm.DB) *gorm.DB {
-		return db.Select("ID", "DocumentationID", "Title", "Slug", "CreatedAt", "UpdatedAt", "AuthorID", "Order", "IsIntroPage").Where("page_group_id IS NULL")
+		return db.Select("ID", "DocumentationID", "Title", "Slug", "CreatedAt", "UpdatedAt", "AuthorID", "Order", "IsIntroPage", "Revision").Where("page_group_id IS NULL")
 	}).Preload("Pages.Author", func(db *gorm.DB) *gorm.DB {
 		return db.Select("ID", "Username", "Email", "Photo")
 	}).Preload("Pages.Editors", func(db *gorm.DB) *gorm.DB {
@@ -64,6 +63,7 @@ func (service *DocService) GetDocumentations() ([]models.Documentation, error) {
 		"NavImage",
 		"NavImageDark",
 		"CustomCSS",
+		"RobotsTxt",
 		"FooterLabelLinks",
 		"MoreLabelLinks",
 		"URL",
@@ -78,6 +78,13 @@ func (service *DocService) GetDocumentations() ([]models.Documentation, error) {
 		"GitPassword",
 		"GitBranch",
 		"TokenSecret",
+		"Locales",
+		"DefaultLocale",
+		"Variables",
+		"DefaultVersion",
+		"Prerelease",
+		"Hidden",
+		"Deprecated",
 	).
 		Find(&documentations).Error; err != nil {
 		return nil, fmt.Errorf("failed_to_get_documentations")
@@ -105,19 +112,19 @@ func (service *DocService) GetDocumentation(id uint) (models.Documentation, erro
 	}).Preload("Editors", func(db *gorm.DB) *gorm.DB {
 		return db.Select("ID", "Username", "Email", "Photo")
 	}).Preload("PageGroups", func(db *gorm.DB) *gorm.DB {
-		return db.Select("ID", "DocumentationID", "Name", "Label", "CreatedAt", "UpdatedAt", "AuthorID", "Order")
+		return db.Select("ID", "DocumentationID", "Name", "Label", "CreatedAt", "UpdatedAt", "AuthorID", "Order", "Revision")
 	}).Preload("PageGroups.Author", func(db *gorm.DB) *gorm.DB {
 		return db.Select("ID", "Username", "Email", "Photo")
 	}).Preload("PageGroups.Editors", func(db *gorm.DB) *gorm.DB {
 		return db.Select("users.ID", "users.Username", "users.Email", "users.Photo")
 	}).Preload("PageGroups.Pages", func(db *gorm.DB) *gorm.DB {
-		return db.Select("ID", "PageGroupID", "Title", "Slug", "CreatedAt", "UpdatedAt", "AuthorID")
+		return db.Select("ID", "PageGroupID", "Title", "Slug", "CreatedAt", "UpdatedAt", "AuthorID", "Revision")
 	}).Preload("PageGroups.Pages.Author", func(db *gorm.DB) *gorm.DB {
 		return db.Select("ID", "Username", "Email", "Photo")
 	}).Preload("PageGroups.Pages.Editors", func(db *gorm.DB) *gorm.DB {
 		return db.Select("users.ID", "users.Username", "users.Email", "users.Photo")
 	}).Preload("Pages", func(db *gorm.DB) *gorm.DB {
-		return db.Select("ID", "DocumentationID", "Title", "Slug", "CreatedAt", "UpdatedAt", "AuthorID", "IsIntroPage", "Order").Where("page_group_id IS NULL")
+		return db.Select("ID", "DocumentationID", "Title", "Slug", "CreatedAt", "UpdatedAt", "AuthorID", "IsIntroPage", "Order", "Revision").Where("page_group_id IS NULL")
 	}).Preload("Pages.Author", func(db *gorm.DB) *gorm.DB {
 		return db.Select("ID", "Username", "Email", "Photo")
 	}).Preload("Pages.Editors", func(db *gorm.DB) *gorm.DB {
@@ -137,6 +144,7 @@ func (service *DocService) GetDocumentation(id uint) (models.Documentation, erro
 			"NavImage",
 			"NavImageDark",
 			"CustomCSS",
+			"RobotsTxt",
 			"FooterLabelLinks",
 			"MoreLabelLinks",
 			"CopyrightText",
@@ -153,6 +161,14 @@ func (service *DocService) GetDocumentation(id uint) (models.Documentation, erro
 			"GitPassword",
 			"GitBranch",
 			"TokenSecret",
+			"Locales",
+			"DefaultLocale",
+			"Variables",
+			"DefaultVersion",
+			"Prerelease",
+			"Hidden",
+			"Deprecated",
+			"Revision",
 		).
 		Find(&documentation).Error; err != nil {
 		return models.Documentation{}, fmt.Errorf("failed_to_get_documentation")
@@ -205,6 +221,8 @@ func (service *DocService) GetChildrenOfDocumentation(id uint) ([]uint, error) {
 	return children, nil
 }
 
+// GetAllVersions returns the default version and the published versions of a
+// documentation, in semantic version order.
 func (service *DocService) GetAllVersions(id uint) (string, []string, error) {
 	var docs []models.Documentation
 	db := service.DB
@@ -244,21 +262,22 @@ func (service *DocService) GetAllVersions(id uint) (string, []string, error) {
 		return "", nil, err
 	}
 
-	sort.Slice(docs, func(i, j int) bool {
-		return docs[i].CreatedAt.Before(*docs[j].CreatedAt)
-	})
+	sortVersions(docs)
 
-	versions := make([]string, len(docs))
-	for i, doc := range docs {
-		versions[i] = doc.Version
+	var published []models.Documentation
+	versions := []string{}
+	for _, doc := range docs {
+		if !doc.Hidden {
+			published = append(published, doc)
+			versions = append(versions, doc.Version)
+		}
 	}
 
 	if len(versions) == 0 {
 		return "", nil, fmt.Errorf("no_versions_found")
 	}
 
-	latestVersion := versions[len(versions)-1]
-	return latestVersion, versions, nil
+	return defaultVersion(published).Version, versions, nil
 }
 
 type BucketUploadMetadataFiles struct {
@@ -268,9 +287,19 @@ type BucketUploadMetadataFiles struct {
 	BucketNavImageDark string `json:"bucketNavImageDark"`
 }
 
-func (service *DocService) CreateDocumentation(documentation *models.Documentation, user models.User, bucketUploadedFiles map[string]string) error {
+// CreateDocumentation creates a documentation from a documentation template,
+// or with an introduction page when templateId is 0. The template fills the
+// settings the documentation is created without.
+func (service *DocService) CreateDocumentation(documentation *models.Documentation, user models.User, templateId uint, bucketUploadedFiles map[string]string) error {
 	db := service.DB
 
+	blueprint, err := service.documentationBlueprint(templateId)
+	if err != nil {
+		return err
+	}
+
+	blueprint.Settings.fillDocumentation(documentation)
+
 	var count int64
 
 	if err := db.Model(&models.Documentation{}).Where("name = ?", documentation.Name).Count(&count).Error; err != nil {
@@ -285,34 +314,23 @@ func (service *DocService) CreateDocumentation(documentation *models.Documentati
 		return fmt.Errorf("invalid_base_url")
 	}
 
-	if err := db.Create(documentation).Error; err != nil {
-		return fmt.Errorf("failed_to_create_documentation")
-	}
-
-	introPageContent := `[{"id":"fa01e096-3187-4628-8f1e-77728cee3aa6","type":"heading","props":{"textColor":"default","backgroundColor":"default","textAlignment":"left","level":1},"content":[{"type":"text","text":"Introduction","styles":{}}],"children":[]},{"id":"64a26e8f-7733-4f8a-b3fb-f2c9a770d727","type":"paragraph","props":{"textColor":"default","backgroundColor":"default","textAlignment":"left"},"content":[{"type":"text","text":"Welcome to the ","styles":{}},{"type":"text","text":"introductory page","styles":{"bold":true}},{"type":"text","text":" of this documentation!","styles":{}}],"children":[]},{"id":"90f28c74-6195-4074-8861-35b82b9bfb1c","type":"paragraph","props":{"textColor":"default","backgroundColor":"default","textAlignment":"left"},"content":[],"children":[]}]`
-
-	introPage := models.Page{
-		Title:           "Introduction",
-		Slug:            "/index",
-		Content:         introPageContent,
-		DocumentationID: documentation.ID,
-		AuthorID:        user.ID,
-		Author:          user,
-		Editors:         []models.User{user},
-		LastEditorID:    &user.ID,
-		Order:           utils.UintPtr(0),
-		IsIntroPage:     true,
-	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(documentation).Error; err != nil {
+			return fmt.Errorf("failed_to_create_documentation")
+		}
 
-	if err := db.Create(&introPage).Error; err != nil {
-		return fmt.Errorf("failed_to_create_documentation_intro_page")
+		return createBlueprintTree(tx, documentation.ID, blueprint, user)
+	})
+	if err != nil {
+		return err
 	}
 
-	err := service.InitRsPress(documentation.ID)
+	err = service.InitRsPress(documentation.ID)
 	if err != nil {
 		logger.Error("failed_to_init_rspress", zap.Error(err))
+		db.Where("documentation_id = ?", documentation.ID).Delete(&models.Page{})
+		db.Where("documentation_id = ?", documentation.ID).Delete(&models.PageGroup{})
 		db.Delete(&documentation)
-		db.Delete(&introPage)
 
 		return fmt.Errorf("failed_to_init_rspress")
 	}
@@ -403,6 +421,7 @@ func (service *DocService) CreateDocumentation(documentation *models.Documentati
 type EditDocumentationParams struct {
 	User                models.User
 	ID                  uint
+	BaseRevision        uint
 	Name                string
 	Description         string
 	Version             string
@@ -423,10 +442,15 @@ type EditDocumentationParams struct {
 	NavImage            string
 	NavImageDark        string
 	CustomCSS           string
+	RobotsTxt           string
 	FooterLabelLinks    string
 	MoreLabelLinks      string
 	BucketUploadedFiles map[string]string
 	TokenSecret         string
+	// Secrets are write-only: an empty GitPassword or TokenSecret keeps the
+	// current one, and the Clear flags remove it.
+	ClearGitPassword bool
+	ClearTokenSecret bool
 }
 
 func (service *DocService) EditDocumentation(params EditDocumentationParams) error {
@@ -435,6 +459,14 @@ func (service *DocService) EditDocumentation(params EditDocumentationParams) err
 		return fmt.Errorf("invalid_base_url")
 	}
 
+	var previous models.Documentation
+	if err := service.DB.Select("id", "base_url").First(&previous, params.ID).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	oldPrefixes, _ := service.versionPathPrefixes(params.ID)
+
 	updateDoc := func(doc *models.Documentation, isTarget bool) error {
 		doc.LastEditorID = &params.User.ID
 		doc.Name = params.Name
@@ -449,6 +481,7 @@ func (service *DocService) EditDocumentation(params EditDocumentationParams) err
 		doc.NavImage = params.NavImage
 		doc.NavImageDark = params.NavImageDark
 		doc.CustomCSS = params.CustomCSS
+		doc.RobotsTxt = params.RobotsTxt
 		doc.FooterLabelLinks = params.FooterLabelLinks
 		doc.MoreLabelLinks = params.MoreLabelLinks
 		doc.CopyrightText = params.CopyrightText
@@ -456,12 +489,19 @@ func (service *DocService) EditDocumentation(params EditDocumentationParams) err
 		doc.GitRepo = params.GitRepo
 		doc.GitBranch = params.GitBranch
 		doc.GitUser = params.GitUser
-		doc.GitPassword = params.GitPassword
+		if params.GitPassword != "" || params.ClearGitPassword {
+			doc.GitPassword = params.GitPassword
+		}
 		doc.GitEmail = params.GitEmail
-		doc.TokenSecret = params.TokenSecret
+		if params.TokenSecret != "" || params.ClearTokenSecret {
+			doc.TokenSecret = params.TokenSecret
+		}
 		if isTarget && params.Version != "" {
 			doc.Version = params.Version
 		}
+		if !isTarget {
+			doc.Revision++
+		}
 
 		alreadyEditor := false
 		for _, editor := range doc.Editors {
@@ -559,6 +599,11 @@ func (service *DocService) EditDocumentation(params EditDocumentationParams) err
 
 	}
 
+	if err := claimRevision(tx, &models.Documentation{}, params.ID, params.BaseRevision, "documentation_not_found"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	var targetDoc models.Documentation
 	if err := tx.Preload("Editors").First(&targetDoc, params.ID).Error; err != nil {
 		tx.Rollback()
@@ -627,6 +672,25 @@ func (service *DocService) EditDocumentation(params EditDocumentationParams) err
 		rootID = *doc.ClonedFrom
 	}
 
+	// links to the old base URL and, for an older version, the old version
+	// folder keep working through redirects. The edit is committed by now, so
+	// failing to record them is only logged.
+	oldBaseURL, newBaseURL := "/"+strings.Trim(previous.BaseURL, "/"), "/"+strings.Trim(params.BaseURL, "/")
+	if oldBaseURL != "/" && oldBaseURL != newBaseURL {
+		if err := addRedirect(service.DB, rootID, oldBaseURL+"/*", newBaseURL+"/*", true, RedirectBaseURL); err != nil {
+			logger.Error("failed to record the redirect of a base URL", zap.Uint("documentation_id", params.ID), zap.Error(err))
+		}
+	}
+
+	newPrefixes, err := service.versionPathPrefixes(params.ID)
+	if err == nil && len(oldPrefixes) > 0 && oldPrefixes[0] != "" && newPrefixes[0] != "" {
+		err = service.recordMovedPaths(params.ID, oldPrefixes[:1], newPrefixes[:1], true, RedirectVersion)
+	}
+
+	if err != nil {
+		logger.Error("failed to record the redirect of a version", zap.Uint("documentation_id", params.ID), zap.Error(err))
+	}
+
 	if err := service.AddBuildTrigger(rootID, false); err != nil {
 		return fmt.Errorf("failed_to_add_build_trigger")
 	}
@@ -634,7 +698,10 @@ func (service *DocService) EditDocumentation(params EditDocumentationParams) err
 	return nil
 }
 
-func (service *DocService) DeleteDocumentation(id uint) error {
+// DeleteDocumentation moves a documentation, with all of its page groups and
+// pages, into the trash. The RsPress folder of a root documentation is kept
+// until the trash item is purged.
+func (service *DocService) DeleteDocumentation(user models.User, id uint) error {
 	doc, err := service.GetDocumentation(id)
 	if err != nil {
 		return fmt.Errorf("failed_to_get_documentation")
@@ -650,25 +717,45 @@ func (service *DocService) DeleteDocumentation(id uint) error {
 		return fmt.Errorf("failed_to_get_parent_id")
 	}
 
+	if count > 0 && parentId == id {
+		return fmt.Errorf("root_parent_cant_be_deleted_as_it_has_children")
+	}
+
+	tx := service.DB.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed_to_start_transaction")
+	}
+
+	var snapshot trashSnapshot
+	if err := collectDocumentationTree(tx, id, &snapshot); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if count > 0 {
-		if parentId == id {
-			return fmt.Errorf("root_parent_cant_be_deleted_as_it_has_children")
-		}
 		var childDocs []models.Documentation
-		if err := service.DB.Where("cloned_from = ?", id).Find(&childDocs).Error; err != nil {
+		if err := tx.Where("cloned_from = ?", id).Find(&childDocs).Error; err != nil {
+			tx.Rollback()
 			return fmt.Errorf("failed_to_get_child_documentations")
 		}
 		for _, childDoc := range childDocs {
 			childDoc.ClonedFrom = doc.ClonedFrom
-			if err := service.DB.Save(&childDoc).Error; err != nil {
+			if err := tx.Save(&childDoc).Error; err != nil {
+				tx.Rollback()
 				return fmt.Errorf("failed_to_update_child_documentation")
 			}
+			snapshot.ReparentedVersions = append(snapshot.ReparentedVersions, childDoc.ID)
 		}
 	}
 
-	tx := service.DB.Begin()
-	if tx.Error != nil {
-		return fmt.Errorf("failed_to_start_transaction")
+	title := doc.Name
+	if doc.Version != "" {
+		title = fmt.Sprintf("%s (%s)", doc.Name, doc.Version)
+	}
+
+	if err := service.moveToTrash(tx, &user, TrashItemDocumentation, id, title, id, parentId, snapshot); err != nil {
+		tx.Rollback()
+		return err
 	}
 
 	var pageGroups []models.PageGroup
@@ -721,7 +808,12 @@ func (service *DocService) DeleteDocumentation(id uint) error {
 		return fmt.Errorf("failed_to_commit_changes: %v", err)
 	}
 
-	err = service.AddBuildTrigger(parentId, true)
+	if parentId == id {
+		clearDocCache(id)
+		return nil
+	}
+
+	err = service.AddBuildTrigger(parentId, false)
 	if err != nil {
 		return fmt.Errorf("failed_to_add_build_trigger: %v", err)
 	}
@@ -754,6 +846,7 @@ func (service *DocService) CreateDocumentationVersion(originalDocId uint, newVer
 		NavImage:         originalDoc.NavImage,
 		NavImageDark:     originalDoc.NavImageDark,
 		CustomCSS:        originalDoc.CustomCSS,
+		RobotsTxt:        originalDoc.RobotsTxt,
 		FooterLabelLinks: originalDoc.FooterLabelLinks,
 		MoreLabelLinks:   originalDoc.MoreLabelLinks,
 		CopyrightText:    originalDoc.CopyrightText,
@@ -768,6 +861,9 @@ func (service *DocService) CreateDocumentationVersion(originalDocId uint, newVer
 		GitPassword:      originalDoc.GitPassword,
 		GitEmail:         originalDoc.GitEmail,
 		TokenSecret:      originalDoc.TokenSecret,
+		Locales:          originalDoc.Locales,
+		DefaultLocale:    originalDoc.DefaultLocale,
+		Variables:        originalDoc.Variables,
 	}
 
 	err = service.DB.Transaction(func(tx *gorm.DB) error {
@@ -782,6 +878,7 @@ func (service *DocService) CreateDocumentationVersion(originalDocId uint, newVer
 		}
 
 		pageGroupMap := make(map[uint]uint)
+		pageMap := make(map[uint]uint)
 		existingPageGroups := make(map[uint]bool)
 
 		for _, pg := range originalDoc.PageGroups {
@@ -821,10 +918,12 @@ func (service *DocService) CreateDocumentationVersion(originalDocId uint, newVer
 					Slug:            page.Slug,
 					Content:         page.Content,
 					Order:           page.Order,
+					PageSEO:         page.PageSEO,
 				}
 				if err := tx.Create(&newPage).Error; err != nil {
 					return fmt.Errorf("failed_to_create_page")
 				}
+				pageMap[page.ID] = newPage.ID
 				for _, editor := range page.Editors {
 					if err := tx.Model(&newPage).Association("Editors").Append(&editor); err != nil {
 						return fmt.Errorf("failed_to_add_editor")
@@ -886,10 +985,12 @@ func (service *DocService) CreateDocumentationVersion(originalDocId uint, newVer
 					Content:         page.Content,
 					Order:           page.Order,
 					IsIntroPage:     page.IsIntroPage,
+					PageSEO:         page.PageSEO,
 				}
 				if err := tx.Create(&newPage).Error; err != nil {
 					return fmt.Errorf("failed to create new page without group: %w", err)
 				}
+				pageMap[page.ID] = newPage.ID
 				for _, editor := range page.Editors {
 					if err := tx.Model(&newPage).Association("Editors").Append(&editor); err != nil {
 						return fmt.Errorf("failed to append editor to page without group: %w", err)
@@ -898,6 +999,14 @@ func (service *DocService) CreateDocumentationVersion(originalDocId uint, newVer
 			}
 		}
 
+		if err := copyTranslations(tx, pageMap, pageGroupMap); err != nil {
+			return fmt.Errorf("failed_to_copy_translations")
+		}
+
+		if err := copyPageTags(tx, pageMap); err != nil {
+			return fmt.Errorf("failed_to_copy_page_tags")
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -992,15 +1101,24 @@ func (service *DocService) BulkReorderPageOrPageGroup(pageOrder []struct {
 	var docId uint
 	var pageGroupUpdates []models.PageGroup
 	var pageUpdates []models.Page
+	var pageGroupIds, pageIds []uint
+
+	// moved items are redirected from where they were before the reorder
+	oldPagePaths := make(map[uint][]string)
+	oldGroupPaths := make(map[uint][]string)
 
 	for _, item := range pageOrder {
 		if item.IsPageGroup {
+			oldGroupPaths[item.ID], _ = service.pageGroupPaths(item.ID)
+			pageGroupIds = append(pageGroupIds, item.ID)
 			pageGroupUpdates = append(pageGroupUpdates, models.PageGroup{
 				ID:       item.ID,
 				Order:    item.Order,
 				ParentID: item.ParentID,
 			})
 		} else {
+			oldPagePaths[item.ID], _ = service.pagePaths(item.ID)
+			pageIds = append(pageIds, item.ID)
 			pageUpdates = append(pageUpdates, models.Page{
 				ID:          item.ID,
 				Order:       item.Order,
@@ -1018,6 +1136,11 @@ func (service *DocService) BulkReorderPageOrPageGroup(pageOrder []struct {
 				return fmt.Errorf("failed to update page groups: %w", err)
 			}
 
+			if err := tx.Model(&models.PageGroup{}).Where("id IN ?", pageGroupIds).
+				UpdateColumn("revision", gorm.Expr("revision + 1")).Error; err != nil {
+				return fmt.Errorf("failed to update page group revisions: %w", err)
+			}
+
 			if docId == 0 && len(pageGroupUpdates) > 0 {
 				var pg models.PageGroup
 				if err := tx.Select("documentation_id").First(&pg, pageGroupUpdates[0].ID).Error; err != nil {
@@ -1035,6 +1158,11 @@ func (service *DocService) BulkReorderPageOrPageGroup(pageOrder []struct {
 				return fmt.Errorf("failed to update pages: %w", err)
 			}
 
+			if err := tx.Model(&models.Page{}).Where("id IN ?", pageIds).
+				UpdateColumn("revision", gorm.Expr("revision + 1")).Error; err != nil {
+				return fmt.Errorf("failed to update page revisions: %w", err)
+			}
+
 			if docId == 0 && len(pageUpdates) > 0 {
 				var p models.Page
 				if err := tx.Select("documentation_id").First(&p, pageUpdates[0].ID).Error; err != nil {
@@ -1050,6 +1178,14 @@ func (service *DocService) BulkReorderPageOrPageGroup(pageOrder []struct {
 		return err
 	}
 
+	for id, oldPaths := range oldPagePaths {
+		service.recordPageMove(id, oldPaths)
+	}
+
+	for id, oldPaths := range oldGroupPaths {
+		service.recordPageGroupMove(id, oldPaths)
+	}
+
 	parentDocId, err := service.GetRootParentID(docId)
 	if err != nil {
 		return fmt.Errorf("failed to get parent doc ID: %w", err)
@@ -0,0 +1,549 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	TranslationCurrent  = "current"
+	TranslationOutdated = "outdated"
+	TranslationMissing  = "missing"
+)
+
+// localePattern accepts BCP 47 style tags such as "en", "pt-BR" or "zh-Hans",
+// which RsPress also uses as folder names.
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+type Locale struct {
+	Lang  string `json:"lang"`
+	Label string `json:"label"`
+}
+
+// documentationLocales returns the declared locales of a documentation. An
+// empty list means the documentation is not translated.
+func documentationLocales(doc models.Documentation) []Locale {
+	if doc.Locales == "" || doc.DefaultLocale == "" {
+		return nil
+	}
+
+	var locales []Locale
+	if err := json.Unmarshal([]byte(doc.Locales), &locales); err != nil {
+		return nil
+	}
+
+	return locales
+}
+
+// SetDocumentationLocales declares the locales of a documentation. Locales are
+// part of the RsPress config, so every version of the documentation shares
+// them. Passing no locales turns translations off again; stored translations
+// are kept for when the locale is added back.
+func (service *DocService) SetDocumentationLocales(user models.User, id uint, defaultLocale string, locales []Locale) error {
+	if len(locales) == 0 && defaultLocale != "" {
+		return fmt.Errorf("invalid_default_locale")
+	}
+
+	seen := make(map[string]bool)
+	for i, locale := range locales {
+		if !localePattern.MatchString(locale.Lang) || seen[locale.Lang] {
+			return fmt.Errorf("invalid_locale")
+		}
+		seen[locale.Lang] = true
+
+		if locale.Label == "" {
+			locales[i].Label = locale.Lang
+		}
+	}
+
+	if len(locales) > 0 && !seen[defaultLocale] {
+		return fmt.Errorf("invalid_default_locale")
+	}
+
+	localesJSON := ""
+	if len(locales) > 0 {
+		raw, err := json.Marshal(locales)
+		if err != nil {
+			return fmt.Errorf("failed_to_update_locales")
+		}
+		localesJSON = string(raw)
+	}
+
+	rootId, err := service.GetRootParentID(id)
+	if err != nil {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	versions, err := service.buildVersionTree(rootId)
+	if err != nil {
+		return err
+	}
+
+	docIds := make([]uint, 0, len(versions))
+	for _, version := range versions {
+		docIds = append(docIds, version.DocId)
+	}
+
+	if err := service.DB.Model(&models.Documentation{}).Where("id IN ?", docIds).Updates(map[string]interface{}{
+		"locales":        localesJSON,
+		"default_locale": defaultLocale,
+		"last_editor_id": user.ID,
+	}).Error; err != nil {
+		return fmt.Errorf("failed_to_update_locales")
+	}
+
+	if err := service.AddBuildTrigger(rootId, false); err != nil {
+		return fmt.Errorf("failed_to_add_build_trigger")
+	}
+
+	return nil
+}
+
+// checkTranslationLocale makes sure locale is one the documentation declares
+// and not the default one, whose text lives on the page itself.
+func (service *DocService) checkTranslationLocale(docId uint, locale string) error {
+	var doc models.Documentation
+	if err := service.DB.Select("id", "locales", "default_locale").First(&doc, docId).Error; err != nil {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	if locale == doc.DefaultLocale {
+		return fmt.Errorf("locale_is_default")
+	}
+
+	for _, declared := range documentationLocales(doc) {
+		if declared.Lang == locale {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid_locale")
+}
+
+// translationStatus compares a stored status with the revision of the source
+// page or page group. Any edit of the source after the translation was saved
+// makes it outdated.
+func translationStatus(status string, sourceRevision uint, revision uint) string {
+	if status == TranslationMissing || status == TranslationOutdated {
+		return status
+	}
+
+	if sourceRevision < revision {
+		return TranslationOutdated
+	}
+
+	return TranslationCurrent
+}
+
+// declaredTranslationLocales lists the locales a page or page group of the
+// documentation is expected to be translated into.
+func (service *DocService) declaredTranslationLocales(docId uint) ([]string, error) {
+	var doc models.Documentation
+	if err := service.DB.Select("id", "locales", "default_locale").First(&doc, docId).Error; err != nil {
+		return nil, fmt.Errorf("documentation_not_found")
+	}
+
+	var langs []string
+	for _, locale := range documentationLocales(doc) {
+		if locale.Lang != doc.DefaultLocale {
+			langs = append(langs, locale.Lang)
+		}
+	}
+
+	return langs, nil
+}
+
+func (service *DocService) addTranslationBuildTrigger(docId uint) error {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return fmt.Errorf("failed_to_get_root_parent_id")
+	}
+
+	if err := service.AddBuildTrigger(rootId, false); err != nil {
+		return fmt.Errorf("failed_to_add_build_trigger")
+	}
+
+	return nil
+}
+
+// GetPageTranslations returns one translation per declared locale, with the
+// status worked out against the current page. Locales without a translation
+// are listed with status "missing".
+func (service *DocService) GetPageTranslations(pageId uint) ([]models.PageTranslation, error) {
+	var page models.Page
+	if err := service.DB.Select("id", "documentation_id", "revision").First(&page, pageId).Error; err != nil {
+		return nil, fmt.Errorf("page_not_found")
+	}
+
+	langs, err := service.declaredTranslationLocales(page.DocumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []models.PageTranslation
+	if err := service.DB.Where("page_id = ?", pageId).Find(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_translations")
+	}
+
+	byLocale := make(map[string]models.PageTranslation)
+	for _, translation := range stored {
+		byLocale[translation.Locale] = translation
+	}
+
+	translations := []models.PageTranslation{}
+	for _, lang := range langs {
+		translation, ok := byLocale[lang]
+		if !ok {
+			translation = models.PageTranslation{PageID: pageId, Locale: lang, Status: TranslationMissing}
+		}
+		translation.Status = translationStatus(translation.Status, translation.SourceRevision, page.Revision)
+		translations = append(translations, translation)
+	}
+
+	return translations, nil
+}
+
+// SavePageTranslation stores the title and content of a page in locale. The
+// translation is considered current for the page revision it was saved at.
+func (service *DocService) SavePageTranslation(user models.User, pageId uint, locale string, title string, content string) (models.PageTranslation, error) {
+	var page models.Page
+	if err := service.DB.Select("id", "documentation_id", "revision").First(&page, pageId).Error; err != nil {
+		return models.PageTranslation{}, fmt.Errorf("page_not_found")
+	}
+
+	if err := service.checkTranslationLocale(page.DocumentationID, locale); err != nil {
+		return models.PageTranslation{}, err
+	}
+
+	translation, err := upsertPageTranslation(service.DB, user, page, locale, title, content, TranslationCurrent)
+	if err != nil {
+		return models.PageTranslation{}, err
+	}
+
+	if err := service.addTranslationBuildTrigger(page.DocumentationID); err != nil {
+		return models.PageTranslation{}, err
+	}
+
+	return translation, nil
+}
+
+// upsertPageTranslation creates or replaces the translation of page in locale,
+// recording the page revision it was made against.
+func upsertPageTranslation(tx *gorm.DB, user models.User, page models.Page, locale string, title string, content string, status string) (models.PageTranslation, error) {
+	var translation models.PageTranslation
+	err := tx.Where("page_id = ? AND locale = ?", page.ID, locale).First(&translation).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.PageTranslation{}, fmt.Errorf("failed_to_save_translation")
+	}
+
+	translation.PageID = page.ID
+	translation.Locale = locale
+	translation.Title = title
+	translation.Content = content
+	translation.Status = status
+	translation.SourceRevision = page.Revision
+	translation.LastEditorID = &user.ID
+
+	if err := tx.Save(&translation).Error; err != nil {
+		return models.PageTranslation{}, fmt.Errorf("failed_to_save_translation")
+	}
+
+	return translation, nil
+}
+
+// SetPageTranslationStatus marks a page translation as current, outdated or
+// missing. Marking it current accepts it for the present page revision, and a
+// missing translation is left out of the build in favour of the source.
+func (service *DocService) SetPageTranslationStatus(pageId uint, locale string, status string) error {
+	var page models.Page
+	if err := service.DB.Select("id", "documentation_id", "revision").First(&page, pageId).Error; err != nil {
+		return fmt.Errorf("page_not_found")
+	}
+
+	if err := service.checkTranslationLocale(page.DocumentationID, locale); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"status": status}
+	switch status {
+	case TranslationCurrent:
+		updates["source_revision"] = page.Revision
+	case TranslationOutdated, TranslationMissing:
+	default:
+		return fmt.Errorf("invalid_translation_status")
+	}
+
+	result := service.DB.Model(&models.PageTranslation{}).Where("page_id = ? AND locale = ?", pageId, locale).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed_to_update_translation")
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("translation_not_found")
+	}
+
+	return service.addTranslationBuildTrigger(page.DocumentationID)
+}
+
+// GetPageGroupTranslations works like GetPageTranslations for page groups.
+func (service *DocService) GetPageGroupTranslations(pageGroupId uint) ([]models.PageGroupTranslation, error) {
+	var pageGroup models.PageGroup
+	if err := service.DB.Select("id", "documentation_id", "revision").First(&pageGroup, pageGroupId).Error; err != nil {
+		return nil, fmt.Errorf("page_group_not_found")
+	}
+
+	langs, err := service.declaredTranslationLocales(pageGroup.DocumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []models.PageGroupTranslation
+	if err := service.DB.Where("page_group_id = ?", pageGroupId).Find(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_translations")
+	}
+
+	byLocale := make(map[string]models.PageGroupTranslation)
+	for _, translation := range stored {
+		byLocale[translation.Locale] = translation
+	}
+
+	translations := []models.PageGroupTranslation{}
+	for _, lang := range langs {
+		translation, ok := byLocale[lang]
+		if !ok {
+			translation = models.PageGroupTranslation{PageGroupID: pageGroupId, Locale: lang, Status: TranslationMissing}
+		}
+		translation.Status = translationStatus(translation.Status, translation.SourceRevision, pageGroup.Revision)
+		translations = append(translations, translation)
+	}
+
+	return translations, nil
+}
+
+// SavePageGroupTranslation stores the sidebar label of a page group in locale.
+func (service *DocService) SavePageGroupTranslation(user models.User, pageGroupId uint, locale string, label string) (models.PageGroupTranslation, error) {
+	var pageGroup models.PageGroup
+	if err := service.DB.Select("id", "documentation_id", "revision").First(&pageGroup, pageGroupId).Error; err != nil {
+		return models.PageGroupTranslation{}, fmt.Errorf("page_group_not_found")
+	}
+
+	if err := service.checkTranslationLocale(pageGroup.DocumentationID, locale); err != nil {
+		return models.PageGroupTranslation{}, err
+	}
+
+	translation, err := upsertPageGroupTranslation(service.DB, user, pageGroup, locale, label, TranslationCurrent)
+	if err != nil {
+		return models.PageGroupTranslation{}, err
+	}
+
+	if err := service.addTranslationBuildTrigger(pageGroup.DocumentationID); err != nil {
+		return models.PageGroupTranslation{}, err
+	}
+
+	return translation, nil
+}
+
+func upsertPageGroupTranslation(tx *gorm.DB, user models.User, pageGroup models.PageGroup, locale string, label string, status string) (models.PageGroupTranslation, error) {
+	var translation models.PageGroupTranslation
+	err := tx.Where("page_group_id = ? AND locale = ?", pageGroup.ID, locale).First(&translation).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.PageGroupTranslation{}, fmt.Errorf("failed_to_save_translation")
+	}
+
+	translation.PageGroupID = pageGroup.ID
+	translation.Locale = locale
+	translation.Label = label
+	translation.Status = status
+	translation.SourceRevision = pageGroup.Revision
+	translation.LastEditorID = &user.ID
+
+	if err := tx.Save(&translation).Error; err != nil {
+		return models.PageGroupTranslation{}, fmt.Errorf("failed_to_save_translation")
+	}
+
+	return translation, nil
+}
+
+// SetPageGroupTranslationStatus works like SetPageTranslationStatus for page
+// groups.
+func (service *DocService) SetPageGroupTranslationStatus(pageGroupId uint, locale string, status string) error {
+	var pageGroup models.PageGroup
+	if err := service.DB.Select("id", "documentation_id", "revision").First(&pageGroup, pageGroupId).Error; err != nil {
+		return fmt.Errorf("page_group_not_found")
+	}
+
+	if err := service.checkTranslationLocale(pageGroup.DocumentationID, locale); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"status": status}
+	switch status {
+	case TranslationCurrent:
+		updates["source_revision"] = pageGroup.Revision
+	case TranslationOutdated, TranslationMissing:
+	default:
+		return fmt.Errorf("invalid_translation_status")
+	}
+
+	result := service.DB.Model(&models.PageGroupTranslation{}).Where("page_group_id = ? AND locale = ?", pageGroupId, locale).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed_to_update_translation")
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("translation_not_found")
+	}
+
+	return service.addTranslationBuildTrigger(pageGroup.DocumentationID)
+}
+
+// translationSet holds the translations of one locale that replace the source
+// titles, labels and content while writing RsPress files. A nil set, used for
+// the default locale, writes the source as is.
+type translationSet struct {
+	pages  map[uint]models.PageTranslation
+	groups map[uint]models.PageGroupTranslation
+}
+
+func (service *DocService) loadTranslationSet(docId uint, locale string) (*translationSet, error) {
+	set := &translationSet{
+		pages:  make(map[uint]models.PageTranslation),
+		groups: make(map[uint]models.PageGroupTranslation),
+	}
+
+	var pages []models.PageTranslation
+	if err := service.DB.Joins("JOIN pages ON pages.id = page_translations.page_id").
+		Where("pages.documentation_id = ? AND page_translations.locale = ? AND page_translations.status <> ?", docId, locale, TranslationMissing).
+		Find(&pages).Error; err != nil {
+		return nil, err
+	}
+
+	for _, translation := range pages {
+		set.pages[translation.PageID] = translation
+	}
+
+	var groups []models.PageGroupTranslation
+	if err := service.DB.Joins("JOIN page_groups ON page_groups.id = page_group_translations.page_group_id").
+		Where("page_groups.documentation_id = ? AND page_group_translations.locale = ? AND page_group_translations.status <> ?", docId, locale, TranslationMissing).
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	for _, translation := range groups {
+		set.groups[translation.PageGroupID] = translation
+	}
+
+	return set, nil
+}
+
+func (set *translationSet) pageTitle(page models.Page) string {
+	if set != nil {
+		if translation, ok := set.pages[page.ID]; ok && translation.Title != "" {
+			return translation.Title
+		}
+	}
+
+	return page.Title
+}
+
+func (set *translationSet) pageContent(page models.Page) string {
+	if set != nil {
+		if translation, ok := set.pages[page.ID]; ok && translation.Content != "" {
+			return translation.Content
+		}
+	}
+
+	return page.Content
+}
+
+func (set *translationSet) groupLabel(group models.PageGroup) string {
+	if set != nil {
+		if translation, ok := set.groups[group.ID]; ok && translation.Label != "" {
+			return translation.Label
+		}
+	}
+
+	return group.Label
+}
+
+// copyTranslations gives the pages and page groups of a new version the
+// translations of the ones they were copied from. New rows start at revision
+// 1, so the source revision is reset to keep outdated translations outdated.
+func copyTranslations(tx *gorm.DB, pageIDMap map[uint]uint, groupIDMap map[uint]uint) error {
+	if len(pageIDMap) > 0 {
+		oldIDs := make([]uint, 0, len(pageIDMap))
+		for oldID := range pageIDMap {
+			oldIDs = append(oldIDs, oldID)
+		}
+
+		var translations []models.PageTranslation
+		if err := tx.Where("page_id IN ?", oldIDs).Find(&translations).Error; err != nil {
+			return err
+		}
+
+		var sources []models.Page
+		if err := tx.Select("id", "revision").Where("id IN ?", oldIDs).Find(&sources).Error; err != nil {
+			return err
+		}
+
+		revisions := make(map[uint]uint)
+		for _, source := range sources {
+			revisions[source.ID] = source.Revision
+		}
+
+		for _, translation := range translations {
+			if translation.SourceRevision < revisions[translation.PageID] {
+				translation.SourceRevision = 0
+			} else {
+				translation.SourceRevision = 1
+			}
+			translation.ID = 0
+			translation.PageID = pageIDMap[translation.PageID]
+			if err := tx.Create(&translation).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(groupIDMap) > 0 {
+		oldIDs := make([]uint, 0, len(groupIDMap))
+		for oldID := range groupIDMap {
+			oldIDs = append(oldIDs, oldID)
+		}
+
+		var translations []models.PageGroupTranslation
+		if err := tx.Where("page_group_id IN ?", oldIDs).Find(&translations).Error; err != nil {
+			return err
+		}
+
+		var sources []models.PageGroup
+		if err := tx.Select("id", "revision").Where("id IN ?", oldIDs).Find(&sources).Error; err != nil {
+			return err
+		}
+
+		revisions := make(map[uint]uint)
+		for _, source := range sources {
+			revisions[source.ID] = source.Revision
+		}
+
+		for _, translation := range translations {
+			if translation.SourceRevision < revisions[translation.PageGroupID] {
+				translation.SourceRevision = 0
+			} else {
+				translation.SourceRevision = 1
+			}
+			translation.ID = 0
+			translation.PageGroupID = groupIDMap[translation.PageGroupID]
+			if err := tx.Create(&translation).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
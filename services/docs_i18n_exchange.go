@@ -0,0 +1,640 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	TranslationFormatXLIFF = "xliff"
+	TranslationFormatPO    = "po"
+)
+
+// translationUnit is one translatable string. Source and Target use the
+// tagged form produced by inlineToTagged, which the file formats map to their
+// own inline markup.
+type translationUnit struct {
+	ID         string
+	Source     string
+	Target     string
+	Translated bool
+}
+
+// translationFile groups the units of one page ("page-<id>") or page group
+// ("group-<id>"). Original is the slug or folder name, as a hint for
+// translators.
+type translationFile struct {
+	ID       string
+	Original string
+	Units    []translationUnit
+}
+
+type StaleSegment struct {
+	File   string `json:"file"`
+	Unit   string `json:"unit"`
+	Reason string `json:"reason"` // "source_changed", "segment_removed", "file_removed" or "invalid_markup"
+}
+
+type TranslationImportReport struct {
+	Pages      int            `json:"pages"`
+	PageGroups int            `json:"pageGroups"`
+	Segments   int            `json:"segments"`
+	Stale      []StaleSegment `json:"stale"`
+}
+
+// contentSegment points at a translatable part of a BlockNote document: the
+// inline content of a block or table cell, or a block caption. It is keyed by
+// the block ID, so translations survive blocks being moved around.
+type contentSegment struct {
+	ID  string
+	get func() interface{}
+	set func(interface{})
+}
+
+// contentSegments lists the translatable segments of blocks in document order.
+// The setters write into blocks, which lets a copy of the source be filled in
+// with translated text while keeping its block structure.
+func contentSegments(blocks []interface{}) []contentSegment {
+	var segments []contentSegment
+
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		id, _ := block["id"].(string)
+		if id != "" {
+			switch content := block["content"].(type) {
+			case []interface{}:
+				segments = append(segments, contentSegment{
+					ID:  id,
+					get: func() interface{} { return block["content"] },
+					set: func(v interface{}) { block["content"] = v },
+				})
+			case map[string]interface{}:
+				rows, _ := content["rows"].([]interface{})
+				for i, row := range rows {
+					rowMap, _ := row.(map[string]interface{})
+					cells, _ := rowMap["cells"].([]interface{})
+					for j := range cells {
+						cellID := fmt.Sprintf("%s:r%dc%d", id, i, j)
+						if cell, ok := cells[j].(map[string]interface{}); ok {
+							segments = append(segments, contentSegment{
+								ID:  cellID,
+								get: func() interface{} { return cell["content"] },
+								set: func(v interface{}) { cell["content"] = v },
+							})
+						} else {
+							segments = append(segments, contentSegment{
+								ID:  cellID,
+								get: func() interface{} { return cells[j] },
+								set: func(v interface{}) { cells[j] = v },
+							})
+						}
+					}
+				}
+			}
+
+			if props, ok := block["props"].(map[string]interface{}); ok {
+				if caption, ok := props["caption"].(string); ok && caption != "" {
+					segments = append(segments, contentSegment{
+						ID:  id + ":caption",
+						get: func() interface{} { return props["caption"] },
+						set: func(v interface{}) { props["caption"] = v },
+					})
+				}
+			}
+		}
+
+		if children, ok := block["children"].([]interface{}); ok {
+			segments = append(segments, contentSegments(children)...)
+		}
+	}
+
+	return segments
+}
+
+func parseBlocks(content string) ([]interface{}, error) {
+	blocks := []interface{}{}
+	if content == "" || content == `"[]"` {
+		return blocks, nil
+	}
+
+	if err := json.Unmarshal([]byte(content), &blocks); err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+var inlineTagPattern = regexp.MustCompile(`<(/?)(\d+)(/?)>`)
+
+// inlineToTagged flattens BlockNote inline content to text. Styled text and
+// links are wrapped in numbered tags, <1>like this</1>, and other inline
+// content becomes a placeholder such as <2/>. The numbers refer to the
+// position in the source, which is where styles and link targets are taken
+// from on import.
+func inlineToTagged(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var builder strings.Builder
+		for i, item := range v {
+			run, _ := item.(map[string]interface{})
+			tag := strconv.Itoa(i + 1)
+
+			switch run["type"] {
+			case "text":
+				text, _ := run["text"].(string)
+				if styles, ok := run["styles"].(map[string]interface{}); ok && len(styles) > 0 {
+					builder.WriteString("<" + tag + ">" + text + "</" + tag + ">")
+				} else {
+					builder.WriteString(text)
+				}
+			case "link":
+				builder.WriteString("<" + tag + ">" + inlineText(run["content"]) + "</" + tag + ">")
+			default:
+				builder.WriteString("<" + tag + "/>")
+			}
+		}
+		return builder.String()
+	default:
+		return ""
+	}
+}
+
+func inlineText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var builder strings.Builder
+		for _, item := range v {
+			if run, ok := item.(map[string]interface{}); ok {
+				text, _ := run["text"].(string)
+				builder.WriteString(text)
+			}
+		}
+		return builder.String()
+	default:
+		return ""
+	}
+}
+
+// taggedToInline is the reverse of inlineToTagged. Tags are resolved against
+// source, so a translation keeps the styles and links of the text it
+// translates even when the translator reordered them.
+func taggedToInline(tagged string, source interface{}) (interface{}, error) {
+	if _, ok := source.(string); ok {
+		return tagged, nil
+	}
+
+	sourceRuns, _ := source.([]interface{})
+	runs := []interface{}{}
+
+	addText := func(text string) {
+		if text != "" {
+			runs = append(runs, map[string]interface{}{"type": "text", "text": text, "styles": map[string]interface{}{}})
+		}
+	}
+
+	sourceRun := func(tag string) (map[string]interface{}, bool) {
+		n, err := strconv.Atoi(tag)
+		if err != nil || n < 1 || n > len(sourceRuns) {
+			return nil, false
+		}
+		run, ok := sourceRuns[n-1].(map[string]interface{})
+		return run, ok
+	}
+
+	open := ""
+	openAt := 0
+	last := 0
+
+	for _, match := range inlineTagPattern.FindAllStringSubmatchIndex(tagged, -1) {
+		closing := tagged[match[2]:match[3]] == "/"
+		tag := tagged[match[4]:match[5]]
+		selfClosing := tagged[match[6]:match[7]] == "/"
+
+		switch {
+		case selfClosing:
+			if open != "" {
+				return nil, fmt.Errorf("invalid_markup")
+			}
+			run, ok := sourceRun(tag)
+			if !ok {
+				return nil, fmt.Errorf("invalid_markup")
+			}
+			addText(tagged[last:match[0]])
+			runs = append(runs, run)
+		case !closing:
+			if open != "" {
+				return nil, fmt.Errorf("invalid_markup")
+			}
+			addText(tagged[last:match[0]])
+			open = tag
+			openAt = match[1]
+		default:
+			if open != tag {
+				return nil, fmt.Errorf("invalid_markup")
+			}
+			run, ok := sourceRun(tag)
+			if !ok {
+				return nil, fmt.Errorf("invalid_markup")
+			}
+			text := tagged[openAt:match[0]]
+
+			if run["type"] == "link" {
+				styles := map[string]interface{}{}
+				if inner, ok := run["content"].([]interface{}); ok && len(inner) > 0 {
+					if first, ok := inner[0].(map[string]interface{}); ok {
+						if s, ok := first["styles"].(map[string]interface{}); ok {
+							styles = s
+						}
+					}
+				}
+				runs = append(runs, map[string]interface{}{
+					"type":    "link",
+					"href":    run["href"],
+					"content": []interface{}{map[string]interface{}{"type": "text", "text": text, "styles": styles}},
+				})
+			} else {
+				runs = append(runs, map[string]interface{}{"type": "text", "text": text, "styles": run["styles"]})
+			}
+			open = ""
+		}
+
+		last = match[1]
+	}
+
+	if open != "" {
+		return nil, fmt.Errorf("invalid_markup")
+	}
+
+	addText(tagged[last:])
+
+	return runs, nil
+}
+
+func translatableFileID(kind string, id uint) string {
+	return fmt.Sprintf("%s-%d", kind, id)
+}
+
+// collectTranslationFiles lists the translatable text of a documentation
+// version, with the current translations into locale as targets.
+func (service *DocService) collectTranslationFiles(docId uint, locale string) ([]translationFile, error) {
+	var pageGroups []models.PageGroup
+	if err := service.DB.Where("documentation_id = ?", docId).Order("id").Find(&pageGroups).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_page_groups")
+	}
+
+	var pages []models.Page
+	if err := service.DB.Where("documentation_id = ?", docId).Order("id").Find(&pages).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_pages")
+	}
+
+	var groupTranslations []models.PageGroupTranslation
+	if err := service.DB.Joins("JOIN page_groups ON page_groups.id = page_group_translations.page_group_id").
+		Where("page_groups.documentation_id = ? AND page_group_translations.locale = ?", docId, locale).
+		Find(&groupTranslations).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_translations")
+	}
+
+	var pageTranslations []models.PageTranslation
+	if err := service.DB.Joins("JOIN pages ON pages.id = page_translations.page_id").
+		Where("pages.documentation_id = ? AND page_translations.locale = ?", docId, locale).
+		Find(&pageTranslations).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_translations")
+	}
+
+	groupTargets := make(map[uint]models.PageGroupTranslation)
+	for _, translation := range groupTranslations {
+		groupTargets[translation.PageGroupID] = translation
+	}
+
+	pageTargets := make(map[uint]models.PageTranslation)
+	for _, translation := range pageTranslations {
+		pageTargets[translation.PageID] = translation
+	}
+
+	var files []translationFile
+
+	for _, group := range pageGroups {
+		file := translationFile{ID: translatableFileID("group", group.ID), Original: group.Name}
+		unit := translationUnit{ID: "label", Source: group.Label}
+		if target, ok := groupTargets[group.ID]; ok && target.Status != TranslationMissing {
+			unit.Target = target.Label
+			unit.Translated = translationStatus(target.Status, target.SourceRevision, group.Revision) == TranslationCurrent
+		}
+		file.Units = append(file.Units, unit)
+		files = append(files, file)
+	}
+
+	for _, page := range pages {
+		file := translationFile{ID: translatableFileID("page", page.ID), Original: page.Slug}
+
+		target, hasTarget := pageTargets[page.ID]
+		if hasTarget && target.Status == TranslationMissing {
+			hasTarget = false
+		}
+		translated := hasTarget && translationStatus(target.Status, target.SourceRevision, page.Revision) == TranslationCurrent
+
+		title := translationUnit{ID: "title", Source: page.Title}
+		if hasTarget {
+			title.Target = target.Title
+			title.Translated = translated
+		}
+		file.Units = append(file.Units, title)
+
+		blocks, err := parseBlocks(page.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid_page_content")
+		}
+
+		targets := make(map[string]string)
+		if hasTarget {
+			if targetBlocks, err := parseBlocks(target.Content); err == nil {
+				for _, segment := range contentSegments(targetBlocks) {
+					targets[segment.ID] = inlineToTagged(segment.get())
+				}
+			}
+		}
+
+		for _, segment := range contentSegments(blocks) {
+			source := inlineToTagged(segment.get())
+			if strings.TrimSpace(source) == "" {
+				continue
+			}
+
+			unit := translationUnit{ID: segment.ID, Source: source}
+			if targetText, ok := targets[segment.ID]; ok {
+				unit.Target = targetText
+				unit.Translated = translated
+			}
+			file.Units = append(file.Units, unit)
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// ExportTranslations writes the translatable text of a documentation version
+// as an XLIFF 2.0 or PO file for locale, ready for a CAT tool.
+func (service *DocService) ExportTranslations(docId uint, locale string, format string) ([]byte, error) {
+	if err := service.checkTranslationLocale(docId, locale); err != nil {
+		return nil, err
+	}
+
+	var doc models.Documentation
+	if err := service.DB.Select("id", "default_locale").First(&doc, docId).Error; err != nil {
+		return nil, fmt.Errorf("documentation_not_found")
+	}
+
+	files, err := service.collectTranslationFiles(docId, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case TranslationFormatXLIFF:
+		return writeXLIFF(doc.DefaultLocale, locale, files)
+	case TranslationFormatPO:
+		return writePO(doc.DefaultLocale, locale, files), nil
+	default:
+		return nil, fmt.Errorf("invalid_translation_format")
+	}
+}
+
+// ImportTranslations reads back a file made by ExportTranslations. Translated
+// segments are applied to a copy of the current source, so the translation
+// keeps the source's block structure and inline styles. Segments whose source
+// text has changed since the export are not applied but reported as stale, and
+// pages with stale segments are marked outdated.
+func (service *DocService) ImportTranslations(user models.User, docId uint, locale string, format string, data []byte) (TranslationImportReport, error) {
+	report := TranslationImportReport{Stale: []StaleSegment{}}
+
+	if err := service.checkTranslationLocale(docId, locale); err != nil {
+		return report, err
+	}
+
+	var fileLocale string
+	var files []translationFile
+	var err error
+
+	switch format {
+	case TranslationFormatXLIFF:
+		fileLocale, files, err = parseXLIFF(data)
+	case TranslationFormatPO:
+		fileLocale, files, err = parsePO(data)
+	default:
+		return report, fmt.Errorf("invalid_translation_format")
+	}
+	if err != nil {
+		return report, err
+	}
+
+	if fileLocale != "" && fileLocale != locale {
+		return report, fmt.Errorf("locale_mismatch")
+	}
+
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		for _, file := range files {
+			kind, idStr, _ := strings.Cut(file.ID, "-")
+			id, err := strconv.ParseUint(idStr, 10, 32)
+			if err != nil {
+				report.Stale = append(report.Stale, StaleSegment{File: file.ID, Reason: "file_removed"})
+				continue
+			}
+
+			switch kind {
+			case "group":
+				imported, err := importPageGroupTranslation(tx, user, docId, uint(id), locale, file, &report)
+				if err != nil {
+					return err
+				}
+				if imported {
+					report.PageGroups++
+				}
+			case "page":
+				imported, err := importPageTranslation(tx, user, docId, uint(id), locale, file, &report)
+				if err != nil {
+					return err
+				}
+				if imported {
+					report.Pages++
+				}
+			default:
+				report.Stale = append(report.Stale, StaleSegment{File: file.ID, Reason: "file_removed"})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if report.Pages > 0 || report.PageGroups > 0 {
+		if err := service.addTranslationBuildTrigger(docId); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+func importPageGroupTranslation(tx *gorm.DB, user models.User, docId uint, id uint, locale string, file translationFile, report *TranslationImportReport) (bool, error) {
+	var group models.PageGroup
+	if err := tx.Where("id = ? AND documentation_id = ?", id, docId).First(&group).Error; err != nil {
+		report.Stale = append(report.Stale, StaleSegment{File: file.ID, Reason: "file_removed"})
+		return false, nil
+	}
+
+	for _, unit := range file.Units {
+		if unit.ID != "label" {
+			report.Stale = append(report.Stale, StaleSegment{File: file.ID, Unit: unit.ID, Reason: "segment_removed"})
+			continue
+		}
+
+		if !unit.Translated || unit.Target == "" {
+			continue
+		}
+
+		if unit.Source != group.Label {
+			report.Stale = append(report.Stale, StaleSegment{File: file.ID, Unit: unit.ID, Reason: "source_changed"})
+			continue
+		}
+
+		if _, err := upsertPageGroupTranslation(tx, user, group, locale, unit.Target, TranslationCurrent); err != nil {
+			return false, err
+		}
+		report.Segments++
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func importPageTranslation(tx *gorm.DB, user models.User, docId uint, id uint, locale string, file translationFile, report *TranslationImportReport) (bool, error) {
+	var page models.Page
+	if err := tx.Where("id = ? AND documentation_id = ?", id, docId).First(&page).Error; err != nil {
+		report.Stale = append(report.Stale, StaleSegment{File: file.ID, Reason: "file_removed"})
+		return false, nil
+	}
+
+	var existing models.PageTranslation
+	hasExisting := tx.Where("page_id = ? AND locale = ?", page.ID, locale).First(&existing).Error == nil
+
+	// blocks becomes the translated content, while sourceBlocks stays as is
+	// for comparing against what the translator saw.
+	blocks, err := parseBlocks(page.Content)
+	if err != nil {
+		return false, fmt.Errorf("invalid_page_content")
+	}
+	sourceBlocks, _ := parseBlocks(page.Content)
+
+	segments := make(map[string]contentSegment)
+	for _, segment := range contentSegments(blocks) {
+		segments[segment.ID] = segment
+	}
+
+	sources := make(map[string]interface{})
+	for _, segment := range contentSegments(sourceBlocks) {
+		sources[segment.ID] = segment.get()
+	}
+
+	// Segments that were translated before but are not part of this file keep
+	// their earlier translation.
+	if hasExisting {
+		if existingBlocks, err := parseBlocks(existing.Content); err == nil {
+			for _, previous := range contentSegments(existingBlocks) {
+				if segment, ok := segments[previous.ID]; ok {
+					if inline, err := taggedToInline(inlineToTagged(previous.get()), sources[previous.ID]); err == nil {
+						segment.set(inline)
+					}
+				}
+			}
+		}
+	}
+
+	title := page.Title
+	if hasExisting && existing.Title != "" {
+		title = existing.Title
+	}
+
+	applied := 0
+	stale := false
+
+	for _, unit := range file.Units {
+		if !unit.Translated || unit.Target == "" {
+			continue
+		}
+
+		if unit.ID == "title" {
+			if unit.Source != page.Title {
+				report.Stale = append(report.Stale, StaleSegment{File: file.ID, Unit: unit.ID, Reason: "source_changed"})
+				stale = true
+				continue
+			}
+			title = unit.Target
+			applied++
+			continue
+		}
+
+		segment, ok := segments[unit.ID]
+		if !ok {
+			report.Stale = append(report.Stale, StaleSegment{File: file.ID, Unit: unit.ID, Reason: "segment_removed"})
+			stale = true
+			continue
+		}
+
+		sourceValue := sources[unit.ID]
+		if inlineToTagged(sourceValue) != unit.Source {
+			report.Stale = append(report.Stale, StaleSegment{File: file.ID, Unit: unit.ID, Reason: "source_changed"})
+			stale = true
+			continue
+		}
+
+		inline, err := taggedToInline(unit.Target, sourceValue)
+		if err != nil {
+			report.Stale = append(report.Stale, StaleSegment{File: file.ID, Unit: unit.ID, Reason: err.Error()})
+			stale = true
+			continue
+		}
+
+		segment.set(inline)
+		applied++
+	}
+
+	if applied == 0 {
+		return false, nil
+	}
+
+	content, err := json.Marshal(blocks)
+	if err != nil {
+		return false, fmt.Errorf("failed_to_save_translation")
+	}
+
+	status := TranslationCurrent
+	if stale {
+		status = TranslationOutdated
+	}
+
+	if _, err := upsertPageTranslation(tx, user, page, locale, title, string(content), status); err != nil {
+		return false, err
+	}
+	report.Segments += applied
+
+	return true, nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+const exchangeTestContent = `[
+	{"id":"b1","type":"paragraph","props":{},"content":[
+		{"type":"text","text":"Hello ","styles":{}},
+		{"type":"text","text":"bold","styles":{"bold":true}},
+		{"type":"text","text":" and ","styles":{}},
+		{"type":"link","href":"https://example.com","content":[{"type":"text","text":"a link","styles":{}}]}
+	],"children":[
+		{"id":"b2","type":"paragraph","props":{},"content":[{"type":"text","text":"Nested","styles":{}}],"children":[]}
+	]},
+	{"id":"b3","type":"image","props":{"url":"/x.png","caption":"A picture"},"children":[]},
+	{"id":"b4","type":"table","props":{},"content":{"type":"tableContent","rows":[
+		{"cells":[[{"type":"text","text":"Cell","styles":{}}]]}
+	]},"children":[]}
+]`
+
+func TestInlineTaggedRoundTrip(t *testing.T) {
+	var blocks []interface{}
+	if err := json.Unmarshal([]byte(exchangeTestContent), &blocks); err != nil {
+		t.Fatalf("Failed to parse content: %v", err)
+	}
+
+	segments := contentSegments(blocks)
+
+	var ids []string
+	for _, segment := range segments {
+		ids = append(ids, segment.ID)
+	}
+
+	if strings.Join(ids, ",") != "b1,b2,b3:caption,b4:r0c0" {
+		t.Fatalf("Unexpected segments %v", ids)
+	}
+
+	source := segments[0].get()
+	tagged := inlineToTagged(source)
+	if tagged != "Hello <2>bold</2> and <4>a link</4>" {
+		t.Fatalf("Unexpected tagged text %q", tagged)
+	}
+
+	inline, err := taggedToInline("<4>Ein Link</4> und <2>fett</2>", source)
+	if err != nil {
+		t.Fatalf("taggedToInline returned an error: %v", err)
+	}
+
+	runs := inline.([]interface{})
+	if len(runs) != 3 {
+		t.Fatalf("Expected 3 runs, got %v", runs)
+	}
+
+	link := runs[0].(map[string]interface{})
+	if link["type"] != "link" || link["href"] != "https://example.com" || inlineText(link["content"]) != "Ein Link" {
+		t.Errorf("Expected the link to keep its target, got %v", link)
+	}
+
+	bold := runs[2].(map[string]interface{})
+	if bold["text"] != "fett" || bold["styles"].(map[string]interface{})["bold"] != true {
+		t.Errorf("Expected bold styles to be kept, got %v", bold)
+	}
+
+	for _, invalid := range []string{"<2>open", "<9>x</9>", "<2><4>x</4></2>"} {
+		if _, err := taggedToInline(invalid, source); err == nil || err.Error() != "invalid_markup" {
+			t.Errorf("Expected 'invalid_markup' error for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func setupExchangeTest(t *testing.T, name string) (models.User, models.Documentation, models.Page) {
+	t.Helper()
+
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, name, "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/exchange", 1)
+
+	if err := TestDocService.DB.Model(&page).Update("content", exchangeTestContent).Error; err != nil {
+		t.Fatalf("Failed to set page content: %v", err)
+	}
+
+	if err := TestDocService.SetDocumentationLocales(admin, doc.ID, "en", []Locale{{Lang: "en"}, {Lang: "de"}}); err != nil {
+		t.Fatalf("SetDocumentationLocales returned an error: %v", err)
+	}
+
+	return admin, doc, page
+}
+
+func TestXLIFFExchange(t *testing.T) {
+	admin, doc, page := setupExchangeTest(t, "XLIFF Exchange Doc")
+
+	exported, err := TestDocService.ExportTranslations(doc.ID, "de", TranslationFormatXLIFF)
+	if err != nil {
+		t.Fatalf("ExportTranslations returned an error: %v", err)
+	}
+
+	xliff := string(exported)
+	if !strings.Contains(xliff, `trgLang="de"`) || !strings.Contains(xliff, `Hello <pc id="2">bold</pc> and <pc id="4">a link</pc>`) {
+		t.Fatalf("Unexpected XLIFF export:\n%s", xliff)
+	}
+
+	// Play the translator: fill in targets for the title and the first block.
+	translated := strings.Replace(xliff,
+		`<source>Hello <pc id="2">bold</pc> and <pc id="4">a link</pc></source>`,
+		`<source>Hello <pc id="2">bold</pc> and <pc id="4">a link</pc></source><target>Hallo <pc id="2">fett</pc> &amp; <pc id="4">ein Link</pc></target>`, 1)
+	translated = strings.Replace(translated,
+		`<source>/exchange</source>`,
+		`<source>/exchange</source><target>Austausch</target>`, 1)
+	translated = strings.ReplaceAll(translated, `state="initial"`, `state="translated"`)
+
+	report, err := TestDocService.ImportTranslations(admin, doc.ID, "de", TranslationFormatXLIFF, []byte(translated))
+	if err != nil {
+		t.Fatalf("ImportTranslations returned an error: %v", err)
+	}
+
+	if report.Pages != 1 || report.Segments != 2 || len(report.Stale) != 0 {
+		t.Fatalf("Unexpected import report %+v", report)
+	}
+
+	var translation models.PageTranslation
+	if err := TestDocService.DB.Where("page_id = ? AND locale = ?", page.ID, "de").First(&translation).Error; err != nil {
+		t.Fatalf("Failed to find translation: %v", err)
+	}
+
+	if translation.Title != "Austausch" || translation.Status != TranslationCurrent {
+		t.Errorf("Expected a current translation titled 'Austausch', got %q (%s)", translation.Title, translation.Status)
+	}
+
+	blocks, err := parseBlocks(translation.Content)
+	if err != nil {
+		t.Fatalf("Failed to parse translated content: %v", err)
+	}
+
+	segments := contentSegments(blocks)
+	if len(segments) != 4 {
+		t.Fatalf("Expected the block structure to be kept, got %d segments", len(segments))
+	}
+
+	if tagged := inlineToTagged(segments[0].get()); tagged != "Hallo <2>fett</2> & <4>ein Link</4>" {
+		t.Errorf("Unexpected translated block %q", tagged)
+	}
+
+	if tagged := inlineToTagged(segments[1].get()); tagged != "Nested" {
+		t.Errorf("Expected untranslated blocks to keep the source text, got %q", tagged)
+	}
+}
+
+func TestPOExchangeReportsStaleSegments(t *testing.T) {
+	admin, doc, page := setupExchangeTest(t, "PO Exchange Doc")
+
+	exported, err := TestDocService.ExportTranslations(doc.ID, "de", TranslationFormatPO)
+	if err != nil {
+		t.Fatalf("ExportTranslations returned an error: %v", err)
+	}
+
+	po := string(exported)
+	if !strings.Contains(po, "\"Language: de\\n\"") || !strings.Contains(po, `msgctxt "page-`) {
+		t.Fatalf("Unexpected PO export:\n%s", po)
+	}
+
+	po = strings.Replace(po, "msgid \"Nested\"\nmsgstr \"\"", "msgid \"Nested\"\nmsgstr \"Verschachtelt\"", 1)
+	po = strings.Replace(po, "msgid \"A picture\"\nmsgstr \"\"", "msgid \"A picture\"\nmsgstr \"Ein Bild\"", 1)
+	po = strings.Replace(po, "msgid \"Cell\"\nmsgstr \"\"", "msgid \"Cell\"\nmsgstr \"Zelle\"", 1)
+
+	// The source changes while the file is out for translation.
+	changed := strings.Replace(exchangeTestContent, `"text":"Cell"`, `"text":"Table cell"`, 1)
+	if err := TestDocService.DB.Model(&page).Update("content", changed).Error; err != nil {
+		t.Fatalf("Failed to update page content: %v", err)
+	}
+
+	report, err := TestDocService.ImportTranslations(admin, doc.ID, "de", TranslationFormatPO, []byte(po))
+	if err != nil {
+		t.Fatalf("ImportTranslations returned an error: %v", err)
+	}
+
+	if report.Segments != 2 || len(report.Stale) != 1 || report.Stale[0].Unit != "b4:r0c0" || report.Stale[0].Reason != "source_changed" {
+		t.Fatalf("Unexpected import report %+v", report)
+	}
+
+	translations, err := TestDocService.GetPageTranslations(page.ID)
+	if err != nil {
+		t.Fatalf("GetPageTranslations returned an error: %v", err)
+	}
+
+	if len(translations) != 1 || translations[0].Status != TranslationOutdated {
+		t.Fatalf("Expected the page translation to be outdated, got %+v", translations)
+	}
+
+	blocks, _ := parseBlocks(translations[0].Content)
+	segments := contentSegments(blocks)
+	if inlineToTagged(segments[1].get()) != "Verschachtelt" || inlineToTagged(segments[2].get()) != "Ein Bild" || inlineToTagged(segments[3].get()) != "Table cell" {
+		t.Errorf("Unexpected translated segments in %s", translations[0].Content)
+	}
+
+	if _, err := TestDocService.ImportTranslations(admin, doc.ID, "fr", TranslationFormatPO, []byte(po)); err == nil || err.Error() != "invalid_locale" {
+		t.Errorf("Expected 'invalid_locale' error, got %v", err)
+	}
+
+	wrongLanguage := strings.Replace(po, "Language: de", "Language: es", 1)
+	if _, err := TestDocService.ImportTranslations(admin, doc.ID, "de", TranslationFormatPO, []byte(wrongLanguage)); err == nil || err.Error() != "locale_mismatch" {
+		t.Errorf("Expected 'locale_mismatch' error, got %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const xliffNamespace = "urn:oasis:names:tc:xliff:document:2.0"
+
+type xliffDocument struct {
+	XMLName xml.Name    `xml:"urn:oasis:names:tc:xliff:document:2.0 xliff"`
+	Version string      `xml:"version,attr"`
+	SrcLang string      `xml:"srcLang,attr"`
+	TrgLang string      `xml:"trgLang,attr,omitempty"`
+	Files   []xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	ID       string      `xml:"id,attr"`
+	Original string      `xml:"original,attr,omitempty"`
+	Units    []xliffUnit `xml:"unit"`
+}
+
+type xliffUnit struct {
+	ID      string       `xml:"id,attr"`
+	Segment xliffSegment `xml:"segment"`
+}
+
+type xliffSegment struct {
+	State  string     `xml:"state,attr,omitempty"`
+	Source xliffText  `xml:"source"`
+	Target *xliffText `xml:"target"`
+}
+
+type xliffText struct {
+	Inner string `xml:",innerxml"`
+}
+
+// taggedToXLIFF turns the numbered tags of a unit into XLIFF paired codes
+// (<pc>) and placeholders (<ph>), escaping everything else.
+func taggedToXLIFF(tagged string) string {
+	var buffer bytes.Buffer
+	last := 0
+
+	for _, match := range inlineTagPattern.FindAllStringSubmatchIndex(tagged, -1) {
+		xml.EscapeText(&buffer, []byte(tagged[last:match[0]]))
+
+		tag := tagged[match[4]:match[5]]
+		switch {
+		case tagged[match[6]:match[7]] == "/":
+			fmt.Fprintf(&buffer, `<ph id="%s"/>`, tag)
+		case tagged[match[2]:match[3]] == "/":
+			buffer.WriteString("</pc>")
+		default:
+			fmt.Fprintf(&buffer, `<pc id="%s">`, tag)
+		}
+
+		last = match[1]
+	}
+
+	xml.EscapeText(&buffer, []byte(tagged[last:]))
+
+	return buffer.String()
+}
+
+// xliffToTagged reads the inline content of a <source> or <target> back into
+// numbered tags. Markup other than <pc> and <ph>, such as annotations added by
+// a CAT tool, is dropped while its text is kept.
+func xliffToTagged(inner string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader("<t>" + inner + "</t>"))
+	decoder.Strict = false
+
+	var builder strings.Builder
+	var open []string
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid_translation_file")
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			id := ""
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "id" {
+					id = attr.Value
+				}
+			}
+
+			switch t.Name.Local {
+			case "pc":
+				builder.WriteString("<" + id + ">")
+				open = append(open, id)
+			case "ph":
+				builder.WriteString("<" + id + "/>")
+			}
+		case xml.EndElement:
+			if t.Name.Local == "pc" && len(open) > 0 {
+				builder.WriteString("</" + open[len(open)-1] + ">")
+				open = open[:len(open)-1]
+			}
+		case xml.CharData:
+			builder.Write(t)
+		}
+	}
+
+	return builder.String(), nil
+}
+
+func writeXLIFF(srcLang string, trgLang string, files []translationFile) ([]byte, error) {
+	document := xliffDocument{Version: "2.0", SrcLang: srcLang, TrgLang: trgLang}
+
+	for _, file := range files {
+		xf := xliffFile{ID: file.ID, Original: file.Original}
+
+		for _, unit := range file.Units {
+			segment := xliffSegment{State: "initial", Source: xliffText{Inner: taggedToXLIFF(unit.Source)}}
+			if unit.Target != "" {
+				segment.Target = &xliffText{Inner: taggedToXLIFF(unit.Target)}
+				if unit.Translated {
+					segment.State = "translated"
+				}
+			}
+
+			xf.Units = append(xf.Units, xliffUnit{ID: unit.ID, Segment: segment})
+		}
+
+		document.Files = append(document.Files, xf)
+	}
+
+	out, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed_to_export_translations")
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
+
+// parseXLIFF reads an XLIFF 2.0 file. A target counts as translated unless the
+// segment is still in the "initial" state.
+func parseXLIFF(data []byte) (string, []translationFile, error) {
+	var document xliffDocument
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return "", nil, fmt.Errorf("invalid_translation_file")
+	}
+
+	if document.XMLName.Space != xliffNamespace || !strings.HasPrefix(document.Version, "2.") {
+		return "", nil, fmt.Errorf("invalid_translation_file")
+	}
+
+	var files []translationFile
+	for _, xf := range document.Files {
+		file := translationFile{ID: xf.ID, Original: xf.Original}
+
+		for _, xu := range xf.Units {
+			source, err := xliffToTagged(xu.Segment.Source.Inner)
+			if err != nil {
+				return "", nil, err
+			}
+
+			unit := translationUnit{ID: xu.ID, Source: source}
+			if xu.Segment.Target != nil {
+				target, err := xliffToTagged(xu.Segment.Target.Inner)
+				if err != nil {
+					return "", nil, err
+				}
+				unit.Target = target
+				unit.Translated = xu.Segment.State != "initial"
+			}
+
+			file.Units = append(file.Units, unit)
+		}
+
+		files = append(files, file)
+	}
+
+	return document.TrgLang, files, nil
+}
+
+func poQuote(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+func writePOString(buffer *bytes.Buffer, keyword string, s string) {
+	if !strings.Contains(s, "\n") || s == "\n" {
+		fmt.Fprintf(buffer, "%s %s\n", keyword, poQuote(s))
+		return
+	}
+
+	fmt.Fprintf(buffer, "%s \"\"\n", keyword)
+	lines := strings.SplitAfter(s, "\n")
+	for _, line := range lines {
+		if line != "" {
+			buffer.WriteString(poQuote(line) + "\n")
+		}
+	}
+}
+
+// writePO writes a gettext catalogue. Each entry is told apart by its msgctxt,
+// "<file>:<unit>", and outdated translations are flagged fuzzy.
+func writePO(srcLang string, trgLang string, files []translationFile) []byte {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("msgid \"\"\n")
+	buffer.WriteString("msgstr \"\"\n")
+	buffer.WriteString(poQuote("Content-Type: text/plain; charset=UTF-8\n") + "\n")
+	buffer.WriteString(poQuote("Language: "+trgLang+"\n") + "\n")
+	buffer.WriteString(poQuote("X-Source-Language: "+srcLang+"\n") + "\n")
+
+	for _, file := range files {
+		for _, unit := range file.Units {
+			buffer.WriteString("\n")
+			if file.Original != "" {
+				fmt.Fprintf(&buffer, "#: %s\n", file.Original)
+			}
+			if unit.Target != "" && !unit.Translated {
+				buffer.WriteString("#, fuzzy\n")
+			}
+			writePOString(&buffer, "msgctxt", file.ID+":"+unit.ID)
+			writePOString(&buffer, "msgid", unit.Source)
+			writePOString(&buffer, "msgstr", unit.Target)
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+func poUnquote(line string) (string, error) {
+	s, err := strconv.Unquote(line)
+	if err != nil {
+		return "", fmt.Errorf("invalid_translation_file")
+	}
+	return s, nil
+}
+
+type poEntry struct {
+	fuzzy   bool
+	msgctxt string
+	msgid   string
+	msgstr  string
+}
+
+// parsePO reads a gettext catalogue written by writePO. Fuzzy entries are
+// read as untranslated, as gettext itself does.
+func parsePO(data []byte) (string, []translationFile, error) {
+	var entries []poEntry
+	var current poEntry
+	var field *string
+	started := false
+
+	flush := func() {
+		if started {
+			entries = append(entries, current)
+		}
+		current = poEntry{}
+		field = nil
+		started = false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "#,"):
+			if started && field != &current.msgctxt {
+				flush()
+			}
+			if strings.Contains(line, "fuzzy") {
+				current.fuzzy = true
+			}
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, `"`):
+			if field == nil {
+				return "", nil, fmt.Errorf("invalid_translation_file")
+			}
+			s, err := poUnquote(line)
+			if err != nil {
+				return "", nil, err
+			}
+			*field += s
+		default:
+			keyword, rest, ok := strings.Cut(line, " ")
+			if !ok {
+				return "", nil, fmt.Errorf("invalid_translation_file")
+			}
+
+			s, err := poUnquote(strings.TrimSpace(rest))
+			if err != nil {
+				return "", nil, err
+			}
+
+			switch keyword {
+			case "msgctxt":
+				if started {
+					flush()
+				}
+				field = &current.msgctxt
+			case "msgid":
+				if started && field == &current.msgstr {
+					flush()
+				}
+				field = &current.msgid
+			case "msgstr":
+				field = &current.msgstr
+			default:
+				return "", nil, fmt.Errorf("invalid_translation_file")
+			}
+
+			started = true
+			*field = s
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return "", nil, fmt.Errorf("invalid_translation_file")
+	}
+
+	language := ""
+	var files []translationFile
+	index := make(map[string]int)
+
+	for _, entry := range entries {
+		if entry.msgctxt == "" && entry.msgid == "" {
+			for _, header := range strings.Split(entry.msgstr, "\n") {
+				if name, value, ok := strings.Cut(header, ":"); ok && strings.TrimSpace(name) == "Language" {
+					language = strings.TrimSpace(value)
+				}
+			}
+			continue
+		}
+
+		fileID, unitID, ok := strings.Cut(entry.msgctxt, ":")
+		if !ok {
+			continue
+		}
+
+		i, ok := index[fileID]
+		if !ok {
+			i = len(files)
+			index[fileID] = i
+			files = append(files, translationFile{ID: fileID})
+		}
+
+		files[i].Units = append(files[i].Units, translationUnit{
+			ID:         unitID,
+			Source:     entry.msgid,
+			Target:     entry.msgstr,
+			Translated: entry.msgstr != "" && !entry.fuzzy,
+		})
+	}
+
+	return language, files, nil
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestSetDocumentationLocales(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Locales Doc", "1.0.0", nil)
+	version := createTestDocumentation(t, "Locales Doc", "2.0.0", &doc.ID)
+
+	tests := []struct {
+		name          string
+		defaultLocale string
+		locales       []Locale
+		expectedError string
+	}{
+		{"Invalid lang", "en", []Locale{{Lang: "en"}, {Lang: "../de"}}, "invalid_locale"},
+		{"Duplicate lang", "en", []Locale{{Lang: "en"}, {Lang: "en"}}, "invalid_locale"},
+		{"Undeclared default", "fr", []Locale{{Lang: "en"}, {Lang: "de"}}, "invalid_default_locale"},
+		{"Default without locales", "en", nil, "invalid_default_locale"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := TestDocService.SetDocumentationLocales(admin, doc.ID, tt.defaultLocale, tt.locales)
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("Expected '%s' error, got %v", tt.expectedError, err)
+			}
+		})
+	}
+
+	locales := []Locale{{Lang: "en", Label: "English"}, {Lang: "pt-BR"}}
+	if err := TestDocService.SetDocumentationLocales(admin, version.ID, "en", locales); err != nil {
+		t.Fatalf("SetDocumentationLocales returned an error: %v", err)
+	}
+
+	for _, id := range []uint{doc.ID, version.ID} {
+		current, err := TestDocService.GetDocumentation(id)
+		if err != nil {
+			t.Fatalf("GetDocumentation returned an error: %v", err)
+		}
+
+		declared := documentationLocales(current)
+		if current.DefaultLocale != "en" || len(declared) != 2 || declared[1].Label != "pt-BR" {
+			t.Errorf("Expected every version to declare en and pt-BR, got %q with %+v", current.DefaultLocale, declared)
+		}
+	}
+}
+
+func TestPageTranslationStatus(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Translated Doc", "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/translated", 1)
+
+	if err := TestDocService.SetDocumentationLocales(admin, doc.ID, "en", []Locale{{Lang: "en"}, {Lang: "de"}}); err != nil {
+		t.Fatalf("SetDocumentationLocales returned an error: %v", err)
+	}
+
+	if _, err := TestDocService.SavePageTranslation(admin, page.ID, "en", "Title", "[]"); err == nil || err.Error() != "locale_is_default" {
+		t.Errorf("Expected 'locale_is_default' error, got %v", err)
+	}
+
+	if _, err := TestDocService.SavePageTranslation(admin, page.ID, "fr", "Titre", "[]"); err == nil || err.Error() != "invalid_locale" {
+		t.Errorf("Expected 'invalid_locale' error, got %v", err)
+	}
+
+	assertStatus := func(expected string) {
+		t.Helper()
+
+		translations, err := TestDocService.GetPageTranslations(page.ID)
+		if err != nil {
+			t.Fatalf("GetPageTranslations returned an error: %v", err)
+		}
+
+		if len(translations) != 1 || translations[0].Locale != "de" || translations[0].Status != expected {
+			t.Fatalf("Expected one 'de' translation with status %q, got %+v", expected, translations)
+		}
+	}
+
+	assertStatus(TranslationMissing)
+
+	if _, err := TestDocService.SavePageTranslation(admin, page.ID, "de", "Übersetzt", "[]"); err != nil {
+		t.Fatalf("SavePageTranslation returned an error: %v", err)
+	}
+	assertStatus(TranslationCurrent)
+
+	if err := TestDocService.EditPage(admin, page.ID, 1, "Translated", "/translated", "[]", nil, nil, nil); err != nil {
+		t.Fatalf("EditPage returned an error: %v", err)
+	}
+	assertStatus(TranslationOutdated)
+
+	if err := TestDocService.SetPageTranslationStatus(page.ID, "de", TranslationCurrent); err != nil {
+		t.Fatalf("SetPageTranslationStatus returned an error: %v", err)
+	}
+	assertStatus(TranslationCurrent)
+
+	if err := TestDocService.SetPageTranslationStatus(page.ID, "de", TranslationMissing); err != nil {
+		t.Fatalf("SetPageTranslationStatus returned an error: %v", err)
+	}
+	assertStatus(TranslationMissing)
+
+	set, err := TestDocService.loadTranslationSet(doc.ID, "de")
+	if err != nil {
+		t.Fatalf("loadTranslationSet returned an error: %v", err)
+	}
+
+	if title := set.pageTitle(models.Page{ID: page.ID, Title: "Translated"}); title != "Translated" {
+		t.Errorf("Expected a missing translation to fall back to the source title, got %q", title)
+	}
+
+	if err := TestDocService.SetPageTranslationStatus(page.ID, "de", "done"); err == nil || err.Error() != "invalid_translation_status" {
+		t.Errorf("Expected 'invalid_translation_status' error, got %v", err)
+	}
+}
+
+func TestTranslationsFollowPageToTrash(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Trash Translation Doc", "1.0.0", nil)
+	group := createTestPageGroup(t, doc.ID, nil, "guide", 1)
+	page := createTestPage(t, doc.ID, &group.ID, "/trash-translation", 1)
+
+	if err := TestDocService.SetDocumentationLocales(admin, doc.ID, "en", []Locale{{Lang: "en"}, {Lang: "de"}}); err != nil {
+		t.Fatalf("SetDocumentationLocales returned an error: %v", err)
+	}
+
+	if _, err := TestDocService.SavePageTranslation(admin, page.ID, "de", "Seite", "[]"); err != nil {
+		t.Fatalf("SavePageTranslation returned an error: %v", err)
+	}
+
+	if _, err := TestDocService.SavePageGroupTranslation(admin, group.ID, "de", "Anleitung"); err != nil {
+		t.Fatalf("SavePageGroupTranslation returned an error: %v", err)
+	}
+
+	if err := TestDocService.DeletePageGroup(admin, group.ID); err != nil {
+		t.Fatalf("DeletePageGroup returned an error: %v", err)
+	}
+
+	var count int64
+	TestDocService.DB.Model(&models.PageTranslation{}).Where("page_id = ?", page.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected page translations to be removed with the page, found %d", count)
+	}
+
+	var item models.TrashItem
+	if err := TestDocService.DB.Where("item_type = ? AND item_id = ?", TrashItemPageGroup, group.ID).First(&item).Error; err != nil {
+		t.Fatalf("Failed to find trash item: %v", err)
+	}
+
+	restored, _, err := TestDocService.RestoreTrashItem(item.ID)
+	if err != nil {
+		t.Fatalf("RestoreTrashItem returned an error: %v", err)
+	}
+
+	groupTranslations, err := TestDocService.GetPageGroupTranslations(restored.ItemID)
+	if err != nil {
+		t.Fatalf("GetPageGroupTranslations returned an error: %v", err)
+	}
+
+	if len(groupTranslations) != 1 || groupTranslations[0].Label != "Anleitung" || groupTranslations[0].Status != TranslationCurrent {
+		t.Errorf("Expected the restored page group to keep its translation, got %+v", groupTranslations)
+	}
+
+	var restoredPage models.Page
+	if err := TestDocService.DB.Where("page_group_id = ?", restored.ItemID).First(&restoredPage).Error; err != nil {
+		t.Fatalf("Failed to find restored page: %v", err)
+	}
+
+	pageTranslations, err := TestDocService.GetPageTranslations(restoredPage.ID)
+	if err != nil {
+		t.Fatalf("GetPageTranslations returned an error: %v", err)
+	}
+
+	if len(pageTranslations) != 1 || pageTranslations[0].Title != "Seite" {
+		t.Errorf("Expected the restored page to keep its translation, got %+v", pageTranslations)
+	}
+}
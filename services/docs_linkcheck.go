@@ -0,0 +1,693 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+)
+
+const (
+	LinkCheckRunning   = "running"
+	LinkCheckCompleted = "completed"
+	LinkCheckFailed    = "failed"
+)
+
+// BrokenLink is one broken link of a report. Links found in page content
+// carry the page and version, links found in the built site carry the file
+// relative to the build folder.
+type BrokenLink struct {
+	Version string `json:"version,omitempty"`
+	PageID  uint   `json:"pageId,omitempty"`
+	File    string `json:"file,omitempty"`
+	URL     string `json:"url"`
+	Reason  string `json:"reason"`
+}
+
+type LinkCheckReport struct {
+	Report models.LinkReport `json:"report"`
+	Broken []BrokenLink      `json:"broken"`
+}
+
+// linkIndex knows every route a documentation builds to, with the version
+// and locale prefixes RsPress puts in front of them, and the heading anchors
+// of every page.
+type linkIndex struct {
+	base     string
+	host     string
+	versions map[string]bool
+	routes   map[string]uint
+	pages    map[uint]string
+	anchors  map[uint]map[string]bool
+}
+
+var versionSegmentPattern = regexp.MustCompile(`^v?\d+(\.\d+)*([-+].*)?$`)
+
+// headingAnchor returns the id RsPress gives a heading, which follows the
+// rules of github-slugger.
+func headingAnchor(text string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			builder.WriteRune(r)
+		case r == ' ':
+			builder.WriteRune('-')
+		}
+	}
+	return builder.String()
+}
+
+// normalizeRoute turns a site path into the form routes are indexed by: no
+// surrounding slashes, no .html extension and no trailing index.
+func normalizeRoute(p string) string {
+	p = strings.Trim(p, "/")
+	p = strings.TrimSuffix(p, ".html")
+
+	if p == "index" {
+		return ""
+	}
+
+	return strings.TrimSuffix(p, "/index")
+}
+
+// collectContentLinks walks BlockNote blocks and returns the targets of links
+// and media blocks, and the anchors of headings in document order.
+func collectContentLinks(value interface{}, links *[]string, anchors map[string]bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			collectContentLinks(item, links, anchors)
+		}
+	case map[string]interface{}:
+		switch v["type"] {
+		case "link":
+			if href, ok := v["href"].(string); ok && href != "" {
+				*links = append(*links, href)
+			}
+		case "heading":
+			anchor := headingAnchor(inlineText(v["content"]))
+			unique := anchor
+			for i := 1; anchors[unique]; i++ {
+				unique = anchor + "-" + strconv.Itoa(i)
+			}
+			anchors[unique] = true
+		case "image", "video", "audio", "file":
+			if props, ok := v["props"].(map[string]interface{}); ok {
+				if src, ok := props["url"].(string); ok && src != "" {
+					*links = append(*links, src)
+				}
+			}
+		}
+
+		for _, key := range []string{"content", "rows", "cells", "children"} {
+			collectContentLinks(v[key], links, anchors)
+		}
+	}
+}
+
+// isExternalLink tells links to other sites apart from links into the
+// documentation, which are checked without a request.
+func (index *linkIndex) isExternalLink(target *url.URL) bool {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return false
+	}
+
+	return index.host == "" || !strings.EqualFold(target.Host, index.host)
+}
+
+// sitePath strips the base URL off an internal path. Paths outside of the
+// documentation, such as uploaded files, are not ours to check.
+func (index *linkIndex) sitePath(p string) (string, bool) {
+	if index.base == "" {
+		return p, true
+	}
+
+	if p != index.base && !strings.HasPrefix(p, index.base+"/") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(p, index.base), true
+}
+
+// checkInternal resolves a path and fragment against the routes and anchors
+// of the documentation. It returns the reason the link is broken, if any.
+func (index *linkIndex) checkInternal(p string, fragment string, buildPath string) string {
+	sitePath, ok := index.sitePath(p)
+	if !ok {
+		return ""
+	}
+
+	route := normalizeRoute(sitePath)
+	pageID, found := index.routes[route]
+	if !found {
+		if buildPath != "" && route != "" && utils.PathExists(filepath.Join(buildPath, filepath.FromSlash(route))) {
+			return ""
+		}
+
+		first, _, _ := strings.Cut(route, "/")
+		if versionSegmentPattern.MatchString(first) && !index.versions[first] {
+			return "version_not_found"
+		}
+
+		return "page_not_found"
+	}
+
+	if fragment != "" && pageID != 0 && !index.anchors[pageID][fragment] {
+		return "anchor_not_found"
+	}
+
+	return ""
+}
+
+// buildLinkIndex indexes the routes of every version of a documentation. The
+// latest version is served without a version prefix and the default locale
+// without a locale prefix, as RsPress does; every other version and locale
+// gets its own folder.
+func (service *DocService) buildLinkIndex(rootId uint) (*linkIndex, map[uint]string, []models.Page, error) {
+	root, err := service.GetDocumentation(rootId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	latest, _, err := service.GetAllVersions(rootId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	versionInfos, err := service.buildVersionTree(rootId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	index := &linkIndex{
+		base:     strings.TrimSuffix(root.BaseURL, "/"),
+		versions: make(map[string]bool),
+		routes:   make(map[string]uint),
+		pages:    make(map[uint]string),
+		anchors:  make(map[uint]map[string]bool),
+	}
+
+	if siteURL, err := url.Parse(root.URL); err == nil {
+		index.host = siteURL.Host
+	}
+
+	pageVersions := make(map[uint]string)
+	var allPages []models.Page
+
+	for _, versionInfo := range versionInfos {
+		if versionInfo.Hidden {
+			continue
+		}
+
+		versionDoc, err := service.GetDocumentation(versionInfo.DocId)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		index.versions[versionDoc.Version] = true
+
+		versionPrefix := versionDoc.Version + "/"
+		if versionDoc.Version == latest {
+			versionPrefix = ""
+		}
+
+		localePrefixes := []string{""}
+		for _, locale := range documentationLocales(versionDoc) {
+			if locale.Lang != versionDoc.DefaultLocale {
+				localePrefixes = append(localePrefixes, locale.Lang+"/")
+			}
+		}
+
+		var groups []models.PageGroup
+		if err := service.DB.Where("documentation_id = ?", versionDoc.ID).Find(&groups).Error; err != nil {
+			return nil, nil, nil, err
+		}
+
+		groupsByID := make(map[uint]models.PageGroup)
+		for _, group := range groups {
+			groupsByID[group.ID] = group
+		}
+
+		var groupDir func(id uint) string
+		groupDir = func(id uint) string {
+			group := groupsByID[id]
+			dir := utils.StringToFileString(group.Name)
+			if group.ParentID != nil {
+				return groupDir(*group.ParentID) + "/" + dir
+			}
+			return "guides/" + dir
+		}
+
+		var pages []models.Page
+		if err := service.DB.Where("documentation_id = ?", versionDoc.ID).Find(&pages).Error; err != nil {
+			return nil, nil, nil, err
+		}
+
+		routes := map[string]uint{"": 0, "guides": 0}
+		for _, group := range groups {
+			routes[groupDir(group.ID)] = 0
+		}
+
+		for _, page := range pages {
+			dir := "guides"
+			if page.PageGroupID != nil {
+				dir = groupDir(*page.PageGroupID)
+			}
+
+			route := dir + "/" + utils.StringToFileString(page.Slug)
+			if page.IsIntroPage {
+				route = dir
+			}
+			routes[route] = page.ID
+			index.pages[page.ID] = versionPrefix + route
+
+			blocks, err := parseBlocks(page.Content)
+			if err != nil {
+				blocks = nil
+			}
+
+			var links []string
+			anchors := make(map[string]bool)
+			collectContentLinks(blocks, &links, anchors)
+			index.anchors[page.ID] = anchors
+
+			pageVersions[page.ID] = versionDoc.Version
+			allPages = append(allPages, page)
+		}
+
+		for _, localePrefix := range localePrefixes {
+			for route, pageID := range routes {
+				index.routes[strings.Trim(versionPrefix+localePrefix+route, "/")] = pageID
+			}
+		}
+	}
+
+	return index, pageVersions, allPages, nil
+}
+
+type externalLink struct {
+	url    string
+	broken BrokenLink
+}
+
+// checkExternalLinks requests every external URL once, at most
+// config.LinkCheck.Concurrency at a time. A HEAD request that the server
+// refuses is retried as a GET.
+func checkExternalLinks(urls []string) map[string]string {
+	client := &http.Client{Timeout: time.Duration(config.ParsedConfig.LinkCheck.Timeout) * time.Second}
+	semaphore := make(chan struct{}, config.ParsedConfig.LinkCheck.Concurrency)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	reasons := make(map[string]string)
+
+	request := func(method string, target string) (int, error) {
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("User-Agent", "Kalmia link checker")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode, nil
+	}
+
+	for _, target := range urls {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(target string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			status, err := request(http.MethodHead, target)
+			if err != nil || status == http.StatusMethodNotAllowed || status == http.StatusForbidden || status == http.StatusNotImplemented {
+				status, err = request(http.MethodGet, target)
+			}
+
+			reason := ""
+			if err != nil {
+				reason = "unreachable"
+			} else if status >= 400 {
+				reason = fmt.Sprintf("http_%d", status)
+			}
+
+			mutex.Lock()
+			reasons[target] = reason
+			mutex.Unlock()
+		}(target)
+	}
+
+	wg.Wait()
+
+	return reasons
+}
+
+// htmlLinks returns the targets of the anchors and the ids of a built page.
+func htmlLinks(data []byte) ([]string, map[string]bool, error) {
+	document, err := html.Parse(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var links []string
+	ids := make(map[string]bool)
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			for _, attr := range node.Attr {
+				switch {
+				case attr.Key == "id":
+					ids[attr.Val] = true
+				case attr.Key == "href" && node.Data == "a":
+					links = append(links, attr.Val)
+				}
+			}
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(document)
+
+	return links, ids, nil
+}
+
+// checkBuildLinks walks the HTML files of a build and checks every anchor
+// against the built files and their ids.
+func (index *linkIndex) checkBuildLinks(buildPath string, report *models.LinkReport, external *[]externalLink) ([]BrokenLink, error) {
+	type builtPage struct {
+		links []string
+		ids   map[string]bool
+	}
+
+	pages := make(map[string]builtPage)
+
+	err := filepath.WalkDir(buildPath, func(p string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(p, ".html") {
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		links, ids, err := htmlLinks(data)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(buildPath, p)
+		if err != nil {
+			return err
+		}
+
+		pages[filepath.ToSlash(rel)] = builtPage{links: links, ids: ids}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resolveFile := func(sitePath string) (string, bool) {
+		sitePath = strings.Trim(sitePath, "/")
+		candidates := []string{sitePath, sitePath + ".html", path.Join(sitePath, "index.html")}
+
+		for _, candidate := range candidates {
+			if _, ok := pages[candidate]; ok {
+				return candidate, true
+			}
+		}
+
+		return "", sitePath != "" && utils.PathExists(filepath.Join(buildPath, filepath.FromSlash(sitePath)))
+	}
+
+	files := make([]string, 0, len(pages))
+	for file := range pages {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var broken []BrokenLink
+	for _, file := range files {
+		page := pages[file]
+		report.FilesChecked++
+		fileURL := &url.URL{Path: index.base + "/" + file}
+
+		for _, href := range page.links {
+			target, err := url.Parse(href)
+			if err != nil {
+				continue
+			}
+
+			report.LinksChecked++
+
+			if index.isExternalLink(target) {
+				*external = append(*external, externalLink{url: href, broken: BrokenLink{File: file, URL: href}})
+				continue
+			}
+
+			if target.Scheme != "" && target.Scheme != "http" && target.Scheme != "https" {
+				continue
+			}
+
+			resolved := fileURL.ResolveReference(target)
+			sitePath, ok := index.sitePath(resolved.Path)
+			if !ok {
+				continue
+			}
+
+			targetFile, found := resolveFile(sitePath)
+			if !found {
+				broken = append(broken, BrokenLink{File: file, URL: href, Reason: "file_not_found"})
+				continue
+			}
+
+			if resolved.Fragment != "" && targetFile != "" && !pages[targetFile].ids[resolved.Fragment] {
+				broken = append(broken, BrokenLink{File: file, URL: href, Reason: "anchor_not_found"})
+			}
+		}
+	}
+
+	return broken, nil
+}
+
+// CheckLinks checks the links of a documentation and all of its versions and
+// stores the report. Page content is checked against the known routes,
+// versions and headings, the built site against its own files, and external
+// URLs are requested only when config.LinkCheck.External is set.
+func (service *DocService) CheckLinks(docId uint) (LinkCheckReport, error) {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return LinkCheckReport{}, fmt.Errorf("documentation_not_found")
+	}
+
+	mutex := service.linkCheckMutex(rootId)
+	if !mutex.TryLock() {
+		return LinkCheckReport{}, fmt.Errorf("link_check_running")
+	}
+	defer mutex.Unlock()
+
+	return service.checkLinks(rootId)
+}
+
+// StartLinkCheck runs CheckLinks in the background.
+func (service *DocService) StartLinkCheck(docId uint) error {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	mutex := service.linkCheckMutex(rootId)
+	if !mutex.TryLock() {
+		return fmt.Errorf("link_check_running")
+	}
+
+	go func() {
+		defer mutex.Unlock()
+
+		if _, err := service.checkLinks(rootId); err != nil {
+			logger.Error("Failed to check links", zap.Uint("doc_id", rootId), zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+func (service *DocService) linkCheckMutex(rootId uint) *sync.Mutex {
+	mutexI, _ := service.UWBMutexMap.LoadOrStore(fmt.Sprintf("link_check_%d", rootId), &sync.Mutex{})
+	return mutexI.(*sync.Mutex)
+}
+
+func (service *DocService) checkLinks(rootId uint) (LinkCheckReport, error) {
+	var report models.LinkReport
+	if err := service.DB.Where(models.LinkReport{DocumentationID: rootId}).FirstOrInit(&report).Error; err != nil {
+		return LinkCheckReport{}, fmt.Errorf("failed_to_save_link_report")
+	}
+
+	report = models.LinkReport{ID: report.ID, DocumentationID: rootId, Status: LinkCheckRunning, StartedAt: utils.TimePtr(time.Now())}
+	if err := service.DB.Save(&report).Error; err != nil {
+		return LinkCheckReport{}, fmt.Errorf("failed_to_save_link_report")
+	}
+
+	broken, err := service.collectBrokenLinks(rootId, &report)
+	report.CheckedAt = utils.TimePtr(time.Now())
+	report.Status = LinkCheckCompleted
+	if err != nil {
+		report.Status = LinkCheckFailed
+		report.Error = err.Error()
+	}
+
+	if broken == nil {
+		broken = []BrokenLink{}
+	}
+
+	data, _ := json.Marshal(broken)
+	report.Broken = string(data)
+	report.BrokenCount = len(broken)
+
+	if err := service.DB.Save(&report).Error; err != nil {
+		return LinkCheckReport{}, fmt.Errorf("failed_to_save_link_report")
+	}
+
+	return LinkCheckReport{Report: report, Broken: broken}, err
+}
+
+func (service *DocService) collectBrokenLinks(rootId uint, report *models.LinkReport) ([]BrokenLink, error) {
+	index, pageVersions, pages, err := service.buildLinkIndex(rootId)
+	if err != nil {
+		return nil, err
+	}
+
+	buildPath := filepath.Join(config.ParsedConfig.DataPath, "rspress_data", "doc_"+strconv.Itoa(int(rootId)), "build")
+
+	var broken []BrokenLink
+	var external []externalLink
+
+	for _, page := range pages {
+		report.PagesChecked++
+
+		blocks, err := parseBlocks(page.Content)
+		if err != nil {
+			continue
+		}
+
+		var links []string
+		collectContentLinks(blocks, &links, make(map[string]bool))
+
+		version := pageVersions[page.ID]
+		pageURL := &url.URL{Path: index.base + "/" + index.pages[page.ID]}
+
+		for _, href := range links {
+			target, err := url.Parse(href)
+			if err != nil {
+				broken = append(broken, BrokenLink{Version: version, PageID: page.ID, URL: href, Reason: "invalid_url"})
+				continue
+			}
+
+			report.LinksChecked++
+			link := BrokenLink{Version: version, PageID: page.ID, URL: href}
+
+			if index.isExternalLink(target) {
+				external = append(external, externalLink{url: href, broken: link})
+				continue
+			}
+
+			if target.Scheme != "" && target.Scheme != "http" && target.Scheme != "https" {
+				continue
+			}
+
+			if target.Path == "" && target.Fragment != "" {
+				if !index.anchors[page.ID][target.Fragment] {
+					link.Reason = "anchor_not_found"
+					broken = append(broken, link)
+				}
+				continue
+			}
+
+			resolved := pageURL.ResolveReference(target)
+			if link.Reason = index.checkInternal(resolved.Path, resolved.Fragment, buildPath); link.Reason != "" {
+				broken = append(broken, link)
+			}
+		}
+	}
+
+	if utils.PathExists(buildPath) {
+		buildBroken, err := index.checkBuildLinks(buildPath, report, &external)
+		if err != nil {
+			return broken, err
+		}
+		broken = append(broken, buildBroken...)
+	}
+
+	if config.ParsedConfig.LinkCheck.External && len(external) > 0 {
+		var urls []string
+		seen := make(map[string]bool)
+		for _, link := range external {
+			if !seen[link.url] {
+				seen[link.url] = true
+				urls = append(urls, link.url)
+			}
+		}
+
+		report.ExternalChecked = len(urls)
+		reasons := checkExternalLinks(urls)
+
+		for _, link := range external {
+			if reason := reasons[link.url]; reason != "" {
+				link.broken.Reason = reason
+				broken = append(broken, link.broken)
+			}
+		}
+	}
+
+	return broken, nil
+}
+
+// GetLinkReport returns the last link check report of a documentation.
+func (service *DocService) GetLinkReport(docId uint) (LinkCheckReport, error) {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return LinkCheckReport{}, fmt.Errorf("documentation_not_found")
+	}
+
+	var report models.LinkReport
+	if err := service.DB.Where("documentation_id = ?", rootId).First(&report).Error; err != nil {
+		return LinkCheckReport{}, fmt.Errorf("link_report_not_found")
+	}
+
+	broken := []BrokenLink{}
+	if report.Broken != "" {
+		if err := json.Unmarshal([]byte(report.Broken), &broken); err != nil {
+			return LinkCheckReport{}, fmt.Errorf("failed_to_read_link_report")
+		}
+	}
+
+	return LinkCheckReport{Report: report, Broken: broken}, nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/utils"
+)
+
+func linkCheckContent(hrefs ...string) string {
+	var links []string
+	for _, href := range hrefs {
+		links = append(links, fmt.Sprintf(`{"type":"link","href":%q,"content":[{"type":"text","text":"link","styles":{}}]}`, href))
+	}
+
+	return `[
+		{"id":"h1","type":"heading","props":{"level":2},"content":[{"type":"text","text":"Getting Started!","styles":{}}],"children":[]},
+		{"id":"p1","type":"paragraph","props":{},"content":[` + strings.Join(links, ",") + `],"children":[]}
+	]`
+}
+
+func TestHeadingAnchor(t *testing.T) {
+	tests := map[string]string{
+		"Getting Started!":  "getting-started",
+		"API v2 (beta)":     "api-v2-beta",
+		"snake_case-Header": "snake_case-header",
+		"Über uns":          "über-uns",
+	}
+
+	for text, expected := range tests {
+		if anchor := headingAnchor(text); anchor != expected {
+			t.Errorf("headingAnchor(%q) = %q, expected %q", text, anchor, expected)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	doc := createTestDocumentation(t, "Link Check Doc", "1.0.0", nil)
+	latest := createTestDocumentation(t, "Link Check Doc", "2.0.0", &doc.ID)
+
+	createTestPage(t, doc.ID, nil, "/intro", 1)
+	createTestPage(t, latest.ID, nil, "/other", 1)
+	group := createTestPageGroup(t, latest.ID, nil, "Setup", 2)
+	page := createTestPage(t, latest.ID, &group.ID, "/install", 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	content := linkCheckContent(
+		"/link-check-doc/guides/setup/install#getting-started",
+		"#getting-started",
+		"#missing",
+		"../other",
+		"/link-check-doc/guides/nope",
+		"/link-check-doc/1.0.0/guides/intro",
+		"/link-check-doc/3.0.0/guides/intro",
+		"/kal-api/file/get/picture.png",
+		"mailto:docs@example.com",
+		server.URL+"/ok",
+		server.URL+"/missing",
+	)
+
+	if err := TestDocService.DB.Model(&page).Update("content", content).Error; err != nil {
+		t.Fatalf("Failed to set page content: %v", err)
+	}
+
+	buildPath := filepath.Join(config.ParsedConfig.DataPath, "rspress_data", "doc_"+strconv.Itoa(int(doc.ID)), "build")
+	defer utils.RemovePath(filepath.Dir(buildPath))
+
+	files := map[string]string{
+		"index.html":        `<a href="/link-check-doc/guides/other.html">Other</a><a href="/link-check-doc/guides/gone.html">Gone</a>`,
+		"guides/other.html": `<h2 id="intro">Intro</h2><a href="#intro">Up</a><a href="./other#nope">Nope</a><a href="/elsewhere">Elsewhere</a>`,
+	}
+
+	for name, html := range files {
+		if err := utils.MakeDir(filepath.Dir(filepath.Join(buildPath, name))); err != nil {
+			t.Fatalf("Failed to create build folder: %v", err)
+		}
+
+		if err := utils.WriteToFile(filepath.Join(buildPath, name), "<html><body>"+html+"</body></html>"); err != nil {
+			t.Fatalf("Failed to write build file: %v", err)
+		}
+	}
+
+	config.ParsedConfig.LinkCheck.External = true
+	defer func() { config.ParsedConfig.LinkCheck.External = false }()
+
+	mutex := TestDocService.linkCheckMutex(doc.ID)
+	mutex.Lock()
+	if _, err := TestDocService.CheckLinks(latest.ID); err == nil || err.Error() != "link_check_running" {
+		t.Errorf("Expected 'link_check_running' error, got %v", err)
+	}
+	mutex.Unlock()
+
+	result, err := TestDocService.CheckLinks(latest.ID)
+	if err != nil {
+		t.Fatalf("CheckLinks returned an error: %v", err)
+	}
+
+	var broken []string
+	for _, link := range result.Broken {
+		broken = append(broken, link.File+"|"+link.URL+"|"+link.Reason)
+	}
+	sort.Strings(broken)
+
+	expected := []string{
+		"|#missing|anchor_not_found",
+		"|" + server.URL + "/missing|http_404",
+		"|/link-check-doc/3.0.0/guides/intro|version_not_found",
+		"|/link-check-doc/guides/nope|page_not_found",
+		"guides/other.html|./other#nope|anchor_not_found",
+		"index.html|/link-check-doc/guides/gone.html|file_not_found",
+	}
+	sort.Strings(expected)
+
+	if strings.Join(broken, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Unexpected broken links:\n%s", strings.Join(broken, "\n"))
+	}
+
+	if result.Report.Status != LinkCheckCompleted || result.Report.PagesChecked != 3 || result.Report.FilesChecked != 2 || result.Report.ExternalChecked != 2 {
+		t.Errorf("Unexpected report %+v", result.Report)
+	}
+
+	stored, err := TestDocService.GetLinkReport(doc.ID)
+	if err != nil {
+		t.Fatalf("GetLinkReport returned an error: %v", err)
+	}
+
+	if stored.Report.BrokenCount != len(expected) || len(stored.Broken) != len(expected) || stored.Broken[0].PageID != page.ID {
+		t.Errorf("Expected the stored report to match, got %+v", stored)
+	}
+}
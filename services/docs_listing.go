@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// ListOptions pages through a list ordered by id: at most Limit items with
+// an id above After.
+type ListOptions struct {
+	After uint
+	Limit int
+}
+
+func (opts ListOptions) limit() int {
+	if opts.Limit <= 0 {
+		return DefaultListLimit
+	}
+	if opts.Limit > MaxListLimit {
+		return MaxListLimit
+	}
+	return opts.Limit
+}
+
+// page applies the options to a query. One item more than the limit is
+// fetched to tell whether there are more.
+func (opts ListOptions) page(query *gorm.DB) *gorm.DB {
+	return query.Where("id > ?", opts.After).Order("id").Limit(opts.limit() + 1)
+}
+
+// PageFilter narrows ListPages down; zero values match everything.
+type PageFilter struct {
+	PageGroupID *uint // 0 for pages outside any page group
+	Slug        string
+	TagID       uint
+	Query       string // part of the title
+}
+
+// ListDocumentations lists documentations, without their versions, by id.
+func (service *DocService) ListDocumentations(name string, opts ListOptions) ([]models.Documentation, bool, error) {
+	query := service.DB.Model(&models.Documentation{}).Where("cloned_from IS NULL OR cloned_from = 0")
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+
+	var docs []models.Documentation
+	if err := opts.page(query).Find(&docs).Error; err != nil {
+		return nil, false, fmt.Errorf("failed_to_get_documentations")
+	}
+
+	if len(docs) > opts.limit() {
+		return docs[:opts.limit()], true, nil
+	}
+	return docs, false, nil
+}
+
+// ResolveVersion finds a version of the documentation by its name.
+func (service *DocService) ResolveVersion(docId uint, version string) (models.Documentation, error) {
+	_, docs, err := service.versionDocuments(docId)
+	if err != nil {
+		return models.Documentation{}, err
+	}
+
+	for _, doc := range docs {
+		if doc.Version == version {
+			return doc, nil
+		}
+	}
+
+	return models.Documentation{}, fmt.Errorf("version_not_found")
+}
+
+// ListPages lists the pages of a version by id, without their content.
+func (service *DocService) ListPages(docId uint, filter PageFilter, opts ListOptions) ([]models.Page, bool, error) {
+	query := service.DB.Model(&models.Page{}).Omit("content").Where("documentation_id = ?", docId)
+
+	if filter.PageGroupID != nil {
+		if *filter.PageGroupID == 0 {
+			query = query.Where("page_group_id IS NULL")
+		} else {
+			query = query.Where("page_group_id = ?", *filter.PageGroupID)
+		}
+	}
+	if filter.Slug != "" {
+		query = query.Where("slug = ?", filter.Slug)
+	}
+	if filter.TagID != 0 {
+		query = query.Where("id IN (?)", service.DB.Table("page_tags").Select("page_id").Where("tag_id = ?", filter.TagID))
+	}
+	if filter.Query != "" {
+		query = query.Where("LOWER(title) LIKE LOWER(?)", "%"+filter.Query+"%")
+	}
+
+	var pages []models.Page
+	if err := opts.page(query).Find(&pages).Error; err != nil {
+		return nil, false, fmt.Errorf("failed_to_get_pages")
+	}
+
+	if len(pages) > opts.limit() {
+		return pages[:opts.limit()], true, nil
+	}
+	return pages, false, nil
+}
+
+// ListPageGroups lists the page groups of a version by id. parentId 0 lists
+// the top-level ones.
+func (service *DocService) ListPageGroups(docId uint, parentId *uint, opts ListOptions) ([]models.PageGroup, bool, error) {
+	query := service.DB.Model(&models.PageGroup{}).Where("documentation_id = ?", docId)
+
+	if parentId != nil {
+		if *parentId == 0 {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *parentId)
+		}
+	}
+
+	var groups []models.PageGroup
+	if err := opts.page(query).Find(&groups).Error; err != nil {
+		return nil, false, fmt.Errorf("failed_to_get_page_groups")
+	}
+
+	if len(groups) > opts.limit() {
+		return groups[:opts.limit()], true, nil
+	}
+	return groups, false, nil
+}
+
+// GetPageGroupOfVersion returns a page group if it belongs to the version.
+func (service *DocService) GetPageGroupOfVersion(docId uint, id uint) (models.PageGroup, error) {
+	var group models.PageGroup
+	if err := service.DB.Where("documentation_id = ?", docId).First(&group, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.PageGroup{}, fmt.Errorf("page_group_not_found")
+		}
+		return models.PageGroup{}, fmt.Errorf("failed_to_fetch_page_group")
+	}
+
+	return group, nil
+}
+
+// GetPageOfVersion returns a page if it belongs to the version.
+func (service *DocService) GetPageOfVersion(docId uint, id uint) (models.Page, error) {
+	var page models.Page
+	if err := service.DB.Where("documentation_id = ?", docId).First(&page, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Page{}, fmt.Errorf("page_not_found")
+		}
+		return models.Page{}, fmt.Errorf("failed_to_fetch_page")
+	}
+
+	return page, nil
+}
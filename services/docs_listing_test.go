@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestListPages(t *testing.T) {
+	v1 := createTestDocumentation(t, "Listing Doc", "1.0.0", nil)
+	v2 := createTestDocumentation(t, "Listing Doc", "2.0.0", &v1.ID)
+
+	group := createTestPageGroup(t, v2.ID, nil, "listing-group", 1)
+	for _, slug := range []string{"/one", "/two", "/three"} {
+		createTestPage(t, v2.ID, nil, slug, 1)
+	}
+	grouped := createTestPage(t, v2.ID, &group.ID, "/grouped", 1)
+
+	resolved, err := TestDocService.ResolveVersion(v1.ID, "2.0.0")
+	if err != nil || resolved.ID != v2.ID {
+		t.Fatalf("Expected version 2.0.0 to resolve to %d, got %d (%v)", v2.ID, resolved.ID, err)
+	}
+	if _, err := TestDocService.ResolveVersion(v1.ID, "9.9.9"); err == nil || err.Error() != "version_not_found" {
+		t.Errorf("Expected version_not_found, got %v", err)
+	}
+
+	first, more, err := TestDocService.ListPages(v2.ID, PageFilter{}, ListOptions{Limit: 3})
+	if err != nil {
+		t.Fatalf("ListPages returned an error: %v", err)
+	}
+	if len(first) != 3 || !more {
+		t.Fatalf("Expected a full first page with more to come, got %d pages (more %v)", len(first), more)
+	}
+	if first[0].Content != "" {
+		t.Errorf("Expected listed pages to omit their content")
+	}
+
+	rest, more, err := TestDocService.ListPages(v2.ID, PageFilter{}, ListOptions{After: first[2].ID, Limit: 3})
+	if err != nil || len(rest) != 1 || more || rest[0].ID != grouped.ID {
+		t.Fatalf("Expected the last page after the cursor, got %+v (more %v, %v)", rest, more, err)
+	}
+
+	topLevel := uint(0)
+	pages, _, _ := TestDocService.ListPages(v2.ID, PageFilter{PageGroupID: &topLevel}, ListOptions{})
+	if len(pages) != 3 {
+		t.Errorf("Expected 3 top-level pages, got %d", len(pages))
+	}
+
+	pages, _, _ = TestDocService.ListPages(v2.ID, PageFilter{PageGroupID: &group.ID}, ListOptions{})
+	if len(pages) != 1 || pages[0].ID != grouped.ID {
+		t.Errorf("Expected only the grouped page, got %+v", pages)
+	}
+
+	pages, _, _ = TestDocService.ListPages(v2.ID, PageFilter{Query: "TW"}, ListOptions{})
+	if len(pages) != 1 || pages[0].Slug != "/two" {
+		t.Errorf("Expected the title search to find /two, got %+v", pages)
+	}
+
+	docs, _, err := TestDocService.ListDocumentations("Listing Doc", ListOptions{})
+	if err != nil || len(docs) != 1 || docs[0].ID != v1.ID {
+		t.Errorf("Expected only the root documentation to be listed, got %+v (%v)", docs, err)
+	}
+
+	var other models.Page
+	TestDocService.DB.Where("documentation_id = ?", v2.ID).First(&other)
+	if _, err := TestDocService.GetPageOfVersion(v1.ID, other.ID); err == nil || err.Error() != "page_not_found" {
+		t.Errorf("Expected a page of another version to be not found, got %v", err)
+	}
+}
@@ -10,6 +10,10 @@ type DocService struct {
 	DB          *gorm.DB
 	UWBMutexMap sync.Map
 	logSubCmd   bool
+
+	collabMu      sync.Mutex
+	collabRooms   map[uint]*collabRoom
+	collabTickets map[string]collabTicket
 }
 
 func NewDocService(db *gorm.DB, logSubCmd bool) *DocService {
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"fmt"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	SlugConflictRename = "rename"
+	SlugConflictFail   = "fail"
+)
+
+// TransferResult is where a page or page group ended up after being moved or
+// copied, and which page slugs were changed to fit the target documentation.
+type TransferResult struct {
+	PageID      uint          `json:"pageId,omitempty"`
+	PageGroupID uint          `json:"pageGroupId,omitempty"`
+	Renamed     []RenamedSlug `json:"renamed"`
+}
+
+type RenamedSlug struct {
+	PageID uint   `json:"pageId"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// transferTree is a page group subtree, or a single page, being moved or
+// copied. Groups are listed parents first.
+type transferTree struct {
+	groups []models.PageGroup
+	pages  []models.Page
+}
+
+func collectTransferTree(tx *gorm.DB, groupId uint) (transferTree, error) {
+	var tree transferTree
+
+	var group models.PageGroup
+	if err := tx.First(&group, groupId).Error; err != nil {
+		return tree, fmt.Errorf("page_group_not_found")
+	}
+	tree.groups = append(tree.groups, group)
+
+	for i := 0; i < len(tree.groups); i++ {
+		var pages []models.Page
+		if err := tx.Where("page_group_id = ?", tree.groups[i].ID).Order("id").Find(&pages).Error; err != nil {
+			return tree, fmt.Errorf("failed_to_fetch_pages")
+		}
+		tree.pages = append(tree.pages, pages...)
+
+		var children []models.PageGroup
+		if err := tx.Where("parent_id = ?", tree.groups[i].ID).Order("id").Find(&children).Error; err != nil {
+			return tree, fmt.Errorf("failed_to_find_child_page_groups")
+		}
+		tree.groups = append(tree.groups, children...)
+	}
+
+	return tree, nil
+}
+
+// checkTransferTarget checks that the page group being moved into belongs to
+// the target documentation and, when a group is moved, is not the group
+// itself or one of its descendants.
+func checkTransferTarget(tx *gorm.DB, targetDocId uint, targetGroupId *uint, movedGroupId uint) error {
+	var count int64
+	if err := tx.Model(&models.Documentation{}).Where("id = ?", targetDocId).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed_to_verify_documentation")
+	}
+	if count == 0 {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	if targetGroupId == nil {
+		return nil
+	}
+
+	visited := make(map[uint]bool)
+	for id := targetGroupId; id != nil; {
+		if movedGroupId != 0 && *id == movedGroupId {
+			return fmt.Errorf("page_group_cycle")
+		}
+		if visited[*id] {
+			return fmt.Errorf("page_group_cycle")
+		}
+		visited[*id] = true
+
+		var group models.PageGroup
+		if err := tx.Select("id", "documentation_id", "parent_id").First(&group, *id).Error; err != nil {
+			return fmt.Errorf("invalid_page_group_id")
+		}
+		if group.DocumentationID != targetDocId {
+			return fmt.Errorf("invalid_page_group_id")
+		}
+
+		id = group.ParentID
+	}
+
+	return nil
+}
+
+// resolveSlugs picks the slug every transferred page gets in the target
+// documentation. A slug that is taken there is either suffixed with "-2",
+// "-3" and so on, or fails the transfer.
+func resolveSlugs(tx *gorm.DB, targetDocId uint, pages []models.Page, moving bool, onConflict string) (map[uint]string, []RenamedSlug, error) {
+	var existing []models.Page
+	if err := tx.Select("id", "slug").Where("documentation_id = ?", targetDocId).Find(&existing).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed_to_verify_page_slug")
+	}
+
+	transferred := make(map[uint]bool)
+	for _, page := range pages {
+		transferred[page.ID] = true
+	}
+
+	taken := make(map[string]bool)
+	for _, page := range existing {
+		if moving && transferred[page.ID] {
+			continue
+		}
+		taken[page.Slug] = true
+	}
+
+	slugs := make(map[uint]string)
+	renamed := []RenamedSlug{}
+	for _, page := range pages {
+		slug := page.Slug
+		if taken[slug] {
+			if onConflict == SlugConflictFail {
+				return nil, nil, fmt.Errorf("page_slug_already_exists")
+			}
+			for n := 2; taken[slug]; n++ {
+				slug = fmt.Sprintf("%s-%d", page.Slug, n)
+			}
+			renamed = append(renamed, RenamedSlug{PageID: page.ID, From: page.Slug, To: slug})
+		}
+		taken[slug] = true
+		slugs[page.ID] = slug
+	}
+
+	return slugs, renamed, nil
+}
+
+func copiedPage(page models.Page, user models.User, docId uint, groupId *uint, slug string) models.Page {
+	return models.Page{
+		DocumentationID: docId,
+		PageGroupID:     groupId,
+		AuthorID:        user.ID,
+		LastEditorID:    &user.ID,
+		Title:           page.Title,
+		Slug:            slug,
+		Content:         page.Content,
+		Order:           page.Order,
+		IsIntroPage:     page.IsIntroPage && groupId != nil,
+		PageSEO:         page.PageSEO,
+	}
+}
+
+// finishTransfer redirects what moved within a documentation and rebuilds
+// both the source and the target documentation. The transfer is committed by
+// then, so failing to record a redirect is only logged.
+func (service *DocService) finishTransfer(sourceDocId uint, targetDocId uint, oldPaths []string, newPaths func() ([]string, error), folder bool, source string) error {
+	sourceRoot, err := service.GetRootParentID(sourceDocId)
+	if err != nil {
+		return fmt.Errorf("failed_to_get_documentation_id")
+	}
+	targetRoot, err := service.GetRootParentID(targetDocId)
+	if err != nil {
+		return fmt.Errorf("failed_to_get_documentation_id")
+	}
+
+	// Redirects are kept per documentation, so a page that moved to another
+	// documentation is not followed.
+	if oldPaths != nil && sourceRoot == targetRoot {
+		paths, err := newPaths()
+		if err == nil {
+			err = service.recordMovedPaths(targetDocId, oldPaths, paths, folder, source)
+		}
+		if err != nil {
+			logger.Error("failed to record the redirects of a transfer", zap.Uint("documentation_id", targetDocId), zap.Error(err))
+		}
+	}
+
+	for _, rootId := range []uint{sourceRoot, targetRoot} {
+		if err := service.AddBuildTrigger(rootId, false); err != nil {
+			return fmt.Errorf("failed_to_update_write_build")
+		}
+		if sourceRoot == targetRoot {
+			break
+		}
+	}
+
+	return nil
+}
+
+// TransferPage moves or copies a page into a page group, or the top level
+// when pageGroupId is nil, of any documentation or version. A moved page
+// keeps its history and translations; its tags are dropped when it leaves
+// the documentation they belong to.
+func (service *DocService) TransferPage(user models.User, id uint, targetDocId uint, pageGroupId *uint, order *uint, duplicate bool, onConflict string) (TransferResult, error) {
+	var page models.Page
+	if err := service.DB.First(&page, id).Error; err != nil {
+		return TransferResult{}, fmt.Errorf("page_not_found")
+	}
+
+	if page.IsIntroPage && page.PageGroupID == nil && !duplicate {
+		return TransferResult{}, fmt.Errorf("intro_page_cannot_be_moved")
+	}
+
+	if order != nil {
+		page.Order = order
+	}
+
+	var oldPaths []string
+	if !duplicate {
+		oldPaths, _ = service.pagePaths(id)
+	}
+
+	sourceRoot, _ := service.GetRootParentID(page.DocumentationID)
+	targetRoot, _ := service.GetRootParentID(targetDocId)
+
+	var result TransferResult
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkTransferTarget(tx, targetDocId, pageGroupId, 0); err != nil {
+			return err
+		}
+
+		slugs, renamed, err := resolveSlugs(tx, targetDocId, []models.Page{page}, !duplicate, onConflict)
+		if err != nil {
+			return err
+		}
+		result.Renamed = renamed
+
+		if duplicate {
+			newPage := copiedPage(page, user, targetDocId, pageGroupId, slugs[page.ID])
+			if err := tx.Create(&newPage).Error; err != nil {
+				return fmt.Errorf("failed_to_create_page")
+			}
+			result.PageID = newPage.ID
+
+			pageMap := map[uint]uint{page.ID: newPage.ID}
+			if err := copyTranslations(tx, pageMap, map[uint]uint{}); err != nil {
+				return fmt.Errorf("failed_to_copy_translations")
+			}
+			if sourceRoot == targetRoot {
+				if err := copyPageTags(tx, pageMap); err != nil {
+					return fmt.Errorf("failed_to_copy_page_tags")
+				}
+			}
+			return nil
+		}
+
+		result.PageID = page.ID
+		if err := tx.Model(&models.Page{}).Where("id = ?", page.ID).Updates(map[string]interface{}{
+			"documentation_id": targetDocId,
+			"page_group_id":    pageGroupId,
+			"order":            page.Order,
+			"slug":             slugs[page.ID],
+			"last_editor_id":   user.ID,
+			"revision":         gorm.Expr("revision + 1"),
+		}).Error; err != nil {
+			return fmt.Errorf("failed_to_update_page")
+		}
+
+		if sourceRoot != targetRoot {
+			if err := tx.Exec("DELETE FROM page_tags WHERE page_id = ?", page.ID).Error; err != nil {
+				return fmt.Errorf("failed_to_update_page_tags")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return TransferResult{}, err
+	}
+
+	newPaths := func() ([]string, error) { return service.pagePaths(id) }
+	if err := service.finishTransfer(page.DocumentationID, targetDocId, oldPaths, newPaths, false, RedirectPage); err != nil {
+		return TransferResult{}, err
+	}
+
+	return result, nil
+}
+
+// TransferPageGroup moves or copies a page group with its nested groups and
+// pages into another page group, or the top level when parentId is nil, of
+// any documentation or version.
+func (service *DocService) TransferPageGroup(user models.User, id uint, targetDocId uint, parentId *uint, order *uint, duplicate bool, onConflict string) (TransferResult, error) {
+	sourceDocId, err := service.GetDocumentationIDOfPageGroup(id)
+	if err != nil {
+		return TransferResult{}, err
+	}
+
+	var oldPaths []string
+	if !duplicate {
+		oldPaths, _ = service.pageGroupPaths(id)
+	}
+
+	sourceRoot, _ := service.GetRootParentID(sourceDocId)
+	targetRoot, _ := service.GetRootParentID(targetDocId)
+
+	var result TransferResult
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		tree, err := collectTransferTree(tx, id)
+		if err != nil {
+			return err
+		}
+
+		movedGroupId := id
+		if duplicate {
+			movedGroupId = 0
+		}
+		if err := checkTransferTarget(tx, targetDocId, parentId, movedGroupId); err != nil {
+			return err
+		}
+
+		slugs, renamed, err := resolveSlugs(tx, targetDocId, tree.pages, !duplicate, onConflict)
+		if err != nil {
+			return err
+		}
+		result.Renamed = renamed
+
+		if order == nil {
+			order = tree.groups[0].Order
+		}
+
+		if duplicate {
+			groupMap := make(map[uint]uint)
+			pageMap := make(map[uint]uint)
+
+			for i, group := range tree.groups {
+				parent := parentId
+				groupOrder := order
+				if i > 0 {
+					newParent := groupMap[*group.ParentID]
+					parent = &newParent
+					groupOrder = group.Order
+				}
+
+				newGroup := models.PageGroup{
+					DocumentationID: targetDocId,
+					ParentID:        parent,
+					AuthorID:        user.ID,
+					LastEditorID:    &user.ID,
+					Name:            group.Name,
+					Label:           group.Label,
+					Order:           groupOrder,
+				}
+				if err := tx.Create(&newGroup).Error; err != nil {
+					return fmt.Errorf("failed_to_create_page_group")
+				}
+				groupMap[group.ID] = newGroup.ID
+			}
+
+			for _, page := range tree.pages {
+				groupId := groupMap[*page.PageGroupID]
+				newPage := copiedPage(page, user, targetDocId, &groupId, slugs[page.ID])
+				if err := tx.Create(&newPage).Error; err != nil {
+					return fmt.Errorf("failed_to_create_page")
+				}
+				pageMap[page.ID] = newPage.ID
+			}
+
+			if err := copyTranslations(tx, pageMap, groupMap); err != nil {
+				return fmt.Errorf("failed_to_copy_translations")
+			}
+			if sourceRoot == targetRoot {
+				if err := copyPageTags(tx, pageMap); err != nil {
+					return fmt.Errorf("failed_to_copy_page_tags")
+				}
+			}
+
+			result.PageGroupID = groupMap[id]
+			return nil
+		}
+
+		result.PageGroupID = id
+
+		groupIds := make([]uint, len(tree.groups))
+		for i, group := range tree.groups {
+			groupIds[i] = group.ID
+		}
+
+		if err := tx.Model(&models.PageGroup{}).Where("id IN ?", groupIds).Update("documentation_id", targetDocId).Error; err != nil {
+			return fmt.Errorf("failed_to_update_page_group")
+		}
+
+		if err := tx.Model(&models.PageGroup{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"parent_id":      parentId,
+			"order":          order,
+			"last_editor_id": user.ID,
+			"revision":       gorm.Expr("revision + 1"),
+		}).Error; err != nil {
+			return fmt.Errorf("failed_to_update_page_group")
+		}
+
+		for _, page := range tree.pages {
+			if err := tx.Model(&models.Page{}).Where("id = ?", page.ID).Updates(map[string]interface{}{
+				"documentation_id": targetDocId,
+				"slug":             slugs[page.ID],
+			}).Error; err != nil {
+				return fmt.Errorf("failed_to_update_page")
+			}
+
+			if sourceRoot != targetRoot {
+				if err := tx.Exec("DELETE FROM page_tags WHERE page_id = ?", page.ID).Error; err != nil {
+					return fmt.Errorf("failed_to_update_page_tags")
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return TransferResult{}, err
+	}
+
+	newPaths := func() ([]string, error) { return service.pageGroupPaths(id) }
+	if err := service.finishTransfer(sourceDocId, targetDocId, oldPaths, newPaths, true, RedirectPageGroup); err != nil {
+		return TransferResult{}, err
+	}
+
+	return result, nil
+}
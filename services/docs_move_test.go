@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestTransferPageGroup(t *testing.T) {
+	admin := getTestAdmin(t)
+
+	source := createTestDocumentation(t, "Move Source", "1.0.0", nil)
+	target := createTestDocumentation(t, "Move Target", "1.0.0", nil)
+
+	guides := createTestPageGroup(t, source.ID, nil, "guides", 1)
+	advanced := createTestPageGroup(t, source.ID, &guides.ID, "advanced", 1)
+	install := createTestPage(t, source.ID, &guides.ID, "/install", 1)
+	deep := createTestPage(t, source.ID, &advanced.ID, "/deep", 1)
+	createTestPage(t, target.ID, nil, "/install", 1)
+
+	if _, err := TestDocService.TransferPageGroup(admin, guides.ID, source.ID, &advanced.ID, nil, false, SlugConflictRename); err == nil || err.Error() != "page_group_cycle" {
+		t.Errorf("Expected page_group_cycle, got %v", err)
+	}
+
+	if _, err := TestDocService.TransferPageGroup(admin, guides.ID, target.ID, &advanced.ID, nil, false, SlugConflictRename); err == nil || err.Error() != "invalid_page_group_id" {
+		t.Errorf("Expected invalid_page_group_id for a group of another documentation, got %v", err)
+	}
+
+	if _, err := TestDocService.TransferPageGroup(admin, guides.ID, target.ID, nil, nil, false, SlugConflictFail); err == nil || err.Error() != "page_slug_already_exists" {
+		t.Errorf("Expected page_slug_already_exists, got %v", err)
+	}
+
+	copied, err := TestDocService.TransferPageGroup(admin, guides.ID, target.ID, nil, nil, true, SlugConflictRename)
+	if err != nil {
+		t.Fatalf("Copying the page group returned an error: %v", err)
+	}
+
+	if len(copied.Renamed) != 1 || copied.Renamed[0].PageID != install.ID || copied.Renamed[0].To != "/install-2" {
+		t.Errorf("Expected /install to be renamed to /install-2, got %+v", copied.Renamed)
+	}
+
+	var copiedGroups []models.PageGroup
+	TestDocService.DB.Where("documentation_id = ?", target.ID).Find(&copiedGroups)
+	if len(copiedGroups) != 2 {
+		t.Fatalf("Expected 2 copied page groups, got %d", len(copiedGroups))
+	}
+
+	var copiedDeep models.Page
+	if err := TestDocService.DB.Where("documentation_id = ? AND slug = ?", target.ID, "/deep").First(&copiedDeep).Error; err != nil {
+		t.Fatalf("Expected /deep to be copied: %v", err)
+	}
+
+	var copiedAdvanced models.PageGroup
+	TestDocService.DB.First(&copiedAdvanced, *copiedDeep.PageGroupID)
+	if copiedAdvanced.Name != "advanced" || copiedAdvanced.ParentID == nil || *copiedAdvanced.ParentID != copied.PageGroupID {
+		t.Errorf("Expected the copy of /deep to be nested under the copied groups, got %+v", copiedAdvanced)
+	}
+
+	var sourceCount int64
+	TestDocService.DB.Model(&models.Page{}).Where("documentation_id = ?", source.ID).Count(&sourceCount)
+	if sourceCount != 2 {
+		t.Errorf("Expected copying to leave the source pages, got %d", sourceCount)
+	}
+
+	moved, err := TestDocService.TransferPageGroup(admin, advanced.ID, target.ID, nil, nil, false, SlugConflictRename)
+	if err != nil {
+		t.Fatalf("Moving the page group returned an error: %v", err)
+	}
+
+	if len(moved.Renamed) != 1 || moved.Renamed[0].To != "/deep-2" {
+		t.Errorf("Expected /deep to be renamed to /deep-2, got %+v", moved.Renamed)
+	}
+
+	var movedGroup models.PageGroup
+	TestDocService.DB.First(&movedGroup, advanced.ID)
+	if movedGroup.DocumentationID != target.ID || movedGroup.ParentID != nil {
+		t.Errorf("Expected the page group to move to the top of the target, got %+v", movedGroup)
+	}
+
+	var movedPage models.Page
+	TestDocService.DB.First(&movedPage, deep.ID)
+	if movedPage.DocumentationID != target.ID || movedPage.Slug != "/deep-2" {
+		t.Errorf("Expected the nested page to move with its group, got %+v", movedPage)
+	}
+}
+
+func TestTransferPage(t *testing.T) {
+	admin := getTestAdmin(t)
+
+	v1 := createTestDocumentation(t, "Move Page Doc", "1.0.0", nil)
+	v2 := createTestDocumentation(t, "Move Page Doc", "2.0.0", &v1.ID)
+
+	group := createTestPageGroup(t, v2.ID, nil, "guides", 1)
+	page := createTestPage(t, v1.ID, nil, "/setup", 1)
+
+	if _, err := TestDocService.TransferPage(admin, page.ID, v2.ID, &group.ID, nil, false, SlugConflictRename); err != nil {
+		t.Fatalf("Moving the page returned an error: %v", err)
+	}
+
+	var moved models.Page
+	TestDocService.DB.First(&moved, page.ID)
+	if moved.DocumentationID != v2.ID || moved.PageGroupID == nil || *moved.PageGroupID != group.ID || moved.Slug != "/setup" {
+		t.Errorf("Unexpected moved page: %+v", moved)
+	}
+
+	copied, err := TestDocService.TransferPage(admin, page.ID, v2.ID, &group.ID, nil, true, SlugConflictRename)
+	if err != nil {
+		t.Fatalf("Copying the page returned an error: %v", err)
+	}
+
+	var copy models.Page
+	TestDocService.DB.First(&copy, copied.PageID)
+	if copy.ID == page.ID || copy.Slug != "/setup-2" || copy.AuthorID != admin.ID {
+		t.Errorf("Unexpected copied page: %+v", copy)
+	}
+}
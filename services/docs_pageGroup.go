@@ -46,6 +46,7 @@ func convertPageGroupToMap(group models.PageGroup) map[string]interface{} {
 			"editors":         simplifiedEditors,
 			"lastEditorId":    page.LastEditorID,
 			"isPage":          page.IsPage,
+			"revision":        page.Revision,
 		})
 	}
 
@@ -85,6 +86,7 @@ func convertPageGroupToMap(group models.PageGroup) map[string]interface{} {
 		"editors":         simplifiedEditors,
 		"lastEditorId":    group.LastEditorID,
 		"isPageGroup":     group.IsPageGroup,
+		"revision":        group.Revision,
 	}
 }
 
@@ -113,12 +115,12 @@ func (service *DocService) recursiveFetchPageGroups(groupMap map[string]interfac
 func (service *DocService) GetPageGroups() ([]map[string]interface{}, error) {
 	var pageGroups []models.PageGroup
 	if err := service.DB.Preload("Pages", func(db *gorm.DB) *gorm.DB {
-		return db.Select("ID", "Title", "Slug", "PageGroupID", "Order", "DocumentationID", "CreatedAt", "UpdatedAt", "AuthorID", "LastEditorID", "IsPage")
+		return db.Select("ID", "Title", "Slug", "PageGroupID", "Order", "DocumentationID", "CreatedAt", "UpdatedAt", "AuthorID", "LastEditorID", "IsPage", "Revision")
 	}).Preload("Pages.Author").
 		Preload("Pages.Editors").
 		Preload("Author").
 		Preload("Editors").
-		Select("ID", "Name", "Label", "DocumentationID", "ParentID", "Order", "CreatedAt", "UpdatedAt", "AuthorID", "LastEditorID", "IsPageGroup").
+		Select("ID", "Name", "Label", "DocumentationID", "ParentID", "Order", "CreatedAt", "UpdatedAt", "AuthorID", "LastEditorID", "IsPageGroup", "Revision").
 		Where("parent_id IS NULL").
 		Find(&pageGroups).Error; err != nil {
 		return nil, fmt.Errorf("failed_to_fetch_page_groups")
@@ -137,7 +139,7 @@ func (service *DocService) GetPageGroups() ([]map[string]interface{}, error) {
 func (service *DocService) GetPageGroup(id uint) (map[string]interface{}, error) {
 	var pageGroup models.PageGroup
 	if err := service.DB.Preload("Pages", func(db *gorm.DB) *gorm.DB {
-		return db.Select("ID", "Title", "Slug", "PageGroupID", "Order", "DocumentationID", "CreatedAt", "UpdatedAt", "AuthorID", "LastEditorID")
+		return db.Select("ID", "Title", "Slug", "PageGroupID", "Order", "DocumentationID", "CreatedAt", "UpdatedAt", "AuthorID", "LastEditorID", "Revision")
 	}).Preload("Pages.Author").
 		Preload("Pages.Editors").
 		Preload("Author").
@@ -183,34 +185,50 @@ func (service *DocService) CreatePageGroup(group *models.PageGroup) (uint, error
 func (service *DocService) EditPageGroup(
 	user models.User,
 	id uint,
+	baseRevision uint,
 	name string,
 	label string,
 	documentationID uint,
 	parentID *uint,
 	order *uint,
 ) error {
+	oldPaths, _ := service.pageGroupPaths(id)
+
+	tx := service.DB.Begin()
+
+	if err := claimRevision(tx, &models.PageGroup{}, id, baseRevision, "page_group_not_found"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	var pageGroup models.PageGroup
-	if err := service.DB.First(&pageGroup, id).Error; err != nil {
+	if err := tx.Preload("Editors").First(&pageGroup, id).Error; err != nil {
+		tx.Rollback()
 		return fmt.Errorf("page_group_not_found")
 	}
 
 	var docCount int64
-	if err := service.DB.Model(&models.Documentation{}).Where("id = ?", documentationID).Count(&docCount).Error; err != nil {
+	if err := tx.Model(&models.Documentation{}).Where("id = ?", documentationID).Count(&docCount).Error; err != nil {
+		tx.Rollback()
 		return fmt.Errorf("failed_to_verify_documentation")
 	}
 	if docCount == 0 {
+		tx.Rollback()
 		return fmt.Errorf("invalid_documentation_id")
 	}
 
 	if parentID != nil {
 		if *parentID == pageGroup.ID {
+			tx.Rollback()
 			return fmt.Errorf("page_group_cannot_be_its_own_parent")
 		}
 		var parentCount int64
-		if err := service.DB.Model(&models.PageGroup{}).Where("id = ?", parentID).Count(&parentCount).Error; err != nil {
+		if err := tx.Model(&models.PageGroup{}).Where("id = ?", parentID).Count(&parentCount).Error; err != nil {
+			tx.Rollback()
 			return fmt.Errorf("failed_to_verify_parent_page_group")
 		}
 		if parentCount == 0 {
+			tx.Rollback()
 			return fmt.Errorf("invalid_parent_page_group_id")
 		}
 	}
@@ -237,10 +255,17 @@ func (service *DocService) EditPageGroup(
 		pageGroup.Editors = append(pageGroup.Editors, user)
 	}
 
-	if err := service.DB.Save(&pageGroup).Error; err != nil {
+	if err := tx.Save(&pageGroup).Error; err != nil {
+		tx.Rollback()
 		return fmt.Errorf("failed_to_update_page_group")
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed_to_commit_changes")
+	}
+
+	service.recordPageGroupMove(id, oldPaths)
+
 	docId, err := service.GetDocumentationIDOfPageGroup(id)
 	if err != nil {
 		return fmt.Errorf("failed_to_get_documentation_id")
@@ -299,14 +324,26 @@ func (service *DocService) deletePageGroupRecursive(tx *gorm.DB, id uint) error
 	return nil
 }
 
-func (service *DocService) DeletePageGroup(id uint) error {
-	var docId uint
-	var err error
+func (service *DocService) DeletePageGroup(user models.User, id uint) error {
+	docId, err := service.GetDocumentationIDOfPageGroup(id)
+	if err != nil {
+		return fmt.Errorf("failed_to_get_documentation_id: %v", err)
+	}
+
+	parentDocId, _ := service.GetRootParentID(docId)
+	triggerDocId := docId
+	if parentDocId != 0 {
+		triggerDocId = parentDocId
+	}
 
 	err = service.DB.Transaction(func(tx *gorm.DB) error {
-		docId, err = service.GetDocumentationIDOfPageGroup(id)
-		if err != nil {
-			return fmt.Errorf("failed_to_get_documentation_id: %v", err)
+		var snapshot trashSnapshot
+		if err := collectPageGroupTree(tx, id, &snapshot); err != nil {
+			return err
+		}
+
+		if err := service.moveToTrash(tx, &user, TrashItemPageGroup, id, snapshot.PageGroups[0].Label, docId, triggerDocId, snapshot); err != nil {
+			return err
 		}
 
 		if err := service.deletePageGroupRecursive(tx, id); err != nil {
@@ -319,12 +356,6 @@ func (service *DocService) DeletePageGroup(id uint) error {
 		return err
 	}
 
-	parentDocId, _ := service.GetRootParentID(docId)
-	triggerDocId := docId
-	if parentDocId != 0 {
-		triggerDocId = parentDocId
-	}
-
 	if err := service.AddBuildTrigger(triggerDocId, false); err != nil {
 		return fmt.Errorf("failed_to_update_write_build: %v", err)
 	}
@@ -350,13 +381,18 @@ func (service *DocService) ReorderPageGroup(id uint, order *uint, parentID *uint
 		return fmt.Errorf("failed_to_fetch_page_group")
 	}
 
-	pageGroup.Order = order
-	pageGroup.ParentID = parentID
+	oldPaths, _ := service.pageGroupPaths(id)
 
-	if err := service.DB.Save(&pageGroup).Error; err != nil {
+	if err := service.DB.Model(&pageGroup).Updates(map[string]interface{}{
+		"order":     order,
+		"parent_id": parentID,
+		"revision":  gorm.Expr("revision + 1"),
+	}).Error; err != nil {
 		return fmt.Errorf("failed_to_update_page_group")
 	}
 
+	service.recordPageGroupMove(id, oldPaths)
+
 	docId, err := service.GetDocumentationIDOfPageGroup(id)
 	if err != nil {
 		return fmt.Errorf("failed_to_get_documentation_id")
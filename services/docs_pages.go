@@ -3,19 +3,27 @@ package services
 import (
 	"errors"
 	"fmt"
+	"net/url"
 
 	"git.difuse.io/Difuse/kalmia/db/models"
 	"gorm.io/gorm"
 )
 
-func (service *DocService) GetPages() ([]models.Page, error) {
+// GetPages lists all pages, or only those tagged with tagId when it is not 0.
+func (service *DocService) GetPages(tagId uint) ([]models.Page, error) {
 	var pages []models.Page
 
-	if err := service.DB.Preload("Author", func(db *gorm.DB) *gorm.DB {
+	query := service.DB.Preload("Author", func(db *gorm.DB) *gorm.DB {
 		return service.DB.Select("ID", "Username", "Email", "Photo")
 	}).Preload("Editors", func(db *gorm.DB) *gorm.DB {
 		return service.DB.Select("users.ID", "users.Username", "users.Email", "users.Photo")
-	}).Select("ID", "Title", "Slug", "DocumentationID", "PageGroupID", "Order", "CreatedAt", "UpdatedAt", "AuthorID", "LastEditorID", "IsIntroPage", "IsPage").
+	}).Preload("Tags")
+
+	if tagId != 0 {
+		query = query.Where("id IN (?)", service.DB.Table("page_tags").Select("page_id").Where("tag_id = ?", tagId))
+	}
+
+	if err := query.Select("ID", "Title", "Slug", "DocumentationID", "PageGroupID", "Order", "CreatedAt", "UpdatedAt", "AuthorID", "LastEditorID", "IsIntroPage", "IsPage", "Revision").
 		Find(&pages).Error; err != nil {
 		return nil, fmt.Errorf("failed_to_get_pages")
 	}
@@ -30,7 +38,7 @@ func (service *DocService) GetPage(id uint) (models.Page, error) {
 		return service.DB.Select("ID", "Username", "Email", "Photo")
 	}).Preload("Editors", func(db *gorm.DB) *gorm.DB {
 		return service.DB.Select("users.ID", "users.Username", "users.Email", "users.Photo")
-	}).First(&page, id).Error; err != nil {
+	}).Preload("Tags").First(&page, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return models.Page{}, fmt.Errorf("page_not_found")
 		} else {
@@ -41,7 +49,30 @@ func (service *DocService) GetPage(id uint) (models.Page, error) {
 	return page, nil
 }
 
+// pageTypes are the RsPress page types a page can be given; an empty one
+// renders as a regular doc page.
+var pageTypes = map[string]bool{"": true, "doc": true, "doc-wide": true, "home": true, "custom": true, "blank": true, "404": true}
+
+func validatePageSEO(seo models.PageSEO) error {
+	if !pageTypes[seo.PageType] {
+		return fmt.Errorf("invalid_page_type")
+	}
+
+	if seo.CanonicalURL != "" {
+		u, err := url.Parse(seo.CanonicalURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid_canonical_url")
+		}
+	}
+
+	return nil
+}
+
 func (service *DocService) CreatePage(page *models.Page) error {
+	if err := validatePageSEO(page.PageSEO); err != nil {
+		return err
+	}
+
 	if err := service.DB.Create(&page).Error; err != nil {
 		return fmt.Errorf("failed_to_create_page")
 	}
@@ -67,15 +98,32 @@ func (service *DocService) CreatePage(page *models.Page) error {
 	return nil
 }
 
-func (service *DocService) EditPage(user models.User, id uint, title, slug, content string, order *uint, pageGroupId *uint) error {
+// EditPage updates a page. seo replaces the page's SEO settings, and leaves
+// them as they are when nil.
+func (service *DocService) EditPage(user models.User, id uint, baseRevision uint, title, slug, content string, order *uint, pageGroupId *uint, seo *models.PageSEO) error {
+	if seo != nil {
+		if err := validatePageSEO(*seo); err != nil {
+			return err
+		}
+	}
+
+	oldPaths, _ := service.pagePaths(id)
+
 	tx := service.DB.Begin()
 
+	if err := claimRevision(tx, &models.Page{}, id, baseRevision, "page_not_found"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	var page models.Page
 	if err := tx.Preload("Editors").First(&page, id).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("page_not_found")
 	}
 
+	before := page
+
 	page.Title = title
 	page.Slug = slug
 
@@ -92,6 +140,10 @@ func (service *DocService) EditPage(user models.User, id uint, title, slug, cont
 		page.PageGroupID = pageGroupId
 	}
 
+	if seo != nil {
+		page.PageSEO = *seo
+	}
+
 	alreadyEditor := false
 	for _, editor := range page.Editors {
 		if editor.ID == user.ID {
@@ -109,10 +161,17 @@ func (service *DocService) EditPage(user models.User, id uint, title, slug, cont
 		return fmt.Errorf("failed_to_update_page")
 	}
 
+	if err := savePageRevision(tx, before, page, user.ID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed_to_save_page_revision")
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return fmt.Errorf("failed_to_commit_changes")
 	}
 
+	service.recordPageMove(id, oldPaths)
+
 	docId, err := service.GetDocumentationIDOfPage(id)
 
 	if err != nil {
@@ -134,8 +193,16 @@ func (service *DocService) EditPage(user models.User, id uint, title, slug, cont
 	return nil
 }
 
-func (service *DocService) DeletePage(id uint) error {
+func (service *DocService) DeletePage(user models.User, id uint) error {
 	docId, err := service.GetDocumentationIDOfPage(id)
+	if err != nil {
+		return err
+	}
+
+	parentDocId, _ := service.GetRootParentID(docId)
+	if parentDocId == 0 {
+		parentDocId = docId
+	}
 
 	tx := service.DB.Begin()
 	if tx.Error != nil {
@@ -143,7 +210,7 @@ func (service *DocService) DeletePage(id uint) error {
 	}
 
 	var page models.Page
-	if err := tx.First(&page, id).Error; err != nil {
+	if err := tx.Preload("Editors").First(&page, id).Error; err != nil {
 		tx.Rollback()
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return fmt.Errorf("page_not_found")
@@ -151,6 +218,14 @@ func (service *DocService) DeletePage(id uint) error {
 		return fmt.Errorf("failed_to_fetch_page")
 	}
 
+	var snapshot trashSnapshot
+	snapshot.addPage(page)
+
+	if err := service.moveToTrash(tx, &user, TrashItemPage, page.ID, page.Title, docId, parentDocId, snapshot); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if err := tx.Model(&page).Association("Editors").Clear(); err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed_to_clear_page_associations")
@@ -165,19 +240,7 @@ func (service *DocService) DeletePage(id uint) error {
 		return fmt.Errorf("transaction_commit_failed")
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed_to_get_documentation_id")
-	}
-
-	parentDocId, _ := service.GetRootParentID(docId)
-
-	if parentDocId == 0 {
-		err = service.AddBuildTrigger(docId, false)
-	} else {
-		err = service.AddBuildTrigger(parentDocId, false)
-	}
-
-	if err != nil {
+	if err := service.AddBuildTrigger(parentDocId, false); err != nil {
 		return fmt.Errorf("failed_to_update_write_build")
 	}
 
@@ -193,13 +256,20 @@ func (service *DocService) ReorderPage(id uint, pageGroupID *uint, order *uint)
 		return fmt.Errorf("failed_to_fetch_page")
 	}
 
-	page.PageGroupID = pageGroupID
-	page.Order = order
+	oldPaths, _ := service.pagePaths(id)
 
-	if err := service.DB.Save(&page).Error; err != nil {
+	// a move is a change like any other, so edits based on the old placement
+	// fail with revision_conflict instead of moving the page back
+	if err := service.DB.Model(&page).Updates(map[string]interface{}{
+		"page_group_id": pageGroupID,
+		"order":         order,
+		"revision":      gorm.Expr("revision + 1"),
+	}).Error; err != nil {
 		return fmt.Errorf("failed_to_update_page")
 	}
 
+	service.recordPageMove(id, oldPaths)
+
 	docId, err := service.GetDocumentationIDOfPage(id)
 
 	if err != nil {
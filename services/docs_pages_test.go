@@ -0,0 +1,110 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestPageSEOFrontMatter(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "SEO Doc", "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/seo", 1)
+
+	seo := models.PageSEO{
+		MetaTitle:       "Search: Engines",
+		MetaDescription: "It's all: about \"search\"",
+		CanonicalURL:    "https://example.com/seo",
+		NoIndex:         true,
+		HideSidebar:     true,
+		PageType:        "doc-wide",
+	}
+
+	if err := TestDocService.EditPage(admin, page.ID, 1, "SEO", "/seo", "[]", nil, nil, &seo); err != nil {
+		t.Fatalf("EditPage returned an error: %v", err)
+	}
+
+	page, err := TestDocService.GetPage(page.ID)
+	if err != nil {
+		t.Fatalf("GetPage returned an error: %v", err)
+	}
+
+	if page.PageSEO != seo {
+		t.Fatalf("Expected SEO settings to be saved, got %+v", page.PageSEO)
+	}
+
+	mdx, err := TestDocService.CraftPage(page, page.Title, page.Content)
+	if err != nil {
+		t.Fatalf("CraftPage returned an error: %v", err)
+	}
+
+	for _, expected := range []string{
+		"pageType: doc-wide\n",
+		"title: \"Search: Engines\"\n",
+		"description: \"It's all: about \\\"search\\\"\"\n",
+		"sidebar: false\n",
+		`\"canonicalURL\":\"https://example.com/seo\"`,
+		`\"noIndex\":true`,
+	} {
+		if !strings.Contains(mdx, expected) {
+			t.Errorf("Expected page to contain %q:\n%s", expected, mdx)
+		}
+	}
+
+	if strings.Contains(mdx, `\"image\"`) {
+		t.Errorf("Expected no meta image without a page or documentation image:\n%s", mdx)
+	}
+
+	for _, invalid := range []struct {
+		seo      models.PageSEO
+		expected string
+	}{
+		{models.PageSEO{PageType: "landing"}, "invalid_page_type"},
+		{models.PageSEO{CanonicalURL: "/relative"}, "invalid_canonical_url"},
+	} {
+		err := TestDocService.EditPage(admin, page.ID, 2, "SEO", "/seo", "[]", nil, nil, &invalid.seo)
+		if err == nil || err.Error() != invalid.expected {
+			t.Errorf("Expected %q error, got %v", invalid.expected, err)
+		}
+	}
+}
+
+func TestHomeFrontMatter(t *testing.T) {
+	doc := createTestDocumentation(t, "Kalmia: \"Docs\" #1", "1.0.0", nil)
+
+	head, err := TestDocService.generateHomeHead(doc.ID, "doc", "")
+	if err != nil {
+		t.Fatalf("generateHomeHead returned an error: %v", err)
+	}
+	if !strings.Contains(head, "title: \"Kalmia: \\\"Docs\\\" #1\"\n") {
+		t.Errorf("Expected the documentation name to be quoted:\n%s", head)
+	}
+
+	doc.Description = "# Not a comment"
+	doc.LanderDetails = `{"ctaButtonText": {"ctaButtonLinkLabel": "Start: here", "ctaButtonLink": "/guides"}, "features": [{"emoji": "", "title": "Fast: really", "text": "'quoted' text"}]}`
+
+	contentPath := filepath.Join(t.TempDir(), "docs")
+	if err := TestDocService.WriteHomePage(doc, contentPath, ""); err != nil {
+		t.Fatalf("WriteHomePage returned an error: %v", err)
+	}
+
+	home, err := os.ReadFile(filepath.Join(contentPath, "../", "index.mdx"))
+	if err != nil {
+		t.Fatalf("Failed to read the home page: %v", err)
+	}
+
+	for _, expected := range []string{
+		"  name: \"Kalmia: \\\"Docs\\\" #1\"\n",
+		"  text: \"# Not a comment\"\n",
+		"      text: \"Start: here\"\n",
+		"  - title: \"Fast: really\"\n",
+		"    details: \"'quoted' text\"\n",
+	} {
+		if !strings.Contains(string(home), expected) {
+			t.Errorf("Expected the home page to contain %q:\n%s", expected, home)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	PropagationApplied      = "applied"
+	PropagationUnchanged    = "unchanged"
+	PropagationConflict     = "conflict"
+	PropagationPageNotFound = "page_not_found"
+)
+
+// PropagationResult is what porting a change did to one version.
+type PropagationResult struct {
+	DocumentationID uint            `json:"documentationId"`
+	Version         string          `json:"version"`
+	PageID          uint            `json:"pageId,omitempty"`
+	Status          string          `json:"status"`
+	Conflicts       []MergeConflict `json:"conflicts,omitempty"`
+}
+
+// MergeConflict is a block, or the title, that the change and the target
+// version both changed in different ways.
+type MergeConflict struct {
+	BlockID string `json:"blockId"` // empty for the title
+	Type    string `json:"type,omitempty"`
+	Reason  string `json:"reason"` // "changed_in_both", "changed_and_deleted" or "deleted_and_changed"
+	Base    string `json:"base,omitempty"`
+	Ours    string `json:"ours,omitempty"`
+	Theirs  string `json:"theirs,omitempty"`
+}
+
+// savePageRevision records the revision an edit saved. The revision the edit
+// started from is recorded too when it is missing, as it is for pages last
+// edited before revisions were kept, so that every change has a base.
+func savePageRevision(tx *gorm.DB, before models.Page, after models.Page, authorId uint) error {
+	if after.Revision > 1 {
+		var count int64
+		if err := tx.Model(&models.PageRevision{}).Where("page_id = ? AND revision = ?", after.ID, after.Revision-1).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count == 0 {
+			if err := tx.Create(&models.PageRevision{
+				PageID:   before.ID,
+				Revision: after.Revision - 1,
+				Title:    before.Title,
+				Content:  before.Content,
+				AuthorID: before.LastEditorID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Create(&models.PageRevision{
+		PageID:   after.ID,
+		Revision: after.Revision,
+		Title:    after.Title,
+		Content:  after.Content,
+		AuthorID: &authorId,
+	}).Error
+}
+
+// GetPageRevisions lists the recorded revisions of a page, newest first,
+// without their content.
+func (service *DocService) GetPageRevisions(pageId uint) ([]models.PageRevision, error) {
+	var revisions []models.PageRevision
+	if err := service.DB.Select("id", "page_id", "revision", "title", "author_id", "created_at").
+		Where("page_id = ?", pageId).Order("revision DESC").Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_page_revisions")
+	}
+
+	return revisions, nil
+}
+
+func blockJSON(block map[string]interface{}) string {
+	raw, _ := json.Marshal(block)
+	return string(raw)
+}
+
+func keyedBlocks(content string) ([]string, map[string]map[string]interface{}, error) {
+	blocks, err := parseBlocks(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	byKey := make(map[string]map[string]interface{})
+	for i, item := range blocks {
+		if block, ok := item.(map[string]interface{}); ok {
+			key := blockKey(block, i)
+			keys = append(keys, key)
+			byKey[key] = block
+		}
+	}
+
+	return keys, byKey, nil
+}
+
+func mergeConflict(key string, reason string, base, ours, theirs map[string]interface{}) MergeConflict {
+	conflict := MergeConflict{BlockID: key, Reason: reason}
+	for _, block := range []map[string]interface{}{theirs, ours, base} {
+		if block != nil {
+			conflict.Type, _ = block["type"].(string)
+			break
+		}
+	}
+
+	if base != nil {
+		conflict.Base = blockText(base)
+	}
+	if ours != nil {
+		conflict.Ours = blockText(ours)
+	}
+	if theirs != nil {
+		conflict.Theirs = blockText(theirs)
+	}
+
+	return conflict
+}
+
+// mergeBlocks applies the change from base to theirs onto ours, matching
+// top-level blocks by id; nested blocks go with their parent. Blocks added by
+// the change are placed after the block they follow in theirs. The order of
+// blocks ours already has is kept.
+func mergeBlocks(base string, ours string, theirs string) (string, []MergeConflict, error) {
+	_, baseBlocks, err := keyedBlocks(base)
+	if err != nil {
+		return "", nil, err
+	}
+	ourKeys, ourBlocks, err := keyedBlocks(ours)
+	if err != nil {
+		return "", nil, err
+	}
+	theirKeys, theirBlocks, err := keyedBlocks(theirs)
+	if err != nil {
+		return "", nil, err
+	}
+
+	conflicts := []MergeConflict{}
+	var merged []string
+	mergedBlocks := make(map[string]map[string]interface{})
+
+	for _, key := range ourKeys {
+		ourBlock, baseBlock := ourBlocks[key], baseBlocks[key]
+		theirBlock, inTheirs := theirBlocks[key]
+
+		switch {
+		case baseBlock == nil && !inTheirs:
+			// added by ours
+		case baseBlock == nil:
+			if blockJSON(ourBlock) != blockJSON(theirBlock) {
+				conflicts = append(conflicts, mergeConflict(key, "changed_in_both", nil, ourBlock, theirBlock))
+			}
+		case !inTheirs:
+			if blockJSON(ourBlock) == blockJSON(baseBlock) {
+				continue
+			}
+			conflicts = append(conflicts, mergeConflict(key, "changed_and_deleted", baseBlock, ourBlock, nil))
+		default:
+			baseJSON, ourJSON, theirJSON := blockJSON(baseBlock), blockJSON(ourBlock), blockJSON(theirBlock)
+			if ourJSON == baseJSON {
+				ourBlock = theirBlock
+			} else if theirJSON != baseJSON && theirJSON != ourJSON {
+				conflicts = append(conflicts, mergeConflict(key, "changed_in_both", baseBlock, ourBlock, theirBlock))
+			}
+		}
+
+		merged = append(merged, key)
+		mergedBlocks[key] = ourBlock
+	}
+
+	for i, key := range theirKeys {
+		if _, inOurs := ourBlocks[key]; inOurs {
+			continue
+		}
+
+		if baseBlock, inBase := baseBlocks[key]; inBase {
+			// deleted by ours
+			if blockJSON(baseBlock) != blockJSON(theirBlocks[key]) {
+				conflicts = append(conflicts, mergeConflict(key, "deleted_and_changed", baseBlock, nil, theirBlocks[key]))
+			}
+			continue
+		}
+
+		position := 0
+		for j := i - 1; j >= 0; j-- {
+			found := false
+			for k, mergedKey := range merged {
+				if mergedKey == theirKeys[j] {
+					position, found = k+1, true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+
+		merged = append(merged[:position], append([]string{key}, merged[position:]...)...)
+		mergedBlocks[key] = theirBlocks[key]
+	}
+
+	blocks := make([]map[string]interface{}, len(merged))
+	for i, key := range merged {
+		blocks[i] = mergedBlocks[key]
+	}
+
+	content, err := json.Marshal(blocks)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return string(content), conflicts, nil
+}
+
+// PropagatePageChange ports the change a revision made to a page into the
+// page with the same page-group path and slug in other versions of its
+// documentation. Versions where the change conflicts are reported and left
+// as they are; with dryRun nothing is saved. The documentation is rebuilt
+// once.
+func (service *DocService) PropagatePageChange(user models.User, pageId uint, revision uint, targetDocIds []uint, dryRun bool) ([]PropagationResult, error) {
+	var page models.Page
+	if err := service.DB.Select("id", "documentation_id", "page_group_id", "slug").First(&page, pageId).Error; err != nil {
+		return nil, fmt.Errorf("page_not_found")
+	}
+
+	var change, base models.PageRevision
+	if err := service.DB.Where("page_id = ? AND revision = ?", pageId, revision).First(&change).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("revision_not_found")
+		}
+		return nil, fmt.Errorf("failed_to_get_page_revision")
+	}
+
+	if err := service.DB.Where("page_id = ? AND revision < ?", pageId, revision).Order("revision DESC").First(&base).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("revision_not_found")
+		}
+		return nil, fmt.Errorf("failed_to_get_page_revision")
+	}
+
+	rootId, docs, err := service.versionDocuments(page.DocumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/guides"
+	if page.PageGroupID != nil {
+		if path, err = service.pageGroupDir(*page.PageGroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	results := []PropagationResult{}
+	applied := false
+
+	for _, targetId := range targetDocIds {
+		target, ok := findVersion(docs, targetId)
+		if !ok {
+			return nil, fmt.Errorf("versions_not_related")
+		}
+
+		if targetId == page.DocumentationID {
+			continue
+		}
+
+		result := PropagationResult{DocumentationID: target.ID, Version: target.Version, Status: PropagationPageNotFound}
+
+		var candidates []models.Page
+		if err := service.DB.Where("documentation_id = ? AND slug = ?", targetId, page.Slug).Find(&candidates).Error; err != nil {
+			return nil, fmt.Errorf("failed_to_propagate_change")
+		}
+
+		var targetPage *models.Page
+		for i, candidate := range candidates {
+			candidatePath := "/guides"
+			if candidate.PageGroupID != nil {
+				if candidatePath, err = service.pageGroupDir(*candidate.PageGroupID); err != nil {
+					return nil, err
+				}
+			}
+			if candidatePath == path {
+				targetPage = &candidates[i]
+				break
+			}
+		}
+
+		if targetPage == nil {
+			results = append(results, result)
+			continue
+		}
+
+		result.PageID = targetPage.ID
+
+		content, conflicts, err := mergeBlocks(base.Content, targetPage.Content, change.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed_to_propagate_change")
+		}
+
+		title := targetPage.Title
+		if change.Title != base.Title {
+			if targetPage.Title == base.Title {
+				title = change.Title
+			} else if targetPage.Title != change.Title {
+				conflicts = append([]MergeConflict{{Reason: "changed_in_both", Base: base.Title, Ours: targetPage.Title, Theirs: change.Title}}, conflicts...)
+			}
+		}
+
+		switch {
+		case len(conflicts) > 0:
+			result.Status = PropagationConflict
+			result.Conflicts = conflicts
+		case title == targetPage.Title && blocksEqual(content, targetPage.Content):
+			result.Status = PropagationUnchanged
+		default:
+			result.Status = PropagationApplied
+		}
+
+		if result.Status == PropagationApplied && !dryRun {
+			err := service.DB.Transaction(func(tx *gorm.DB) error {
+				if err := claimRevision(tx, &models.Page{}, targetPage.ID, targetPage.Revision, "page_not_found"); err != nil {
+					return err
+				}
+
+				before := *targetPage
+				targetPage.Title = title
+				targetPage.Content = content
+				targetPage.LastEditorID = &user.ID
+				targetPage.Revision++
+
+				if err := tx.Model(&models.Page{}).Where("id = ?", targetPage.ID).Updates(map[string]interface{}{
+					"title":          title,
+					"content":        content,
+					"last_editor_id": user.ID,
+				}).Error; err != nil {
+					return fmt.Errorf("failed_to_propagate_change")
+				}
+
+				return savePageRevision(tx, before, *targetPage, user.ID)
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			applied = true
+		}
+
+		results = append(results, result)
+	}
+
+	if applied {
+		if err := service.AddBuildTrigger(rootId, false); err != nil {
+			return nil, fmt.Errorf("failed_to_add_build_trigger")
+		}
+	}
+
+	return results, nil
+}
+
+func blocksEqual(a string, b string) bool {
+	aBlocks, errA := parseBlocks(a)
+	bBlocks, errB := parseBlocks(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+
+	aJSON, _ := json.Marshal(aBlocks)
+	bJSON, _ := json.Marshal(bBlocks)
+
+	return string(aJSON) == string(bJSON)
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func propagateTestBlock(id string, text string) string {
+	return fmt.Sprintf(`{"id":"%s","type":"paragraph","props":{},"content":[{"type":"text","text":"%s","styles":{}}],"children":[]}`, id, text)
+}
+
+func propagateTestContent(blocks ...string) string {
+	return "[" + strings.Join(blocks, ",") + "]"
+}
+
+func TestPropagatePageChange(t *testing.T) {
+	admin := getTestAdmin(t)
+
+	v1 := createTestDocumentation(t, "Propagate Doc", "1.0.0", nil)
+	v2 := createTestDocumentation(t, "Propagate Doc", "1.1.0", &v1.ID)
+	v3 := createTestDocumentation(t, "Propagate Doc", "2.0.0", &v1.ID)
+	v4 := createTestDocumentation(t, "Propagate Doc", "3.0.0", &v1.ID)
+	v5 := createTestDocumentation(t, "Propagate Doc", "4.0.0", &v1.ID)
+
+	original := propagateTestContent(propagateTestBlock("a", "Download"), propagateTestBlock("b", "Unpack"), propagateTestBlock("c", "Run"))
+
+	pages := map[uint]models.Page{}
+	for _, doc := range []models.Documentation{v1, v2, v3, v4} {
+		group := createTestPageGroup(t, doc.ID, nil, "guides", 1)
+		page := createTestPage(t, doc.ID, &group.ID, "/install", 1)
+		TestDocService.DB.Model(&page).Update("content", original)
+		pages[doc.ID] = page
+	}
+	createTestPage(t, v5.ID, nil, "/install", 1)
+
+	// v3 changed another block, v4 changed the same one.
+	TestDocService.DB.Model(&models.Page{}).Where("id = ?", pages[v3.ID].ID).Update("content",
+		propagateTestContent(propagateTestBlock("a", "Download"), propagateTestBlock("b", "Unpack"), propagateTestBlock("c", "Start")))
+	TestDocService.DB.Model(&models.Page{}).Where("id = ?", pages[v4.ID].ID).Update("content",
+		propagateTestContent(propagateTestBlock("a", "Download"), propagateTestBlock("b", "Decompress"), propagateTestBlock("c", "Run")))
+
+	changed := propagateTestContent(propagateTestBlock("a", "Download"), propagateTestBlock("b", "Extract"), propagateTestBlock("c", "Run"), propagateTestBlock("d", "Verify"))
+	if err := TestDocService.EditPage(admin, pages[v1.ID].ID, 1, "/install", "/install", changed, nil, nil, nil); err != nil {
+		t.Fatalf("EditPage returned an error: %v", err)
+	}
+
+	revisions, err := TestDocService.GetPageRevisions(pages[v1.ID].ID)
+	if err != nil || len(revisions) != 2 || revisions[0].Revision != 2 || revisions[1].Revision != 1 {
+		t.Fatalf("Expected revisions 2 and 1, got %+v (%v)", revisions, err)
+	}
+
+	targets := []uint{v2.ID, v3.ID, v4.ID, v5.ID}
+
+	preview, err := TestDocService.PropagatePageChange(admin, pages[v1.ID].ID, 2, targets, true)
+	if err != nil {
+		t.Fatalf("PropagatePageChange returned an error: %v", err)
+	}
+	if len(preview) != 4 || preview[0].Status != PropagationApplied {
+		t.Fatalf("Unexpected dry run results: %+v", preview)
+	}
+
+	var untouched models.Page
+	TestDocService.DB.First(&untouched, pages[v2.ID].ID)
+	if untouched.Content != original {
+		t.Errorf("Expected a dry run to leave pages as they are, got %s", untouched.Content)
+	}
+
+	results, err := TestDocService.PropagatePageChange(admin, pages[v1.ID].ID, 2, targets, false)
+	if err != nil {
+		t.Fatalf("PropagatePageChange returned an error: %v", err)
+	}
+
+	expected := map[uint]string{
+		v2.ID: PropagationApplied,
+		v3.ID: PropagationApplied,
+		v4.ID: PropagationConflict,
+		v5.ID: PropagationPageNotFound,
+	}
+	for _, result := range results {
+		if result.Status != expected[result.DocumentationID] {
+			t.Errorf("Expected %s for version %s, got %s", expected[result.DocumentationID], result.Version, result.Status)
+		}
+	}
+
+	contents := map[uint]string{
+		v2.ID: propagateTestContent(propagateTestBlock("a", "Download"), propagateTestBlock("b", "Extract"), propagateTestBlock("c", "Run"), propagateTestBlock("d", "Verify")),
+		v3.ID: propagateTestContent(propagateTestBlock("a", "Download"), propagateTestBlock("b", "Extract"), propagateTestBlock("c", "Start"), propagateTestBlock("d", "Verify")),
+	}
+	for docId, content := range contents {
+		var page models.Page
+		TestDocService.DB.First(&page, pages[docId].ID)
+		if !blocksEqual(page.Content, content) {
+			t.Errorf("Unexpected content for documentation %d: %s", docId, page.Content)
+		}
+		if page.Revision != 2 {
+			t.Errorf("Expected the revision of documentation %d to be bumped, got %d", docId, page.Revision)
+		}
+	}
+
+	conflicts := results[2].Conflicts
+	if len(conflicts) != 1 || conflicts[0].BlockID != "b" || conflicts[0].Reason != "changed_in_both" ||
+		conflicts[0].Ours != "Decompress" || conflicts[0].Theirs != "Extract" {
+		t.Errorf("Unexpected conflicts: %+v", conflicts)
+	}
+
+	if _, err := TestDocService.PropagatePageChange(admin, pages[v1.ID].ID, 1, targets, true); err == nil || err.Error() != "revision_not_found" {
+		t.Errorf("Expected revision_not_found for the first revision, got %v", err)
+	}
+
+	other := createTestDocumentation(t, "Other Doc", "1.0.0", nil)
+	if _, err := TestDocService.PropagatePageChange(admin, pages[v1.ID].ID, 2, []uint{other.ID}, true); err == nil || err.Error() != "versions_not_related" {
+		t.Errorf("Expected versions_not_related, got %v", err)
+	}
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	RedirectManual    = "manual"
+	RedirectPage      = "page"
+	RedirectPageGroup = "page_group"
+	RedirectVersion   = "version"
+	RedirectBaseURL   = "base_url"
+)
+
+// normalizeRedirectPath strips what RsPress adds to a route, so that
+// "/guides/a.html", "/guides/a/" and "/guides/a/index.html" are the same path.
+// The stripped .html extension is returned to be put back on the target.
+func normalizeRedirectPath(p string) (string, string) {
+	suffix := ""
+	if strings.HasSuffix(p, ".html") {
+		suffix = ".html"
+		p = strings.TrimSuffix(p, ".html")
+	}
+
+	p = strings.TrimSuffix(p, "/index")
+	p = strings.TrimRight(p, "/")
+
+	if p == "" {
+		p = "/"
+	}
+
+	return p, suffix
+}
+
+// matchRedirect finds the rule for a path and where it leads. An exact rule
+// wins over a wildcard rule, and a longer wildcard over a shorter one. A
+// wildcard rule "/a/*" matches "/a" and everything below it, and a target
+// ending in "/*" gets the matched remainder appended.
+func matchRedirect(rules []models.Redirect, p string) (string, *models.Redirect) {
+	var best *models.Redirect
+	bestLength := -1
+
+	for i, rule := range rules {
+		if !rule.Wildcard {
+			if rule.FromPath == p {
+				return rule.ToPath, &rules[i]
+			}
+			continue
+		}
+
+		prefix := strings.TrimSuffix(rule.FromPath, "/*")
+		if (p == prefix || strings.HasPrefix(p, prefix+"/")) && len(prefix) > bestLength {
+			best = &rules[i]
+			bestLength = len(prefix)
+		}
+	}
+
+	if best == nil {
+		return "", nil
+	}
+
+	if !strings.HasSuffix(best.ToPath, "/*") {
+		return best.ToPath, best
+	}
+
+	return strings.TrimSuffix(best.ToPath, "/*") + p[bestLength:], best
+}
+
+func isAbsoluteRedirect(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// ResolveRedirect returns where a path that is not served should be sent.
+// Rules of a documentation are relative to its base URL; when no
+// documentation is served at the path, the base URLs documentations were
+// moved away from are tried instead.
+func (service *DocService) ResolveRedirect(docId uint, baseURL string, urlPath string) (string, bool) {
+	if docId != 0 {
+		rootId, err := service.GetRootParentID(docId)
+		if err != nil {
+			return "", false
+		}
+
+		var rules []models.Redirect
+		if err := service.DB.Where("documentation_id = ? AND source <> ?", rootId, RedirectBaseURL).Find(&rules).Error; err != nil {
+			return "", false
+		}
+
+		base := strings.TrimSuffix(baseURL, "/")
+		sitePath, suffix := normalizeRedirectPath(strings.TrimPrefix(urlPath, base))
+
+		if target, rule := matchRedirect(rules, sitePath); rule != nil {
+			absolute := isAbsoluteRedirect(target)
+			if absolute && !strings.HasSuffix(rule.ToPath, "/*") {
+				return target, true
+			}
+
+			if target != "/" && path.Ext(target) == "" {
+				target += suffix
+			}
+
+			if absolute {
+				return target, true
+			}
+
+			return base + target, true
+		}
+	}
+
+	var rules []models.Redirect
+	if err := service.DB.Where("source = ?", RedirectBaseURL).Find(&rules).Error; err != nil {
+		return "", false
+	}
+
+	target, rule := matchRedirect(rules, urlPath)
+	return target, rule != nil
+}
+
+// addRedirect records that a path has moved. A rule leading back to the new
+// path is dropped, since the path is served again, and rules that led to the
+// old path, or below it for a folder, are pointed at the new one so that
+// clients get a single hop.
+func addRedirect(tx *gorm.DB, rootId uint, from string, to string, wildcard bool, source string) error {
+	if err := tx.Where("documentation_id = ? AND from_path = ?", rootId, to).Delete(&models.Redirect{}).Error; err != nil {
+		return err
+	}
+
+	var leading []models.Redirect
+	if source != RedirectBaseURL {
+		if err := tx.Where("documentation_id = ? AND source <> ?", rootId, RedirectBaseURL).Find(&leading).Error; err != nil {
+			return err
+		}
+	}
+
+	moved := []models.Redirect{{FromPath: from, ToPath: to, Wildcard: wildcard}}
+	for _, rule := range leading {
+		target, matched := matchRedirect(moved, rule.ToPath)
+		if matched == nil {
+			continue
+		}
+
+		if err := tx.Model(&rule).Update("to_path", target).Error; err != nil {
+			return err
+		}
+	}
+
+	var redirect models.Redirect
+	if err := tx.Where("documentation_id = ? AND from_path = ?", rootId, from).FirstOrInit(&redirect).Error; err != nil {
+		return err
+	}
+
+	redirect.DocumentationID = rootId
+	redirect.FromPath = from
+	redirect.ToPath = to
+	redirect.Wildcard = wildcard
+	redirect.Source = source
+
+	return tx.Save(&redirect).Error
+}
+
+// versionPathPrefixes returns the prefixes the routes of a version are served
+// under: none for the latest version and its default locale, the version and
+// locale folders otherwise. The version prefix alone comes first.
+func (service *DocService) versionPathPrefixes(docId uint) ([]string, error) {
+	var doc models.Documentation
+	if err := service.DB.Select("id", "version", "locales", "default_locale").First(&doc, docId).Error; err != nil {
+		return nil, fmt.Errorf("documentation_not_found")
+	}
+
+	latest, _, err := service.GetAllVersions(docId)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if doc.Version != latest {
+		prefix = "/" + doc.Version
+	}
+
+	prefixes := []string{prefix}
+	for _, locale := range documentationLocales(doc) {
+		if locale.Lang != doc.DefaultLocale {
+			prefixes = append(prefixes, prefix+"/"+locale.Lang)
+		}
+	}
+
+	return prefixes, nil
+}
+
+// pageGroupDir returns the folder a page group is written to, relative to the
+// version root.
+func (service *DocService) pageGroupDir(id uint) (string, error) {
+	var dirs []string
+	seen := make(map[uint]bool)
+
+	for current := &id; current != nil && !seen[*current]; {
+		seen[*current] = true
+
+		var group models.PageGroup
+		if err := service.DB.Select("id", "name", "parent_id").First(&group, *current).Error; err != nil {
+			return "", fmt.Errorf("page_group_not_found")
+		}
+
+		dirs = append([]string{utils.StringToFileString(group.Name)}, dirs...)
+		current = group.ParentID
+	}
+
+	return "/guides/" + strings.Join(dirs, "/"), nil
+}
+
+// pageRoute returns the path a page is served at relative to the root of its
+// version. An intro page is served as the index of its folder.
+func (service *DocService) pageRoute(page models.Page) (string, error) {
+	dir := "/guides"
+	if page.PageGroupID != nil {
+		groupDir, err := service.pageGroupDir(*page.PageGroupID)
+		if err != nil {
+			return "", err
+		}
+		dir = groupDir
+	}
+
+	if page.IsIntroPage {
+		return dir, nil
+	}
+
+	return dir + "/" + utils.StringToFileString(page.Slug), nil
+}
+
+// pagePaths returns the paths a page is served at, one per locale.
+func (service *DocService) pagePaths(pageId uint) ([]string, error) {
+	var page models.Page
+	if err := service.DB.Select("id", "documentation_id", "page_group_id", "slug", "is_intro_page").First(&page, pageId).Error; err != nil {
+		return nil, fmt.Errorf("page_not_found")
+	}
+
+	route, err := service.pageRoute(page)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, err := service.versionPathPrefixes(page.DocumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		paths[i] = prefix + route
+	}
+
+	return paths, nil
+}
+
+// pageGroupPaths returns the folders a page group is served at, one per
+// locale.
+func (service *DocService) pageGroupPaths(pageGroupId uint) ([]string, error) {
+	var group models.PageGroup
+	if err := service.DB.Select("id", "documentation_id").First(&group, pageGroupId).Error; err != nil {
+		return nil, fmt.Errorf("page_group_not_found")
+	}
+
+	dir, err := service.pageGroupDir(pageGroupId)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, err := service.versionPathPrefixes(group.DocumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		paths[i] = prefix + dir
+	}
+
+	return paths, nil
+}
+
+// recordMovedPaths adds a redirect for every path that changed. Folders are
+// redirected with everything below them.
+func (service *DocService) recordMovedPaths(docId uint, oldPaths []string, newPaths []string, folder bool, source string) error {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return fmt.Errorf("failed_to_record_redirects")
+	}
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		for i, oldPath := range oldPaths {
+			if i >= len(newPaths) || oldPath == newPaths[i] {
+				continue
+			}
+
+			from, to := oldPath, newPaths[i]
+			if folder {
+				from, to = from+"/*", to+"/*"
+			}
+
+			if err := addRedirect(tx, rootId, from, to, folder, source); err != nil {
+				return fmt.Errorf("failed_to_record_redirects")
+			}
+		}
+		return nil
+	})
+}
+
+// recordPageMove records redirects for a page that was at oldPaths before a
+// committed change. The change stands when this fails, so a failure is only
+// logged.
+func (service *DocService) recordPageMove(id uint, oldPaths []string) {
+	docId, err := service.GetDocumentationIDOfPage(id)
+	if err == nil {
+		var newPaths []string
+		if newPaths, err = service.pagePaths(id); err == nil {
+			err = service.recordMovedPaths(docId, oldPaths, newPaths, false, RedirectPage)
+		}
+	}
+
+	if err != nil {
+		logger.Error("failed to record the redirects of a page", zap.Uint("page_id", id), zap.Error(err))
+	}
+}
+
+// recordPageGroupMove is recordPageMove for a page group and everything
+// below it.
+func (service *DocService) recordPageGroupMove(id uint, oldPaths []string) {
+	docId, err := service.GetDocumentationIDOfPageGroup(id)
+	if err == nil {
+		var newPaths []string
+		if newPaths, err = service.pageGroupPaths(id); err == nil {
+			err = service.recordMovedPaths(docId, oldPaths, newPaths, true, RedirectPageGroup)
+		}
+	}
+
+	if err != nil {
+		logger.Error("failed to record the redirects of a page group", zap.Uint("page_group_id", id), zap.Error(err))
+	}
+}
+
+// validateRedirect checks a manual rule. Sources are paths relative to the
+// base URL and may end in "/*" to match everything below them; targets are
+// paths or absolute URLs, and only a wildcard rule may carry the matched
+// remainder over with a trailing "/*".
+func validateRedirect(from string, to string) (string, bool, error) {
+	if !strings.HasPrefix(from, "/") || strings.Contains(strings.TrimSuffix(from, "/*"), "*") {
+		return "", false, fmt.Errorf("invalid_redirect")
+	}
+
+	if !strings.HasPrefix(to, "/") && !isAbsoluteRedirect(to) || strings.Contains(strings.TrimSuffix(to, "/*"), "*") {
+		return "", false, fmt.Errorf("invalid_redirect")
+	}
+
+	wildcard := strings.HasSuffix(from, "/*")
+	if strings.HasSuffix(to, "/*") && !wildcard {
+		return "", false, fmt.Errorf("invalid_redirect")
+	}
+
+	if wildcard {
+		prefix, _ := normalizeRedirectPath(strings.TrimSuffix(from, "/*"))
+		from = strings.TrimSuffix(prefix, "/") + "/*"
+	} else {
+		from, _ = normalizeRedirectPath(from)
+	}
+
+	if from == to || from == "/*" {
+		return "", false, fmt.Errorf("invalid_redirect")
+	}
+
+	return from, wildcard, nil
+}
+
+func (service *DocService) GetRedirects(docId uint) ([]models.Redirect, error) {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return nil, fmt.Errorf("documentation_not_found")
+	}
+
+	redirects := []models.Redirect{}
+	if err := service.DB.Where("documentation_id = ?", rootId).Order("from_path").Find(&redirects).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_redirects")
+	}
+
+	return redirects, nil
+}
+
+func (service *DocService) CreateRedirect(docId uint, from string, to string) (models.Redirect, error) {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return models.Redirect{}, fmt.Errorf("documentation_not_found")
+	}
+
+	from, wildcard, err := validateRedirect(from, to)
+	if err != nil {
+		return models.Redirect{}, err
+	}
+
+	var count int64
+	if err := service.DB.Model(&models.Redirect{}).Where("documentation_id = ? AND from_path = ?", rootId, from).Count(&count).Error; err != nil {
+		return models.Redirect{}, fmt.Errorf("failed_to_create_redirect")
+	}
+
+	if count > 0 {
+		return models.Redirect{}, fmt.Errorf("redirect_already_exists")
+	}
+
+	redirect := models.Redirect{DocumentationID: rootId, FromPath: from, ToPath: to, Wildcard: wildcard, Source: RedirectManual}
+	if err := service.DB.Create(&redirect).Error; err != nil {
+		return models.Redirect{}, fmt.Errorf("failed_to_create_redirect")
+	}
+
+	return redirect, nil
+}
+
+func (service *DocService) EditRedirect(id uint, from string, to string) (models.Redirect, error) {
+	var redirect models.Redirect
+	if err := service.DB.First(&redirect, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Redirect{}, fmt.Errorf("redirect_not_found")
+		}
+		return models.Redirect{}, fmt.Errorf("failed_to_edit_redirect")
+	}
+
+	if redirect.Source == RedirectBaseURL {
+		return models.Redirect{}, fmt.Errorf("invalid_redirect")
+	}
+
+	from, wildcard, err := validateRedirect(from, to)
+	if err != nil {
+		return models.Redirect{}, err
+	}
+
+	var count int64
+	if err := service.DB.Model(&models.Redirect{}).Where("documentation_id = ? AND from_path = ? AND id <> ?", redirect.DocumentationID, from, id).Count(&count).Error; err != nil {
+		return models.Redirect{}, fmt.Errorf("failed_to_edit_redirect")
+	}
+
+	if count > 0 {
+		return models.Redirect{}, fmt.Errorf("redirect_already_exists")
+	}
+
+	redirect.FromPath = from
+	redirect.ToPath = to
+	redirect.Wildcard = wildcard
+	redirect.Source = RedirectManual
+
+	if err := service.DB.Save(&redirect).Error; err != nil {
+		return models.Redirect{}, fmt.Errorf("failed_to_edit_redirect")
+	}
+
+	return redirect, nil
+}
+
+func (service *DocService) DeleteRedirect(id uint) error {
+	result := service.DB.Delete(&models.Redirect{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed_to_delete_redirect")
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("redirect_not_found")
+	}
+
+	return nil
+}
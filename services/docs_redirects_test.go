@@ -0,0 +1,212 @@
+package services
+
+import (
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+)
+
+func TestMatchRedirect(t *testing.T) {
+	rules := []models.Redirect{
+		{FromPath: "/guides/old", ToPath: "/guides/new"},
+		{FromPath: "/guides/*", ToPath: "/docs/*", Wildcard: true},
+		{FromPath: "/guides/setup/*", ToPath: "/install", Wildcard: true},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/guides/old", "/guides/new"},
+		{"/guides/other", "/docs/other"},
+		{"/guides", "/docs"},
+		{"/guides/setup/linux", "/install"},
+		{"/guidesx", ""},
+	}
+
+	for _, tt := range tests {
+		target, _ := matchRedirect(rules, tt.path)
+		if target != tt.expected {
+			t.Errorf("matchRedirect(%q) = %q, expected %q", tt.path, target, tt.expected)
+		}
+	}
+}
+
+func TestRedirectsFollowRenames(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Redirect Doc", "1.0.0", nil)
+	group := createTestPageGroup(t, doc.ID, nil, "Setup", 1)
+	page := createTestPage(t, doc.ID, &group.ID, "/install", 1)
+
+	if err := TestDocService.EditPage(admin, page.ID, 1, "Install", "/installation", "[]", nil, nil, nil); err != nil {
+		t.Fatalf("EditPage returned an error: %v", err)
+	}
+
+	if err := TestDocService.EditPageGroup(admin, group.ID, 1, "Getting Started", "Getting Started", doc.ID, nil, nil); err != nil {
+		t.Fatalf("EditPageGroup returned an error: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/redirect-doc/guides/setup/install.html", "/redirect-doc/guides/getting-started/installation.html"},
+		{"/redirect-doc/guides/setup/install", "/redirect-doc/guides/getting-started/installation"},
+		{"/redirect-doc/guides/setup/other.html", "/redirect-doc/guides/getting-started/other.html"},
+		{"/redirect-doc/guides/setup", "/redirect-doc/guides/getting-started"},
+	}
+
+	for _, tt := range tests {
+		target, ok := TestDocService.ResolveRedirect(doc.ID, doc.BaseURL, tt.path)
+		if !ok || target != tt.expected {
+			t.Errorf("ResolveRedirect(%q) = %q, expected %q", tt.path, target, tt.expected)
+		}
+	}
+
+	if _, ok := TestDocService.ResolveRedirect(doc.ID, doc.BaseURL, "/redirect-doc/guides/unknown.html"); ok {
+		t.Errorf("Expected no redirect for an unknown path")
+	}
+
+	// Renaming the page again points the older rules at the new path, and
+	// renaming it back drops the rule that would now loop.
+	if err := TestDocService.EditPage(admin, page.ID, 2, "Install", "/install", "[]", nil, nil, nil); err != nil {
+		t.Fatalf("EditPage returned an error: %v", err)
+	}
+
+	if err := TestDocService.EditPage(admin, page.ID, 3, "Install", "/installation", "[]", nil, nil, nil); err != nil {
+		t.Fatalf("EditPage returned an error: %v", err)
+	}
+
+	redirects, err := TestDocService.GetRedirects(doc.ID)
+	if err != nil {
+		t.Fatalf("GetRedirects returned an error: %v", err)
+	}
+
+	expected := map[string]string{
+		"/guides/getting-started/install": "/guides/getting-started/installation",
+		"/guides/setup/*":                 "/guides/getting-started/*",
+		"/guides/setup/install":           "/guides/getting-started/installation",
+	}
+
+	if len(redirects) != len(expected) {
+		t.Fatalf("Expected %d redirects, got %+v", len(expected), redirects)
+	}
+
+	for _, redirect := range redirects {
+		if expected[redirect.FromPath] != redirect.ToPath {
+			t.Errorf("Unexpected redirect %s -> %s", redirect.FromPath, redirect.ToPath)
+		}
+	}
+}
+
+func TestRedirectsFollowReorders(t *testing.T) {
+	doc := createTestDocumentation(t, "Reorder Redirect Doc", "1.0.0", nil)
+	setup := createTestPageGroup(t, doc.ID, nil, "Setup", 1)
+	usage := createTestPageGroup(t, doc.ID, nil, "Usage", 2)
+	api := createTestPageGroup(t, doc.ID, nil, "API", 3)
+	page := createTestPage(t, doc.ID, &setup.ID, "/install", 1)
+	other := createTestPage(t, doc.ID, nil, "/faq", 2)
+
+	if err := TestDocService.ReorderPage(page.ID, &usage.ID, utils.UintPtr(1)); err != nil {
+		t.Fatalf("ReorderPage returned an error: %v", err)
+	}
+
+	if err := TestDocService.ReorderPageGroup(api.ID, utils.UintPtr(1), &usage.ID); err != nil {
+		t.Fatalf("ReorderPageGroup returned an error: %v", err)
+	}
+
+	if err := TestDocService.BulkReorderPageOrPageGroup([]struct {
+		ID          uint  `json:"id" validate:"required"`
+		Order       *uint `json:"order"`
+		ParentID    *uint `json:"parentId"`
+		PageGroupID *uint `json:"pageGroupId"`
+		IsPageGroup bool  `json:"isPageGroup"`
+	}{{ID: other.ID, Order: utils.UintPtr(2), PageGroupID: &setup.ID}}); err != nil {
+		t.Fatalf("BulkReorderPageOrPageGroup returned an error: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/reorder-redirect-doc/guides/setup/install", "/reorder-redirect-doc/guides/usage/install"},
+		{"/reorder-redirect-doc/guides/api/reference", "/reorder-redirect-doc/guides/usage/api/reference"},
+		{"/reorder-redirect-doc/guides/faq", "/reorder-redirect-doc/guides/setup/faq"},
+	}
+
+	for _, tt := range tests {
+		target, ok := TestDocService.ResolveRedirect(doc.ID, doc.BaseURL, tt.path)
+		if !ok || target != tt.expected {
+			t.Errorf("ResolveRedirect(%q) = %q, expected %q", tt.path, target, tt.expected)
+		}
+	}
+}
+
+func TestManualRedirects(t *testing.T) {
+	doc := createTestDocumentation(t, "Manual Redirect Doc", "1.0.0", nil)
+
+	for _, invalid := range [][2]string{
+		{"old", "/new"},
+		{"/old", "new"},
+		{"/o*ld", "/new"},
+		{"/old", "/new/*"},
+		{"/*", "/new"},
+	} {
+		if _, err := TestDocService.CreateRedirect(doc.ID, invalid[0], invalid[1]); err == nil || err.Error() != "invalid_redirect" {
+			t.Errorf("Expected 'invalid_redirect' error for %v, got %v", invalid, err)
+		}
+	}
+
+	redirect, err := TestDocService.CreateRedirect(doc.ID, "/blog/*", "https://blog.example.com/*")
+	if err != nil {
+		t.Fatalf("CreateRedirect returned an error: %v", err)
+	}
+
+	if !redirect.Wildcard || redirect.Source != RedirectManual {
+		t.Errorf("Expected a manual wildcard redirect, got %+v", redirect)
+	}
+
+	if _, err := TestDocService.CreateRedirect(doc.ID, "/blog/", "/news"); err != nil {
+		t.Fatalf("CreateRedirect returned an error: %v", err)
+	}
+
+	if _, err := TestDocService.CreateRedirect(doc.ID, "/blog.html", "/news"); err == nil || err.Error() != "redirect_already_exists" {
+		t.Errorf("Expected 'redirect_already_exists' error, got %v", err)
+	}
+
+	target, ok := TestDocService.ResolveRedirect(doc.ID, doc.BaseURL, "/manual-redirect-doc/blog/2024/post.html")
+	if !ok || target != "https://blog.example.com/2024/post.html" {
+		t.Errorf("Unexpected wildcard redirect %q", target)
+	}
+
+	if _, err := TestDocService.EditRedirect(redirect.ID, "/articles/*", "/news/*"); err != nil {
+		t.Fatalf("EditRedirect returned an error: %v", err)
+	}
+
+	target, ok = TestDocService.ResolveRedirect(doc.ID, doc.BaseURL, "/manual-redirect-doc/articles/a.html")
+	if !ok || target != "/manual-redirect-doc/news/a.html" {
+		t.Errorf("Unexpected edited redirect %q", target)
+	}
+
+	if err := TestDocService.DeleteRedirect(redirect.ID); err != nil {
+		t.Fatalf("DeleteRedirect returned an error: %v", err)
+	}
+
+	if err := TestDocService.DeleteRedirect(redirect.ID); err == nil || err.Error() != "redirect_not_found" {
+		t.Errorf("Expected 'redirect_not_found' error, got %v", err)
+	}
+}
+
+func TestBaseURLRedirect(t *testing.T) {
+	doc := createTestDocumentation(t, "Moved Doc", "1.0.0", nil)
+
+	if err := addRedirect(TestDocService.DB, doc.ID, "/moved-doc/*", "/new-home/*", true, RedirectBaseURL); err != nil {
+		t.Fatalf("addRedirect returned an error: %v", err)
+	}
+
+	target, ok := TestDocService.ResolveRedirect(0, "", "/moved-doc/guides/a.html")
+	if !ok || target != "/new-home/guides/a.html" {
+		t.Errorf("Unexpected base URL redirect %q", target)
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// claimRevision bumps the revision of the row with the given id, but only
+// while it still equals baseRevision. It must run inside the transaction
+// that applies the edit, so a concurrent writer that got there first makes
+// it fail with revision_conflict instead of being silently overwritten.
+func claimRevision(tx *gorm.DB, model interface{}, id uint, baseRevision uint, notFound string) error {
+	result := tx.Model(model).
+		Where("id = ? AND revision = ?", id, baseRevision).
+		UpdateColumn("revision", gorm.Expr("revision + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed_to_update_revision")
+	}
+
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := tx.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed_to_update_revision")
+		}
+		if count == 0 {
+			return errors.New(notFound)
+		}
+		return fmt.Errorf("revision_conflict")
+	}
+
+	return nil
+}
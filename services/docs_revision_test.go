@@ -0,0 +1,125 @@
+package services
+
+import (
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+)
+
+func TestEditPageRevisionConflict(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Revision Page Doc", "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/revision", 1)
+
+	if page.Revision != 1 {
+		t.Fatalf("Expected new page to start at revision 1, got %d", page.Revision)
+	}
+
+	if err := TestDocService.EditPage(admin, page.ID, 1, "First", "/revision", "[]", nil, nil, nil); err != nil {
+		t.Fatalf("EditPage returned an error: %v", err)
+	}
+
+	err := TestDocService.EditPage(admin, page.ID, 1, "Second", "/revision", "[]", nil, nil, nil)
+	if err == nil || err.Error() != "revision_conflict" {
+		t.Fatalf("Expected 'revision_conflict' error, got %v", err)
+	}
+
+	current, err := TestDocService.GetPage(page.ID)
+	if err != nil {
+		t.Fatalf("GetPage returned an error: %v", err)
+	}
+
+	if current.Title != "First" || current.Revision != 2 {
+		t.Errorf("Expected first edit to be kept at revision 2, got %q at revision %d", current.Title, current.Revision)
+	}
+
+	err = TestDocService.EditPage(admin, 999999, 1, "Missing", "/missing", "", nil, nil, nil)
+	if err == nil || err.Error() != "page_not_found" {
+		t.Errorf("Expected 'page_not_found' error, got %v", err)
+	}
+}
+
+func TestEditPageGroupRevisionConflict(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Revision Group Doc", "1.0.0", nil)
+	group := createTestPageGroup(t, doc.ID, nil, "revision", 1)
+
+	if err := TestDocService.EditPageGroup(admin, group.ID, 1, "renamed", "Renamed", doc.ID, nil, nil); err != nil {
+		t.Fatalf("EditPageGroup returned an error: %v", err)
+	}
+
+	err := TestDocService.EditPageGroup(admin, group.ID, 1, "stale", "Stale", doc.ID, nil, nil)
+	if err == nil || err.Error() != "revision_conflict" {
+		t.Fatalf("Expected 'revision_conflict' error, got %v", err)
+	}
+
+	if err := TestDocService.ReorderPageGroup(group.ID, nil, nil); err != nil {
+		t.Fatalf("ReorderPageGroup returned an error: %v", err)
+	}
+
+	var current models.PageGroup
+	TestDocService.DB.First(&current, group.ID)
+	if current.Label != "Renamed" || current.Revision != 3 {
+		t.Errorf("Expected label 'Renamed' at revision 3 after the reorder, got %q at revision %d", current.Label, current.Revision)
+	}
+}
+
+func TestReorderRevisionConflict(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Revision Reorder Doc", "1.0.0", nil)
+	group := createTestPageGroup(t, doc.ID, nil, "reorder", 1)
+	page := createTestPage(t, doc.ID, nil, "/reorder", 2)
+	bulkPage := createTestPage(t, doc.ID, nil, "/reorder-bulk", 3)
+
+	if err := TestDocService.ReorderPage(page.ID, &group.ID, utils.UintPtr(1)); err != nil {
+		t.Fatalf("ReorderPage returned an error: %v", err)
+	}
+	err := TestDocService.EditPage(admin, page.ID, 1, "Stale", "/reorder", "[]", nil, nil, nil)
+	if err == nil || err.Error() != "revision_conflict" {
+		t.Errorf("Expected an edit from before the move to fail with 'revision_conflict', got %v", err)
+	}
+
+	if err := TestDocService.ReorderPageGroup(group.ID, utils.UintPtr(4), nil); err != nil {
+		t.Fatalf("ReorderPageGroup returned an error: %v", err)
+	}
+	err = TestDocService.EditPageGroup(admin, group.ID, 1, "stale", "Stale", doc.ID, nil, nil)
+	if err == nil || err.Error() != "revision_conflict" {
+		t.Errorf("Expected a group edit from before the move to fail with 'revision_conflict', got %v", err)
+	}
+
+	err = TestDocService.BulkReorderPageOrPageGroup([]struct {
+		ID          uint  `json:"id" validate:"required"`
+		Order       *uint `json:"order"`
+		ParentID    *uint `json:"parentId"`
+		PageGroupID *uint `json:"pageGroupId"`
+		IsPageGroup bool  `json:"isPageGroup"`
+	}{
+		{ID: bulkPage.ID, Order: utils.UintPtr(0), PageGroupID: &group.ID},
+		{ID: group.ID, Order: utils.UintPtr(0), IsPageGroup: true},
+	})
+	if err != nil {
+		t.Fatalf("BulkReorderPageOrPageGroup returned an error: %v", err)
+	}
+
+	var moved models.Page
+	TestDocService.DB.First(&moved, bulkPage.ID)
+	var movedGroup models.PageGroup
+	TestDocService.DB.First(&movedGroup, group.ID)
+	if moved.Revision != 2 || movedGroup.Revision != 3 {
+		t.Errorf("Expected the bulk reorder to bump both revisions, got page %d and group %d", moved.Revision, movedGroup.Revision)
+	}
+}
+
+func TestGetDocumentationIncludesRevision(t *testing.T) {
+	doc := createTestDocumentation(t, "Revision Documentation", "1.0.0", nil)
+
+	fetched, err := TestDocService.GetDocumentation(doc.ID)
+	if err != nil {
+		t.Fatalf("GetDocumentation returned an error: %v", err)
+	}
+
+	if fetched.Revision != 1 {
+		t.Errorf("Expected revision 1, got %d", fetched.Revision)
+	}
+}
@@ -36,6 +36,7 @@ type VersionInfo struct {
 	Version   string
 	CreatedAt time.Time
 	DocId     uint
+	Hidden    bool // hidden versions are not built
 }
 
 type MetaElement struct {
@@ -65,138 +66,194 @@ type SocialLinkRsPress struct {
 }
 
 type MetaData struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Image       string `json:"image"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Image        string `json:"image,omitempty"`
+	CanonicalURL string `json:"canonicalURL,omitempty"`
+	NoIndex      bool   `json:"noIndex,omitempty"`
 }
 
-func (service *DocService) GenerateHead(docID uint, pageId uint, pageType string) (string, error) {
-	var buffer bytes.Buffer
-	doc, err := service.GetDocumentation(docID)
+// metaComponent renders the Meta component. The JSON is passed as a string
+// literal, so quotes in titles and descriptions can't end the attribute.
+func metaComponent(meta MetaData) (string, error) {
+	metaJSON, err := json.Marshal(meta)
 	if err != nil {
 		return "", err
 	}
 
-	latest, _, err := service.GetAllVersions(docID)
+	rawJSON, err := json.Marshal(string(metaJSON))
 	if err != nil {
 		return "", err
 	}
 
-	latestVersion := latest
-	isLatestVersion := (doc.Version == latest)
+	return fmt.Sprintf("<Meta rawJson={%s} />", rawJSON), nil
+}
+
+// frontMatterString quotes a front matter value; JSON strings are valid YAML.
+func frontMatterString(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
 
+func (service *DocService) GenerateHead(docID uint, pageId uint, pageType string) (string, error) {
 	if pageId == math.MaxUint32 {
-		buffer.WriteString("---\n")
-		buffer.WriteString(fmt.Sprintf("pageType: %s\n", pageType))
-		buffer.WriteString("footer: true\n")
-		buffer.WriteString(fmt.Sprintf("title: %s\n", doc.Name))
-		buffer.WriteString("---\n\n")
+		return service.generateHomeHead(docID, pageType, "")
+	}
 
-		buffer.WriteString("import { Redirect } from '@components/Redirect';\n\n")
-		buffer.WriteString("import { Meta } from '@components/Meta';\n\n")
+	page, err := service.GetPage(pageId)
+	if err != nil {
+		return "", err
+	}
+
+	if page.PageType == "" {
+		page.PageType = pageType
+	}
 
-		metaTitle := doc.Name
-		metaDescription := doc.Description
+	return service.generatePageHead(docID, page, page.Title, page.Content)
+}
 
-		var metaImage string
+// generateHomeHead writes the placeholder home page that redirects to the
+// guides. linkPrefix is the locale folder of a non-default locale, if any.
+func (service *DocService) generateHomeHead(docID uint, pageType string, linkPrefix string) (string, error) {
+	var buffer bytes.Buffer
+	doc, err := service.GetDocumentation(docID)
+	if err != nil {
+		return "", err
+	}
 
-		if doc.MetaImage != "" {
-			metaImage = doc.MetaImage
-		} else {
-			// TODO remove
-			metaImage = "https://imagedelivery.net/SM0H54GQmiDTGcg4Xr4iPA/c5359df9-c88f-4767-397e-ee4299a42c00/public"
-		}
+	buffer.WriteString("---\n")
+	buffer.WriteString(fmt.Sprintf("pageType: %s\n", pageType))
+	buffer.WriteString("footer: true\n")
+	buffer.WriteString(fmt.Sprintf("title: %s\n", frontMatterString(doc.Name)))
+	buffer.WriteString("---\n\n")
 
-		meta := MetaData{
-			Title:       metaTitle,
-			Description: metaDescription,
-			Image:       metaImage,
-		}
+	buffer.WriteString("import { Redirect } from '@components/Redirect';\n\n")
+	buffer.WriteString("import { Meta } from '@components/Meta';\n\n")
 
-		metaJSON, err := json.Marshal(meta)
-		if err != nil {
-			return "", err
-		}
+	meta, err := metaComponent(MetaData{
+		Title:       doc.Name,
+		Description: doc.Description,
+		Image:       doc.MetaImage,
+	})
+	if err != nil {
+		return "", err
+	}
 
-		buffer.WriteString(fmt.Sprintf(`<Meta rawJson='%s' />%s`, string(metaJSON), "\n"))
-		buffer.WriteString(fmt.Sprintf(`<Redirect to={'%s'} />%s`, doc.BaseURL+"/guides/index.html", "\n\n"))
+	buffer.WriteString(meta + "\n")
+	buffer.WriteString(fmt.Sprintf(`<Redirect to={'%s'} />%s`, doc.BaseURL+linkPrefix+"/guides/index.html", "\n\n"))
 
-		return buffer.String(), nil
-	} else {
-		page, err := service.GetPage(pageId)
-		if err != nil {
-			return "", err
-		}
+	return buffer.String(), nil
+}
+
+// generatePageHead writes the front matter and imports of a page. The title
+// and content are passed in, so translations can use it as well; the SEO
+// settings always come from the page.
+func (service *DocService) generatePageHead(docID uint, page models.Page, title string, content string) (string, error) {
+	var buffer bytes.Buffer
+	doc, err := service.GetDocumentation(docID)
+	if err != nil {
+		return "", err
+	}
+
+	latest, _, err := service.GetAllVersions(docID)
+	if err != nil {
+		return "", err
+	}
 
-		buffer.WriteString("---\n")
-		buffer.WriteString(fmt.Sprintf("pageType: %s\n", pageType))
-		buffer.WriteString("footer: true\n")
-		buffer.WriteString(fmt.Sprintf("title: %s\n", page.Title))
-		buffer.WriteString("---\n\n")
+	// deprecated versions and versions older than the default get a banner
+	// pointing readers at the default
+	latestVersion := latest
+	showOldVersion := doc.Version != latest && (doc.Deprecated || compareSemver(doc.Version, latest) < 0)
 
-		buffer.WriteString("import { Meta } from '@components/Meta';\n")
+	pageType := page.PageType
+	if pageType == "" {
+		pageType = "doc"
+	}
 
-		componentTypes := []string{"paragraph", "table", "image", "video", "audio", "file", "alert", "numberedListItem", "bulletListItem"}
-		caser := cases.Title(language.English)
-		addedComponents := make(map[string]bool)
-		var contentObjects []map[string]interface{}
-		err = json.Unmarshal([]byte(page.Content), &contentObjects)
-		if err != nil {
-			return "", err
-		}
+	if page.MetaTitle != "" {
+		title = page.MetaTitle
+	}
+
+	buffer.WriteString("---\n")
+	buffer.WriteString(fmt.Sprintf("pageType: %s\n", pageType))
+	buffer.WriteString("footer: true\n")
+	buffer.WriteString(fmt.Sprintf("title: %s\n", frontMatterString(title)))
+	if page.MetaDescription != "" {
+		buffer.WriteString(fmt.Sprintf("description: %s\n", frontMatterString(page.MetaDescription)))
+	}
+	if page.HideSidebar {
+		buffer.WriteString("sidebar: false\n")
+	}
+	buffer.WriteString("---\n\n")
+
+	buffer.WriteString("import { Meta } from '@components/Meta';\n")
+
+	componentTypes := []string{"paragraph", "table", "image", "video", "audio", "file", "alert", "numberedListItem", "bulletListItem"}
+	caser := cases.Title(language.English)
+	addedComponents := make(map[string]bool)
+	var contentObjects []map[string]interface{}
+	err = json.Unmarshal([]byte(content), &contentObjects)
+	if err != nil {
+		return "", err
+	}
 
-		for _, obj := range contentObjects {
-			if objType, ok := obj["type"].(string); ok {
-				for _, componentType := range componentTypes {
-					if objType == componentType && !addedComponents[componentType] {
-						componentName := caser.String(componentType)
-						if componentType == "numberedListItem" || componentType == "bulletListItem" {
-							componentName = "List"
-						}
-						buffer.WriteString(fmt.Sprintf(`import { %s } from "@components/%s";%s`, componentName, componentName, "\n"))
-						addedComponents[componentType] = true
+	for _, obj := range contentObjects {
+		if objType, ok := obj["type"].(string); ok {
+			for _, componentType := range componentTypes {
+				if objType == componentType && !addedComponents[componentType] {
+					componentName := caser.String(componentType)
+					if componentType == "numberedListItem" || componentType == "bulletListItem" {
+						componentName = "List"
 					}
+					buffer.WriteString(fmt.Sprintf(`import { %s } from "@components/%s";%s`, componentName, componentName, "\n"))
+					addedComponents[componentType] = true
 				}
 			}
 		}
+	}
 
-		if !isLatestVersion {
-			buffer.WriteString("import { OldVersion } from '@components/OldVersion';\n")
-		}
+	if showOldVersion {
+		buffer.WriteString("import { OldVersion } from '@components/OldVersion';\n")
+	}
 
-		buffer.WriteString("\n\n")
+	buffer.WriteString("\n\n")
 
-		if !isLatestVersion {
-			buffer.WriteString(fmt.Sprintf(`<OldVersion newVersion="%s" />%s`, latestVersion, "\n\n"))
+	if showOldVersion {
+		deprecated := ""
+		if doc.Deprecated {
+			deprecated = " deprecated"
 		}
+		buffer.WriteString(fmt.Sprintf(`<OldVersion newVersion="%s"%s />%s`, latestVersion, deprecated, "\n\n"))
+	}
 
-		metaTitle := doc.Name
-		metaDescription := doc.Description
+	meta := MetaData{
+		Title:        doc.Name,
+		Description:  doc.Description,
+		Image:        doc.MetaImage,
+		CanonicalURL: page.CanonicalURL,
+		NoIndex:      page.NoIndex,
+	}
 
-		var metaImage string
+	if page.MetaTitle != "" {
+		meta.Title = page.MetaTitle
+	}
 
-		if doc.MetaImage != "" {
-			metaImage = doc.MetaImage
-		} else {
-			// TODO: remove
-			metaImage = "https://downloads-bucket.difuse.io/kalmia-meta-resized.png"
-		}
+	if page.MetaDescription != "" {
+		meta.Description = page.MetaDescription
+	}
 
-		meta := MetaData{
-			Title:       metaTitle,
-			Description: metaDescription,
-			Image:       metaImage,
-		}
+	if page.MetaImage != "" {
+		meta.Image = page.MetaImage
+	}
 
-		metaJSON, err := json.Marshal(meta)
-		if err != nil {
-			return "", err
-		}
+	metaTag, err := metaComponent(meta)
+	if err != nil {
+		return "", err
+	}
 
-		buffer.WriteString(fmt.Sprintf(`<Meta rawJson='%s' />%s`, string(metaJSON), "\n\n"))
+	buffer.WriteString(metaTag + "\n\n")
 
-		return buffer.String(), nil
-	}
+	return buffer.String(), nil
 }
 
 func (service *DocService) RemoveDocFolder(docId uint) error {
@@ -526,6 +583,16 @@ func (service *DocService) StartUpdate(docId uint, rootParentId uint) (string, e
 	}
 
 	replacements["__MULTI_VERSIONS__"] = "multiVersion: " + string(multiVersionsJSON)
+	replacements["__LOCALES__"] = ""
+
+	if locales := documentationLocales(doc); len(locales) > 0 {
+		localesJSON, err := json.Marshal(locales)
+		if err != nil {
+			return "", err
+		}
+
+		replacements["__LOCALES__"] = fmt.Sprintf("lang: '%s',\n  locales: %s,", doc.DefaultLocale, string(localesJSON))
+	}
 
 	err = utils.WriteToFile(docConfig, utils.ReplaceMany(string(docConfigTemplate), replacements))
 	if err != nil {
@@ -548,13 +615,40 @@ func (service *DocService) StartUpdate(docId uint, rootParentId uint) (string, e
 	return configHash, nil
 }
 
-func (service *DocService) CraftPage(pageID uint, title string, slug string, content string) (string, error) {
+func (service *DocService) CraftPage(page models.Page, title string, content string) (string, error) {
 	if content == `"[]"` {
 		return "", nil
 	}
 
+	docId, err := service.GetDocIdByPageId(page.ID)
+	if err != nil {
+		return "", err
+	}
+
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return "", err
+	}
+
+	content, err = service.expandSnippets(content, rootId)
+	if err != nil {
+		return "", err
+	}
+
+	var doc models.Documentation
+	if err := service.DB.Select("id", "version", "variables").First(&doc, docId).Error; err != nil {
+		return "", fmt.Errorf("documentation_not_found")
+	}
+
+	content, err = applyVersionContent(content, doc)
+	if err != nil {
+		return "", err
+	}
+
+	title = substituteVariables(title, documentationVariables(doc))
+
 	var blocks []Block
-	err := json.Unmarshal([]byte(content), &blocks)
+	err = json.Unmarshal([]byte(content), &blocks)
 	if err != nil {
 		return "", err
 	}
@@ -578,12 +672,7 @@ func (service *DocService) CraftPage(pageID uint, title string, slug string, con
 		markdown += utils.ListToMDX(listItems)
 	}
 
-	docId, err := service.GetDocIdByPageId(pageID)
-	if err != nil {
-		return "", err
-	}
-
-	top, err := service.GenerateHead(docId, pageID, "doc")
+	top, err := service.generatePageHead(docId, page, title, content)
 	if err != nil {
 		return "", err
 	}
@@ -591,7 +680,7 @@ func (service *DocService) CraftPage(pageID uint, title string, slug string, con
 	return fmt.Sprintf("%s%s", top, markdown), nil
 }
 
-func (service *DocService) writePagesToDirectory(pages []models.Page, dirPath string) error {
+func (service *DocService) writePagesToDirectory(pages []models.Page, dirPath string, translations *translationSet) error {
 	var metaElements []MetaElement
 
 	sort.Slice(pages, func(i, j int) bool {
@@ -608,7 +697,8 @@ func (service *DocService) writePagesToDirectory(pages []models.Page, dirPath st
 		}
 
 		var fileName, content string
-		content, err = service.CraftPage(fullPage.ID, fullPage.Title, fullPage.Slug, fullPage.Content)
+		title := translations.pageTitle(fullPage)
+		content, err = service.CraftPage(fullPage, title, translations.pageContent(fullPage))
 		if err != nil {
 			return err
 		}
@@ -635,7 +725,7 @@ func (service *DocService) writePagesToDirectory(pages []models.Page, dirPath st
 			metaElements = append(metaElements, MetaElement{
 				Type:  "file",
 				Name:  "index",
-				Label: fullPage.Title,
+				Label: title,
 				Path:  "/",
 				Order: 0,
 			})
@@ -643,7 +733,7 @@ func (service *DocService) writePagesToDirectory(pages []models.Page, dirPath st
 			metaElements = append(metaElements, MetaElement{
 				Type:  "file",
 				Name:  strings.TrimPrefix(fullPage.Slug, "/"),
-				Label: fullPage.Title,
+				Label: title,
 				Path:  fullPage.Slug,
 				Order: order,
 			})
@@ -653,7 +743,7 @@ func (service *DocService) writePagesToDirectory(pages []models.Page, dirPath st
 	return writeMetaJSON(metaElements, dirPath)
 }
 
-func (service *DocService) writePageGroupsToDirectory(pageGroups []models.PageGroup, dirPath string, docId uint) error {
+func (service *DocService) writePageGroupsToDirectory(pageGroups []models.PageGroup, dirPath string, docId uint, translations *translationSet) error {
 	for _, pageGroup := range pageGroups {
 		if pageGroup.DocumentationID != docId {
 			continue
@@ -675,7 +765,7 @@ func (service *DocService) writePageGroupsToDirectory(pageGroups []models.PageGr
 			return err
 		}
 
-		if err := service.writePagesToDirectory(pages, fullPath); err != nil {
+		if err := service.writePagesToDirectory(pages, fullPath, translations); err != nil {
 			return err
 		}
 
@@ -688,7 +778,7 @@ func (service *DocService) writePageGroupsToDirectory(pageGroups []models.PageGr
 			metaElements = append(metaElements, MetaElement{
 				Type:  "file",
 				Name:  strings.TrimPrefix(page.Slug, "/"),
-				Label: page.Title,
+				Label: translations.pageTitle(page),
 				Path:  page.Slug,
 				Order: order,
 			})
@@ -709,7 +799,7 @@ func (service *DocService) writePageGroupsToDirectory(pageGroups []models.PageGr
 				}
 			}
 
-			if err := service.writePageGroupsToDirectory([]models.PageGroup{nestedGroup}, fullPath, docId); err != nil {
+			if err := service.writePageGroupsToDirectory([]models.PageGroup{nestedGroup}, fullPath, docId, translations); err != nil {
 				return err
 			}
 
@@ -720,7 +810,7 @@ func (service *DocService) writePageGroupsToDirectory(pageGroups []models.PageGr
 			metaElements = append(metaElements, MetaElement{
 				Type:        "dir",
 				Name:        utils.StringToFileString(nestedGroup.Name),
-				Label:       nestedGroup.Label,
+				Label:       translations.groupLabel(nestedGroup),
 				Path:        utils.StringToFileString(nestedGroup.Name),
 				Order:       order,
 				Collapsible: &[]bool{true}[0],
@@ -774,7 +864,7 @@ func (service *DocService) buildVersionTree(docId uint) ([]VersionInfo, error) {
 		return nil, err
 	}
 
-	versionTree := []VersionInfo{{Version: doc.Version, CreatedAt: *doc.CreatedAt, DocId: doc.ID}}
+	versionTree := []VersionInfo{{Version: doc.Version, CreatedAt: *doc.CreatedAt, DocId: doc.ID, Hidden: doc.Hidden}}
 
 	childrenIds, err := service.GetChildrenOfDocumentation(docId)
 	if err != nil {
@@ -818,6 +908,10 @@ func (service *DocService) WriteContents(docId uint, rootParentId uint, preHash
 	}
 
 	for _, versionInfo := range versionInfos {
+		if versionInfo.Hidden {
+			continue
+		}
+
 		versionDoc, err := service.GetDocumentation(versionInfo.DocId)
 		if err != nil {
 			return err
@@ -831,22 +925,6 @@ func (service *DocService) WriteContents(docId uint, rootParentId uint, preHash
 			}
 		}
 
-		var rootPageGroups []models.PageGroup
-
-		if err := service.DB.Where("parent_id IS NULL AND documentation_id = ?", versionDoc.ID).Preload("Pages").Find(&rootPageGroups).Error; err != nil {
-			return err
-		}
-
-		cleanedBase := "guides"
-
-		var rootMeta string
-
-		if versionDoc.LanderDetails != "" && versionDoc.LanderDetails != "{}" {
-			rootMeta = `[{"text": "Home", "link": "/", "activeMatch": "^(?!.*guides).*$"}, {"text": "Documentation", "link": "/guides", "activeMatch": ".*guides.*"}]`
-		} else {
-			rootMeta = fmt.Sprintf(`[{"text": "Documentation","link": "/%s/index","activeMatch": "/%s/"}]`, cleanedBase, cleanedBase)
-		}
-
 		var customCSS strings.Builder
 
 		customCSS.WriteString("@tailwind base;\n")
@@ -861,82 +939,51 @@ func (service *DocService) WriteContents(docId uint, rootParentId uint, preHash
 			return err
 		}
 
-		if err := utils.WriteToFile(filepath.Join(versionedDocPath, "_meta.json"), rootMeta); err != nil {
-			return err
-		}
-
-		userContentPath := filepath.Join(versionedDocPath, cleanedBase)
+		locales := documentationLocales(versionDoc)
+		if len(locales) == 0 {
+			if err := pruneVersionDir(versionedDocPath, map[string]bool{"_meta.json": true, "index.mdx": true, "guides": true, "tags": true}); err != nil {
+				return err
+			}
 
-		if !utils.PathExists(userContentPath) {
-			if err := utils.MakeDir(userContentPath); err != nil {
+			if err := service.writeVersionContents(versionDoc, versionedDocPath, "", nil); err != nil {
 				return err
 			}
+			continue
 		}
 
-		if err := service.WriteHomePage(versionDoc, userContentPath); err != nil {
-			return err
+		// Every locale gets its own tree under docs/<version>/<lang>/, which
+		// is where RsPress looks when both versions and locales are set.
+		keep := make(map[string]bool)
+		for _, locale := range locales {
+			keep[locale.Lang] = true
 		}
 
-		var rootMetaElements []MetaElement
-
-		// Write pages directly in the userContentPath
-		if err := service.writePagesToDirectory(versionDoc.Pages, userContentPath); err != nil {
+		if err := pruneVersionDir(versionedDocPath, keep); err != nil {
 			return err
 		}
 
-		// Add pages to root meta elements
-		for _, page := range versionDoc.Pages {
-			order := uint(0)
-			if page.Order != nil {
-				order = *page.Order
-			}
+		for _, locale := range locales {
+			var translations *translationSet
+			linkPrefix := ""
 
-			if page.IsIntroPage {
-				rootMetaElements = append(rootMetaElements, MetaElement{
-					Type:  "file",
-					Name:  "index",
-					Label: page.Title,
-					Path:  "/",
-					Order: order,
-				})
-			} else {
-				rootMetaElements = append(rootMetaElements, MetaElement{
-					Type:  "file",
-					Name:  strings.TrimPrefix(page.Slug, "/"),
-					Label: page.Title,
-					Path:  page.Slug,
-					Order: order,
-				})
+			if locale.Lang != versionDoc.DefaultLocale {
+				translations, err = service.loadTranslationSet(versionDoc.ID, locale.Lang)
+				if err != nil {
+					return err
+				}
+				linkPrefix = "/" + locale.Lang
 			}
-		}
-
-		// Write page groups
-		if err := service.writePageGroupsToDirectory(rootPageGroups, userContentPath, versionDoc.ID); err != nil {
-			return err
-		}
 
-		// Add page groups to root meta elements
-		for _, group := range rootPageGroups {
-			order := uint(0)
-			if group.Order != nil {
-				order = *group.Order
+			localePath := filepath.Join(versionedDocPath, locale.Lang)
+			if !utils.PathExists(localePath) {
+				if err := utils.MakeDir(localePath); err != nil {
+					return err
+				}
 			}
-			rootMetaElements = append(rootMetaElements, MetaElement{
-				Type:        "dir",
-				Name:        utils.StringToFileString(group.Name),
-				Label:       group.Label,
-				Path:        utils.StringToFileString(group.Name),
-				Order:       order,
-				Collapsible: &[]bool{true}[0],
-				Collapsed:   &[]bool{true}[0],
-			})
-		}
 
-		// Write root _meta.json
-		// note that service.writePagesToDirectory already written meta.json once,
-		// and it's OK to overwrite it again here.
-		if err := writeMetaJSON(rootMetaElements, userContentPath); err != nil {
-			return err
+			if err := service.writeVersionContents(versionDoc, localePath, linkPrefix, translations); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -967,7 +1014,139 @@ func (service *DocService) WriteContents(docId uint, rootParentId uint, preHash
 	return service.RsPressBuild(rootParentId, needRebuild)
 }
 
-func (service *DocService) WriteHomePage(documentation models.Documentation, contentPath string) error {
+// writeVersionContents writes the home page, navigation and guides of one
+// version into contentRoot. For a non-default locale, linkPrefix is the locale
+// folder the navigation links need and translations replace the source text.
+func (service *DocService) writeVersionContents(versionDoc models.Documentation, contentRoot string, linkPrefix string, translations *translationSet) error {
+	var rootPageGroups []models.PageGroup
+
+	if err := service.DB.Where("parent_id IS NULL AND documentation_id = ?", versionDoc.ID).Preload("Pages").Find(&rootPageGroups).Error; err != nil {
+		return err
+	}
+
+	cleanedBase := "guides"
+
+	var rootMeta string
+
+	if versionDoc.LanderDetails != "" && versionDoc.LanderDetails != "{}" {
+		rootMeta = fmt.Sprintf(`[{"text": "Home", "link": "%s/", "activeMatch": "^(?!.*(guides|tags)).*$"}, {"text": "Documentation", "link": "%s/guides", "activeMatch": ".*guides.*"}]`, linkPrefix, linkPrefix)
+	} else {
+		rootMeta = fmt.Sprintf(`[{"text": "Documentation","link": "%s/%s/index","activeMatch": "/%s/"}]`, linkPrefix, cleanedBase, cleanedBase)
+	}
+
+	hasTags, err := service.writeTagPages(versionDoc, contentRoot, linkPrefix, translations)
+	if err != nil {
+		return err
+	}
+
+	if hasTags {
+		rootMeta = strings.TrimSuffix(rootMeta, "]") + fmt.Sprintf(`, {"text": "Tags", "link": "%s/tags/index", "activeMatch": "/tags/"}]`, linkPrefix)
+	}
+
+	if err := utils.WriteToFile(filepath.Join(contentRoot, "_meta.json"), rootMeta); err != nil {
+		return err
+	}
+
+	userContentPath := filepath.Join(contentRoot, cleanedBase)
+
+	if !utils.PathExists(userContentPath) {
+		if err := utils.MakeDir(userContentPath); err != nil {
+			return err
+		}
+	}
+
+	if err := service.WriteHomePage(versionDoc, userContentPath, linkPrefix); err != nil {
+		return err
+	}
+
+	var rootMetaElements []MetaElement
+
+	// Write pages directly in the userContentPath
+	if err := service.writePagesToDirectory(versionDoc.Pages, userContentPath, translations); err != nil {
+		return err
+	}
+
+	// Add pages to root meta elements
+	for _, page := range versionDoc.Pages {
+		order := uint(0)
+		if page.Order != nil {
+			order = *page.Order
+		}
+
+		if page.IsIntroPage {
+			rootMetaElements = append(rootMetaElements, MetaElement{
+				Type:  "file",
+				Name:  "index",
+				Label: translations.pageTitle(page),
+				Path:  "/",
+				Order: order,
+			})
+		} else {
+			rootMetaElements = append(rootMetaElements, MetaElement{
+				Type:  "file",
+				Name:  strings.TrimPrefix(page.Slug, "/"),
+				Label: translations.pageTitle(page),
+				Path:  page.Slug,
+				Order: order,
+			})
+		}
+	}
+
+	// Write page groups
+	if err := service.writePageGroupsToDirectory(rootPageGroups, userContentPath, versionDoc.ID, translations); err != nil {
+		return err
+	}
+
+	// Add page groups to root meta elements
+	for _, group := range rootPageGroups {
+		order := uint(0)
+		if group.Order != nil {
+			order = *group.Order
+		}
+		rootMetaElements = append(rootMetaElements, MetaElement{
+			Type:        "dir",
+			Name:        utils.StringToFileString(group.Name),
+			Label:       translations.groupLabel(group),
+			Path:        utils.StringToFileString(group.Name),
+			Order:       order,
+			Collapsible: &[]bool{true}[0],
+			Collapsed:   &[]bool{true}[0],
+		})
+	}
+
+	// Write root _meta.json
+	// note that service.writePagesToDirectory already written meta.json once,
+	// and it's OK to overwrite it again here.
+	if err := writeMetaJSON(rootMetaElements, userContentPath); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// pruneVersionDir removes whatever an earlier build left in a version folder
+// that the current layout no longer writes, such as the untranslated tree
+// after locales were turned on or the folder of a removed locale.
+func pruneVersionDir(versionedDocPath string, keep map[string]bool) error {
+	entries, err := os.ReadDir(versionedDocPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if keep[entry.Name()] {
+			continue
+		}
+
+		if err := utils.RemovePath(filepath.Join(versionedDocPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (service *DocService) WriteHomePage(documentation models.Documentation, contentPath string, linkPrefix string) error {
 	var homePage string
 	var homePagePath string
 
@@ -998,63 +1177,49 @@ func (service *DocService) WriteHomePage(documentation models.Documentation, con
 		yamlBuilder.WriteString("---\n")
 		yamlBuilder.WriteString("pageType: home\n")
 		yamlBuilder.WriteString("hero:\n")
-		yamlBuilder.WriteString(fmt.Sprintf("  name: %s\n", documentation.Name))
-		yamlBuilder.WriteString(fmt.Sprintf("  text: %s\n", documentation.Description))
+		yamlBuilder.WriteString(fmt.Sprintf("  name: %s\n", frontMatterString(documentation.Name)))
+		yamlBuilder.WriteString(fmt.Sprintf("  text: %s\n", frontMatterString(documentation.Description)))
 		yamlBuilder.WriteString("  actions:\n")
 		yamlBuilder.WriteString(fmt.Sprintf("    - theme: brand\n      text: %s\n      link: %s\n",
-			landerDetails.CtaButtonText.CtaButtonLinkLabel,
-			landerDetails.CtaButtonText.CtaButtonLink))
+			frontMatterString(landerDetails.CtaButtonText.CtaButtonLinkLabel),
+			frontMatterString(landerDetails.CtaButtonText.CtaButtonLink)))
 		yamlBuilder.WriteString(fmt.Sprintf("    - theme: alt\n      text: %s\n      link: %s\n",
-			landerDetails.SecondCtaButtonText.CtaButtonLinkLabel,
-			landerDetails.SecondCtaButtonText.CtaButtonLink))
+			frontMatterString(landerDetails.SecondCtaButtonText.CtaButtonLinkLabel),
+			frontMatterString(landerDetails.SecondCtaButtonText.CtaButtonLink)))
 
 		if landerDetails.CtaImageLink != "" {
 			yamlBuilder.WriteString("  image:\n")
-			yamlBuilder.WriteString(fmt.Sprintf("    src: %s\n", landerDetails.CtaImageLink))
+			yamlBuilder.WriteString(fmt.Sprintf("    src: %s\n", frontMatterString(landerDetails.CtaImageLink)))
 			yamlBuilder.WriteString("    alt: Kalmia Logo\n")
 		}
 
 		if len(landerDetails.Features) > 0 {
 			yamlBuilder.WriteString("features:\n")
 			for _, feature := range landerDetails.Features {
-				yamlBuilder.WriteString(fmt.Sprintf("  - title: %s\n", feature.Title))
-				yamlBuilder.WriteString(fmt.Sprintf("    details: %s\n", feature.Text))
-				yamlBuilder.WriteString(fmt.Sprintf("    icon: %s\n", utils.ConvertToEmoji(feature.Emoji)))
+				yamlBuilder.WriteString(fmt.Sprintf("  - title: %s\n", frontMatterString(feature.Title)))
+				yamlBuilder.WriteString(fmt.Sprintf("    details: %s\n", frontMatterString(feature.Text)))
+				yamlBuilder.WriteString(fmt.Sprintf("    icon: %s\n", frontMatterString(utils.ConvertToEmoji(feature.Emoji))))
 			}
 		}
 
 		yamlBuilder.WriteString("---\n\n")
 		yamlBuilder.WriteString("import { Meta } from '@components/Meta';\n\n")
 
-		metaTitle := documentation.Name
-		metaDescription := documentation.Description
-
-		var metaImage string
-
-		if documentation.MetaImage != "" {
-			metaImage = documentation.MetaImage
-		} else {
-			// TODO remove
-			metaImage = "https://downloads-bucket.difuse.io/kalmia-meta-resized.png"
-		}
-
-		meta := MetaData{
-			Title:       metaTitle,
-			Description: metaDescription,
-			Image:       metaImage,
-		}
-
-		metaJSON, err := json.Marshal(meta)
+		meta, err := metaComponent(MetaData{
+			Title:       documentation.Name,
+			Description: documentation.Description,
+			Image:       documentation.MetaImage,
+		})
 		if err != nil {
 			return err
 		}
 
-		yamlBuilder.WriteString(fmt.Sprintf(`<Meta rawJson='%s' />%s`, string(metaJSON), "\n\n"))
+		yamlBuilder.WriteString(meta + "\n\n")
 
 		homePage = yamlBuilder.String()
 		homePagePath = filepath.Join(contentPath, "../", "index.mdx")
 	} else {
-		head, err := service.GenerateHead(documentation.ID, math.MaxUint32, "doc")
+		head, err := service.generateHomeHead(documentation.ID, "doc", linkPrefix)
 		if err != nil {
 			logger.Error("Failed to generate head for home page", zap.Error(err))
 		}
@@ -1169,6 +1334,10 @@ func (service *DocService) RsPressBuild(docId uint, rebuild bool) error {
 		}
 	}
 
+	if err := service.writeSiteFiles(docId, buildPath); err != nil {
+		return fmt.Errorf("failed to write site files: %w", err)
+	}
+
 	filesContent, err := utils.Tree(buildPath)
 	if err != nil {
 		return err
@@ -1389,6 +1558,10 @@ func (service *DocService) BuildJob() {
 			} else {
 				logger.Info("successfully copied files to target", zap.Uint("doc_id", docID))
 			}
+
+			if err := service.StartLinkCheck(docID); err != nil && err.Error() != "link_check_running" {
+				logger.Error("Failed to start link check", zap.Uint("doc_id", docID), zap.Error(err))
+			}
 		}
 
 		for i := range groupTriggers {
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db"
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func rawDocumentationColumn(t *testing.T, id uint, column string) string {
+	t.Helper()
+
+	var value string
+	if err := TestDocService.DB.Table("documentations").Select(column).Where("id = ?", id).Row().Scan(&value); err != nil {
+		t.Fatalf("Failed to read %s: %v", column, err)
+	}
+	return value
+}
+
+func TestCredentialsEncryptedAtRest(t *testing.T) {
+	doc := createTestDocumentation(t, "Secrets Doc", "1.0.0", nil)
+	if err := TestDocService.DB.Model(&doc).Updates(models.Documentation{GitPassword: "hunter2", TokenSecret: "token-secret"}).Error; err != nil {
+		t.Fatalf("Failed to set credentials: %v", err)
+	}
+
+	raw := rawDocumentationColumn(t, doc.ID, "git_password")
+	if !db.IsEncryptedSecret(raw) || strings.Contains(raw, "hunter2") {
+		t.Fatalf("Expected the git password to be encrypted, got %q", raw)
+	}
+
+	var loaded models.Documentation
+	TestDocService.DB.First(&loaded, doc.ID)
+	if loaded.GitPassword != "hunter2" || loaded.TokenSecret != "token-secret" {
+		t.Fatalf("Expected the credentials to decrypt, got %q and %q", loaded.GitPassword, loaded.TokenSecret)
+	}
+
+	// rows written before encryption are migrated on startup
+	TestDocService.DB.Exec("UPDATE documentations SET token_secret = ? WHERE id = ?", "legacy-secret", doc.ID)
+	if err := db.SetupSecrets(TestDocService.DB, TestConfig); err != nil {
+		t.Fatalf("SetupSecrets returned an error: %v", err)
+	}
+	if raw := rawDocumentationColumn(t, doc.ID, "token_secret"); !db.IsEncryptedSecret(raw) {
+		t.Fatalf("Expected the plaintext row to be encrypted, got %q", raw)
+	}
+
+	oldMasterKey := TestConfig.Secret.MasterKey
+	newMasterKey, err := db.RotateMasterKey(TestDocService.DB, TestConfig, "")
+	if err != nil {
+		t.Fatalf("RotateMasterKey returned an error: %v", err)
+	}
+
+	secretFile, _ := os.ReadFile(TestConfig.PathToSecret)
+	if newMasterKey == oldMasterKey || !strings.Contains(string(secretFile), newMasterKey) || strings.Contains(string(secretFile), oldMasterKey) {
+		t.Fatalf("Expected the secret file to hold only the new master key")
+	}
+
+	if err := db.SetupSecrets(TestDocService.DB, TestConfig); err != nil {
+		t.Fatalf("Expected the rotated key to load, got %v", err)
+	}
+	loaded = models.Documentation{}
+	TestDocService.DB.First(&loaded, doc.ID)
+	if loaded.GitPassword != "hunter2" || loaded.TokenSecret != "legacy-secret" {
+		t.Fatalf("Expected the credentials to survive the rotation, got %q and %q", loaded.GitPassword, loaded.TokenSecret)
+	}
+
+	stale := *TestConfig
+	stale.Secret.MasterKey = oldMasterKey
+	if err := db.SetupSecrets(TestDocService.DB, &stale); err == nil || err.Error() != "invalid_master_key" {
+		t.Errorf("Expected the old master key to be rejected, got %v", err)
+	}
+
+	// a rotation interrupted after the secret file was written
+	interrupted := *TestConfig
+	interrupted.Secret.PreviousMasterKey = interrupted.Secret.MasterKey
+	interrupted.Secret.MasterKey, _ = db.NewMasterKey()
+	if err := db.SetupSecrets(TestDocService.DB, &interrupted); err != nil {
+		t.Fatalf("Expected the interrupted rotation to finish, got %v", err)
+	}
+	if interrupted.Secret.PreviousMasterKey != "" {
+		t.Errorf("Expected the previous master key to be dropped")
+	}
+	TestConfig.Secret = interrupted.Secret
+
+	encrypted, err := db.EncryptSecret("client-secret", db.ConfigSecretContext)
+	if err != nil {
+		t.Fatalf("EncryptSecret returned an error: %v", err)
+	}
+	if plain, err := db.DecryptSecret(encrypted, db.ConfigSecretContext); err != nil || plain != "client-secret" {
+		t.Errorf("Expected the config secret to decrypt, got %q (%v)", plain, err)
+	}
+	if _, err := db.DecryptSecret(encrypted, "git_password"); err == nil {
+		t.Errorf("Expected a secret not to decrypt in another context")
+	}
+}
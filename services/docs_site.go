@@ -0,0 +1,328 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+)
+
+const feedEntryLimit = 20
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   atomAuthor  `xml:"author"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string   `xml:"title"`
+	ID        string   `xml:"id"`
+	Link      atomLink `xml:"link"`
+	Published string   `xml:"published,omitempty"`
+	Updated   string   `xml:"updated"`
+	Summary   string   `xml:"summary,omitempty"`
+}
+
+func feedTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// siteURL is where a documentation is published: its URL followed by its
+// base URL.
+func siteURL(doc models.Documentation) string {
+	return strings.TrimSuffix(doc.URL, "/") + "/" + strings.Trim(doc.BaseURL, "/")
+}
+
+// pageFile is the file RsPress builds a route to, which is what the site
+// serves; an intro page is the index of its folder.
+func pageFile(route string, page models.Page) string {
+	if page.IsIntroPage {
+		return route + "/index.html"
+	}
+	return route + ".html"
+}
+
+// pageSummary is the text of the first paragraph of a page.
+func pageSummary(content string) string {
+	blocks, err := parseBlocks(content)
+	if err != nil {
+		return ""
+	}
+
+	for _, block := range blocks {
+		if b, ok := block.(map[string]interface{}); ok && b["type"] == "paragraph" {
+			if text := strings.TrimSpace(inlineText(b["content"])); text != "" {
+				runes := []rune(text)
+				if len(runes) > 280 {
+					return string(runes[:279]) + "…"
+				}
+				return text
+			}
+		}
+	}
+
+	return ""
+}
+
+// Sitemap lists every page of every version and locale of a documentation,
+// dated by when the page was last updated. Pages marked noindex are left out.
+func (service *DocService) Sitemap(rootId uint) ([]byte, error) {
+	root, err := service.GetDocumentation(rootId)
+	if err != nil {
+		return nil, err
+	}
+
+	versionInfos, err := service.buildVersionTree(rootId)
+	if err != nil {
+		return nil, err
+	}
+
+	urlSet := sitemapURLSet{URLs: []sitemapURL{}}
+
+	for _, versionInfo := range versionInfos {
+		if versionInfo.Hidden {
+			continue
+		}
+
+		prefixes, err := service.versionPathPrefixes(versionInfo.DocId)
+		if err != nil {
+			return nil, err
+		}
+
+		var pages []models.Page
+		if err := service.DB.Select("id", "documentation_id", "page_group_id", "slug", "is_intro_page", "updated_at").
+			Where("documentation_id = ? AND no_index = ?", versionInfo.DocId, false).Order("id").Find(&pages).Error; err != nil {
+			return nil, err
+		}
+
+		for _, page := range pages {
+			route, err := service.pageRoute(page)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, prefix := range prefixes {
+				urlSet.URLs = append(urlSet.URLs, sitemapURL{
+					Loc:     siteURL(root) + prefix + pageFile(route, page),
+					LastMod: feedTime(page.UpdatedAt),
+				})
+			}
+		}
+	}
+
+	out, err := xml.MarshalIndent(urlSet, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
+
+// Feed is an Atom feed of the most recently added or changed pages of the
+// latest version of a documentation.
+func (service *DocService) Feed(rootId uint) ([]byte, error) {
+	root, err := service.GetDocumentation(rootId)
+	if err != nil {
+		return nil, err
+	}
+
+	latestVersion, _, err := service.GetAllVersions(rootId)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest models.Documentation
+	if err := service.DB.Select("id").Where("(id = ? OR cloned_from = ?) AND version = ?", rootId, rootId, latestVersion).
+		First(&latest).Error; err != nil {
+		return nil, fmt.Errorf("documentation_not_found")
+	}
+
+	var pages []models.Page
+	if err := service.DB.Where("documentation_id = ? AND no_index = ?", latest.ID, false).
+		Order("updated_at DESC").Limit(feedEntryLimit).Find(&pages).Error; err != nil {
+		return nil, err
+	}
+
+	site := siteURL(root)
+	author := root.OrganizationName
+	if author == "" {
+		author = root.Name
+	}
+
+	feed := atomFeed{
+		Title:    root.Name,
+		Subtitle: root.Description,
+		ID:       site + "/",
+		Updated:  feedTime(root.UpdatedAt),
+		Links: []atomLink{
+			{Href: site + "/feed.xml", Rel: "self", Type: "application/atom+xml"},
+			{Href: site + "/", Rel: "alternate", Type: "text/html"},
+		},
+		Author: atomAuthor{Name: author},
+	}
+
+	for _, page := range pages {
+		route, err := service.pageRoute(page)
+		if err != nil {
+			return nil, err
+		}
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     page.Title,
+			ID:        fmt.Sprintf("%s/#page-%d", site, page.ID),
+			Link:      atomLink{Href: site + pageFile(route, page), Rel: "alternate", Type: "text/html"},
+			Published: feedTime(page.CreatedAt),
+			Updated:   feedTime(page.UpdatedAt),
+			Summary:   pageSummary(page.Content),
+		})
+	}
+
+	if len(pages) > 0 && pages[0].UpdatedAt != nil && (root.UpdatedAt == nil || pages[0].UpdatedAt.After(*root.UpdatedAt)) {
+		feed.Updated = feedTime(pages[0].UpdatedAt)
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), out...), nil
+}
+
+// robotsRules are the rules of one documentation. A documentation that
+// requires authentication is disallowed as a whole; otherwise the Allow and
+// Disallow lines of its RobotsTxt apply, with paths relative to its base URL.
+func robotsRules(doc models.Documentation) []string {
+	base := "/" + strings.Trim(doc.BaseURL, "/")
+	if doc.RequireAuth {
+		return []string{"Disallow: " + base + "/"}
+	}
+
+	rules := []string{"Allow: " + base + "/"}
+	for _, line := range strings.Split(doc.RobotsTxt, "\n") {
+		directive, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive != "allow" && directive != "disallow" {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if !strings.HasPrefix(value, "/") {
+			value = "/" + value
+		}
+
+		rules = append(rules, strings.ToUpper(directive[:1])+directive[1:]+": "+base+value)
+	}
+
+	return rules
+}
+
+func writeRobots(builder *strings.Builder, docs []models.Documentation) {
+	builder.WriteString("User-agent: *\n")
+	for _, doc := range docs {
+		for _, rule := range robotsRules(doc) {
+			builder.WriteString(rule + "\n")
+		}
+	}
+
+	for _, doc := range docs {
+		if !doc.RequireAuth && doc.URL != "" {
+			builder.WriteString("\nSitemap: " + siteURL(doc) + "/sitemap.xml")
+		}
+	}
+	builder.WriteString("\n")
+}
+
+// RobotsTxt is the robots.txt of the whole site, which holds the rules of
+// every documentation served by Kalmia.
+func (service *DocService) RobotsTxt() (string, error) {
+	var docs []models.Documentation
+	if err := service.DB.Select("id", "url", "base_url", "require_auth", "robots_txt").
+		Where("cloned_from IS NULL").Order("base_url").Find(&docs).Error; err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	writeRobots(&builder, docs)
+
+	return builder.String(), nil
+}
+
+// writeSiteFiles writes sitemap.xml, feed.xml and robots.txt into a build,
+// where they are served from the base URL like any other built file. The
+// sitemap and the feed need absolute URLs and are left out while the
+// documentation has no URL.
+func (service *DocService) writeSiteFiles(rootId uint, buildPath string) error {
+	if !utils.PathExists(buildPath) {
+		return nil
+	}
+
+	root, err := service.GetDocumentation(rootId)
+	if err != nil {
+		return err
+	}
+
+	var robots strings.Builder
+	writeRobots(&robots, []models.Documentation{root})
+
+	if err := utils.WriteToFile(filepath.Join(buildPath, "robots.txt"), robots.String()); err != nil {
+		return err
+	}
+
+	if root.URL == "" {
+		return nil
+	}
+
+	sitemap, err := service.Sitemap(rootId)
+	if err != nil {
+		return err
+	}
+
+	if err := utils.WriteToFile(filepath.Join(buildPath, "sitemap.xml"), string(sitemap)); err != nil {
+		return err
+	}
+
+	feed, err := service.Feed(rootId)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteToFile(filepath.Join(buildPath, "feed.xml"), string(feed))
+}
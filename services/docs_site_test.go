@@ -0,0 +1,114 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+)
+
+func TestRobotsRules(t *testing.T) {
+	public := models.Documentation{BaseURL: "/public", RobotsTxt: "Disallow: /drafts/\nUser-agent: evil\nallow: api"}
+	private := models.Documentation{BaseURL: "/private/", RequireAuth: true, RobotsTxt: "Allow: /"}
+
+	if rules := strings.Join(robotsRules(public), "|"); rules != "Allow: /public/|Disallow: /public/drafts/|Allow: /public/api" {
+		t.Errorf("Unexpected public rules %q", rules)
+	}
+
+	if rules := strings.Join(robotsRules(private), "|"); rules != "Disallow: /private/" {
+		t.Errorf("Unexpected private rules %q", rules)
+	}
+}
+
+func TestSiteFiles(t *testing.T) {
+	doc := createTestDocumentation(t, "Site Doc", "1.0.0", nil)
+	if err := TestDocService.DB.Model(&doc).Updates(map[string]interface{}{
+		"url":        "https://docs.example.com/",
+		"created_at": time.Now().Add(-time.Hour),
+	}).Error; err != nil {
+		t.Fatalf("Failed to update documentation: %v", err)
+	}
+
+	version := createTestDocumentation(t, "Site Doc", "2.0.0", &doc.ID)
+	group := createTestPageGroup(t, version.ID, nil, "Setup", 1)
+	intro := createTestPage(t, version.ID, &group.ID, "/intro", 1)
+	install := createTestPage(t, version.ID, &group.ID, "/install", 2)
+	createTestPage(t, doc.ID, nil, "/old", 1)
+
+	if err := TestDocService.DB.Model(&intro).Update("is_intro_page", true).Error; err != nil {
+		t.Fatalf("Failed to update page: %v", err)
+	}
+
+	content := `[{"id":"b1","type":"paragraph","props":{},"content":[{"type":"text","text":"Run the installer.","styles":{}}],"children":[]}]`
+	if err := TestDocService.DB.Model(&install).Updates(map[string]interface{}{"content": content, "updated_at": time.Now().Add(time.Minute)}).Error; err != nil {
+		t.Fatalf("Failed to update page: %v", err)
+	}
+
+	buildPath := filepath.Join(TestConfig.DataPath, "site_test_build")
+	if err := utils.MakeDir(buildPath); err != nil {
+		t.Fatalf("Failed to create build dir: %v", err)
+	}
+
+	if err := TestDocService.writeSiteFiles(doc.ID, buildPath); err != nil {
+		t.Fatalf("writeSiteFiles returned an error: %v", err)
+	}
+
+	sitemap, err := os.ReadFile(filepath.Join(buildPath, "sitemap.xml"))
+	if err != nil {
+		t.Fatalf("Failed to read sitemap: %v", err)
+	}
+
+	for _, loc := range []string{
+		"<loc>https://docs.example.com/site-doc/guides/setup/index.html</loc>",
+		"<loc>https://docs.example.com/site-doc/guides/setup/install.html</loc>",
+		"<loc>https://docs.example.com/site-doc/1.0.0/guides/old.html</loc>",
+	} {
+		if !strings.Contains(string(sitemap), loc) {
+			t.Errorf("Expected sitemap to contain %s:\n%s", loc, sitemap)
+		}
+	}
+
+	if !strings.Contains(string(sitemap), "<lastmod>") {
+		t.Errorf("Expected sitemap entries to have a lastmod:\n%s", sitemap)
+	}
+
+	feed, err := os.ReadFile(filepath.Join(buildPath, "feed.xml"))
+	if err != nil {
+		t.Fatalf("Failed to read feed: %v", err)
+	}
+
+	entries := strings.Split(string(feed), "<entry>")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 2 feed entries for the latest version, got %d:\n%s", len(entries)-1, feed)
+	}
+
+	if !strings.Contains(entries[1], "<title>/install</title>") || !strings.Contains(entries[1], "<summary>Run the installer.</summary>") {
+		t.Errorf("Expected the most recently updated page first:\n%s", entries[1])
+	}
+
+	robots, err := os.ReadFile(filepath.Join(buildPath, "robots.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read robots.txt: %v", err)
+	}
+
+	if !strings.Contains(string(robots), "Allow: /site-doc/") || !strings.Contains(string(robots), "Sitemap: https://docs.example.com/site-doc/sitemap.xml") {
+		t.Errorf("Unexpected robots.txt:\n%s", robots)
+	}
+
+	if err := TestDocService.DB.Model(&doc).Update("require_auth", true).Error; err != nil {
+		t.Fatalf("Failed to update documentation: %v", err)
+	}
+
+	siteRobots, err := TestDocService.RobotsTxt()
+	if err != nil {
+		t.Fatalf("RobotsTxt returned an error: %v", err)
+	}
+
+	if !strings.Contains(siteRobots, "Disallow: /site-doc/") || strings.Contains(siteRobots, "site-doc/sitemap.xml") {
+		t.Errorf("Expected the documentation to be disallowed:\n%s", siteRobots)
+	}
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"gorm.io/gorm"
+)
+
+// snippetBlockType is the BlockNote block a page embeds a snippet with, as in
+// {"type": "snippet", "props": {"snippetId": "12"}}.
+const snippetBlockType = "snippet"
+
+type SnippetUsage struct {
+	PageID          uint   `json:"pageId"`
+	DocumentationID uint   `json:"documentationId"`
+	Title           string `json:"title"`
+	Locale          string `json:"locale,omitempty"`
+	SnippetID       uint   `json:"snippetId"` // the snippet the page embeds, which may embed this one
+}
+
+// snippetRef returns the snippet a block embeds, if it is a snippet block.
+func snippetRef(block map[string]interface{}) (uint, bool) {
+	if block["type"] != snippetBlockType {
+		return 0, false
+	}
+
+	props, _ := block["props"].(map[string]interface{})
+	switch id := props["snippetId"].(type) {
+	case string:
+		parsed, err := strconv.ParseUint(id, 10, 32)
+		return uint(parsed), err == nil
+	case float64:
+		return uint(id), id > 0
+	}
+
+	return 0, false
+}
+
+// collectSnippetRefs adds the snippets embedded anywhere in value to refs.
+func collectSnippetRefs(value interface{}, refs map[uint]bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			collectSnippetRefs(item, refs)
+		}
+	case map[string]interface{}:
+		if id, ok := snippetRef(v); ok {
+			refs[id] = true
+			return
+		}
+		collectSnippetRefs(v["children"], refs)
+	}
+}
+
+func contentSnippetRefs(content string) map[uint]bool {
+	refs := make(map[uint]bool)
+	if blocks, err := parseBlocks(content); err == nil {
+		collectSnippetRefs(blocks, refs)
+	}
+	return refs
+}
+
+// expandSnippetBlocks replaces snippet blocks with the blocks of the snippet
+// they embed. Snippets of other documentations, missing snippets and
+// snippets that would embed themselves render as nothing.
+func (service *DocService) expandSnippetBlocks(blocks []interface{}, rootId uint, parents map[uint]bool) ([]interface{}, error) {
+	expanded := make([]interface{}, 0, len(blocks))
+
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			expanded = append(expanded, item)
+			continue
+		}
+
+		id, isSnippet := snippetRef(block)
+		if !isSnippet {
+			if children, ok := block["children"].([]interface{}); ok && len(children) > 0 {
+				children, err := service.expandSnippetBlocks(children, rootId, parents)
+				if err != nil {
+					return nil, err
+				}
+				block["children"] = children
+			}
+			expanded = append(expanded, block)
+			continue
+		}
+
+		if parents[id] {
+			continue
+		}
+
+		var snippet models.Snippet
+		if err := service.DB.First(&snippet, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		if snippet.DocumentationID != nil && *snippet.DocumentationID != rootId {
+			continue
+		}
+
+		snippetBlocks, err := parseBlocks(snippet.Content)
+		if err != nil {
+			continue
+		}
+
+		parents[id] = true
+		snippetBlocks, err = service.expandSnippetBlocks(snippetBlocks, rootId, parents)
+		delete(parents, id)
+		if err != nil {
+			return nil, err
+		}
+
+		expanded = append(expanded, snippetBlocks...)
+	}
+
+	return expanded, nil
+}
+
+// expandSnippets returns page content with its snippets expanded, as it is
+// built.
+func (service *DocService) expandSnippets(content string, rootId uint) (string, error) {
+	if len(contentSnippetRefs(content)) == 0 {
+		return content, nil
+	}
+
+	blocks, err := parseBlocks(content)
+	if err != nil {
+		return "", err
+	}
+
+	blocks, err = service.expandSnippetBlocks(blocks, rootId, make(map[uint]bool))
+	if err != nil {
+		return "", err
+	}
+
+	expanded, err := json.Marshal(blocks)
+	if err != nil {
+		return "", err
+	}
+
+	return string(expanded), nil
+}
+
+// GetSnippets lists the global snippets and, for a documentation, its own.
+func (service *DocService) GetSnippets(docId uint) ([]models.Snippet, error) {
+	query := service.DB.Where("documentation_id IS NULL")
+
+	if docId != 0 {
+		rootId, err := service.GetRootParentID(docId)
+		if err != nil {
+			return nil, fmt.Errorf("documentation_not_found")
+		}
+		query = query.Or("documentation_id = ?", rootId)
+	}
+
+	var snippets []models.Snippet
+	if err := query.Order("name").Find(&snippets).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_snippets")
+	}
+
+	return snippets, nil
+}
+
+func (service *DocService) GetSnippet(id uint) (models.Snippet, error) {
+	var snippet models.Snippet
+	if err := service.DB.First(&snippet, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Snippet{}, fmt.Errorf("snippet_not_found")
+		}
+		return models.Snippet{}, fmt.Errorf("failed_to_get_snippet")
+	}
+
+	return snippet, nil
+}
+
+func validateSnippetContent(content string) error {
+	var blocks []interface{}
+	if err := json.Unmarshal([]byte(content), &blocks); err != nil {
+		return fmt.Errorf("invalid_snippet_content")
+	}
+
+	return nil
+}
+
+// CreateSnippet creates a snippet of a documentation, or a global one when
+// docId is 0. Global snippets reach every documentation, so only admins
+// manage them.
+func (service *DocService) CreateSnippet(user models.User, docId uint, name string, content string) (models.Snippet, error) {
+	if err := validateSnippetContent(content); err != nil {
+		return models.Snippet{}, err
+	}
+
+	if docId == 0 && !user.Admin {
+		return models.Snippet{}, fmt.Errorf("global_snippet_requires_admin")
+	}
+
+	snippet := models.Snippet{
+		Name:         name,
+		Content:      content,
+		AuthorID:     user.ID,
+		LastEditorID: &user.ID,
+	}
+
+	if docId != 0 {
+		rootId, err := service.GetRootParentID(docId)
+		if err != nil {
+			return models.Snippet{}, fmt.Errorf("documentation_not_found")
+		}
+		snippet.DocumentationID = &rootId
+	}
+
+	if err := service.DB.Create(&snippet).Error; err != nil {
+		return models.Snippet{}, fmt.Errorf("failed_to_create_snippet")
+	}
+
+	return snippet, nil
+}
+
+// EditSnippet updates a snippet and rebuilds every documentation with a page
+// that embeds it.
+func (service *DocService) EditSnippet(user models.User, id uint, name string, content string) (models.Snippet, error) {
+	if err := validateSnippetContent(content); err != nil {
+		return models.Snippet{}, err
+	}
+
+	snippet, err := service.GetSnippet(id)
+	if err != nil {
+		return models.Snippet{}, err
+	}
+
+	if snippet.DocumentationID == nil && !user.Admin {
+		return models.Snippet{}, fmt.Errorf("global_snippet_requires_admin")
+	}
+
+	snippet.Name = name
+	snippet.Content = content
+	snippet.LastEditorID = &user.ID
+
+	if err := service.DB.Save(&snippet).Error; err != nil {
+		return models.Snippet{}, fmt.Errorf("failed_to_update_snippet")
+	}
+
+	usage, err := service.GetSnippetUsage(id)
+	if err != nil {
+		return models.Snippet{}, err
+	}
+
+	rebuilt := make(map[uint]bool)
+	for _, use := range usage {
+		rootId, err := service.GetRootParentID(use.DocumentationID)
+		if err != nil || rebuilt[rootId] {
+			continue
+		}
+
+		rebuilt[rootId] = true
+		if err := service.AddBuildTrigger(rootId, false); err != nil {
+			return models.Snippet{}, fmt.Errorf("failed_to_update_write_build")
+		}
+	}
+
+	return snippet, nil
+}
+
+// DeleteSnippet deletes a snippet that no page embeds.
+func (service *DocService) DeleteSnippet(user models.User, id uint) error {
+	snippet, err := service.GetSnippet(id)
+	if err != nil {
+		return err
+	}
+
+	if snippet.DocumentationID == nil && !user.Admin {
+		return fmt.Errorf("global_snippet_requires_admin")
+	}
+
+	usage, err := service.GetSnippetUsage(id)
+	if err != nil {
+		return err
+	}
+
+	if len(usage) > 0 {
+		return fmt.Errorf("snippet_in_use")
+	}
+
+	if err := service.DB.Delete(&models.Snippet{}, id).Error; err != nil {
+		return fmt.Errorf("failed_to_delete_snippet")
+	}
+
+	return nil
+}
+
+// embeddingSnippets returns the snippet and every snippet that embeds it,
+// directly or through other snippets.
+func (service *DocService) embeddingSnippets(id uint) (map[uint]bool, error) {
+	var snippets []models.Snippet
+	if err := service.DB.Select("id", "content").Find(&snippets).Error; err != nil {
+		return nil, err
+	}
+
+	embeddedBy := make(map[uint][]uint)
+	for _, snippet := range snippets {
+		for ref := range contentSnippetRefs(snippet.Content) {
+			embeddedBy[ref] = append(embeddedBy[ref], snippet.ID)
+		}
+	}
+
+	found := map[uint]bool{id: true}
+	queue := []uint{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, parent := range embeddedBy[current] {
+			if !found[parent] {
+				found[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// GetSnippetUsage lists the pages and page translations that embed a
+// snippet, directly or through another snippet.
+func (service *DocService) GetSnippetUsage(id uint) ([]SnippetUsage, error) {
+	if _, err := service.GetSnippet(id); err != nil {
+		return nil, err
+	}
+
+	snippetIDs, err := service.embeddingSnippets(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed_to_get_snippet_usage")
+	}
+
+	var candidates []struct {
+		PageID          uint
+		DocumentationID uint
+		Title           string
+		Locale          string
+		Content         string
+	}
+
+	pattern := `%"` + snippetBlockType + `"%`
+
+	if err := service.DB.Table("pages").Select("id AS page_id, documentation_id, title, '' AS locale, content").
+		Where("content LIKE ?", pattern).Scan(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_snippet_usage")
+	}
+
+	var translations []struct {
+		PageID          uint
+		DocumentationID uint
+		Title           string
+		Locale          string
+		Content         string
+	}
+
+	if err := service.DB.Table("page_translations").
+		Select("page_translations.page_id, pages.documentation_id, page_translations.title, page_translations.locale, page_translations.content").
+		Joins("JOIN pages ON pages.id = page_translations.page_id").
+		Where("page_translations.content LIKE ?", pattern).Scan(&translations).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_snippet_usage")
+	}
+
+	candidates = append(candidates, translations...)
+
+	usage := []SnippetUsage{}
+	for _, candidate := range candidates {
+		refs := contentSnippetRefs(candidate.Content)
+
+		var embedded []uint
+		for ref := range refs {
+			if snippetIDs[ref] {
+				embedded = append(embedded, ref)
+			}
+		}
+
+		if len(embedded) == 0 {
+			continue
+		}
+
+		sort.Slice(embedded, func(i, j int) bool { return embedded[i] < embedded[j] })
+
+		usage = append(usage, SnippetUsage{
+			PageID:          candidate.PageID,
+			DocumentationID: candidate.DocumentationID,
+			Title:           candidate.Title,
+			Locale:          candidate.Locale,
+			SnippetID:       embedded[0],
+		})
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].PageID != usage[j].PageID {
+			return usage[i].PageID < usage[j].PageID
+		}
+		return usage[i].Locale < usage[j].Locale
+	})
+
+	return usage, nil
+}
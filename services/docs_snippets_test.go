@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func snippetTestBlock(text string) string {
+	return fmt.Sprintf(`{"id":"%s","type":"paragraph","props":{},"content":[{"type":"text","text":"%s","styles":{}}],"children":[]}`, text, text)
+}
+
+func snippetTestRef(id uint) string {
+	return fmt.Sprintf(`{"id":"ref-%d","type":"snippet","props":{"snippetId":"%d"},"children":[]}`, id, id)
+}
+
+func TestSnippets(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Snippet Doc", "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/snippets", 1)
+
+	if _, err := TestDocService.CreateSnippet(models.User{ID: admin.ID}, 0, "Support", "[]"); err == nil || err.Error() != "global_snippet_requires_admin" {
+		t.Errorf("Expected 'global_snippet_requires_admin' error, got %v", err)
+	}
+
+	support, err := TestDocService.CreateSnippet(admin, 0, "Support", "["+snippetTestBlock("Contact support")+"]")
+	if err != nil {
+		t.Fatalf("CreateSnippet returned an error: %v", err)
+	}
+
+	warning, err := TestDocService.CreateSnippet(admin, doc.ID, "Warning", "["+snippetTestBlock("Back up first")+","+snippetTestRef(support.ID)+"]")
+	if err != nil {
+		t.Fatalf("CreateSnippet returned an error: %v", err)
+	}
+
+	other := createTestDocumentation(t, "Other Snippet Doc", "1.0.0", nil)
+	foreign, err := TestDocService.CreateSnippet(admin, other.ID, "Foreign", "["+snippetTestBlock("Not here")+"]")
+	if err != nil {
+		t.Fatalf("CreateSnippet returned an error: %v", err)
+	}
+
+	content := "[" + snippetTestBlock("Intro") + "," + snippetTestRef(warning.ID) + "," + snippetTestRef(foreign.ID) + "]"
+	if err := TestDocService.DB.Model(&page).Update("content", content).Error; err != nil {
+		t.Fatalf("Failed to set page content: %v", err)
+	}
+
+	mdx, err := TestDocService.CraftPage(page, page.Title, content)
+	if err != nil {
+		t.Fatalf("CraftPage returned an error: %v", err)
+	}
+
+	intro, backup, contact := strings.Index(mdx, "Intro"), strings.Index(mdx, "Back up first"), strings.Index(mdx, "Contact support")
+	if intro < 0 || backup < intro || contact < backup {
+		t.Errorf("Expected nested snippets to be expanded in place:\n%s", mdx)
+	}
+
+	if strings.Contains(mdx, "Not here") {
+		t.Errorf("Expected another documentation's snippet not to be expanded:\n%s", mdx)
+	}
+
+	usage, err := TestDocService.GetSnippetUsage(support.ID)
+	if err != nil {
+		t.Fatalf("GetSnippetUsage returned an error: %v", err)
+	}
+
+	if len(usage) != 1 || usage[0].PageID != page.ID || usage[0].SnippetID != warning.ID {
+		t.Fatalf("Expected the page to use the snippet through the warning, got %+v", usage)
+	}
+
+	if err := TestDocService.DeleteSnippet(admin, support.ID); err == nil || err.Error() != "snippet_in_use" {
+		t.Errorf("Expected 'snippet_in_use' error, got %v", err)
+	}
+
+	// A snippet that embeds itself must not expand forever.
+	if _, err := TestDocService.EditSnippet(admin, support.ID, "Support", "["+snippetTestBlock("Contact us")+","+snippetTestRef(warning.ID)+"]"); err != nil {
+		t.Fatalf("EditSnippet returned an error: %v", err)
+	}
+
+	var trigger models.BuildTriggers
+	if err := TestDocService.DB.Where("documentation_id = ?", doc.ID).Order("id DESC").First(&trigger).Error; err != nil {
+		t.Errorf("Expected editing the snippet to trigger a build: %v", err)
+	}
+
+	mdx, err = TestDocService.CraftPage(page, page.Title, content)
+	if err != nil {
+		t.Fatalf("CraftPage returned an error: %v", err)
+	}
+
+	if strings.Count(mdx, `"text":"Back up first"`) != 1 || !strings.Contains(mdx, "Contact us") {
+		t.Errorf("Expected the cycle to be expanded once:\n%s", mdx)
+	}
+}
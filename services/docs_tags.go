@@ -0,0 +1,274 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"gorm.io/gorm"
+)
+
+func (service *DocService) GetTags(docId uint) ([]models.Tag, error) {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return nil, fmt.Errorf("documentation_not_found")
+	}
+
+	var tags []models.Tag
+	if err := service.DB.Where("documentation_id = ?", rootId).Order("category, name").Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_tags")
+	}
+
+	return tags, nil
+}
+
+func (service *DocService) getTag(id uint) (models.Tag, error) {
+	var tag models.Tag
+	if err := service.DB.First(&tag, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Tag{}, fmt.Errorf("tag_not_found")
+		}
+		return models.Tag{}, fmt.Errorf("failed_to_get_tag")
+	}
+
+	return tag, nil
+}
+
+// saveTag derives the slug from the name, which is what tag pages are named
+// after, so two tags of a documentation cannot share a name.
+func (service *DocService) saveTag(tag *models.Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	tag.Category = strings.TrimSpace(tag.Category)
+	if tag.Name == "" {
+		return fmt.Errorf("invalid_tag_name")
+	}
+
+	tag.Slug = utils.StringToFileString(tag.Name)
+
+	var count int64
+	if err := service.DB.Model(&models.Tag{}).Where("documentation_id = ? AND slug = ? AND id <> ?", tag.DocumentationID, tag.Slug, tag.ID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed_to_save_tag")
+	}
+
+	if count > 0 {
+		return fmt.Errorf("tag_already_exists")
+	}
+
+	if err := service.DB.Save(tag).Error; err != nil {
+		return fmt.Errorf("failed_to_save_tag")
+	}
+
+	return service.AddBuildTrigger(tag.DocumentationID, false)
+}
+
+func (service *DocService) CreateTag(docId uint, name string, category string, description string) (models.Tag, error) {
+	rootId, err := service.GetRootParentID(docId)
+	if err != nil {
+		return models.Tag{}, fmt.Errorf("documentation_not_found")
+	}
+
+	tag := models.Tag{
+		DocumentationID: rootId,
+		Name:            name,
+		Category:        category,
+		Description:     description,
+	}
+
+	if err := service.saveTag(&tag); err != nil {
+		return models.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+func (service *DocService) EditTag(id uint, name string, category string, description string) (models.Tag, error) {
+	tag, err := service.getTag(id)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	tag.Name = name
+	tag.Category = category
+	tag.Description = description
+
+	if err := service.saveTag(&tag); err != nil {
+		return models.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+func (service *DocService) DeleteTag(id uint) error {
+	tag, err := service.getTag(id)
+	if err != nil {
+		return err
+	}
+
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM page_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed_to_delete_tag")
+	}
+
+	return service.AddBuildTrigger(tag.DocumentationID, false)
+}
+
+// SetPageTags replaces the tags of a page. The tags must belong to the
+// documentation of the page.
+func (service *DocService) SetPageTags(pageId uint, tagIds []uint) error {
+	var page models.Page
+	if err := service.DB.Select("id", "documentation_id").First(&page, pageId).Error; err != nil {
+		return fmt.Errorf("page_not_found")
+	}
+
+	rootId, err := service.GetRootParentID(page.DocumentationID)
+	if err != nil {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	tags := []models.Tag{}
+	if len(tagIds) > 0 {
+		if err := service.DB.Where("id IN ? AND documentation_id = ?", tagIds, rootId).Find(&tags).Error; err != nil {
+			return fmt.Errorf("failed_to_get_tags")
+		}
+	}
+
+	seen := make(map[uint]bool)
+	for _, id := range tagIds {
+		seen[id] = true
+	}
+
+	if len(tags) != len(seen) {
+		return fmt.Errorf("tag_not_found")
+	}
+
+	if err := service.DB.Model(&page).Association("Tags").Replace(tags); err != nil {
+		return fmt.Errorf("failed_to_set_page_tags")
+	}
+
+	return service.AddBuildTrigger(rootId, false)
+}
+
+// copyPageTags tags the pages of a new version like the pages they were
+// copied from.
+func copyPageTags(tx *gorm.DB, pageMap map[uint]uint) error {
+	for oldID, newID := range pageMap {
+		if err := tx.Exec("INSERT INTO page_tags (page_id, tag_id) SELECT ?, tag_id FROM page_tags WHERE page_id = ?", newID, oldID).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTagPages writes an index of the tags used in a version and a page per
+// tag that lists the pages tagged with it. It reports whether there were any
+// tags, so the navigation only links to the index when it exists.
+func (service *DocService) writeTagPages(versionDoc models.Documentation, contentRoot string, linkPrefix string, translations *translationSet) (bool, error) {
+	tagsPath := filepath.Join(contentRoot, "tags")
+	if err := utils.RemovePath(tagsPath); err != nil {
+		return false, err
+	}
+
+	var tags []models.Tag
+	if err := service.DB.Model(&models.Tag{}).Distinct("tags.*").
+		Joins("JOIN page_tags ON page_tags.tag_id = tags.id").
+		Joins("JOIN pages ON pages.id = page_tags.page_id").
+		Where("pages.documentation_id = ?", versionDoc.ID).
+		Order("tags.category, tags.name").Find(&tags).Error; err != nil {
+		return false, err
+	}
+
+	if len(tags) == 0 {
+		return false, nil
+	}
+
+	if err := utils.MakeDir(tagsPath); err != nil {
+		return false, err
+	}
+
+	prefixes, err := service.versionPathPrefixes(versionDoc.ID)
+	if err != nil {
+		return false, err
+	}
+
+	base := "/" + strings.Trim(versionDoc.BaseURL, "/") + prefixes[0] + linkPrefix
+
+	var index strings.Builder
+	index.WriteString("---\npageType: doc\nfooter: true\ntitle: Tags\n---\n\n# Tags\n")
+
+	metaElements := []MetaElement{{Type: "file", Name: "index", Label: "Tags", Path: "/"}}
+
+	for i, tag := range tags {
+		var pages []models.Page
+		if err := service.DB.Joins("JOIN page_tags ON page_tags.page_id = pages.id").
+			Where("page_tags.tag_id = ? AND pages.documentation_id = ?", tag.ID, versionDoc.ID).
+			Find(&pages).Error; err != nil {
+			return false, err
+		}
+
+		sort.SliceStable(pages, func(a, b int) bool {
+			return translations.pageTitle(pages[a]) < translations.pageTitle(pages[b])
+		})
+
+		var tagPage strings.Builder
+		tagPage.WriteString(fmt.Sprintf("---\npageType: doc\nfooter: true\ntitle: %s\n---\n\n", frontMatterString(tag.Name)))
+		tagPage.WriteString(fmt.Sprintf("# %s\n\n", mdxText(tag.Name)))
+		if tag.Description != "" {
+			tagPage.WriteString(mdxText(tag.Description) + "\n\n")
+		}
+
+		for _, page := range pages {
+			route, err := service.pageRoute(page)
+			if err != nil {
+				return false, err
+			}
+			tagPage.WriteString(fmt.Sprintf("- [%s](%s)\n", mdxText(translations.pageTitle(page)), base+pageFile(route, page)))
+		}
+
+		if err := utils.WriteToFile(filepath.Join(tagsPath, tag.Slug+".mdx"), tagPage.String()); err != nil {
+			return false, err
+		}
+
+		if i == 0 || tag.Category != tags[i-1].Category {
+			index.WriteString("\n")
+			if tag.Category != "" {
+				index.WriteString(fmt.Sprintf("## %s\n\n", mdxText(tag.Category)))
+			}
+		}
+
+		index.WriteString(fmt.Sprintf("- [%s](%s/tags/%s.html) (%d)\n", mdxText(tag.Name), base, tag.Slug, len(pages)))
+
+		metaElements = append(metaElements, MetaElement{
+			Type:  "file",
+			Name:  tag.Slug,
+			Label: tag.Name,
+			Path:  "/" + tag.Slug,
+			Order: uint(i + 1),
+		})
+	}
+
+	if err := utils.WriteToFile(filepath.Join(tagsPath, "index.mdx"), index.String()); err != nil {
+		return false, err
+	}
+
+	if err := writeMetaJSON(metaElements, tagsPath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// mdxText escapes the characters that MDX would read as markup.
+func mdxText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "{", `\{`, "}", `\}`, "<", `\<`, ">", `\>`, "*", `\*`, "_", `\_`).Replace(text)
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestTags(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Tag Doc", "1.0.0", nil)
+	group := createTestPageGroup(t, doc.ID, nil, "Setup", 1)
+	install := createTestPage(t, doc.ID, &group.ID, "/install", 1)
+	upgrade := createTestPage(t, doc.ID, nil, "/upgrade", 2)
+
+	admins, err := TestDocService.CreateTag(doc.ID, "Administrators", "Audience", "Pages for [admins]")
+	if err != nil {
+		t.Fatalf("CreateTag returned an error: %v", err)
+	}
+
+	if admins.Slug != "administrators" {
+		t.Errorf("Expected slug 'administrators', got %q", admins.Slug)
+	}
+
+	rest, err := TestDocService.CreateTag(doc.ID, "REST API", "", "")
+	if err != nil {
+		t.Fatalf("CreateTag returned an error: %v", err)
+	}
+
+	if _, err := TestDocService.CreateTag(doc.ID, "rest-api", "", ""); err == nil || err.Error() != "tag_already_exists" {
+		t.Errorf("Expected 'tag_already_exists' error, got %v", err)
+	}
+
+	other := createTestDocumentation(t, "Other Tag Doc", "1.0.0", nil)
+	foreign, err := TestDocService.CreateTag(other.ID, "Foreign", "", "")
+	if err != nil {
+		t.Fatalf("CreateTag returned an error: %v", err)
+	}
+
+	if err := TestDocService.SetPageTags(install.ID, []uint{admins.ID, foreign.ID}); err == nil || err.Error() != "tag_not_found" {
+		t.Errorf("Expected 'tag_not_found' error for another documentation's tag, got %v", err)
+	}
+
+	if err := TestDocService.SetPageTags(install.ID, []uint{admins.ID, rest.ID}); err != nil {
+		t.Fatalf("SetPageTags returned an error: %v", err)
+	}
+
+	if err := TestDocService.SetPageTags(upgrade.ID, []uint{admins.ID}); err != nil {
+		t.Fatalf("SetPageTags returned an error: %v", err)
+	}
+
+	pages, err := TestDocService.GetPages(rest.ID)
+	if err != nil {
+		t.Fatalf("GetPages returned an error: %v", err)
+	}
+
+	if len(pages) != 1 || pages[0].ID != install.ID || len(pages[0].Tags) != 2 {
+		t.Fatalf("Expected only the install page with its two tags, got %+v", pages)
+	}
+
+	contentRoot := filepath.Join(TestConfig.DataPath, "tag_test_content")
+	hasTags, err := TestDocService.writeTagPages(doc, contentRoot, "", nil)
+	if err != nil || !hasTags {
+		t.Fatalf("writeTagPages returned %v, %v", hasTags, err)
+	}
+
+	tagPage, err := os.ReadFile(filepath.Join(contentRoot, "tags", "administrators.mdx"))
+	if err != nil {
+		t.Fatalf("Failed to read tag page: %v", err)
+	}
+
+	for _, expected := range []string{
+		`Pages for \[admins\]`,
+		"- [/install](/tag-doc/guides/setup/install.html)\n- [/upgrade](/tag-doc/guides/upgrade.html)\n",
+	} {
+		if !strings.Contains(string(tagPage), expected) {
+			t.Errorf("Expected tag page to contain %q:\n%s", expected, tagPage)
+		}
+	}
+
+	index, err := os.ReadFile(filepath.Join(contentRoot, "tags", "index.mdx"))
+	if err != nil {
+		t.Fatalf("Failed to read tag index: %v", err)
+	}
+
+	if !strings.Contains(string(index), "- [REST API](/tag-doc/tags/rest-api.html) (1)\n\n## Audience\n\n- [Administrators](/tag-doc/tags/administrators.html) (2)\n") {
+		t.Errorf("Unexpected tag index:\n%s", index)
+	}
+
+	if err := TestDocService.DeletePage(admin, install.ID); err != nil {
+		t.Fatalf("DeletePage returned an error: %v", err)
+	}
+
+	var item models.TrashItem
+	if err := TestDocService.DB.Where("item_type = ? AND item_id = ?", TrashItemPage, install.ID).First(&item).Error; err != nil {
+		t.Fatalf("Failed to find trash item: %v", err)
+	}
+
+	if err := TestDocService.DeleteTag(rest.ID); err != nil {
+		t.Fatalf("DeleteTag returned an error: %v", err)
+	}
+
+	if _, _, err := TestDocService.RestoreTrashItem(item.ID); err != nil {
+		t.Fatalf("RestoreTrashItem returned an error: %v", err)
+	}
+
+	restored, err := TestDocService.GetPage(install.ID)
+	if err != nil {
+		t.Fatalf("GetPage returned an error: %v", err)
+	}
+
+	if len(restored.Tags) != 1 || restored.Tags[0].ID != admins.ID {
+		t.Errorf("Expected the restored page to keep its remaining tag, got %+v", restored.Tags)
+	}
+}
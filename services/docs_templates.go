@@ -0,0 +1,469 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	PageTemplate          = "page"
+	DocumentationTemplate = "documentation"
+)
+
+// DocumentationBlueprint is the content of a documentation template: the
+// settings a new documentation starts with and its page groups and pages.
+type DocumentationBlueprint struct {
+	Settings BlueprintSettings `json:"settings"`
+	Groups   []BlueprintGroup  `json:"groups,omitempty"`
+	Pages    []BlueprintPage   `json:"pages,omitempty"`
+}
+
+// BlueprintSettings fill the settings a new documentation is created
+// without.
+type BlueprintSettings struct {
+	LanderDetails    string `json:"landerDetails,omitempty"`
+	CustomCSS        string `json:"customCSS,omitempty"`
+	RobotsTxt        string `json:"robotsTxt,omitempty"`
+	FooterLabelLinks string `json:"footerLabelLinks,omitempty"`
+	MoreLabelLinks   string `json:"moreLabelLinks,omitempty"`
+	CopyrightText    string `json:"copyrightText,omitempty"`
+	Locales          string `json:"locales,omitempty"`
+	DefaultLocale    string `json:"defaultLocale,omitempty"`
+	Variables        string `json:"variables,omitempty"`
+}
+
+type BlueprintGroup struct {
+	Name   string           `json:"name"`
+	Label  string           `json:"label,omitempty"`
+	Order  *uint            `json:"order,omitempty"`
+	Groups []BlueprintGroup `json:"groups,omitempty"`
+	Pages  []BlueprintPage  `json:"pages,omitempty"`
+}
+
+type BlueprintPage struct {
+	Title       string         `json:"title"`
+	Slug        string         `json:"slug"`
+	Content     string         `json:"content"`
+	Order       *uint          `json:"order,omitempty"`
+	IsIntroPage bool           `json:"isIntroPage,omitempty"`
+	SEO         models.PageSEO `json:"seo"`
+}
+
+const introPageContent = `[{"id":"fa01e096-3187-4628-8f1e-77728cee3aa6","type":"heading","props":{"textColor":"default","backgroundColor":"default","textAlignment":"left","level":1},"content":[{"type":"text","text":"Introduction","styles":{}}],"children":[]},{"id":"64a26e8f-7733-4f8a-b3fb-f2c9a770d727","type":"paragraph","props":{"textColor":"default","backgroundColor":"default","textAlignment":"left"},"content":[{"type":"text","text":"Welcome to the ","styles":{}},{"type":"text","text":"introductory page","styles":{"bold":true}},{"type":"text","text":" of this documentation!","styles":{}}],"children":[]},{"id":"90f28c74-6195-4074-8861-35b82b9bfb1c","type":"paragraph","props":{"textColor":"default","backgroundColor":"default","textAlignment":"left"},"content":[],"children":[]}]`
+
+// defaultBlueprint is what a documentation is created from when no template
+// is given: an introduction page and nothing else.
+var defaultBlueprint = DocumentationBlueprint{
+	Pages: []BlueprintPage{{
+		Title:       "Introduction",
+		Slug:        "/index",
+		Content:     introPageContent,
+		Order:       utils.UintPtr(0),
+		IsIntroPage: true,
+	}},
+}
+
+// templateBlock is a BlockNote block of placeholder text; level makes it a
+// heading.
+func templateBlock(blockType string, level int, text string) map[string]interface{} {
+	props := map[string]interface{}{"textColor": "default", "backgroundColor": "default", "textAlignment": "left"}
+	if level > 0 {
+		props["level"] = level
+	}
+
+	content := []interface{}{}
+	if text != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": text, "styles": map[string]interface{}{}})
+	}
+
+	return map[string]interface{}{
+		"id":       uuid.NewString(),
+		"type":     blockType,
+		"props":    props,
+		"content":  content,
+		"children": []interface{}{},
+	}
+}
+
+func templateContent(blocks ...map[string]interface{}) string {
+	content, _ := json.Marshal(blocks)
+	return string(content)
+}
+
+func builtinTemplates() []models.Template {
+	h := func(level int, text string) map[string]interface{} { return templateBlock("heading", level, text) }
+	p := func(text string) map[string]interface{} { return templateBlock("paragraph", 0, text) }
+	li := func(text string) map[string]interface{} { return templateBlock("numberedListItem", 0, text) }
+	code := func() map[string]interface{} { return templateBlock("codeBlock", 0, "") }
+
+	blueprint, _ := json.Marshal(defaultBlueprint)
+
+	return []models.Template{
+		{
+			Kind:        PageTemplate,
+			Name:        "API reference",
+			Description: "An endpoint or function with its parameters, response and errors.",
+			Content: templateContent(
+				h(1, "Endpoint name"), p("Describe what the endpoint does and when to use it."),
+				h(2, "Request"), p("The method, the path and the parameters it takes."),
+				h(2, "Response"), p("What a successful call returns."),
+				h(2, "Errors"), p("The errors it can return and what they mean."),
+				h(2, "Example"), code(),
+			),
+		},
+		{
+			Kind:        PageTemplate,
+			Name:        "How-to guide",
+			Description: "The steps to get one task done.",
+			Content: templateContent(
+				h(1, "How to …"), p("What this guide helps the reader do."),
+				h(2, "Before you begin"), p("What the reader needs first."),
+				h(2, "Steps"), li("First step."), li("Second step."), li("Third step."),
+				h(2, "Next steps"), p("Where to go from here."),
+			),
+		},
+		{
+			Kind:        PageTemplate,
+			Name:        "Troubleshooting",
+			Description: "A problem, what causes it and how to fix it.",
+			Content: templateContent(
+				h(1, "Problem"),
+				h(2, "Symptoms"), p("What the reader sees when this happens."),
+				h(2, "Cause"), p("Why it happens."),
+				h(2, "Solution"), li("First step of the fix."), li("Second step of the fix."),
+			),
+		},
+		{
+			Kind:        DocumentationTemplate,
+			Name:        "Default",
+			Description: "A documentation with an introduction page.",
+			Content:     string(blueprint),
+		},
+	}
+}
+
+// EnsureBuiltinTemplates creates the built-in templates that are missing.
+// Existing ones are left alone.
+func (service *DocService) EnsureBuiltinTemplates() error {
+	for _, template := range builtinTemplates() {
+		var count int64
+		if err := service.DB.Model(&models.Template{}).Where("builtin = ? AND kind = ? AND name = ?", true, template.Kind, template.Name).
+			Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			continue
+		}
+
+		template.Builtin = true
+		if err := service.DB.Create(&template).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTemplates lists the templates of a kind, or of every kind when kind is
+// empty.
+func (service *DocService) GetTemplates(kind string) ([]models.Template, error) {
+	query := service.DB.Select("id", "kind", "name", "description", "builtin", "author_id", "created_at", "updated_at")
+	if kind != "" {
+		if kind != PageTemplate && kind != DocumentationTemplate {
+			return nil, fmt.Errorf("invalid_template_kind")
+		}
+		query = query.Where("kind = ?", kind)
+	}
+
+	var templates []models.Template
+	if err := query.Order("builtin DESC, name").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_templates")
+	}
+
+	return templates, nil
+}
+
+func (service *DocService) GetTemplate(id uint) (models.Template, error) {
+	var template models.Template
+	if err := service.DB.First(&template, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Template{}, fmt.Errorf("template_not_found")
+		}
+		return models.Template{}, fmt.Errorf("failed_to_get_template")
+	}
+
+	return template, nil
+}
+
+func (service *DocService) getTemplateOfKind(id uint, kind string) (models.Template, error) {
+	template, err := service.GetTemplate(id)
+	if err != nil {
+		return models.Template{}, err
+	}
+
+	if template.Kind != kind {
+		return models.Template{}, fmt.Errorf("invalid_template_kind")
+	}
+
+	return template, nil
+}
+
+// ApplyPageTemplate gives a page without content the content of a page
+// template.
+func (service *DocService) ApplyPageTemplate(page *models.Page, templateId uint) error {
+	template, err := service.getTemplateOfKind(templateId, PageTemplate)
+	if err != nil {
+		return err
+	}
+
+	if page.Content == "" {
+		page.Content = template.Content
+	}
+
+	return nil
+}
+
+// documentationBlueprint is the blueprint of a documentation template, or
+// the default one when templateId is 0. A blueprint needs an introduction
+// page, which is the index of the built site.
+func (service *DocService) documentationBlueprint(templateId uint) (DocumentationBlueprint, error) {
+	if templateId == 0 {
+		return defaultBlueprint, nil
+	}
+
+	template, err := service.getTemplateOfKind(templateId, DocumentationTemplate)
+	if err != nil {
+		return DocumentationBlueprint{}, err
+	}
+
+	var blueprint DocumentationBlueprint
+	if err := json.Unmarshal([]byte(template.Content), &blueprint); err != nil {
+		return DocumentationBlueprint{}, fmt.Errorf("invalid_template_content")
+	}
+
+	hasIntroPage := false
+	for _, page := range blueprint.Pages {
+		hasIntroPage = hasIntroPage || page.IsIntroPage
+	}
+
+	if !hasIntroPage {
+		return DocumentationBlueprint{}, fmt.Errorf("invalid_template_content")
+	}
+
+	return blueprint, nil
+}
+
+// fillDocumentation sets the settings a documentation was created without.
+func (settings BlueprintSettings) fillDocumentation(doc *models.Documentation) {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+
+	fill(&doc.LanderDetails, settings.LanderDetails)
+	fill(&doc.CustomCSS, settings.CustomCSS)
+	fill(&doc.RobotsTxt, settings.RobotsTxt)
+	fill(&doc.FooterLabelLinks, settings.FooterLabelLinks)
+	fill(&doc.MoreLabelLinks, settings.MoreLabelLinks)
+	fill(&doc.CopyrightText, settings.CopyrightText)
+	fill(&doc.Locales, settings.Locales)
+	fill(&doc.DefaultLocale, settings.DefaultLocale)
+	fill(&doc.Variables, settings.Variables)
+}
+
+func createBlueprintPages(tx *gorm.DB, docId uint, groupId *uint, pages []BlueprintPage, user models.User) error {
+	for _, blueprintPage := range pages {
+		page := models.Page{
+			DocumentationID: docId,
+			PageGroupID:     groupId,
+			Title:           blueprintPage.Title,
+			Slug:            blueprintPage.Slug,
+			Content:         blueprintPage.Content,
+			Order:           blueprintPage.Order,
+			IsIntroPage:     blueprintPage.IsIntroPage,
+			PageSEO:         blueprintPage.SEO,
+			AuthorID:        user.ID,
+			Author:          user,
+			Editors:         []models.User{user},
+			LastEditorID:    &user.ID,
+		}
+
+		if err := validatePageSEO(page.PageSEO); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&page).Error; err != nil {
+			return fmt.Errorf("failed_to_create_page")
+		}
+	}
+
+	return nil
+}
+
+func createBlueprintGroups(tx *gorm.DB, docId uint, parentId *uint, groups []BlueprintGroup, user models.User) error {
+	for _, blueprintGroup := range groups {
+		group := models.PageGroup{
+			DocumentationID: docId,
+			ParentID:        parentId,
+			Name:            blueprintGroup.Name,
+			Label:           blueprintGroup.Label,
+			Order:           blueprintGroup.Order,
+			AuthorID:        user.ID,
+			Author:          user,
+			Editors:         []models.User{user},
+			LastEditorID:    &user.ID,
+		}
+
+		if err := tx.Create(&group).Error; err != nil {
+			return fmt.Errorf("failed_to_create_page_group")
+		}
+
+		if err := createBlueprintPages(tx, docId, &group.ID, blueprintGroup.Pages, user); err != nil {
+			return err
+		}
+
+		if err := createBlueprintGroups(tx, docId, &group.ID, blueprintGroup.Groups, user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createBlueprintTree creates the page groups and pages of a blueprint in a
+// new documentation.
+func createBlueprintTree(tx *gorm.DB, docId uint, blueprint DocumentationBlueprint, user models.User) error {
+	if err := createBlueprintPages(tx, docId, nil, blueprint.Pages, user); err != nil {
+		return err
+	}
+
+	return createBlueprintGroups(tx, docId, nil, blueprint.Groups, user)
+}
+
+func blueprintPages(pages []models.Page) []BlueprintPage {
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].ID < pages[j].ID })
+
+	children := []BlueprintPage{}
+	for _, page := range pages {
+		children = append(children, BlueprintPage{
+			Title:       page.Title,
+			Slug:        page.Slug,
+			Content:     page.Content,
+			Order:       page.Order,
+			IsIntroPage: page.IsIntroPage,
+			SEO:         page.PageSEO,
+		})
+	}
+
+	return children
+}
+
+func blueprintGroups(groups []models.PageGroup, parentId *uint) []BlueprintGroup {
+	children := []BlueprintGroup{}
+	for _, group := range groups {
+		if (group.ParentID == nil) != (parentId == nil) || (parentId != nil && *group.ParentID != *parentId) {
+			continue
+		}
+
+		children = append(children, BlueprintGroup{
+			Name:   group.Name,
+			Label:  group.Label,
+			Order:  group.Order,
+			Groups: blueprintGroups(groups, &group.ID),
+			Pages:  blueprintPages(group.Pages),
+		})
+	}
+
+	return children
+}
+
+func (service *DocService) createTemplate(user models.User, kind string, name string, description string, content string) (models.Template, error) {
+	template := models.Template{
+		Kind:        kind,
+		Name:        name,
+		Description: description,
+		Content:     content,
+		AuthorID:    &user.ID,
+	}
+
+	if err := service.DB.Create(&template).Error; err != nil {
+		return models.Template{}, fmt.Errorf("failed_to_create_template")
+	}
+
+	return template, nil
+}
+
+// SavePageAsTemplate creates a page template with the content of a page.
+func (service *DocService) SavePageAsTemplate(user models.User, pageId uint, name string, description string) (models.Template, error) {
+	var page models.Page
+	if err := service.DB.Select("id", "content").First(&page, pageId).Error; err != nil {
+		return models.Template{}, fmt.Errorf("page_not_found")
+	}
+
+	return service.createTemplate(user, PageTemplate, name, description, page.Content)
+}
+
+// SaveDocumentationAsTemplate creates a documentation template with the
+// settings, page groups and pages of a documentation version. Names, URLs,
+// images and credentials are left out; they belong to the documentation.
+func (service *DocService) SaveDocumentationAsTemplate(user models.User, docId uint, name string, description string) (models.Template, error) {
+	var doc models.Documentation
+	if err := service.DB.Preload("PageGroups", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Preload("PageGroups.Pages").
+		First(&doc, docId).Error; err != nil {
+		return models.Template{}, fmt.Errorf("documentation_not_found")
+	}
+
+	var pages []models.Page
+	if err := service.DB.Where("documentation_id = ? AND page_group_id IS NULL", docId).Find(&pages).Error; err != nil {
+		return models.Template{}, fmt.Errorf("failed_to_get_pages")
+	}
+
+	blueprint := DocumentationBlueprint{
+		Settings: BlueprintSettings{
+			LanderDetails:    doc.LanderDetails,
+			CustomCSS:        doc.CustomCSS,
+			RobotsTxt:        doc.RobotsTxt,
+			FooterLabelLinks: doc.FooterLabelLinks,
+			MoreLabelLinks:   doc.MoreLabelLinks,
+			CopyrightText:    doc.CopyrightText,
+			Locales:          doc.Locales,
+			DefaultLocale:    doc.DefaultLocale,
+			Variables:        doc.Variables,
+		},
+		Groups: blueprintGroups(doc.PageGroups, nil),
+		Pages:  blueprintPages(pages),
+	}
+
+	content, err := json.Marshal(blueprint)
+	if err != nil {
+		return models.Template{}, fmt.Errorf("failed_to_create_template")
+	}
+
+	return service.createTemplate(user, DocumentationTemplate, name, description, string(content))
+}
+
+func (service *DocService) DeleteTemplate(id uint) error {
+	template, err := service.GetTemplate(id)
+	if err != nil {
+		return err
+	}
+
+	if template.Builtin {
+		return fmt.Errorf("builtin_template_cannot_be_deleted")
+	}
+
+	if err := service.DB.Delete(&template).Error; err != nil {
+		return fmt.Errorf("failed_to_delete_template")
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func TestBuiltinTemplates(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		if err := TestDocService.EnsureBuiltinTemplates(); err != nil {
+			t.Fatalf("EnsureBuiltinTemplates returned an error: %v", err)
+		}
+	}
+
+	pageTemplates, err := TestDocService.GetTemplates(PageTemplate)
+	if err != nil {
+		t.Fatalf("GetTemplates returned an error: %v", err)
+	}
+
+	if len(pageTemplates) != 3 {
+		t.Fatalf("Expected 3 built-in page templates, got %d", len(pageTemplates))
+	}
+
+	page := models.Page{}
+	if err := TestDocService.ApplyPageTemplate(&page, pageTemplates[0].ID); err != nil {
+		t.Fatalf("ApplyPageTemplate returned an error: %v", err)
+	}
+
+	template, _ := TestDocService.GetTemplate(pageTemplates[0].ID)
+	if page.Content != template.Content {
+		t.Errorf("Expected the page to get the template's content, got %q", page.Content)
+	}
+
+	if _, err := TestDocService.documentationBlueprint(pageTemplates[0].ID); err == nil || err.Error() != "invalid_template_kind" {
+		t.Errorf("Expected 'invalid_template_kind' error, got %v", err)
+	}
+
+	if err := TestDocService.DeleteTemplate(pageTemplates[0].ID); err == nil || err.Error() != "builtin_template_cannot_be_deleted" {
+		t.Errorf("Expected 'builtin_template_cannot_be_deleted' error, got %v", err)
+	}
+}
+
+func TestDocumentationTemplate(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Blueprint Doc", "1.0.0", nil)
+	if err := TestDocService.DB.Model(&doc).Updates(map[string]interface{}{"custom_css": "body {}", "copyright_text": "Acme"}).Error; err != nil {
+		t.Fatalf("Failed to update documentation: %v", err)
+	}
+
+	intro := createTestPage(t, doc.ID, nil, "/index", 0)
+	TestDocService.DB.Model(&intro).Update("is_intro_page", true)
+	guides := createTestPageGroup(t, doc.ID, nil, "guides", 1)
+	advanced := createTestPageGroup(t, doc.ID, &guides.ID, "advanced", 1)
+	createTestPage(t, doc.ID, &guides.ID, "/install", 0)
+	createTestPage(t, doc.ID, &advanced.ID, "/tuning", 0)
+
+	template, err := TestDocService.SaveDocumentationAsTemplate(admin, doc.ID, "Product docs", "")
+	if err != nil {
+		t.Fatalf("SaveDocumentationAsTemplate returned an error: %v", err)
+	}
+
+	blueprint, err := TestDocService.documentationBlueprint(template.ID)
+	if err != nil {
+		t.Fatalf("documentationBlueprint returned an error: %v", err)
+	}
+
+	newDoc := models.Documentation{Name: "From Blueprint", Version: "1.0.0", BaseURL: "/from-blueprint", CopyrightText: "Mine", AuthorID: admin.ID}
+	blueprint.Settings.fillDocumentation(&newDoc)
+
+	if newDoc.CustomCSS != "body {}" || newDoc.CopyrightText != "Mine" {
+		t.Errorf("Expected the blueprint to fill only empty settings, got %q and %q", newDoc.CustomCSS, newDoc.CopyrightText)
+	}
+
+	if err := TestDocService.DB.Create(&newDoc).Error; err != nil {
+		t.Fatalf("Failed to create documentation: %v", err)
+	}
+
+	if err := createBlueprintTree(TestDocService.DB, newDoc.ID, blueprint, admin); err != nil {
+		t.Fatalf("createBlueprintTree returned an error: %v", err)
+	}
+
+	var tuning models.Page
+	if err := TestDocService.DB.Where("documentation_id = ? AND slug = ?", newDoc.ID, "/tuning").First(&tuning).Error; err != nil {
+		t.Fatalf("Expected the nested page to be created: %v", err)
+	}
+
+	var group, parent models.PageGroup
+	TestDocService.DB.First(&group, *tuning.PageGroupID)
+	if group.ParentID != nil {
+		TestDocService.DB.First(&parent, *group.ParentID)
+	}
+
+	if group.Name != "advanced" || parent.Name != "guides" || parent.DocumentationID != newDoc.ID {
+		t.Errorf("Expected the page group tree to be copied, got %q in %q", group.Name, parent.Name)
+	}
+
+	var count int64
+	TestDocService.DB.Model(&models.Page{}).Where("documentation_id = ? AND is_intro_page = ?", newDoc.ID, true).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 intro page, got %d", count)
+	}
+
+	emptyDoc := createTestDocumentation(t, "No Intro Doc", "1.0.0", nil)
+	createTestPage(t, emptyDoc.ID, nil, "/only", 0)
+	noIntro, err := TestDocService.SaveDocumentationAsTemplate(admin, emptyDoc.ID, "No intro", "")
+	if err != nil {
+		t.Fatalf("SaveDocumentationAsTemplate returned an error: %v", err)
+	}
+
+	if _, err := TestDocService.documentationBlueprint(noIntro.ID); err == nil || err.Error() != "invalid_template_content" {
+		t.Errorf("Expected 'invalid_template_content' error, got %v", err)
+	}
+
+	if err := TestDocService.DeleteTemplate(noIntro.ID); err != nil {
+		t.Errorf("DeleteTemplate returned an error: %v", err)
+	}
+}
@@ -0,0 +1,726 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"git.difuse.io/Difuse/kalmia/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TrashItemDocumentation = "documentation"
+	TrashItemPageGroup     = "page_group"
+	TrashItemPage          = "page"
+)
+
+// trashSnapshot is the serialized form of a deleted subtree. Editors are kept
+// as user IDs so that restoring never depends on the deleted rows.
+type trashSnapshot struct {
+	Documentation         *trashDocumentation           `json:"documentation,omitempty"`
+	PageGroups            []models.PageGroup            `json:"pageGroups,omitempty"`
+	Pages                 []models.Page                 `json:"pages,omitempty"`
+	PageTranslations      []models.PageTranslation      `json:"pageTranslations,omitempty"`
+	PageGroupTranslations []models.PageGroupTranslation `json:"pageGroupTranslations,omitempty"`
+	Editors               map[string][]uint             `json:"editors,omitempty"`
+	PageTags              map[uint][]uint               `json:"pageTags,omitempty"`
+	ReparentedVersions    []uint                        `json:"reparentedVersions,omitempty"`
+}
+
+// trashDocumentationFields drops the JSON methods of models.Documentation so
+// that it can be embedded in trashDocumentation.
+type trashDocumentationFields models.Documentation
+
+// trashDocumentation is a documentation together with the credentials its
+// JSON form leaves out, sealed the same way as in their columns.
+type trashDocumentation struct {
+	trashDocumentationFields
+	GitPassword string `json:"gitPassword,omitempty"`
+	TokenSecret string `json:"tokenSecret,omitempty"`
+}
+
+func newTrashDocumentation(doc models.Documentation) (*trashDocumentation, error) {
+	gitPassword, err := db.EncryptSecret(doc.GitPassword, "git_password")
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSecret, err := db.EncryptSecret(doc.TokenSecret, "token_secret")
+	if err != nil {
+		return nil, err
+	}
+
+	return &trashDocumentation{
+		trashDocumentationFields: trashDocumentationFields(doc),
+		GitPassword:              gitPassword,
+		TokenSecret:              tokenSecret,
+	}, nil
+}
+
+func (d *trashDocumentation) documentation() (models.Documentation, error) {
+	doc := models.Documentation(d.trashDocumentationFields)
+
+	var err error
+	if doc.GitPassword, err = db.DecryptSecret(d.GitPassword, "git_password"); err != nil {
+		return models.Documentation{}, err
+	}
+	if doc.TokenSecret, err = db.DecryptSecret(d.TokenSecret, "token_secret"); err != nil {
+		return models.Documentation{}, err
+	}
+
+	return doc, nil
+}
+
+func trashEditorKey(itemType string, id uint) string {
+	return fmt.Sprintf("%s:%d", itemType, id)
+}
+
+func (s *trashSnapshot) addEditors(itemType string, id uint, editors []models.User) {
+	if len(editors) == 0 {
+		return
+	}
+
+	if s.Editors == nil {
+		s.Editors = make(map[string][]uint)
+	}
+
+	ids := make([]uint, 0, len(editors))
+	for _, editor := range editors {
+		ids = append(ids, editor.ID)
+	}
+
+	s.Editors[trashEditorKey(itemType, id)] = ids
+}
+
+func (s *trashSnapshot) addPage(page models.Page) {
+	s.addEditors(TrashItemPage, page.ID, page.Editors)
+	page.Author = models.User{}
+	page.Editors = nil
+	s.Pages = append(s.Pages, page)
+}
+
+func (s *trashSnapshot) addPageGroup(group models.PageGroup) {
+	s.addEditors(TrashItemPageGroup, group.ID, group.Editors)
+	group.Author = models.User{}
+	group.Editors = nil
+	group.Pages = nil
+	s.PageGroups = append(s.PageGroups, group)
+}
+
+func (s *trashSnapshot) setDocumentation(doc models.Documentation) error {
+	s.addEditors(TrashItemDocumentation, doc.ID, doc.Editors)
+	doc.Author = models.User{}
+	doc.Editors = nil
+	doc.PageGroups = nil
+	doc.Pages = nil
+
+	trashed, err := newTrashDocumentation(doc)
+	if err != nil {
+		return err
+	}
+
+	s.Documentation = trashed
+	return nil
+}
+
+func collectPageGroupTree(tx *gorm.DB, id uint, snapshot *trashSnapshot) error {
+	var pageGroup models.PageGroup
+	if err := tx.Preload("Editors").First(&pageGroup, id).Error; err != nil {
+		return fmt.Errorf("page_group_not_found")
+	}
+
+	snapshot.addPageGroup(pageGroup)
+
+	var pages []models.Page
+	if err := tx.Preload("Editors").Where("page_group_id = ?", id).Find(&pages).Error; err != nil {
+		return fmt.Errorf("failed_to_fetch_pages")
+	}
+
+	for _, page := range pages {
+		snapshot.addPage(page)
+	}
+
+	var childGroups []models.PageGroup
+	if err := tx.Where("parent_id = ?", id).Order("id").Find(&childGroups).Error; err != nil {
+		return fmt.Errorf("failed_to_find_child_page_groups")
+	}
+
+	for _, childGroup := range childGroups {
+		if err := collectPageGroupTree(tx, childGroup.ID, snapshot); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func collectDocumentationTree(tx *gorm.DB, id uint, snapshot *trashSnapshot) error {
+	var doc models.Documentation
+	if err := tx.Preload("Editors").First(&doc, id).Error; err != nil {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	if err := snapshot.setDocumentation(doc); err != nil {
+		return fmt.Errorf("failed_to_encrypt_credentials")
+	}
+
+	var pageGroups []models.PageGroup
+	if err := tx.Preload("Editors").Where("documentation_id = ?", id).Order("id").Find(&pageGroups).Error; err != nil {
+		return fmt.Errorf("failed_to_fetch_page_groups")
+	}
+
+	for _, pageGroup := range pageGroups {
+		snapshot.addPageGroup(pageGroup)
+	}
+
+	var pages []models.Page
+	if err := tx.Preload("Editors").Where("documentation_id = ?", id).Order("id").Find(&pages).Error; err != nil {
+		return fmt.Errorf("failed_to_fetch_pages")
+	}
+
+	for _, page := range pages {
+		snapshot.addPage(page)
+	}
+
+	return nil
+}
+
+// collectTranslations moves the translations of the snapshot's pages and page
+// groups into it, since they cannot outlive the rows they belong to.
+func collectTranslations(tx *gorm.DB, snapshot *trashSnapshot) error {
+	if len(snapshot.Pages) > 0 {
+		pageIDs := make([]uint, 0, len(snapshot.Pages))
+		for _, page := range snapshot.Pages {
+			pageIDs = append(pageIDs, page.ID)
+		}
+
+		if err := tx.Where("page_id IN ?", pageIDs).Order("id").Find(&snapshot.PageTranslations).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("page_id IN ?", pageIDs).Delete(&models.PageTranslation{}).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(snapshot.PageGroups) > 0 {
+		groupIDs := make([]uint, 0, len(snapshot.PageGroups))
+		for _, group := range snapshot.PageGroups {
+			groupIDs = append(groupIDs, group.ID)
+		}
+
+		if err := tx.Where("page_group_id IN ?", groupIDs).Order("id").Find(&snapshot.PageGroupTranslations).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("page_group_id IN ?", groupIDs).Delete(&models.PageGroupTranslation{}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectPageTags keeps the tag IDs of the snapshot's pages, which lose their
+// tags when they are deleted.
+func collectPageTags(tx *gorm.DB, snapshot *trashSnapshot) error {
+	if len(snapshot.Pages) == 0 {
+		return nil
+	}
+
+	pageIDs := make([]uint, 0, len(snapshot.Pages))
+	for _, page := range snapshot.Pages {
+		pageIDs = append(pageIDs, page.ID)
+	}
+
+	var rows []struct {
+		PageID uint
+		TagID  uint
+	}
+
+	if err := tx.Table("page_tags").Where("page_id IN ?", pageIDs).Order("page_id, tag_id").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if snapshot.PageTags == nil {
+			snapshot.PageTags = make(map[uint][]uint)
+		}
+		snapshot.PageTags[row.PageID] = append(snapshot.PageTags[row.PageID], row.TagID)
+	}
+
+	return nil
+}
+
+func (service *DocService) moveToTrash(tx *gorm.DB, user *models.User, itemType string, itemID uint, title string, docId uint, rootDocId uint, snapshot trashSnapshot) error {
+	if err := collectTranslations(tx, &snapshot); err != nil {
+		return fmt.Errorf("failed_to_collect_translations")
+	}
+
+	if err := collectPageTags(tx, &snapshot); err != nil {
+		return fmt.Errorf("failed_to_collect_page_tags")
+	}
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed_to_serialize_trash_item")
+	}
+
+	item := models.TrashItem{
+		ItemType:            itemType,
+		ItemID:              itemID,
+		Title:               title,
+		DocumentationID:     docId,
+		RootDocumentationID: rootDocId,
+		Snapshot:            string(snapshotJSON),
+		PageCount:           len(snapshot.Pages),
+		PageGroupCount:      len(snapshot.PageGroups),
+	}
+
+	if user != nil {
+		item.DeletedByID = &user.ID
+	}
+
+	if err := tx.Create(&item).Error; err != nil {
+		return fmt.Errorf("failed_to_create_trash_item")
+	}
+
+	return nil
+}
+
+func (service *DocService) GetTrashItems(documentationID uint) ([]models.TrashItem, error) {
+	var items []models.TrashItem
+
+	query := service.DB.Order("deleted_at DESC")
+	if documentationID != 0 {
+		query = query.Where("documentation_id = ? OR root_documentation_id = ?", documentationID, documentationID)
+	}
+
+	if err := query.Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_trash_items")
+	}
+
+	return items, nil
+}
+
+func (service *DocService) GetTrashItem(id uint) (models.TrashItem, error) {
+	var item models.TrashItem
+	if err := service.DB.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.TrashItem{}, fmt.Errorf("trash_item_not_found")
+		}
+		return models.TrashItem{}, fmt.Errorf("failed_to_get_trash_item")
+	}
+
+	return item, nil
+}
+
+func restoreEditors(tx *gorm.DB, model interface{}, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	var editors []models.User
+	if err := tx.Where("id IN ?", userIDs).Find(&editors).Error; err != nil {
+		return err
+	}
+
+	if len(editors) == 0 {
+		return nil
+	}
+
+	return tx.Model(model).Association("Editors").Append(editors)
+}
+
+// keepIDIfFree clears id when the row has been taken over since deletion, so
+// that the database hands out a new one instead of failing the restore.
+func keepIDIfFree(tx *gorm.DB, model interface{}, id *uint) error {
+	var count int64
+	if err := tx.Model(model).Where("id = ?", *id).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count > 0 {
+		*id = 0
+	}
+
+	return nil
+}
+
+// RestoreTrashItem puts a trashed subtree back with its original order. Items
+// whose parent page group is gone are restored at the top level, and the
+// returned item carries the ID the restored root ended up with. Pages whose
+// slug has been taken in the meantime get a "-2", "-3"... suffix, as when
+// moving pages, and are listed with their new slug.
+func (service *DocService) RestoreTrashItem(id uint) (models.TrashItem, []RenamedSlug, error) {
+	item, err := service.GetTrashItem(id)
+	if err != nil {
+		return models.TrashItem{}, nil, err
+	}
+
+	var snapshot trashSnapshot
+	if err := json.Unmarshal([]byte(item.Snapshot), &snapshot); err != nil {
+		return models.TrashItem{}, nil, fmt.Errorf("invalid_trash_snapshot")
+	}
+
+	restoredDocID := item.DocumentationID
+	previousDocID := item.DocumentationID
+	isRootDoc := false
+	renamed := []RenamedSlug{}
+
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		docIDMap := make(map[uint]uint)
+
+		if snapshot.Documentation != nil {
+			doc, err := snapshot.Documentation.documentation()
+			if err != nil {
+				return fmt.Errorf("failed_to_decrypt_credentials")
+			}
+			oldID := doc.ID
+			isRootDoc = doc.ClonedFrom == nil
+
+			if doc.ClonedFrom != nil {
+				var parentCount int64
+				if err := tx.Model(&models.Documentation{}).Where("id = ?", *doc.ClonedFrom).Count(&parentCount).Error; err != nil {
+					return fmt.Errorf("failed_to_verify_parent_documentation")
+				}
+
+				if parentCount == 0 {
+					doc.ClonedFrom = nil
+					if item.RootDocumentationID != oldID {
+						if err := tx.Model(&models.Documentation{}).Where("id = ?", item.RootDocumentationID).Count(&parentCount).Error; err != nil {
+							return fmt.Errorf("failed_to_verify_parent_documentation")
+						}
+						if parentCount > 0 {
+							doc.ClonedFrom = utils.UintPtr(item.RootDocumentationID)
+						}
+					}
+					isRootDoc = doc.ClonedFrom == nil
+				}
+			}
+
+			if err := keepIDIfFree(tx, &models.Documentation{}, &doc.ID); err != nil {
+				return fmt.Errorf("failed_to_restore_documentation")
+			}
+
+			if err := tx.Omit(clause.Associations).Create(&doc).Error; err != nil {
+				return fmt.Errorf("failed_to_restore_documentation")
+			}
+
+			if err := restoreEditors(tx, &doc, snapshot.Editors[trashEditorKey(TrashItemDocumentation, oldID)]); err != nil {
+				return fmt.Errorf("failed_to_restore_editors")
+			}
+
+			if len(snapshot.ReparentedVersions) > 0 {
+				if err := tx.Model(&models.Documentation{}).Where("id IN ?", snapshot.ReparentedVersions).
+					Update("cloned_from", doc.ID).Error; err != nil {
+					return fmt.Errorf("failed_to_restore_child_versions")
+				}
+			}
+
+			docIDMap[oldID] = doc.ID
+			restoredDocID = doc.ID
+			previousDocID = oldID
+		} else {
+			var docCount int64
+			if err := tx.Model(&models.Documentation{}).Where("id = ?", item.DocumentationID).Count(&docCount).Error; err != nil {
+				return fmt.Errorf("failed_to_verify_documentation")
+			}
+			if docCount == 0 {
+				return fmt.Errorf("documentation_not_found")
+			}
+		}
+
+		mapDocID := func(oldID uint) uint {
+			if newID, ok := docIDMap[oldID]; ok {
+				return newID
+			}
+			return oldID
+		}
+
+		groupIDMap := make(map[uint]uint)
+		inSnapshot := make(map[uint]bool)
+		for _, pg := range snapshot.PageGroups {
+			inSnapshot[pg.ID] = true
+		}
+
+		// Page groups are inserted once their parent exists, which keeps the
+		// restore independent of the order they were collected in.
+		pending := snapshot.PageGroups
+		for len(pending) > 0 {
+			var next []models.PageGroup
+			for _, pg := range pending {
+				oldID := pg.ID
+
+				if pg.ParentID != nil && inSnapshot[*pg.ParentID] {
+					newParentID, ok := groupIDMap[*pg.ParentID]
+					if !ok {
+						next = append(next, pg)
+						continue
+					}
+					pg.ParentID = &newParentID
+				} else if pg.ParentID != nil {
+					var parentCount int64
+					if err := tx.Model(&models.PageGroup{}).Where("id = ?", *pg.ParentID).Count(&parentCount).Error; err != nil {
+						return fmt.Errorf("failed_to_verify_parent_page_group")
+					}
+					if parentCount == 0 {
+						pg.ParentID = nil
+					}
+				}
+
+				pg.DocumentationID = mapDocID(pg.DocumentationID)
+
+				if err := keepIDIfFree(tx, &models.PageGroup{}, &pg.ID); err != nil {
+					return fmt.Errorf("failed_to_restore_page_group")
+				}
+
+				if err := tx.Omit(clause.Associations).Create(&pg).Error; err != nil {
+					return fmt.Errorf("failed_to_restore_page_group")
+				}
+
+				if err := restoreEditors(tx, &pg, snapshot.Editors[trashEditorKey(TrashItemPageGroup, oldID)]); err != nil {
+					return fmt.Errorf("failed_to_restore_editors")
+				}
+
+				groupIDMap[oldID] = pg.ID
+			}
+
+			if len(next) == len(pending) {
+				return fmt.Errorf("invalid_trash_snapshot")
+			}
+			pending = next
+		}
+
+		pagesByDoc := make(map[uint][]models.Page)
+		for _, page := range snapshot.Pages {
+			docID := mapDocID(page.DocumentationID)
+			pagesByDoc[docID] = append(pagesByDoc[docID], page)
+		}
+
+		slugs := make(map[uint]string)
+		renamedFrom := make(map[uint]string)
+		for docID, pages := range pagesByDoc {
+			docSlugs, docRenamed, err := resolveSlugs(tx, docID, pages, false, SlugConflictRename)
+			if err != nil {
+				return err
+			}
+			for oldID, slug := range docSlugs {
+				slugs[oldID] = slug
+			}
+			for _, r := range docRenamed {
+				renamedFrom[r.PageID] = r.From
+			}
+		}
+
+		pageIDMap := make(map[uint]uint)
+		for _, page := range snapshot.Pages {
+			oldID := page.ID
+
+			if page.PageGroupID != nil {
+				if newGroupID, ok := groupIDMap[*page.PageGroupID]; ok {
+					page.PageGroupID = &newGroupID
+				} else {
+					var groupCount int64
+					if err := tx.Model(&models.PageGroup{}).Where("id = ?", *page.PageGroupID).Count(&groupCount).Error; err != nil {
+						return fmt.Errorf("failed_to_verify_page_group")
+					}
+					if groupCount == 0 {
+						page.PageGroupID = nil
+					}
+				}
+			}
+
+			page.DocumentationID = mapDocID(page.DocumentationID)
+			page.Slug = slugs[oldID]
+
+			if err := keepIDIfFree(tx, &models.Page{}, &page.ID); err != nil {
+				return fmt.Errorf("failed_to_restore_page")
+			}
+
+			if err := tx.Omit(clause.Associations).Create(&page).Error; err != nil {
+				return fmt.Errorf("failed_to_restore_page")
+			}
+
+			if err := restoreEditors(tx, &page, snapshot.Editors[trashEditorKey(TrashItemPage, oldID)]); err != nil {
+				return fmt.Errorf("failed_to_restore_editors")
+			}
+
+			if tagIDs := snapshot.PageTags[oldID]; len(tagIDs) > 0 {
+				if err := tx.Exec("INSERT INTO page_tags (page_id, tag_id) SELECT ?, id FROM tags WHERE id IN ?", page.ID, tagIDs).Error; err != nil {
+					return fmt.Errorf("failed_to_restore_page_tags")
+				}
+			}
+
+			pageIDMap[oldID] = page.ID
+			if from, ok := renamedFrom[oldID]; ok {
+				renamed = append(renamed, RenamedSlug{PageID: page.ID, From: from, To: page.Slug})
+			}
+		}
+
+		for _, translation := range snapshot.PageTranslations {
+			translation.ID = 0
+			translation.PageID = pageIDMap[translation.PageID]
+			if err := tx.Create(&translation).Error; err != nil {
+				return fmt.Errorf("failed_to_restore_translation")
+			}
+		}
+
+		for _, translation := range snapshot.PageGroupTranslations {
+			translation.ID = 0
+			translation.PageGroupID = groupIDMap[translation.PageGroupID]
+			if err := tx.Create(&translation).Error; err != nil {
+				return fmt.Errorf("failed_to_restore_translation")
+			}
+		}
+
+		if err := tx.Delete(&item).Error; err != nil {
+			return fmt.Errorf("failed_to_delete_trash_item")
+		}
+
+		switch item.ItemType {
+		case TrashItemDocumentation:
+			item.ItemID = restoredDocID
+		case TrashItemPageGroup:
+			item.ItemID = groupIDMap[item.ItemID]
+		case TrashItemPage:
+			item.ItemID = pageIDMap[item.ItemID]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.TrashItem{}, nil, err
+	}
+
+	rootDocId, err := service.GetRootParentID(restoredDocID)
+	if err != nil {
+		return models.TrashItem{}, nil, fmt.Errorf("failed_to_get_root_parent_id")
+	}
+
+	if isRootDoc {
+		docPath := filepath.Join(config.ParsedConfig.DataPath, "rspress_data", "doc_"+strconv.Itoa(int(rootDocId)))
+		if previousDocID != rootDocId {
+			service.moveRsPressFolder(previousDocID, docPath)
+		}
+
+		if !utils.PathExists(docPath) {
+			if err := service.InitRsPress(rootDocId); err != nil {
+				logger.Error("failed_to_init_rspress", zap.Uint("doc_id", rootDocId), zap.Error(err))
+				return models.TrashItem{}, nil, fmt.Errorf("failed_to_init_rspress")
+			}
+		}
+	}
+
+	if err := service.AddBuildTrigger(rootDocId, false); err != nil {
+		return models.TrashItem{}, nil, fmt.Errorf("failed_to_update_write_build")
+	}
+
+	return item, renamed, nil
+}
+
+// moveRsPressFolder hands the RsPress folder a root documentation had in the
+// trash over to the ID it was restored under, unless a root documentation
+// that took over the old ID uses the folder by now.
+func (service *DocService) moveRsPressFolder(oldID uint, docPath string) {
+	oldPath := filepath.Join(config.ParsedConfig.DataPath, "rspress_data", "doc_"+strconv.Itoa(int(oldID)))
+	if !utils.PathExists(oldPath) {
+		return
+	}
+
+	var owners int64
+	if err := service.DB.Model(&models.Documentation{}).Where("id = ? AND cloned_from IS NULL", oldID).Count(&owners).Error; err != nil || owners > 0 {
+		return
+	}
+
+	if utils.PathExists(docPath) {
+		err := utils.RemovePath(oldPath)
+		if err != nil {
+			logger.Error("failed to remove restored rspress folder", zap.Uint("doc_id", oldID), zap.Error(err))
+		}
+		return
+	}
+
+	if err := os.Rename(oldPath, docPath); err != nil {
+		logger.Error("failed to move restored rspress folder", zap.Uint("doc_id", oldID), zap.Error(err))
+	}
+}
+
+// DeleteTrashItem removes an item from the trash for good. Root documentations
+// keep their RsPress folder while in the trash, so it is removed only here.
+func (service *DocService) DeleteTrashItem(id uint) error {
+	item, err := service.GetTrashItem(id)
+	if err != nil {
+		return err
+	}
+
+	if err := service.DB.Delete(&item).Error; err != nil {
+		return fmt.Errorf("failed_to_delete_trash_item")
+	}
+
+	if item.ItemType == TrashItemDocumentation && item.ItemID == item.RootDocumentationID {
+		var count int64
+		if err := service.DB.Model(&models.Documentation{}).Where("id = ?", item.ItemID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed_to_verify_documentation")
+		}
+
+		if count == 0 {
+			if err := service.AddBuildTrigger(item.ItemID, true); err != nil {
+				return fmt.Errorf("failed_to_add_build_trigger")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (service *DocService) PurgeTrash(olderThan time.Time) (int, error) {
+	var items []models.TrashItem
+	if err := service.DB.Select("id").Where("deleted_at < ?", olderThan).Find(&items).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_get_trash_items")
+	}
+
+	purged := 0
+	for _, item := range items {
+		if err := service.DeleteTrashItem(item.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (service *DocService) TrashPurgeJob() {
+	retention := time.Duration(config.ParsedConfig.TrashRetention) * 24 * time.Hour
+
+	purged, err := service.PurgeTrash(time.Now().Add(-retention))
+	if err != nil {
+		logger.Error("(TrashPurgeJob) Failed to purge trash", zap.Error(err))
+	}
+
+	if purged > 0 {
+		logger.Info("Purged expired trash items", zap.Int("count", purged))
+	}
+}
+
+func clearDocCache(docId uint) {
+	if err := db.ClearCacheByPrefix(fmt.Sprintf("rs|doc_%d", docId)); err != nil {
+		logger.Error("Failed to clear cache", zap.Error(err))
+	}
+
+	if err := db.ClearCacheByPrefix(fmt.Sprintf("burl|doc_%d", docId)); err != nil {
+		logger.Error("Failed to clear cache", zap.Error(err))
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/utils"
+)
+
+func createTestDocumentation(t *testing.T, name string, version string, clonedFrom *uint) models.Documentation {
+	t.Helper()
+
+	doc := models.Documentation{
+		Name:       name,
+		Version:    version,
+		BaseURL:    "/" + utils.StringToFileString(name),
+		ClonedFrom: clonedFrom,
+		AuthorID:   1,
+	}
+
+	if err := TestDocService.DB.Create(&doc).Error; err != nil {
+		t.Fatalf("Failed to create documentation: %v", err)
+	}
+
+	return doc
+}
+
+func createTestPageGroup(t *testing.T, docID uint, parentID *uint, name string, order uint) models.PageGroup {
+	t.Helper()
+
+	pageGroup := models.PageGroup{
+		DocumentationID: docID,
+		ParentID:        parentID,
+		AuthorID:        1,
+		Name:            name,
+		Label:           name,
+		Order:           utils.UintPtr(order),
+	}
+
+	if err := TestDocService.DB.Create(&pageGroup).Error; err != nil {
+		t.Fatalf("Failed to create page group: %v", err)
+	}
+
+	return pageGroup
+}
+
+func createTestPage(t *testing.T, docID uint, pageGroupID *uint, slug string, order uint) models.Page {
+	t.Helper()
+
+	page := models.Page{
+		DocumentationID: docID,
+		PageGroupID:     pageGroupID,
+		AuthorID:        1,
+		Title:           slug,
+		Slug:            slug,
+		Content:         "[]",
+		Order:           utils.UintPtr(order),
+	}
+
+	if err := TestDocService.DB.Create(&page).Error; err != nil {
+		t.Fatalf("Failed to create page: %v", err)
+	}
+
+	return page
+}
+
+func getTestAdmin(t *testing.T) models.User {
+	t.Helper()
+
+	var admin models.User
+	if err := TestDocService.DB.Where("username = ?", "admin").First(&admin).Error; err != nil {
+		t.Fatalf("Failed to get admin user: %v", err)
+	}
+
+	return admin
+}
+
+func TestTrashPageGroupRestore(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Trash Group Doc", "1.0.0", nil)
+
+	group := createTestPageGroup(t, doc.ID, nil, "guides", 3)
+	nested := createTestPageGroup(t, doc.ID, &group.ID, "advanced", 1)
+	first := createTestPage(t, doc.ID, &group.ID, "/first", 2)
+	deep := createTestPage(t, doc.ID, &nested.ID, "/deep", 5)
+
+	if err := TestDocService.DeletePageGroup(admin, group.ID); err != nil {
+		t.Fatalf("DeletePageGroup returned an error: %v", err)
+	}
+
+	var count int64
+	TestDocService.DB.Model(&models.Page{}).Where("id IN ?", []uint{first.ID, deep.ID}).Count(&count)
+	if count != 0 {
+		t.Fatalf("Expected pages to be removed, found %d", count)
+	}
+
+	items, err := TestDocService.GetTrashItems(doc.ID)
+	if err != nil {
+		t.Fatalf("GetTrashItems returned an error: %v", err)
+	}
+
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 trash item, got %d", len(items))
+	}
+
+	if items[0].ItemType != TrashItemPageGroup || items[0].PageCount != 2 || items[0].PageGroupCount != 2 {
+		t.Errorf("Unexpected trash item: %+v", items[0])
+	}
+
+	if *items[0].DeletedByID != admin.ID {
+		t.Errorf("Expected deletedById %d, got %d", admin.ID, *items[0].DeletedByID)
+	}
+
+	restored, _, err := TestDocService.RestoreTrashItem(items[0].ID)
+	if err != nil {
+		t.Fatalf("RestoreTrashItem returned an error: %v", err)
+	}
+
+	var restoredGroup models.PageGroup
+	if err := TestDocService.DB.First(&restoredGroup, restored.ItemID).Error; err != nil {
+		t.Fatalf("Restored page group not found: %v", err)
+	}
+
+	if *restoredGroup.Order != 3 {
+		t.Errorf("Expected restored order 3, got %d", *restoredGroup.Order)
+	}
+
+	var restoredNested models.PageGroup
+	if err := TestDocService.DB.Where("parent_id = ?", restoredGroup.ID).First(&restoredNested).Error; err != nil {
+		t.Fatalf("Restored nested page group not found: %v", err)
+	}
+
+	var restoredDeep models.Page
+	if err := TestDocService.DB.Where("documentation_id = ? AND slug = ?", doc.ID, "/deep").First(&restoredDeep).Error; err != nil {
+		t.Fatalf("Restored page not found: %v", err)
+	}
+
+	if *restoredDeep.PageGroupID != restoredNested.ID || *restoredDeep.Order != 5 {
+		t.Errorf("Restored page has wrong placement: group %d, order %d", *restoredDeep.PageGroupID, *restoredDeep.Order)
+	}
+
+	if _, err := TestDocService.GetTrashItem(items[0].ID); err == nil {
+		t.Errorf("Expected trash item to be removed after restore")
+	}
+}
+
+func TestTrashPageRestoreConflict(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Trash Page Doc", "1.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/conflict", 1)
+
+	if err := TestDocService.DeletePage(admin, page.ID); err != nil {
+		t.Fatalf("DeletePage returned an error: %v", err)
+	}
+
+	createTestPage(t, doc.ID, nil, "/conflict", 2)
+
+	items, err := TestDocService.GetTrashItems(doc.ID)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected 1 trash item, got %d (%v)", len(items), err)
+	}
+
+	restored, renamed, err := TestDocService.RestoreTrashItem(items[0].ID)
+	if err != nil {
+		t.Fatalf("RestoreTrashItem returned an error: %v", err)
+	}
+
+	if len(renamed) != 1 || renamed[0].PageID != restored.ItemID || renamed[0].From != "/conflict" || renamed[0].To != "/conflict-2" {
+		t.Errorf("Expected the restored page to be renamed to /conflict-2, got %+v", renamed)
+	}
+
+	var restoredPage models.Page
+	TestDocService.DB.First(&restoredPage, restored.ItemID)
+	if restoredPage.Slug != "/conflict-2" {
+		t.Errorf("Expected the restored page to have slug /conflict-2, got %q", restoredPage.Slug)
+	}
+}
+
+func TestTrashDocumentationVersionRestore(t *testing.T) {
+	admin := getTestAdmin(t)
+	root := createTestDocumentation(t, "Trash Version Doc", "1.0.0", nil)
+	version := createTestDocumentation(t, "Trash Version Doc", "2.0.0", &root.ID)
+	child := createTestDocumentation(t, "Trash Version Doc", "3.0.0", &version.ID)
+	createTestPage(t, version.ID, nil, "/index", 0)
+
+	if err := TestDocService.DeleteDocumentation(admin, version.ID); err != nil {
+		t.Fatalf("DeleteDocumentation returned an error: %v", err)
+	}
+
+	var reparented models.Documentation
+	TestDocService.DB.First(&reparented, child.ID)
+	if reparented.ClonedFrom == nil || *reparented.ClonedFrom != root.ID {
+		t.Fatalf("Expected child version to be attached to root after delete")
+	}
+
+	items, err := TestDocService.GetTrashItems(root.ID)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected 1 trash item, got %d (%v)", len(items), err)
+	}
+
+	if _, _, err := TestDocService.RestoreTrashItem(items[0].ID); err != nil {
+		t.Fatalf("RestoreTrashItem returned an error: %v", err)
+	}
+
+	TestDocService.DB.First(&reparented, child.ID)
+	if reparented.ClonedFrom == nil || *reparented.ClonedFrom != version.ID {
+		t.Errorf("Expected child version to be attached back to the restored version")
+	}
+
+	var pageCount int64
+	TestDocService.DB.Model(&models.Page{}).Where("documentation_id = ?", version.ID).Count(&pageCount)
+	if pageCount != 1 {
+		t.Errorf("Expected 1 restored page, got %d", pageCount)
+	}
+}
+
+func TestTrashDocumentationKeepsCredentials(t *testing.T) {
+	admin := getTestAdmin(t)
+	root := createTestDocumentation(t, "Trash Credentials Doc", "1.0.0", nil)
+
+	doc := models.Documentation{
+		Name:        "Trash Credentials Doc",
+		Version:     "2.0.0",
+		BaseURL:     root.BaseURL,
+		ClonedFrom:  &root.ID,
+		AuthorID:    admin.ID,
+		GitUser:     "deployer",
+		GitPassword: "git-password-secret",
+		TokenSecret: "token-secret-value",
+	}
+	if err := TestDocService.DB.Create(&doc).Error; err != nil {
+		t.Fatalf("Failed to create documentation: %v", err)
+	}
+
+	if err := TestDocService.DeleteDocumentation(admin, doc.ID); err != nil {
+		t.Fatalf("DeleteDocumentation returned an error: %v", err)
+	}
+
+	items, err := TestDocService.GetTrashItems(root.ID)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected 1 trash item, got %d (%v)", len(items), err)
+	}
+
+	var item models.TrashItem
+	TestDocService.DB.First(&item, items[0].ID)
+	if strings.Contains(item.Snapshot, "git-password-secret") || strings.Contains(item.Snapshot, "token-secret-value") {
+		t.Errorf("Expected the credentials to be encrypted in the snapshot")
+	}
+
+	restored, _, err := TestDocService.RestoreTrashItem(item.ID)
+	if err != nil {
+		t.Fatalf("RestoreTrashItem returned an error: %v", err)
+	}
+
+	var restoredDoc models.Documentation
+	if err := TestDocService.DB.First(&restoredDoc, restored.ItemID).Error; err != nil {
+		t.Fatalf("Failed to get the restored documentation: %v", err)
+	}
+	if restoredDoc.GitPassword != "git-password-secret" || restoredDoc.TokenSecret != "token-secret-value" {
+		t.Errorf("Expected the credentials to be restored, got %q and %q", restoredDoc.GitPassword, restoredDoc.TokenSecret)
+	}
+}
+
+func TestTrashRootRestoreUnderNewID(t *testing.T) {
+	admin := getTestAdmin(t)
+	other := createTestDocumentation(t, "Trash Other Root Doc", "1.0.0", nil)
+	root := createTestDocumentation(t, "Trash New ID Doc", "1.0.0", nil)
+	createTestPage(t, root.ID, nil, "/index", 0)
+
+	rsPressData := filepath.Join(config.ParsedConfig.DataPath, "rspress_data")
+	oldPath := filepath.Join(rsPressData, "doc_"+strconv.Itoa(int(root.ID)))
+	if err := os.MkdirAll(oldPath, 0755); err != nil {
+		t.Fatalf("Failed to create the rspress folder: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(oldPath, "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to write to the rspress folder: %v", err)
+	}
+
+	if err := TestDocService.DeleteDocumentation(admin, root.ID); err != nil {
+		t.Fatalf("DeleteDocumentation returned an error: %v", err)
+	}
+
+	// a version of another documentation takes over the ID in the meantime
+	taker := models.Documentation{ID: root.ID, Name: other.Name, Version: "2.0.0", BaseURL: other.BaseURL, ClonedFrom: &other.ID, AuthorID: admin.ID}
+	if err := TestDocService.DB.Create(&taker).Error; err != nil {
+		t.Fatalf("Failed to create documentation: %v", err)
+	}
+
+	var item models.TrashItem
+	if err := TestDocService.DB.Where("item_type = ? AND item_id = ?", TrashItemDocumentation, root.ID).First(&item).Error; err != nil {
+		t.Fatalf("Failed to get the trash item: %v", err)
+	}
+
+	restored, _, err := TestDocService.RestoreTrashItem(item.ID)
+	if err != nil {
+		t.Fatalf("RestoreTrashItem returned an error: %v", err)
+	}
+	if restored.ItemID == root.ID {
+		t.Fatalf("Expected the documentation to be restored under a new ID")
+	}
+
+	newPath := filepath.Join(rsPressData, "doc_"+strconv.Itoa(int(restored.ItemID)))
+	if utils.PathExists(oldPath) || !utils.PathExists(filepath.Join(newPath, "package.json")) {
+		t.Errorf("Expected the rspress folder to move from %s to %s", oldPath, newPath)
+	}
+
+	var triggers int64
+	TestDocService.DB.Model(&models.BuildTriggers{}).Where("documentation_id = ? AND is_delete = ?", restored.ItemID, false).Count(&triggers)
+	if triggers == 0 {
+		t.Errorf("Expected a build for the new ID")
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+// conditionalBlockType is the BlockNote block whose children are only built
+// for some versions or audiences, as in
+// {"type": "conditional", "props": {"versions": "2.*", "audiences": "admin"}}.
+const conditionalBlockType = "conditional"
+
+var (
+	variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+	placeholderPattern  = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+)
+
+// documentationVariables returns the variables of a documentation version.
+// "version" is the version itself unless it is set explicitly.
+func documentationVariables(doc models.Documentation) map[string]string {
+	variables := make(map[string]string)
+	if doc.Variables != "" {
+		_ = json.Unmarshal([]byte(doc.Variables), &variables)
+	}
+
+	if _, ok := variables["version"]; !ok {
+		variables["version"] = doc.Version
+	}
+
+	return variables
+}
+
+// SetDocumentationVariables replaces the variables of one documentation
+// version. Versions created from it start with a copy.
+func (service *DocService) SetDocumentationVariables(user models.User, id uint, variables map[string]string) error {
+	for name := range variables {
+		if !variableNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid_variable_name")
+		}
+	}
+
+	variablesJSON := ""
+	if len(variables) > 0 {
+		raw, err := json.Marshal(variables)
+		if err != nil {
+			return fmt.Errorf("failed_to_update_variables")
+		}
+		variablesJSON = string(raw)
+	}
+
+	result := service.DB.Model(&models.Documentation{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"variables":      variablesJSON,
+		"last_editor_id": user.ID,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed_to_update_variables")
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	rootId, err := service.GetRootParentID(id)
+	if err != nil {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	if err := service.AddBuildTrigger(rootId, false); err != nil {
+		return fmt.Errorf("failed_to_add_build_trigger")
+	}
+
+	return nil
+}
+
+// substituteVariables replaces {{ name }} placeholders. Unknown names are
+// left as they are, so a typo shows up on the page instead of vanishing.
+func substituteVariables(text string, variables map[string]string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+func substituteValue(value interface{}, variables map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return substituteVariables(v, variables)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = substituteValue(item, variables)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			if key != "id" && key != "type" {
+				v[key] = substituteValue(item, variables)
+			}
+		}
+	}
+
+	return value
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// conditionMatches tells whether a conditional block is built for a version.
+// Versions are exact versions or patterns such as "2.*"; audiences are
+// matched against the version's "audience" variable. An empty list matches
+// everything.
+func conditionMatches(props map[string]interface{}, version string, variables map[string]string) bool {
+	versions, _ := props["versions"].(string)
+	if patterns := splitList(versions); len(patterns) > 0 {
+		matched := false
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, version); ok || pattern == version {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	audiences, _ := props["audiences"].(string)
+	if wanted := splitList(audiences); len(wanted) > 0 {
+		current := make(map[string]bool)
+		for _, audience := range splitList(variables["audience"]) {
+			current[audience] = true
+		}
+
+		for _, audience := range wanted {
+			if current[audience] {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// resolveConditionals replaces conditional blocks with their children when
+// they match, and drops them otherwise.
+func resolveConditionals(blocks []interface{}, version string, variables map[string]string) []interface{} {
+	resolved := make([]interface{}, 0, len(blocks))
+
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			resolved = append(resolved, item)
+			continue
+		}
+
+		children, _ := block["children"].([]interface{})
+		children = resolveConditionals(children, version, variables)
+
+		if block["type"] == conditionalBlockType {
+			props, _ := block["props"].(map[string]interface{})
+			if conditionMatches(props, version, variables) {
+				resolved = append(resolved, children...)
+			}
+			continue
+		}
+
+		if _, ok := block["children"]; ok {
+			block["children"] = children
+		}
+		resolved = append(resolved, block)
+	}
+
+	return resolved
+}
+
+// applyVersionContent builds the content of a page for its version: blocks
+// that are not for the version are dropped and variables are substituted.
+func applyVersionContent(content string, doc models.Documentation) (string, error) {
+	if !strings.Contains(content, "{{") && !strings.Contains(content, `"`+conditionalBlockType+`"`) {
+		return content, nil
+	}
+
+	blocks, err := parseBlocks(content)
+	if err != nil {
+		return "", err
+	}
+
+	variables := documentationVariables(doc)
+	blocks = resolveConditionals(blocks, doc.Version, variables)
+	substituteValue(blocks, variables)
+
+	applied, err := json.Marshal(blocks)
+	if err != nil {
+		return "", err
+	}
+
+	return string(applied), nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+const variablesTestContent = `[
+	{"id":"b1","type":"paragraph","props":{},"content":[{"type":"text","text":"Install {{ cli }} {{version}} from {{downloadUrl}} or {{ unknown }}","styles":{}}],"children":[]},
+	{"id":"c1","type":"conditional","props":{"versions":"2.*"},"children":[
+		{"id":"b2","type":"paragraph","props":{},"content":[{"type":"text","text":"New in two","styles":{}}],"children":[]}
+	]},
+	{"id":"c2","type":"conditional","props":{"versions":"1.0.0, 1.1.0"},"children":[
+		{"id":"b3","type":"paragraph","props":{},"content":[{"type":"text","text":"Legacy only","styles":{}}],"children":[]}
+	]},
+	{"id":"c3","type":"conditional","props":{"audiences":"admin"},"children":[
+		{"id":"b4","type":"paragraph","props":{},"content":[{"type":"text","text":"Admins only","styles":{}}],"children":[]}
+	]}
+]`
+
+func TestApplyVersionContent(t *testing.T) {
+	doc := models.Documentation{
+		Version:   "2.1.0",
+		Variables: `{"cli":"kalmia","downloadUrl":"https://example.com/{{version}}","audience":"admin, developer"}`,
+	}
+
+	content, err := applyVersionContent(variablesTestContent, doc)
+	if err != nil {
+		t.Fatalf("applyVersionContent returned an error: %v", err)
+	}
+
+	blocks, _ := parseBlocks(content)
+	var texts []string
+	for _, block := range blocks {
+		texts = append(texts, inlineText(block.(map[string]interface{})["content"]))
+	}
+
+	expected := "Install kalmia 2.1.0 from https://example.com/{{version}} or {{ unknown }}|New in two|Admins only"
+	if strings.Join(texts, "|") != expected {
+		t.Errorf("Expected %q, got %q", expected, strings.Join(texts, "|"))
+	}
+
+	doc = models.Documentation{Version: "1.1.0"}
+	content, err = applyVersionContent(variablesTestContent, doc)
+	if err != nil {
+		t.Fatalf("applyVersionContent returned an error: %v", err)
+	}
+
+	if !strings.Contains(content, "Legacy only") || strings.Contains(content, "New in two") || strings.Contains(content, "Admins only") {
+		t.Errorf("Unexpected content for 1.1.0: %s", content)
+	}
+}
+
+func TestDocumentationVariables(t *testing.T) {
+	admin := getTestAdmin(t)
+	doc := createTestDocumentation(t, "Variables Doc", "3.0.0", nil)
+	page := createTestPage(t, doc.ID, nil, "/variables", 1)
+
+	if err := TestDocService.SetDocumentationVariables(admin, doc.ID, map[string]string{"bad name": "x"}); err == nil || err.Error() != "invalid_variable_name" {
+		t.Errorf("Expected 'invalid_variable_name' error, got %v", err)
+	}
+
+	if err := TestDocService.SetDocumentationVariables(admin, doc.ID, map[string]string{"cli": "kalmia"}); err != nil {
+		t.Fatalf("SetDocumentationVariables returned an error: %v", err)
+	}
+
+	mdx, err := TestDocService.CraftPage(page, "{{cli}} {{version}}", variablesTestContent)
+	if err != nil {
+		t.Fatalf("CraftPage returned an error: %v", err)
+	}
+
+	if !strings.Contains(mdx, "title: \"kalmia 3.0.0\"\n") || !strings.Contains(mdx, "Install kalmia 3.0.0") {
+		t.Errorf("Expected variables to be substituted:\n%s", mdx)
+	}
+
+	if strings.Contains(mdx, "New in two") || strings.Contains(mdx, "Admins only") || strings.Contains(mdx, `"conditional"`) {
+		t.Errorf("Expected conditional blocks to be resolved:\n%s", mdx)
+	}
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"go.uber.org/zap"
+	"golang.org/x/mod/semver"
+	"gorm.io/gorm"
+)
+
+type VersionDetails struct {
+	ID         uint       `json:"id"`
+	Version    string     `json:"version"`
+	ClonedFrom *uint      `json:"clonedFrom"`
+	Prerelease bool       `json:"prerelease"`
+	Hidden     bool       `json:"hidden"`
+	Deprecated bool       `json:"deprecated"`
+	Pinned     bool       `json:"pinned"`  // pinned as the default
+	Default    bool       `json:"default"` // the default, pinned or not
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+}
+
+// compareSemver compares two versions as semantic versions, with or
+// without the leading "v". Versions that are not semantic versions sort
+// before those that are.
+func compareSemver(a string, b string) int {
+	if !strings.HasPrefix(a, "v") {
+		a = "v" + a
+	}
+	if !strings.HasPrefix(b, "v") {
+		b = "v" + b
+	}
+	return semver.Compare(a, b)
+}
+
+// sortVersions orders versions from the oldest to the newest. Versions that
+// compare equal are ordered by when they were created.
+func sortVersions(docs []models.Documentation) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		if c := compareSemver(docs[i].Version, docs[j].Version); c != 0 {
+			return c < 0
+		}
+		if docs[i].CreatedAt == nil || docs[j].CreatedAt == nil {
+			return docs[i].ID < docs[j].ID
+		}
+		return docs[i].CreatedAt.Before(*docs[j].CreatedAt)
+	})
+}
+
+// defaultVersion picks the default of sorted, published versions: the pinned
+// one, else the newest that is neither a prerelease nor deprecated, else the
+// newest.
+func defaultVersion(docs []models.Documentation) models.Documentation {
+	for _, doc := range docs {
+		if doc.DefaultVersion {
+			return doc
+		}
+	}
+
+	for i := len(docs) - 1; i >= 0; i-- {
+		if !docs[i].Prerelease && !docs[i].Deprecated {
+			return docs[i]
+		}
+	}
+
+	return docs[len(docs)-1]
+}
+
+// versionDocuments returns every version of the documentation a version
+// belongs to, sorted.
+func (service *DocService) versionDocuments(id uint) (uint, []models.Documentation, error) {
+	rootId, err := service.GetRootParentID(id)
+	if err != nil {
+		return 0, nil, fmt.Errorf("documentation_not_found")
+	}
+
+	ids := []uint{rootId}
+	for i := 0; i < len(ids); i++ {
+		var children []uint
+		if err := service.DB.Model(&models.Documentation{}).Where("cloned_from = ?", ids[i]).Pluck("id", &children).Error; err != nil {
+			return 0, nil, fmt.Errorf("failed_to_get_versions")
+		}
+		ids = append(ids, children...)
+	}
+
+	var docs []models.Documentation
+	if err := service.DB.Select("id", "version", "cloned_from", "created_at", "default_version", "prerelease", "hidden", "deprecated").
+		Where("id IN ?", ids).Find(&docs).Error; err != nil {
+		return 0, nil, fmt.Errorf("failed_to_get_versions")
+	}
+
+	sortVersions(docs)
+
+	return rootId, docs, nil
+}
+
+// GetVersions lists the versions of a documentation from the oldest to the
+// newest.
+func (service *DocService) GetVersions(id uint) ([]VersionDetails, error) {
+	_, docs, err := service.versionDocuments(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var published []models.Documentation
+	for _, doc := range docs {
+		if !doc.Hidden {
+			published = append(published, doc)
+		}
+	}
+
+	defaultId := uint(0)
+	if len(published) > 0 {
+		defaultId = defaultVersion(published).ID
+	}
+
+	versions := make([]VersionDetails, len(docs))
+	for i, doc := range docs {
+		versions[i] = VersionDetails{
+			ID:         doc.ID,
+			Version:    doc.Version,
+			ClonedFrom: doc.ClonedFrom,
+			Prerelease: doc.Prerelease,
+			Hidden:     doc.Hidden,
+			Deprecated: doc.Deprecated,
+			Pinned:     doc.DefaultVersion,
+			Default:    doc.ID == defaultId,
+			CreatedAt:  doc.CreatedAt,
+		}
+	}
+
+	return versions, nil
+}
+
+// versionPrefixes returns the folder each version is served under.
+func (service *DocService) versionPrefixes(docs []models.Documentation) map[uint]string {
+	prefixes := make(map[uint]string)
+	for _, doc := range docs {
+		if versionPrefixes, err := service.versionPathPrefixes(doc.ID); err == nil {
+			prefixes[doc.ID] = versionPrefixes[0]
+		}
+	}
+	return prefixes
+}
+
+// finishVersionChange redirects the old folders of versions that moved, as a
+// version does when it is renamed or becomes the default, and rebuilds the
+// documentation. A version that moves away from the root is not redirected,
+// since the root is still served by the new default. The change is
+// committed by then, so failing to record a redirect is only logged.
+func (service *DocService) finishVersionChange(rootId uint, before map[uint]string) error {
+	_, docs, err := service.versionDocuments(rootId)
+	if err != nil {
+		logger.Error("failed to record the redirects of versions", zap.Uint("documentation_id", rootId), zap.Error(err))
+	}
+
+	for id, prefix := range service.versionPrefixes(docs) {
+		if before[id] == "" {
+			continue
+		}
+
+		if err := service.recordMovedPaths(id, []string{before[id]}, []string{prefix}, true, RedirectVersion); err != nil {
+			logger.Error("failed to record the redirect of a version", zap.Uint("documentation_id", id), zap.Error(err))
+		}
+	}
+
+	if err := service.AddBuildTrigger(rootId, false); err != nil {
+		return fmt.Errorf("failed_to_add_build_trigger")
+	}
+
+	return nil
+}
+
+func findVersion(docs []models.Documentation, id uint) (models.Documentation, bool) {
+	for _, doc := range docs {
+		if doc.ID == id {
+			return doc, true
+		}
+	}
+	return models.Documentation{}, false
+}
+
+func publishedCount(docs []models.Documentation) int {
+	count := 0
+	for _, doc := range docs {
+		if !doc.Hidden {
+			count++
+		}
+	}
+	return count
+}
+
+// RenameVersion renames a version. Links to its old folder are redirected.
+func (service *DocService) RenameVersion(user models.User, id uint, version string) error {
+	version = strings.TrimSpace(version)
+	if version == "" || strings.ContainsAny(version, `/\`) || version == "." || version == ".." {
+		return fmt.Errorf("invalid_version")
+	}
+
+	rootId, docs, err := service.versionDocuments(id)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := findVersion(docs, id); !ok {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	for _, doc := range docs {
+		if doc.ID != id && doc.Version == version {
+			return fmt.Errorf("version_already_exists")
+		}
+	}
+
+	before := service.versionPrefixes(docs)
+
+	if err := service.DB.Model(&models.Documentation{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"version":        version,
+		"last_editor_id": user.ID,
+	}).Error; err != nil {
+		return fmt.Errorf("failed_to_rename_version")
+	}
+
+	return service.finishVersionChange(rootId, before)
+}
+
+// SetVersionStatus marks a version as a prerelease, hidden or deprecated;
+// nil leaves a flag as it is. Hidden versions are not built, so the pinned
+// default and the last published version cannot be hidden.
+func (service *DocService) SetVersionStatus(user models.User, id uint, prerelease *bool, hidden *bool, deprecated *bool) error {
+	rootId, docs, err := service.versionDocuments(id)
+	if err != nil {
+		return err
+	}
+
+	doc, ok := findVersion(docs, id)
+	if !ok {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	updates := map[string]interface{}{"last_editor_id": user.ID}
+	if prerelease != nil {
+		updates["prerelease"] = *prerelease
+	}
+	if deprecated != nil {
+		updates["deprecated"] = *deprecated
+	}
+	if hidden != nil {
+		if *hidden && !doc.Hidden {
+			if doc.DefaultVersion {
+				return fmt.Errorf("default_version_cannot_be_hidden")
+			}
+			if publishedCount(docs) == 1 {
+				return fmt.Errorf("last_published_version")
+			}
+		}
+		updates["hidden"] = *hidden
+	}
+
+	before := service.versionPrefixes(docs)
+
+	if err := service.DB.Model(&models.Documentation{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed_to_update_version")
+	}
+
+	return service.finishVersionChange(rootId, before)
+}
+
+// SetDefaultVersion pins a version as the default, in place of the newest
+// stable one. With pinned false the pin is removed.
+func (service *DocService) SetDefaultVersion(user models.User, id uint, pinned bool) error {
+	rootId, docs, err := service.versionDocuments(id)
+	if err != nil {
+		return err
+	}
+
+	doc, ok := findVersion(docs, id)
+	if !ok {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	if pinned && doc.Hidden {
+		return fmt.Errorf("hidden_version_cannot_be_default")
+	}
+
+	ids := make([]uint, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+
+	before := service.versionPrefixes(docs)
+
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Documentation{}).Where("id IN ?", ids).Update("default_version", false).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Documentation{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"default_version": pinned,
+			"last_editor_id":  user.ID,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed_to_update_version")
+	}
+
+	return service.finishVersionChange(rootId, before)
+}
+
+// DeleteVersion moves a version and its pages into the trash. The first
+// version holds what the whole documentation shares, such as its build, and
+// is only deleted with the documentation.
+func (service *DocService) DeleteVersion(user models.User, id uint) error {
+	rootId, docs, err := service.versionDocuments(id)
+	if err != nil {
+		return err
+	}
+
+	doc, ok := findVersion(docs, id)
+	if !ok {
+		return fmt.Errorf("documentation_not_found")
+	}
+
+	if id == rootId {
+		return fmt.Errorf("root_version_cannot_be_deleted")
+	}
+
+	if !doc.Hidden && publishedCount(docs) == 1 {
+		return fmt.Errorf("last_published_version")
+	}
+
+	before := service.versionPrefixes(docs)
+
+	if err := service.DeleteDocumentation(user, id); err != nil {
+		return err
+	}
+
+	return service.finishVersionChange(rootId, before)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func TestVersionLifecycle(t *testing.T) {
+	admin := getTestAdmin(t)
+	v1 := createTestDocumentation(t, "Lifecycle Doc", "1.0.0", nil)
+	v2 := createTestDocumentation(t, "Lifecycle Doc", "2.0.0", &v1.ID)
+	v19 := createTestDocumentation(t, "Lifecycle Doc", "1.9.0", &v1.ID)
+	beta := createTestDocumentation(t, "Lifecycle Doc", "3.0.0-beta.1", &v2.ID)
+
+	expectVersions := func(wantDefault string, want []string) {
+		t.Helper()
+		latest, versions, err := TestDocService.GetAllVersions(v1.ID)
+		if err != nil {
+			t.Fatalf("GetAllVersions returned an error: %v", err)
+		}
+		if latest != wantDefault || !reflect.DeepEqual(versions, want) {
+			t.Errorf("Expected default %s of %v, got %s of %v", wantDefault, want, latest, versions)
+		}
+	}
+
+	expectRedirect := func(from string, to string) {
+		t.Helper()
+		var redirect models.Redirect
+		if err := TestDocService.DB.Where("documentation_id = ? AND from_path = ?", v1.ID, from).First(&redirect).Error; err != nil || redirect.ToPath != to {
+			t.Errorf("Expected a redirect from %s to %s, got %+v (%v)", from, to, redirect, err)
+		}
+	}
+
+	expectVersions("3.0.0-beta.1", []string{"1.0.0", "1.9.0", "2.0.0", "3.0.0-beta.1"})
+
+	if err := TestDocService.SetVersionStatus(admin, beta.ID, boolPtr(true), nil, nil); err != nil {
+		t.Fatalf("SetVersionStatus returned an error: %v", err)
+	}
+	expectVersions("2.0.0", []string{"1.0.0", "1.9.0", "2.0.0", "3.0.0-beta.1"})
+
+	if err := TestDocService.SetDefaultVersion(admin, v19.ID, true); err != nil {
+		t.Fatalf("SetDefaultVersion returned an error: %v", err)
+	}
+	expectVersions("1.9.0", []string{"1.0.0", "1.9.0", "2.0.0", "3.0.0-beta.1"})
+	expectRedirect("/1.9.0/*", "/*")
+
+	if err := TestDocService.SetVersionStatus(admin, v19.ID, nil, boolPtr(true), nil); err == nil || err.Error() != "default_version_cannot_be_hidden" {
+		t.Errorf("Expected 'default_version_cannot_be_hidden' error, got %v", err)
+	}
+
+	if err := TestDocService.SetDefaultVersion(admin, v19.ID, false); err != nil {
+		t.Fatalf("SetDefaultVersion returned an error: %v", err)
+	}
+
+	if err := TestDocService.SetVersionStatus(admin, v19.ID, nil, boolPtr(true), boolPtr(true)); err != nil {
+		t.Fatalf("SetVersionStatus returned an error: %v", err)
+	}
+	expectVersions("2.0.0", []string{"1.0.0", "2.0.0", "3.0.0-beta.1"})
+
+	if err := TestDocService.RenameVersion(admin, v1.ID, "2.0.0"); err == nil || err.Error() != "version_already_exists" {
+		t.Errorf("Expected 'version_already_exists' error, got %v", err)
+	}
+
+	if err := TestDocService.RenameVersion(admin, v1.ID, "1.0.1"); err != nil {
+		t.Fatalf("RenameVersion returned an error: %v", err)
+	}
+	expectVersions("2.0.0", []string{"1.0.1", "2.0.0", "3.0.0-beta.1"})
+	expectRedirect("/1.0.0/*", "/1.0.1/*")
+
+	versions, err := TestDocService.GetVersions(v2.ID)
+	if err != nil {
+		t.Fatalf("GetVersions returned an error: %v", err)
+	}
+	if len(versions) != 4 || versions[1].Version != "1.9.0" || !versions[1].Hidden || !versions[1].Deprecated || !versions[2].Default {
+		t.Errorf("Unexpected versions: %+v", versions)
+	}
+
+	if err := TestDocService.DeleteVersion(admin, v1.ID); err == nil || err.Error() != "root_version_cannot_be_deleted" {
+		t.Errorf("Expected 'root_version_cannot_be_deleted' error, got %v", err)
+	}
+
+	if err := TestDocService.DeleteVersion(admin, v19.ID); err != nil {
+		t.Fatalf("DeleteVersion returned an error: %v", err)
+	}
+
+	versions, _ = TestDocService.GetVersions(v1.ID)
+	if len(versions) != 3 {
+		t.Errorf("Expected 3 versions after deleting one, got %+v", versions)
+	}
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	htmlTemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db/models"
+	"git.difuse.io/Difuse/kalmia/embedded"
+	"git.difuse.io/Difuse/kalmia/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+// smtpTimeout bounds connecting to the SMTP server and each send.
+const smtpTimeout = 30 * time.Second
+
+type MailService struct {
+	DB *gorm.DB
+}
+
+func NewMailService(db *gorm.DB) *MailService {
+	return &MailService{DB: db}
+}
+
+func emailConfig() config.Email {
+	cfg := config.Email{}
+	if config.ParsedConfig != nil {
+		cfg = config.ParsedConfig.Email
+	}
+	cfg.SetDefault()
+	return cfg
+}
+
+// renderEmail fills the "subject", "text" and "html" parts of an email
+// template. A file of the same name in the configured templates path
+// replaces the built-in template.
+func renderEmail(name string, data interface{}) (subject string, text string, html string, err error) {
+	source, err := embedded.EmailsFS.ReadFile("emails/" + name + ".tmpl")
+	if dir := emailConfig().TemplatesPath; dir != "" {
+		if custom, customErr := os.ReadFile(filepath.Join(dir, name+".tmpl")); customErr == nil {
+			source, err = custom, nil
+		}
+	}
+	if err != nil {
+		return "", "", "", fmt.Errorf("email_template_not_found")
+	}
+
+	textTmpl, err := textTemplate.New(name).Parse(string(source))
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid_email_template")
+	}
+
+	var buf bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", "", fmt.Errorf("invalid_email_template")
+	}
+	subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := textTmpl.ExecuteTemplate(&buf, "text", data); err != nil {
+		return "", "", "", fmt.Errorf("invalid_email_template")
+	}
+	text = buf.String()
+
+	htmlTmpl, err := htmlTemplate.New(name).Parse(string(source))
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid_email_template")
+	}
+
+	if htmlTmpl.Lookup("html") != nil {
+		buf.Reset()
+		if err := htmlTmpl.ExecuteTemplate(&buf, "html", data); err != nil {
+			return "", "", "", fmt.Errorf("invalid_email_template")
+		}
+		html = buf.String()
+	}
+
+	return subject, text, html, nil
+}
+
+// enqueueEmail renders a template into the outbox within tx, so the email
+// is only queued when the change it belongs to is committed.
+func enqueueEmail(tx *gorm.DB, recipient string, template string, data interface{}) error {
+	subject, text, html, err := renderEmail(template, data)
+	if err != nil {
+		return err
+	}
+
+	email := models.OutboxEmail{
+		Recipient:     recipient,
+		Subject:       subject,
+		Text:          text,
+		HTML:          html,
+		Status:        EmailPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	if err := tx.Create(&email).Error; err != nil {
+		return fmt.Errorf("failed_to_queue_email")
+	}
+
+	return nil
+}
+
+func (service *MailService) Enqueue(recipient string, template string, data interface{}) error {
+	return enqueueEmail(service.DB, recipient, template, data)
+}
+
+// retryDelay backs off exponentially from a minute up to an hour.
+func retryDelay(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// SendPending sends the emails that are due and returns how many went out.
+// A failed email is retried later until it runs out of attempts.
+func (service *MailService) SendPending() (int, error) {
+	cfg := emailConfig()
+	if cfg.Host == "" {
+		return 0, nil
+	}
+
+	var emails []models.OutboxEmail
+	if err := service.DB.Where("status = ? AND next_attempt_at <= ?", EmailPending, time.Now()).
+		Order("next_attempt_at").
+		Limit(20).
+		Find(&emails).Error; err != nil {
+		return 0, fmt.Errorf("failed_to_get_outbox")
+	}
+
+	sent := 0
+	for _, email := range emails {
+		err := sendSMTP(cfg, email)
+		now := time.Now()
+
+		updates := map[string]interface{}{"attempts": email.Attempts + 1}
+		if err == nil {
+			// the links in a sent email must not outlive it
+			updates["status"] = EmailSent
+			updates["sent_at"] = now
+			updates["text"] = ""
+			updates["html"] = ""
+			updates["last_error"] = ""
+			sent++
+		} else {
+			updates["last_error"] = err.Error()
+			updates["next_attempt_at"] = now.Add(retryDelay(email.Attempts + 1))
+			if email.Attempts+1 >= cfg.MaxAttempts {
+				updates["status"] = EmailFailed
+			}
+			logger.Error("Failed to send email", zap.Uint("id", email.ID), zap.Error(err))
+		}
+
+		if err := service.DB.Model(&models.OutboxEmail{}).Where("id = ?", email.ID).Updates(updates).Error; err != nil {
+			return sent, fmt.Errorf("failed_to_update_outbox")
+		}
+	}
+
+	return sent, nil
+}
+
+func (service *MailService) SendJob() {
+	sent, err := service.SendPending()
+	if err != nil {
+		logger.Error("(SendJob) Failed to send emails", zap.Error(err))
+	}
+
+	if sent > 0 {
+		logger.Info("Sent queued emails", zap.Int("count", sent))
+	}
+}
+
+// GetOutbox lists the latest emails, without their bodies.
+func (service *MailService) GetOutbox() ([]models.OutboxEmail, error) {
+	var emails []models.OutboxEmail
+	if err := service.DB.Omit("text", "html").Order("id DESC").Limit(100).Find(&emails).Error; err != nil {
+		return nil, fmt.Errorf("failed_to_get_outbox")
+	}
+
+	return emails, nil
+}
+
+// RetryEmail queues a failed email again with fresh attempts.
+func (service *MailService) RetryEmail(id uint) error {
+	var email models.OutboxEmail
+	if err := service.DB.Omit("text", "html").First(&email, id).Error; err != nil {
+		return fmt.Errorf("email_not_found")
+	}
+
+	if email.Status == EmailSent {
+		return fmt.Errorf("email_already_sent")
+	}
+
+	if err := service.DB.Model(&models.OutboxEmail{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          EmailPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed_to_update_outbox")
+	}
+
+	return nil
+}
+
+func buildMessage(from string, email models.OutboxEmail) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	bodies := []struct{ contentType, content string }{{"text/plain", email.Text}}
+	if email.HTML != "" {
+		bodies = append(bodies, struct{ contentType, content string }{"text/html", email.HTML})
+	}
+
+	for _, b := range bodies {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {b.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(b.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	domain := "kalmia"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if _, host, found := strings.Cut(address.Address, "@"); found {
+			domain = host
+		}
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", email.Recipient)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// sendSMTP delivers one email. Security "tls" connects over TLS, "starttls"
+// requires the server to upgrade the connection and "none" sends in the
+// clear, for local relays and test servers.
+func sendSMTP(cfg config.Email, email models.OutboxEmail) error {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid_email_from")
+	}
+
+	msg, err := buildMessage(cfg.From, email)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	if cfg.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if cfg.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp_starttls_not_supported")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(email.Recipient); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
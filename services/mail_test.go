@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.difuse.io/Difuse/kalmia/config"
+	"git.difuse.io/Difuse/kalmia/db"
+	"git.difuse.io/Difuse/kalmia/db/models"
+)
+
+// testSMTPServer is a local SMTP stand-in that keeps the messages it
+// receives, or rejects every recipient.
+type testSMTPServer struct {
+	listener net.Listener
+	reject   bool
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func startTestSMTPServer(t *testing.T) *testSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start the SMTP stand-in: %v", err)
+	}
+
+	server := &testSMTPServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (s *testSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "RCPT"):
+			s.mu.Lock()
+			reject := s.reject
+			s.mu.Unlock()
+			if reject {
+				reply("550 mailbox unavailable")
+			} else {
+				reply("250 OK")
+			}
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *testSMTPServer) setReject(reject bool) {
+	s.mu.Lock()
+	s.reject = reject
+	s.mu.Unlock()
+}
+
+func (s *testSMTPServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+// useTestSMTPServer points the email config at the stand-in for one test.
+func useTestSMTPServer(t *testing.T, server *testSMTPServer) {
+	t.Helper()
+
+	previous := config.ParsedConfig.Email
+	t.Cleanup(func() { config.ParsedConfig.Email = previous })
+
+	_, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	config.ParsedConfig.Email.Host = "127.0.0.1"
+	config.ParsedConfig.Email.Port, _ = strconv.Atoi(port)
+	config.ParsedConfig.Email.Security = "none"
+	config.ParsedConfig.Email.From = "Kalmia <no-reply@kalmia.difuse.io>"
+	config.ParsedConfig.Email.MaxAttempts = 2
+}
+
+func clearOutbox(t *testing.T) {
+	t.Helper()
+	TestMailService.DB.Where("1 = 1").Delete(&models.OutboxEmail{})
+}
+
+func TestSendPendingEmails(t *testing.T) {
+	clearOutbox(t)
+	t.Cleanup(func() { clearOutbox(t) })
+
+	data := linkEmailData{Username: "someone", Link: "http://localhost/admin/reset-password?token=abc", Expires: "1 hour"}
+
+	t.Run("Emails stay queued without a host", func(t *testing.T) {
+		if err := TestMailService.Enqueue("someone@kalmia.difuse.io", "password_reset", data); err != nil {
+			t.Fatalf("Enqueue returned an error: %v", err)
+		}
+
+		var raw string
+		TestMailService.DB.Table("outbox_emails").Select("text").Order("id DESC").Limit(1).Row().Scan(&raw)
+		if !db.IsEncryptedSecret(raw) {
+			t.Errorf("Expected the queued body to be encrypted, got %q", raw)
+		}
+
+		sent, err := TestMailService.SendPending()
+		if err != nil || sent != 0 {
+			t.Errorf("Expected nothing to be sent, got %d (%v)", sent, err)
+		}
+	})
+
+	t.Run("Queued emails are delivered", func(t *testing.T) {
+		server := startTestSMTPServer(t)
+		useTestSMTPServer(t, server)
+
+		sent, err := TestMailService.SendPending()
+		if err != nil || sent != 1 {
+			t.Fatalf("Expected one email to be sent, got %d (%v)", sent, err)
+		}
+
+		messages := server.received()
+		if len(messages) != 1 || !strings.Contains(messages[0], "To: someone@kalmia.difuse.io") ||
+			!strings.Contains(messages[0], "Subject: Reset your Kalmia password") {
+			t.Fatalf("Unexpected messages: %v", messages)
+		}
+
+		var email models.OutboxEmail
+		TestMailService.DB.Order("id DESC").First(&email)
+		if email.Status != EmailSent || email.SentAt == nil || email.Text != "" || email.HTML != "" {
+			t.Errorf("Expected a sent email without its bodies, got %+v", email)
+		}
+	})
+
+	t.Run("Failed emails are retried until they run out of attempts", func(t *testing.T) {
+		server := startTestSMTPServer(t)
+		useTestSMTPServer(t, server)
+		server.setReject(true)
+
+		if err := TestMailService.Enqueue("nobody@kalmia.difuse.io", "invitation", data); err != nil {
+			t.Fatalf("Enqueue returned an error: %v", err)
+		}
+
+		if sent, _ := TestMailService.SendPending(); sent != 0 {
+			t.Fatalf("Expected the email to be rejected")
+		}
+
+		var email models.OutboxEmail
+		TestMailService.DB.Order("id DESC").First(&email)
+		if email.Status != EmailPending || email.Attempts != 1 || email.LastError == "" || !email.NextAttemptAt.After(time.Now()) {
+			t.Fatalf("Expected a retry to be scheduled, got %+v", email)
+		}
+
+		TestMailService.DB.Model(&email).Update("next_attempt_at", time.Now().Add(-time.Second))
+		TestMailService.SendPending()
+		TestMailService.DB.First(&email, email.ID)
+		if email.Status != EmailFailed || email.Attempts != 2 {
+			t.Fatalf("Expected the email to fail after its attempts, got %+v", email)
+		}
+
+		if err := TestMailService.RetryEmail(email.ID); err != nil {
+			t.Fatalf("RetryEmail returned an error: %v", err)
+		}
+
+		server.setReject(false)
+		if sent, err := TestMailService.SendPending(); sent != 1 {
+			t.Errorf("Expected the retried email to be sent, got %d (%v)", sent, err)
+		}
+
+		if err := TestMailService.RetryEmail(email.ID); err == nil || err.Error() != "email_already_sent" {
+			t.Errorf("Expected email_already_sent, got %v", err)
+		}
+	})
+}
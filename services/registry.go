@@ -8,11 +8,13 @@ import (
 type ServiceRegistry struct {
 	AuthService *AuthService
 	DocService  *DocService
+	MailService *MailService
 }
 
 func NewServiceRegistry(db *gorm.DB, logSubCmd bool, secret config.Secret) *ServiceRegistry {
 	return &ServiceRegistry{
 		AuthService: NewAuthService(db, secret.JwtSecretKey),
 		DocService:  NewDocService(db, logSubCmd),
+		MailService: NewMailService(db),
 	}
 }
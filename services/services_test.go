@@ -14,6 +14,7 @@ import (
 var TestConfig *config.Config
 var TestAuthService *AuthService
 var TestDocService *DocService
+var TestMailService *MailService
 
 func TestMain(m *testing.M) {
 	configJson := `{
@@ -23,11 +24,18 @@ func TestMain(m *testing.M) {
 		"database": "sqlite",
 		"sessionSecret": "test",
 		"dataPath": "./service_test_dir",
+		"pathToSecretFile": "./secret.json",
 		"users": [{"username": "admin", "email": "admin@kalmia.difuse.io", "password": "admin", "admin": true}, 
 				  {"username": "user", "email": "user@kalmia.difuse.io", "password": "user", "admin": false}]
 	}`
 
-	err := utils.TouchFile("./config.json")
+	err := utils.WriteToFile("./secret.json", `{"JwtSecretKey": "test"}`)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = utils.TouchFile("./config.json")
 
 	if err != nil {
 		panic(err)
@@ -50,12 +58,16 @@ func TestMain(m *testing.M) {
 	logger.InitializeLogger("test", TestConfig.LogLevel, TestConfig.DataPath)
 
 	d := db.SetupDatabase(TestConfig.Environment, TestConfig.Database, TestConfig.DataPath)
+	if err := db.SetupSecrets(d, TestConfig); err != nil {
+		panic(err)
+	}
 	db.SetupBasicData(d, TestConfig.Admins)
 	db.InitCache()
 
-	serviceRegistry := NewServiceRegistry(d)
+	serviceRegistry := NewServiceRegistry(d, false, TestConfig.Secret)
 	TestAuthService = serviceRegistry.AuthService
 	TestDocService = serviceRegistry.DocService
+	TestMailService = serviceRegistry.MailService
 
 	code := m.Run()
 
@@ -71,5 +83,11 @@ func TestMain(m *testing.M) {
 		logger.Error("Failed to remove test config file: %v", zap.Error(err))
 	}
 
+	err = utils.RemovePath("./secret.json")
+
+	if err != nil {
+		logger.Error("Failed to remove test secret file", zap.Error(err))
+	}
+
 	os.Exit(code)
 }
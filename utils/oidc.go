@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// OIDCDiscovery is the part of an OpenID Connect discovery document that
+// logins need.
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// JWK is a public key of a JSON Web Key Set, RSA or EC.
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// idTokenMethods are the asymmetric algorithms ID tokens are accepted in.
+// HS256 would make the client secret a signing key, and "none" is never
+// acceptable.
+var idTokenMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// idTokenLeeway allows for clocks of the provider and Kalmia that differ.
+const idTokenLeeway = time.Minute
+
+func getJSON(ctx context.Context, client *http.Client, url string, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// FetchOIDCDiscovery reads the discovery document of an issuer, which must
+// name the same issuer.
+func FetchOIDCDiscovery(ctx context.Context, client *http.Client, issuer string) (OIDCDiscovery, error) {
+	var discovery OIDCDiscovery
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return OIDCDiscovery{}, err
+	}
+
+	if discovery.Issuer != issuer {
+		return OIDCDiscovery{}, fmt.Errorf("discovery document is for issuer %q, not %q", discovery.Issuer, issuer)
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return OIDCDiscovery{}, fmt.Errorf("discovery document of %q lacks an endpoint", issuer)
+	}
+
+	return discovery, nil
+}
+
+// FetchJWKS returns the signing keys of a key set by key ID. Keys of other
+// types or meant for encryption are left out.
+func FetchJWKS(ctx context.Context, client *http.Client, uri string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := getJSON(ctx, client, uri, "", &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := ParseJWK(jwk)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// FetchOIDCUserinfo returns the claims of the userinfo endpoint.
+func FetchOIDCUserinfo(ctx context.Context, client *http.Client, uri string, accessToken string) (map[string]interface{}, error) {
+	claims := map[string]interface{}{}
+	if err := getJSON(ctx, client, uri, accessToken, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeJWKInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// ParseJWK turns an RSA or EC JWK into its public key.
+func ParseJWK(jwk JWK) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := decodeJWKInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC key is not on its curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// VerifyIDToken checks the signature of an ID token with the key named by
+// its kid, then that it was issued by issuer for clientID, has not expired
+// and carries the nonce of the login.
+func VerifyIDToken(raw string, key func(kid string) (crypto.PublicKey, error), issuer string, clientID string, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(idTokenMethods), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer")
+	}
+
+	if !claims.VerifyAudience(clientID, true) {
+		return nil, fmt.Errorf("unexpected audience")
+	}
+
+	// a token for several audiences must have been requested by this client
+	if audiences, ok := claims["aud"].([]interface{}); ok && len(audiences) > 1 {
+		if azp, _ := claims["azp"].(string); azp != clientID {
+			return nil, fmt.Errorf("unexpected authorized party")
+		}
+	}
+
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-idTokenLeeway).Unix(), true) {
+		return nil, fmt.Errorf("token has expired")
+	}
+
+	if !claims.VerifyNotBefore(now.Add(idTokenLeeway).Unix(), false) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return nil, fmt.Errorf("unexpected nonce")
+	}
+
+	return claims, nil
+}
+
+// ClaimStrings reads a claim that holds a string or a list of strings. A
+// path with dots, such as "realm_access.roles", reaches into nested
+// objects.
+func ClaimStrings(claims map[string]interface{}, path string) []string {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
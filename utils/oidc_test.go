@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func signTestIDToken(t *testing.T, key *rsa.PrivateKey, method jwt.SigningMethod, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = "test"
+
+	var signingKey interface{} = key
+	if method == jwt.SigningMethodHS256 {
+		signingKey = []byte("client-secret")
+	}
+
+	raw, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatalf("Failed to sign the token: %v", err)
+	}
+	return raw
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate a key: %v", err)
+	}
+
+	keyFunc := func(kid string) (crypto.PublicKey, error) {
+		if kid != "test" {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return &key.PublicKey, nil
+	}
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   "https://idp.example.com",
+			"aud":   "kalmia",
+			"sub":   "1234",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	raw := signTestIDToken(t, key, jwt.SigningMethodRS256, validClaims())
+	claims, err := VerifyIDToken(raw, keyFunc, "https://idp.example.com", "kalmia", "nonce")
+	if err != nil {
+		t.Fatalf("Expected a valid token, got %v", err)
+	}
+	if claims["sub"] != "1234" {
+		t.Errorf("Expected the claims of the token, got %v", claims)
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		change func(jwt.MapClaims)
+	}{
+		{"Wrong issuer", jwt.SigningMethodRS256, func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" }},
+		{"Wrong audience", jwt.SigningMethodRS256, func(c jwt.MapClaims) { c["aud"] = "other" }},
+		{"Other authorized party", jwt.SigningMethodRS256, func(c jwt.MapClaims) { c["aud"] = []string{"kalmia", "other"}; c["azp"] = "other" }},
+		{"Expired", jwt.SigningMethodRS256, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"No expiry", jwt.SigningMethodRS256, func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"Wrong nonce", jwt.SigningMethodRS256, func(c jwt.MapClaims) { c["nonce"] = "other" }},
+		{"Symmetric signature", jwt.SigningMethodHS256, func(c jwt.MapClaims) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.change(claims)
+
+			raw := signTestIDToken(t, key, tt.method, claims)
+			if _, err := VerifyIDToken(raw, keyFunc, "https://idp.example.com", "kalmia", "nonce"); err == nil {
+				t.Errorf("Expected the token to be rejected")
+			}
+		})
+	}
+}
+
+func TestParseJWK(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	parsed, err := ParseJWK(JWK{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	})
+	if err != nil || !rsaKey.PublicKey.Equal(parsed) {
+		t.Errorf("Expected the RSA key back, got %v (%v)", parsed, err)
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	parsed, err = ParseJWK(JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+	})
+	if err != nil || !ecKey.PublicKey.Equal(parsed) {
+		t.Errorf("Expected the EC key back, got %v (%v)", parsed, err)
+	}
+
+	if _, err := ParseJWK(JWK{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}); err == nil {
+		t.Errorf("Expected a point off the curve to be rejected")
+	}
+}
+
+func TestClaimStrings(t *testing.T) {
+	claims := map[string]interface{}{
+		"groups":       []interface{}{"docs-admins", "docs-writers"},
+		"role":         "editor",
+		"realm_access": map[string]interface{}{"roles": []interface{}{"offline_access", "kalmia"}},
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"groups", []string{"docs-admins", "docs-writers"}},
+		{"role", []string{"editor"}},
+		{"realm_access.roles", []string{"offline_access", "kalmia"}},
+		{"missing", nil},
+		{"role.nested", nil},
+	}
+
+	for _, tt := range tests {
+		got := ClaimStrings(claims, tt.path)
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) || (got == nil) != (tt.expected == nil) {
+			t.Errorf("ClaimStrings(%q) = %v, expected %v", tt.path, got, tt.expected)
+		}
+	}
+}
@@ -8,7 +8,7 @@ import (
 func TestRunNpmCommand(t *testing.T) {
 	tempDir := createTempTestDir(t)
 
-	initCmd := RunNpmCommand(tempDir, "init")
+	initCmd := RunNpmCommand(false, tempDir, "init")
 	if initCmd != nil {
 		t.Fatalf("Failed to initialize npm project: %v", initCmd)
 	}
@@ -45,7 +45,7 @@ func TestRunNpmCommand(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := RunNpmCommand(tt.dir, tt.command, tt.args...)
+			err := RunNpmCommand(false, tt.dir, tt.command, tt.args...)
 
 			if tt.expectError && err == nil {
 				t.Errorf("Expected an error, but got none")
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("TOTPCode() at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+
+	now := time.Now()
+	code, _ := TOTPCode(secret, TOTPStep(now))
+
+	step, ok := ValidateTOTP(secret, code, now, 0)
+	if !ok || step != TOTPStep(now) {
+		t.Fatalf("Expected the current code to validate")
+	}
+
+	if _, ok := ValidateTOTP(secret, code, now, step); ok {
+		t.Errorf("Expected a used code to be refused")
+	}
+
+	if _, ok := ValidateTOTP(secret, code, now.Add(2*time.Minute), 0); ok {
+		t.Errorf("Expected an old code to be refused")
+	}
+
+	previous, _ := TOTPCode(secret, TOTPStep(now)-1)
+	if _, ok := ValidateTOTP(secret, previous, now, 0); !ok {
+		t.Errorf("Expected the previous period to be accepted for drift")
+	}
+
+	uri := TOTPProvisioningURI("Kalmia", "admin", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Kalmia:admin?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected provisioning URI %s", uri)
+	}
+}
@@ -15,7 +15,10 @@ import { AuthProvider } from "./context/AuthContext";
 import { ModalProvider } from "./context/ModalContext";
 import { ThemeProvider } from "./context/ThemeContext";
 import DashboardPage from "./pages/DashboardPage";
+import ForgotPasswordPage from "./pages/ForgotPasswordPage";
 import LoginPage from "./pages/LoginPage";
+import SetPasswordPage from "./pages/SetPasswordPage";
+import TwoFactorPage from "./pages/TwoFactorPage";
 import AdminAuth from "./protected/AdminAuth";
 import LoginAuth from "./protected/LoginAuth";
 import RequireAuth from "./protected/RequireAuth";
@@ -37,6 +40,20 @@ function App() {
                   <Route path="/login/gh" element={<LoginPage />} />
                   <Route path="/login/ms" element={<LoginPage />} />
                   <Route path="/login/gg" element={<LoginPage />} />
+                  <Route path="/login/oidc" element={<LoginPage />} />
+                  <Route path="/login/2fa" element={<TwoFactorPage />} />
+                  <Route
+                    path="/forgot-password"
+                    element={<ForgotPasswordPage />}
+                  />
+                  <Route
+                    path="/reset-password"
+                    element={<SetPasswordPage mode="reset" />}
+                  />
+                  <Route
+                    path="/invite"
+                    element={<SetPasswordPage mode="invite" />}
+                  />
                 </Route>
 
                 <Route element={<RequireAuth />}>
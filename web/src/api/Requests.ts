@@ -45,6 +45,9 @@ export interface DocumentationPayload {
   gitEmail?: string;
   gitPassword?: string;
   gitBranch?: string;
+  // secrets are write-only; an empty one is kept unless cleared
+  clearGitPassword?: boolean;
+  clearTokenSecret?: boolean;
 
   // stored in bucket named
   bucketFavicon: string;
@@ -53,6 +56,8 @@ export interface DocumentationPayload {
   bucketNavImageDark: string;
   // token for auth
   tokenSecret: string;
+  // revision the edit is based on
+  baseRevision?: number;
 }
 
 interface CreateVersionPayload {
@@ -67,6 +72,7 @@ interface PageGroupPayload {
   parentId?: number;
   id?: number;
   order?: number;
+  baseRevision?: number;
 }
 
 interface PagePayload {
@@ -77,6 +83,7 @@ interface PagePayload {
   documentationId?: number;
   order?: number;
   pageGroupId?: number;
+  baseRevision?: number;
 }
 
 export interface OrderItem {
@@ -100,6 +107,8 @@ export interface UserPayload {
   admin?: boolean;
 }
 
+export type InvitePayload = Omit<UserPayload, "password">;
+
 export interface GitBookPayload {
   username: string;
   password: string;
@@ -288,6 +297,55 @@ export const uploadAssetsFile = (data: FormData) =>
 export const deleteUser = (username: string) =>
   makeRequest("/kal-api/auth/user/delete", "post", { username });
 
+export const inviteUser = (data: InvitePayload) =>
+  makeRequest("/kal-api/auth/user/invite", "post", data);
+
+export const acceptInvitation = (token: string, password: string) =>
+  makeRequest("/kal-api/auth/invite/accept", "post", { token, password });
+
+export const forgotPassword = (email: string) =>
+  makeRequest("/kal-api/auth/password/forgot", "post", { email });
+
+export const resetPassword = (token: string, password: string) =>
+  makeRequest("/kal-api/auth/password/reset", "post", { token, password });
+
+export const getOutbox = () => makeRequest("/kal-api/auth/outbox");
+
+export const retryEmail = (id: number) =>
+  makeRequest("/kal-api/auth/outbox/retry", "post", { id });
+
+export const enrollTwoFactorChallenge = (challenge: string) =>
+  makeRequest("/kal-api/auth/2fa/challenge/enroll", "post", { challenge });
+
+export const verifyTwoFactorChallenge = (challenge: string, code: string) =>
+  makeRequest("/kal-api/auth/2fa/challenge/verify", "post", {
+    challenge,
+    code,
+  });
+
+export const beginTwoFactorEnrolment = () =>
+  makeRequest("/kal-api/auth/2fa/enroll", "post");
+
+export const confirmTwoFactorEnrolment = (code: string) =>
+  makeRequest("/kal-api/auth/2fa/confirm", "post", { code });
+
+export const disableTwoFactor = (code: string) =>
+  makeRequest("/kal-api/auth/2fa/disable", "post", { code });
+
+export const regenerateRecoveryCodes = (code: string) =>
+  makeRequest("/kal-api/auth/2fa/recovery-codes", "post", { code });
+
+export const resetTwoFactor = (id: number) =>
+  makeRequest("/kal-api/auth/user/2fa/reset", "post", { id });
+
+export const requireTwoFactor = (id: number, required: boolean) =>
+  makeRequest("/kal-api/auth/user/2fa/require", "post", { id, required });
+
+export const getLockouts = () => makeRequest("/kal-api/auth/lockouts");
+
+export const clearLockout = (id: number) =>
+  makeRequest("/kal-api/auth/lockout/clear", "post", { id });
+
 export const getRootParentId = (docId: number) =>
   makeRequest(`/docs/documentation/root-parent-id?id=${docId}`);
 
@@ -302,3 +360,17 @@ export const oAuthProviders = async (): Promise<string[]> => {
     throw new Error(`Error fetching OAuth providers: ${response.message}`);
   }
 };
+
+export interface OIDCProvider {
+  name: string;
+  displayName: string;
+}
+
+export const oidcProviders = async (): Promise<OIDCProvider[]> => {
+  const response = await makeRequest<OIDCProvider[]>("/kal-api/oauth/oidc");
+  if (response.status === "success") {
+    return response.data as OIDCProvider[];
+  } else {
+    throw new Error(`Error fetching OIDC providers: ${response.message}`);
+  }
+};
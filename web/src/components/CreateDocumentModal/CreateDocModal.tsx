@@ -210,7 +210,7 @@ export default function CreateDocModal() {
 
           if (result.status === "success") {
             const data: Documentation = result.data;
-            setFormData(data);
+            setFormData({ ...data, gitPassword: "", tokenSecret: "" });
 
             if (data.gitUser) {
               SetGitDeployOn(true);
@@ -461,7 +461,7 @@ export default function CreateDocModal() {
           gitBranch: formData.gitBranch || "",
           tokenSecret: formData.tokenSecret || "",
         }
-      : {};
+      : { clearGitPassword: true };
 
     const payload: DocumentationPayload = {
       id: docId,
@@ -492,6 +492,7 @@ export default function CreateDocModal() {
       bucketNavImage: uploadedFiles.navImage.name || "",
       bucketNavImageDark: uploadedFiles.navImageDark.name || "",
       tokenSecret: formData.tokenSecret || "",
+      baseRevision: formData.revision,
     };
     let result;
 
@@ -764,7 +765,9 @@ export default function CreateDocModal() {
                   />
                   <FormField
                     label={t("token_secret")}
-                    placeholder=""
+                    placeholder={
+                      formData?.tokenSecretSet ? t("secret_set_placeholder") : ""
+                    }
                     value={formData?.tokenSecret}
                     onChange={handleChange}
                     name="tokenSecret"
@@ -1207,7 +1210,11 @@ export default function CreateDocModal() {
                       />
                       <FormField
                         label={t("git_password")}
-                        placeholder={t("git_password_placeholder")}
+                        placeholder={
+                          formData?.gitPasswordSet
+                            ? t("secret_set_placeholder")
+                            : t("git_password_placeholder")
+                        }
                         value={formData?.gitPassword}
                         onChange={handleChange}
                         name="gitPassword"
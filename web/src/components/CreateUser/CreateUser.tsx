@@ -3,7 +3,12 @@ import React, { ChangeEvent, JSX, useEffect, useRef, useState } from "react";
 import { useTranslation } from "react-i18next";
 import { useNavigate } from "react-router-dom";
 
-import { ApiResponse, createUser, UserPayload } from "../../api/Requests";
+import {
+  ApiResponse,
+  createUser,
+  inviteUser,
+  UserPayload,
+} from "../../api/Requests";
 import { formatRole, handleError, permissionList } from "../../utils/Common";
 import { toastMessage } from "../../utils/Toast";
 import Breadcrumb from "../Breadcrumb/Breadcrumb";
@@ -17,6 +22,7 @@ export default function CreateUser(): JSX.Element {
   const [permissions, setPermissions] = useState<string[] | null>(null);
   const [password, setPassword] = useState<string>("");
   const [confirmPassword, setConfirmPassword] = useState<string>("");
+  const [invite, setInvite] = useState<boolean>(false);
   const [dropdown, setDropdown] = useState<boolean>(false);
 
   const navigate = useNavigate();
@@ -36,12 +42,12 @@ export default function CreateUser(): JSX.Element {
       return;
     }
 
-    if (password.length < 8) {
+    if (!invite && password.length < 8) {
       toastMessage(t("password_must_be_at_least_8_characters"), "warning");
       return;
     }
 
-    if (password !== confirmPassword) {
+    if (!invite && password !== confirmPassword) {
       toastMessage(t("password_and_confirm_password_do_not_match"), "warning");
       return;
     }
@@ -54,10 +60,20 @@ export default function CreateUser(): JSX.Element {
       admin: permissions.length == 1 && permissions[0] === "all" ? true : false,
     };
 
-    const result: ApiResponse = await createUser(userData);
+    const result: ApiResponse = invite
+      ? await inviteUser({
+          username,
+          email,
+          permissions: userData.permissions,
+          admin: userData.admin,
+        })
+      : await createUser(userData);
 
     if (result.status === "success") {
-      toastMessage(t("user_created_successfully"), "success");
+      toastMessage(
+        t(invite ? "invitation_sent" : "user_created_successfully"),
+        "success",
+      );
       navigate("/dashboard/admin/user-list");
     } else {
       handleError(result, navigate, t);
@@ -169,39 +185,54 @@ export default function CreateUser(): JSX.Element {
               )}
             </div>
           </div>
-          <div>
-            <span className="block text-sm font-medium text-gray-700 dark:text-gray-300 mb-2">
-              {t("password")}
-              {requiredField()}
-            </span>
+          <label className="flex items-center gap-2 text-sm font-medium text-gray-700 dark:text-gray-300">
             <input
-              type="password"
-              id="password"
-              value={password}
+              type="checkbox"
+              checked={invite}
               onChange={(e: ChangeEvent<HTMLInputElement>) =>
-                setPassword(e.target.value)
+                setInvite(e.target.checked)
               }
-              className="w-full px-3 py-2 border rounded-md border-gray-300 dark:border-gray-600 bg-white dark:bg-gray-700 text-gray-900 dark:text-white"
-              required
             />
-          </div>
+            {t("send_invitation")}
+          </label>
 
-          <div>
-            <span className="block text-sm font-medium text-gray-700 dark:text-gray-300 mb-2">
-              {t("confirm_password")}
-              {requiredField()}
-            </span>
-            <input
-              type="password"
-              id="confirmPassword"
-              value={confirmPassword}
-              onChange={(e: ChangeEvent<HTMLInputElement>) =>
-                setConfirmPassword(e.target.value)
-              }
-              className="w-full px-3 py-2 border rounded-md border-gray-300 dark:border-gray-600 bg-white dark:bg-gray-700 text-gray-900 dark:text-white"
-              required
-            />
-          </div>
+          {!invite && (
+            <>
+              <div>
+                <span className="block text-sm font-medium text-gray-700 dark:text-gray-300 mb-2">
+                  {t("password")}
+                  {requiredField()}
+                </span>
+                <input
+                  type="password"
+                  id="password"
+                  value={password}
+                  onChange={(e: ChangeEvent<HTMLInputElement>) =>
+                    setPassword(e.target.value)
+                  }
+                  className="w-full px-3 py-2 border rounded-md border-gray-300 dark:border-gray-600 bg-white dark:bg-gray-700 text-gray-900 dark:text-white"
+                  required
+                />
+              </div>
+
+              <div>
+                <span className="block text-sm font-medium text-gray-700 dark:text-gray-300 mb-2">
+                  {t("confirm_password")}
+                  {requiredField()}
+                </span>
+                <input
+                  type="password"
+                  id="confirmPassword"
+                  value={confirmPassword}
+                  onChange={(e: ChangeEvent<HTMLInputElement>) =>
+                    setConfirmPassword(e.target.value)
+                  }
+                  className="w-full px-3 py-2 border rounded-md border-gray-300 dark:border-gray-600 bg-white dark:bg-gray-700 text-gray-900 dark:text-white"
+                  required
+                />
+              </div>
+            </>
+          )}
 
           <div className="flex justify-start space-x-4">
             <button
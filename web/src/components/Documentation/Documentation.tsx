@@ -346,6 +346,7 @@ export const Documentation = memo(function Documentation() {
         label: editLabel,
         documentationId: Number(selectedVersion?.id),
         ...(pageGroupId && { parentId: Number(pageGroupId) }),
+        baseRevision: currentModalItem?.revision,
       };
 
       const result = await updatePageGroup(updatePageGroupPayload);
@@ -367,7 +368,7 @@ export const Documentation = memo(function Documentation() {
         toastMessage(t(result.data?.message), "success");
       }
     },
-    [navigate, t, closeModal],
+    [navigate, t, closeModal, currentModalItem],
   );
 
   const handleCreatePageGroup = async (title: string, label: string) => {
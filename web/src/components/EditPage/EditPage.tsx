@@ -152,6 +152,7 @@ export default function EditPage() {
     slug: "",
     content: {},
     isIntroPage: false,
+    revision: 0,
   });
 
   const [editorContent, setEditorContent] = useState([
@@ -218,6 +219,7 @@ export default function EditPage() {
           title: data.title || "",
           slug: data.slug || "",
           isIntroPage: data.isIntroPage || false,
+          revision: data.revision || 0,
         }));
 
         const parsed = parsedContent(data.content);
@@ -248,13 +250,29 @@ export default function EditPage() {
       slug: pageData?.slug,
       content: JSON.stringify(editor.document),
       id: Number(pageId),
+      baseRevision: pageData?.revision,
     });
 
+    if (result.code === 409 && result.data?.current) {
+      // Someone else saved first. Keep the local edits in the editor and move
+      // onto their revision, so saving again overwrites it deliberately.
+      setPageData((prev) => ({
+        ...prev,
+        revision: result.data.current.revision,
+      }));
+      toastMessage(t("revision_conflict"), "warning");
+      return;
+    }
+
     if (handleError(result, navigate, t)) {
       return;
     }
 
     if (result.status === "success") {
+      setPageData((prev) => ({
+        ...prev,
+        revision: Number(result.data.revision),
+      }));
       toastMessage(t(result.data.message), "success");
       refreshData();
     }
@@ -17,6 +17,7 @@ const errorConfig: ErrorConfigs = {
   401: { title: "Unauthorized", icon: "carbon:user-profile" },
   403: { title: "Forbidden", icon: "carbon:locked" },
   404: { title: "Not Found", icon: "carbon:search" },
+  429: { title: "Too Many Requests", icon: "carbon:time" },
   500: { title: "Internal Server Error", icon: "carbon:server-error" },
   502: { title: "Bad Gateway", icon: "carbon:network-3" },
   503: { title: "Service Unavailable", icon: "carbon:time" },
@@ -66,12 +66,14 @@ export default function PageGroupListModal() {
           id: currentModalItem?.id || 0,
           name: currentModalItem?.name,
           documentationId: currentModalItem?.documentationId || 0,
+          baseRevision: currentModalItem?.revision,
           parentId: undefined,
         });
       } else {
         result = updatePage({
           id: currentModalItem?.id || 0,
           documentationId: currentModalItem?.documentationId || 0,
+          baseRevision: currentModalItem?.revision,
           title: currentModalItem?.title || "",
           slug: currentModalItem?.slug || "",
           content: "",
@@ -83,12 +85,14 @@ export default function PageGroupListModal() {
           id: currentModalItem?.id || 0,
           name: currentModalItem?.name,
           documentationId: currentModalItem?.documentationId || 0,
+          baseRevision: currentModalItem?.revision,
           parentId: obj.id,
         });
       } else {
         result = updatePage({
           id: currentModalItem?.id || 0,
           documentationId: currentModalItem?.documentationId || 0,
+          baseRevision: currentModalItem?.revision,
           pageGroupId: obj.id,
           title: currentModalItem?.title || "",
           slug: currentModalItem?.slug || "",
@@ -5,7 +5,13 @@ import { useTranslation } from "react-i18next";
 import { useNavigate, useParams } from "react-router-dom";
 
 import {
+  beginTwoFactorEnrolment,
+  confirmTwoFactorEnrolment,
+  disableTwoFactor,
   getUser,
+  regenerateRecoveryCodes,
+  requireTwoFactor,
+  resetTwoFactor,
   updateUser,
   UpdateUserPayload,
   uploadFile,
@@ -46,6 +52,13 @@ export default function UserForm() {
   const [confirmPasswod, setConfirmPassword] = useState<string>("");
   const [isLoading, setIsLoading] = useState<boolean>(false);
   const [dropdown, setDropdown] = useState<boolean>(false);
+  const [twoFactorKey, setTwoFactorKey] = useState<{
+    secret: string;
+    uri: string;
+  } | null>(null);
+  const [twoFactorCode, setTwoFactorCode] = useState<string>("");
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [twoFactorRefresh, setTwoFactorRefresh] = useState<boolean>(false);
 
   const inputRef = useRef<HTMLInputElement | null>(null);
   const editorRef = useRef<AvatarEditor | null>(null);
@@ -74,7 +87,7 @@ export default function UserForm() {
     };
 
     fetchUserData();
-  }, [userId, currentUser, navigate]);
+  }, [userId, currentUser, navigate, twoFactorRefresh]);
 
   useEffect(() => {
     if (isEdit && inputRef.current) {
@@ -211,6 +224,57 @@ export default function UserForm() {
     }
   };
 
+  const isOwnProfile = userData?.id === Number(currentUser?.userId);
+
+  const reloadTwoFactor = () => {
+    setTwoFactorCode("");
+    setTwoFactorRefresh(!twoFactorRefresh);
+  };
+
+  const handleSetUpTwoFactor = async () => {
+    const result = await beginTwoFactorEnrolment();
+    if (handleError(result, navigate, t)) return;
+    setRecoveryCodes([]);
+    setTwoFactorKey({ secret: result.data.secret, uri: result.data.uri });
+  };
+
+  const handleConfirmTwoFactor = async () => {
+    const result = await confirmTwoFactorEnrolment(twoFactorCode.trim());
+    if (handleError(result, navigate, t)) return;
+    setTwoFactorKey(null);
+    setRecoveryCodes(result.data.recoveryCodes);
+    toastMessage(t("two_factor_enabled"), "success");
+    reloadTwoFactor();
+  };
+
+  const handleDisableTwoFactor = async () => {
+    const result = await disableTwoFactor(twoFactorCode.trim());
+    if (handleError(result, navigate, t)) return;
+    setRecoveryCodes([]);
+    toastMessage(t("two_factor_disabled"), "success");
+    reloadTwoFactor();
+  };
+
+  const handleRegenerateRecoveryCodes = async () => {
+    const result = await regenerateRecoveryCodes(twoFactorCode.trim());
+    if (handleError(result, navigate, t)) return;
+    setRecoveryCodes(result.data.recoveryCodes);
+    setTwoFactorCode("");
+  };
+
+  const handleResetTwoFactor = async () => {
+    const result = await resetTwoFactor(Number(userData?.id));
+    if (handleError(result, navigate, t)) return;
+    toastMessage(t("two_factor_reset"), "success");
+    reloadTwoFactor();
+  };
+
+  const handleRequireTwoFactor = async (required: boolean) => {
+    const result = await requireTwoFactor(Number(userData?.id), required);
+    if (handleError(result, navigate, t)) return;
+    reloadTwoFactor();
+  };
+
   const handleWheel = (e: React.WheelEvent<HTMLDivElement>) => {
     e.preventDefault();
     const delta = Math.sign(e.deltaY);
@@ -440,6 +504,122 @@ export default function UserForm() {
             </button>
           </div>
         </div>
+
+        {/* Two-Factor Authentication Section */}
+        <div className="mt-12 border-t pt-8 dark:border-gray-700">
+          <h3 className="text-xl font-semibold text-gray-900 dark:text-white mb-6">
+            {t("two_factor_authentication")}
+          </h3>
+          <p className="text-sm text-gray-700 dark:text-gray-300 mb-6">
+            {userData?.twoFactorEnabled
+              ? t("two_factor_enabled")
+              : t("two_factor_not_enabled")}
+            {userData?.twoFactorRequired && ` ${t("two_factor_required")}`}
+          </p>
+
+          {!isOwnProfile && (
+            <div className="flex flex-wrap items-center gap-6">
+              <label className="flex items-center gap-2 text-sm text-gray-700 dark:text-gray-300">
+                <input
+                  type="checkbox"
+                  checked={userData?.twoFactorRequired || false}
+                  onChange={(e) => handleRequireTwoFactor(e.target.checked)}
+                  className="w-4 h-4 rounded border-gray-300 dark:bg-gray-700 dark:border-gray-600"
+                />
+                {t("require_two_factor")}
+              </label>
+              {userData?.twoFactorEnabled && (
+                <button
+                  className="bg-red-500 text-white rounded-md px-6 py-2 hover:bg-red-600 transition duration-300"
+                  onClick={handleResetTwoFactor}
+                >
+                  {t("reset_two_factor")}
+                </button>
+              )}
+            </div>
+          )}
+
+          {isOwnProfile && (
+            <div className="space-y-6">
+              {twoFactorKey && (
+                <div className="space-y-2 text-sm text-gray-700 dark:text-gray-300">
+                  <p>{t("scan_two_factor_key")}</p>
+                  <a
+                    href={twoFactorKey.uri}
+                    className="block text-blue-500 hover:underline break-all"
+                  >
+                    {t("open_in_authenticator_app")}
+                  </a>
+                  <p className="font-mono break-all text-gray-900 dark:text-white">
+                    {twoFactorKey.secret}
+                  </p>
+                </div>
+              )}
+
+              {recoveryCodes.length > 0 && (
+                <div className="space-y-2">
+                  <p className="text-sm text-gray-700 dark:text-gray-300">
+                    {t("save_recovery_codes")}
+                  </p>
+                  <ul className="grid grid-cols-2 md:grid-cols-5 gap-2 font-mono text-sm text-gray-900 dark:text-white">
+                    {recoveryCodes.map((recoveryCode) => (
+                      <li key={recoveryCode}>{recoveryCode}</li>
+                    ))}
+                  </ul>
+                </div>
+              )}
+
+              {!userData?.twoFactorEnabled && !twoFactorKey ? (
+                <button
+                  className="bg-blue-500 text-white rounded-md px-6 py-2 hover:bg-blue-600 transition duration-300"
+                  onClick={handleSetUpTwoFactor}
+                >
+                  {t("set_up_two_factor")}
+                </button>
+              ) : (
+                <div className="flex flex-wrap items-end gap-4">
+                  <div>
+                    <span className="block text-sm font-medium text-gray-700 dark:text-gray-300 mb-2">
+                      {t("two_factor_code")}
+                    </span>
+                    <input
+                      type="text"
+                      value={twoFactorCode}
+                      autoComplete="one-time-code"
+                      onChange={(e) => setTwoFactorCode(e.target.value)}
+                      className="w-full px-3 py-2 border border-gray-300 rounded-md focus:ring-blue-500 focus:border-blue-500 dark:bg-gray-700 dark:border-gray-600 dark:text-white"
+                    />
+                  </div>
+                  {twoFactorKey ? (
+                    <button
+                      className="bg-green-500 text-white rounded-md px-6 py-2 hover:bg-green-600 transition duration-300"
+                      onClick={handleConfirmTwoFactor}
+                    >
+                      {t("verify")}
+                    </button>
+                  ) : (
+                    <>
+                      <button
+                        className="bg-blue-500 text-white rounded-md px-6 py-2 hover:bg-blue-600 transition duration-300"
+                        onClick={handleRegenerateRecoveryCodes}
+                      >
+                        {t("new_recovery_codes")}
+                      </button>
+                      {!userData?.twoFactorRequired && (
+                        <button
+                          className="bg-red-500 text-white rounded-md px-6 py-2 hover:bg-red-600 transition duration-300"
+                          onClick={handleDisableTwoFactor}
+                        >
+                          {t("disable_two_factor")}
+                        </button>
+                      )}
+                    </>
+                  )}
+                </div>
+              )}
+            </div>
+          )}
+        </div>
       </div>
 
       {/* Image Cropping Modal */}
@@ -12,6 +12,7 @@ import { createJWT, refreshJWT, signOut, validateJWT } from "../api/Requests";
 import { useToken } from "../hooks/useToken";
 import { UpdateUserFunction, UserType, useUser } from "../hooks/useUser";
 import { UserDetails, useUserDetails } from "../hooks/useUserDetails";
+import { ValidatedJWT } from "../types/auth";
 import { handleError, isTokenExpiringSoon, setCookie } from "../utils/Common";
 import { toastMessage } from "../utils/Toast";
 
@@ -23,6 +24,11 @@ export interface AuthContextType {
     redirectTo: string,
   ) => Promise<void>;
   loginOAuth: (code: string) => Promise<void>;
+  completeLogin: (
+    data: ValidatedJWT,
+    setSession: boolean,
+    redirectTo: string,
+  ) => void;
   user: UserType;
   setUser: UpdateUserFunction;
   logout: () => Promise<void>;
@@ -71,21 +77,42 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     redirectTo: string = "",
   ) => {
     const response = await createJWT({ username, password });
+    if (response.status === "error" && response.code === 401) {
+      toastMessage(t(response.data?.message || response.message), "error");
+      return;
+    }
     if (handleError(response, navigate, t)) return;
+    if (response.data.status === "two_factor_required") {
+      const params = new URLSearchParams({
+        challenge: response.data.challenge,
+        enroll: String(response.data.enroll),
+      });
+      navigate(`/login/2fa?${params.toString()}`, {
+        state: { setSession, redirectTo },
+      });
+      return;
+    }
     if (response.status === "success") {
-      const data = response.data.token;
-      setToken(data);
-      setUser(data);
-      if (setSession !== false) {
-        setCookie("viewToken", data, 1);
-        if (redirectTo) {
-          window.location.href = redirectTo;
-          return;
-        }
+      completeLogin(response.data, setSession, redirectTo);
+    }
+  };
+
+  const completeLogin = (
+    data: ValidatedJWT,
+    setSession: boolean,
+    redirectTo: string,
+  ) => {
+    setToken(data.token);
+    setUser(data.token);
+    if (setSession !== false) {
+      setCookie("viewToken", data.token, 1);
+      if (redirectTo) {
+        window.location.href = redirectTo;
+        return;
       }
-      localStorage.setItem("accessToken", JSON.stringify(response?.data));
-      navigate("/dashboard", { replace: true });
     }
+    localStorage.setItem("accessToken", JSON.stringify(data));
+    navigate("/dashboard", { replace: true });
   };
 
   const loginOAuth = async (code: string) => {
@@ -152,6 +179,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   const contextValue: AuthContextType = {
     login,
     loginOAuth,
+    completeLogin,
     user,
     setUser,
     logout,
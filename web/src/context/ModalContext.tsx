@@ -13,6 +13,7 @@ export interface ModalItem {
   pageGroupId?: number | null | undefined;
   isPageGroup?: boolean;
   isPage?: boolean;
+  revision?: number;
 }
 
 export interface ModalContextType {
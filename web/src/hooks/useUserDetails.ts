@@ -14,7 +14,9 @@ export interface UserDetails {
   admin?: boolean;
   username: string;
   email: string;
-  password: string;
+  passwordSet: boolean;
+  twoFactorEnabled: boolean;
+  twoFactorRequired: boolean;
   createdAt: string;
   updatedAt: string;
   photo?: string;
@@ -0,0 +1,95 @@
+import { KeyboardEventHandler, useState } from "react";
+import { useTranslation } from "react-i18next";
+import { Link } from "react-router-dom";
+
+import { forgotPassword } from "../api/Requests";
+import Navbar from "../components/Navbar/Navbar";
+import { handleError, isValidEmail } from "../utils/Common";
+import { toastMessage } from "../utils/Toast";
+
+export default function ForgotPasswordPage() {
+  const { t } = useTranslation();
+  const [email, setEmail] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+  const [sent, setSent] = useState(false);
+
+  const handleSubmit = async () => {
+    if (!isValidEmail(email)) {
+      toastMessage(t("invalid_email"), "warning");
+      return;
+    }
+
+    setIsLoading(true);
+    const result = await forgotPassword(email);
+    setIsLoading(false);
+
+    if (!handleError(result, null, t)) {
+      setSent(true);
+    }
+  };
+
+  const handleKeyDown: KeyboardEventHandler<HTMLInputElement> = (event) => {
+    if (event.key === "Enter" && !isLoading) {
+      event.preventDefault();
+      handleSubmit();
+    }
+  };
+
+  return (
+    <div>
+      <Navbar />
+      <section className="bg-gray-50 dark:bg-gray-900">
+        <div className="flex flex-col items-center justify-center px-6 py-8 mx-auto h-screen lg:py-0">
+          <div className="w-full bg-white rounded-lg shadow dark:border md:mt-0 sm:max-w-md xl:p-0 dark:bg-gray-800 dark:border-gray-700">
+            <div className="p-6 space-y-4 md:space-y-6 sm:p-8">
+              <h1 className="text-xl font-bold leading-tight tracking-tight text-gray-900 md:text-2xl dark:text-white text-center">
+                {t("forgot_password")}
+              </h1>
+              {sent ? (
+                <p className="text-sm text-gray-700 dark:text-gray-300 text-center">
+                  {t("reset_email_sent")}
+                </p>
+              ) : (
+                <div className="space-y-4 md:space-y-6">
+                  <p className="text-sm text-gray-700 dark:text-gray-300">
+                    {t("forgot_password_hint")}
+                  </p>
+                  <div>
+                    <span className="block mb-2 text-sm font-medium text-gray-900 dark:text-white">
+                      {t("email_address")}
+                    </span>
+                    <input
+                      type="email"
+                      name="email"
+                      id="email"
+                      className="bg-gray-50 border border-gray-300 text-gray-900 rounded-lg focus:ring-primary-600 focus:border-primary-600 block w-full p-2.5 dark:bg-gray-700 dark:border-gray-600 dark:placeholder-gray-400 dark:text-white dark:focus:ring-blue-500 dark:focus:border-blue-500"
+                      placeholder="admin@example.com"
+                      onChange={(e) => setEmail(e.target.value)}
+                      onKeyDown={handleKeyDown}
+                    />
+                  </div>
+                  <button
+                    onClick={handleSubmit}
+                    type="submit"
+                    disabled={isLoading}
+                    className={`w-full text-white bg-primary-600 hover:bg-primary-700 focus:ring-4 focus:outline-none focus:ring-primary-300 font-medium rounded-lg text-sm px-5 py-2.5 text-center dark:bg-primary-600 dark:hover:bg-primary-700 dark:focus:ring-primary-800 ${
+                      isLoading ? "opacity-50 cursor-not-allowed" : ""
+                    }`}
+                  >
+                    {t("send_reset_link")}
+                  </button>
+                </div>
+              )}
+              <Link
+                to="/login"
+                className="block text-sm text-center text-primary-600 hover:underline dark:text-primary-500"
+              >
+                {t("back_to_sign_in")}
+              </Link>
+            </div>
+          </div>
+        </div>
+      </section>
+    </div>
+  );
+}
@@ -1,10 +1,10 @@
 import { Icon } from "@iconify/react/dist/iconify.js";
 import { KeyboardEventHandler, useContext, useEffect, useState } from "react";
 import { useTranslation } from "react-i18next";
-import { useSearchParams } from "react-router-dom";
+import { Link, useSearchParams } from "react-router-dom";
 
 import { baseURL } from "../api/AxiosInstance";
-import { oAuthProviders } from "../api/Requests";
+import { OIDCProvider, oAuthProviders, oidcProviders } from "../api/Requests";
 import Navbar from "../components/Navbar/Navbar";
 import { AuthContext, AuthContextType } from "../context/AuthContext";
 import { b64ToString } from "../utils/Common";
@@ -16,6 +16,9 @@ export default function LoginPage() {
   const [password, setPassword] = useState("");
   const [isLoading, setIsLoading] = useState(false);
   const [availableProviders, setAvailableProviders] = useState<string[]>([]);
+  const [availableOIDCProviders, setAvailableOIDCProviders] = useState<
+    OIDCProvider[]
+  >([]);
   const [searchParams] = useSearchParams();
   const [docAuth, setDocAuth] = useState<string>("");
 
@@ -37,14 +40,26 @@ export default function LoginPage() {
       }
     };
 
+    const fetchOIDCProviders = async () => {
+      try {
+        const response = await oidcProviders();
+        setAvailableOIDCProviders(response || []);
+      } catch (error) {
+        console.error("Failed to fetch OIDC providers:", error);
+        setAvailableOIDCProviders([]);
+      }
+    };
+
     fetchOAuthProviders();
+    fetchOIDCProviders();
   }, []);
 
   useEffect(() => {
     if (
       window.location.pathname.endsWith("login/gh") ||
       window.location.pathname.endsWith("login/ms") ||
-      window.location.pathname.endsWith("login/gg")
+      window.location.pathname.endsWith("login/gg") ||
+      window.location.pathname.endsWith("login/oidc")
     ) {
       const code = new URLSearchParams(window.location.search).get("token");
       if (code) {
@@ -160,6 +175,12 @@ export default function LoginPage() {
                     onChange={(e) => setPassword(e.target.value)}
                     onKeyDown={handleKeyDown}
                   />
+                  <Link
+                    to="/forgot-password"
+                    className="block mt-2 text-sm text-right text-primary-600 hover:underline dark:text-primary-500"
+                  >
+                    {t("forgot_password")}
+                  </Link>
                 </div>
 
                 {availableProviders.length > 0 && (
@@ -179,6 +200,19 @@ export default function LoginPage() {
                   </div>
                 )}
 
+                {availableOIDCProviders.map((provider) => (
+                  <button
+                    key={provider.name}
+                    onClick={() => {
+                      window.location.href = `${baseURL}/kal-api/oauth/oidc/${provider.name}`;
+                    }}
+                    className="w-full inline-flex items-center justify-center gap-2 py-2.5 px-5 focus:ring-2 dark:focus:ring-2 focus:outline-none focus:ring-gray-700 dark:focus:ring-gray-700 font-medium text-sm text-gray-900 bg-white rounded-lg border border-gray-200 hover:bg-gray-100 hover:text-gray-900 dark:bg-gray-800 dark:text-gray-400 dark:border-gray-600 dark:hover:text-white dark:hover:bg-gray-700"
+                  >
+                    <Icon icon="mdi:shield-key-outline" className="w-5 h-5" />
+                    {t("sign_in_with", { provider: provider.displayName })}
+                  </button>
+                ))}
+
                 <button
                   onClick={handleSubmit}
                   type="submit"
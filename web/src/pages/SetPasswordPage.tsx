@@ -0,0 +1,115 @@
+import { useState } from "react";
+import { useTranslation } from "react-i18next";
+import { Link, useNavigate, useSearchParams } from "react-router-dom";
+
+import { acceptInvitation, resetPassword } from "../api/Requests";
+import Navbar from "../components/Navbar/Navbar";
+import { handleError } from "../utils/Common";
+import { toastMessage } from "../utils/Toast";
+
+interface SetPasswordPageProps {
+  mode: "reset" | "invite";
+}
+
+export default function SetPasswordPage({ mode }: SetPasswordPageProps) {
+  const { t } = useTranslation();
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const [password, setPassword] = useState("");
+  const [confirmPassword, setConfirmPassword] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  const token = searchParams.get("token") || "";
+
+  const handleSubmit = async () => {
+    if (password.length < 8) {
+      toastMessage(t("password_must_be_at_least_8_characters"), "warning");
+      return;
+    }
+
+    if (password !== confirmPassword) {
+      toastMessage(t("password_and_confirm_password_do_not_match"), "warning");
+      return;
+    }
+
+    setIsLoading(true);
+    const result =
+      mode === "invite"
+        ? await acceptInvitation(token, password)
+        : await resetPassword(token, password);
+    setIsLoading(false);
+
+    if (!handleError(result, null, t)) {
+      toastMessage(t("password_set"), "success");
+      navigate("/login");
+    }
+  };
+
+  const inputClass =
+    "bg-gray-50 border border-gray-300 text-gray-900 rounded-lg focus:ring-primary-600 focus:border-primary-600 block w-full p-2.5 dark:bg-gray-700 dark:border-gray-600 dark:placeholder-gray-400 dark:text-white dark:focus:ring-blue-500 dark:focus:border-blue-500";
+
+  return (
+    <div>
+      <Navbar />
+      <section className="bg-gray-50 dark:bg-gray-900">
+        <div className="flex flex-col items-center justify-center px-6 py-8 mx-auto h-screen lg:py-0">
+          <div className="w-full bg-white rounded-lg shadow dark:border md:mt-0 sm:max-w-md xl:p-0 dark:bg-gray-800 dark:border-gray-700">
+            <div className="p-6 space-y-4 md:space-y-6 sm:p-8">
+              <h1 className="text-xl font-bold leading-tight tracking-tight text-gray-900 md:text-2xl dark:text-white text-center">
+                {mode === "invite" ? t("accept_invitation") : t("reset_password")}
+              </h1>
+              {token === "" ? (
+                <p className="text-sm text-red-600 dark:text-red-400 text-center">
+                  {t("invalid_or_expired_link")}
+                </p>
+              ) : (
+                <div className="space-y-4 md:space-y-6">
+                  <div>
+                    <span className="block mb-2 text-sm font-medium text-gray-900 dark:text-white">
+                      {t("new_password")}
+                    </span>
+                    <input
+                      type="password"
+                      id="password"
+                      placeholder="••••••••"
+                      className={inputClass}
+                      onChange={(e) => setPassword(e.target.value)}
+                    />
+                  </div>
+                  <div>
+                    <span className="block mb-2 text-sm font-medium text-gray-900 dark:text-white">
+                      {t("confirm_password")}
+                    </span>
+                    <input
+                      type="password"
+                      id="confirmPassword"
+                      placeholder="••••••••"
+                      className={inputClass}
+                      onChange={(e) => setConfirmPassword(e.target.value)}
+                    />
+                  </div>
+                  <button
+                    onClick={handleSubmit}
+                    type="submit"
+                    disabled={isLoading}
+                    className={`w-full text-white bg-primary-600 hover:bg-primary-700 focus:ring-4 focus:outline-none focus:ring-primary-300 font-medium rounded-lg text-sm px-5 py-2.5 text-center dark:bg-primary-600 dark:hover:bg-primary-700 dark:focus:ring-primary-800 ${
+                      isLoading ? "opacity-50 cursor-not-allowed" : ""
+                    }`}
+                  >
+                    {t("choose_password")}
+                  </button>
+                </div>
+              )}
+              <Link
+                to="/login"
+                className="block text-sm text-center text-primary-600 hover:underline dark:text-primary-500"
+              >
+                {t("back_to_sign_in")}
+              </Link>
+            </div>
+          </div>
+        </div>
+      </section>
+    </div>
+  );
+}
@@ -0,0 +1,176 @@
+import { useContext, useEffect, useState } from "react";
+import { useTranslation } from "react-i18next";
+import { Link, useLocation, useSearchParams } from "react-router-dom";
+
+import {
+  enrollTwoFactorChallenge,
+  verifyTwoFactorChallenge,
+} from "../api/Requests";
+import Navbar from "../components/Navbar/Navbar";
+import { AuthContext, AuthContextType } from "../context/AuthContext";
+import { ValidatedJWT } from "../types/auth";
+import { handleError } from "../utils/Common";
+import { toastMessage } from "../utils/Toast";
+
+interface Enrolment {
+  secret: string;
+  uri: string;
+}
+
+export default function TwoFactorPage() {
+  const { t } = useTranslation();
+  const location = useLocation();
+  const [searchParams] = useSearchParams();
+  const { completeLogin } = useContext(AuthContext) as AuthContextType;
+  const [code, setCode] = useState("");
+  const [enrolment, setEnrolment] = useState<Enrolment | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+  const [pendingLogin, setPendingLogin] = useState<ValidatedJWT | null>(null);
+  const [isLoading, setIsLoading] = useState(false);
+
+  const challenge = searchParams.get("challenge") || "";
+  const enroll = searchParams.get("enroll") === "true";
+  const keepSession = location.state?.setSession ?? false;
+  const redirectTo = location.state?.redirectTo ?? "";
+
+  useEffect(() => {
+    if (!enroll || challenge === "") return;
+
+    const fetchEnrolment = async () => {
+      const result = await enrollTwoFactorChallenge(challenge);
+      if (handleError(result, null, t)) return;
+      setEnrolment({ secret: result.data.secret, uri: result.data.uri });
+    };
+
+    fetchEnrolment();
+  }, [challenge, enroll, t]);
+
+  const handleSubmit = async () => {
+    if (code.trim() === "") {
+      toastMessage(t("enter_two_factor_code"), "warning");
+      return;
+    }
+
+    setIsLoading(true);
+    const result = await verifyTwoFactorChallenge(challenge, code.trim());
+    setIsLoading(false);
+
+    if (result.status === "error" && result.code === 401) {
+      toastMessage(t(result.data?.message || result.message), "error");
+      return;
+    }
+    if (handleError(result, null, t)) return;
+
+    if (result.data.recoveryCodes) {
+      setRecoveryCodes(result.data.recoveryCodes);
+      setPendingLogin(result.data);
+      return;
+    }
+
+    completeLogin(result.data, keepSession, redirectTo);
+  };
+
+  const inputClass =
+    "bg-gray-50 border border-gray-300 text-gray-900 rounded-lg focus:ring-primary-600 focus:border-primary-600 block w-full p-2.5 dark:bg-gray-700 dark:border-gray-600 dark:placeholder-gray-400 dark:text-white dark:focus:ring-blue-500 dark:focus:border-blue-500";
+
+  const buttonClass = `w-full text-white bg-primary-600 hover:bg-primary-700 focus:ring-4 focus:outline-none focus:ring-primary-300 font-medium rounded-lg text-sm px-5 py-2.5 text-center dark:bg-primary-600 dark:hover:bg-primary-700 dark:focus:ring-primary-800 ${
+    isLoading ? "opacity-50 cursor-not-allowed" : ""
+  }`;
+
+  return (
+    <div>
+      <Navbar />
+      <section className="bg-gray-50 dark:bg-gray-900">
+        <div className="flex flex-col items-center justify-center px-6 py-8 mx-auto h-screen lg:py-0">
+          <div className="w-full bg-white rounded-lg shadow dark:border md:mt-0 sm:max-w-md xl:p-0 dark:bg-gray-800 dark:border-gray-700">
+            <div className="p-6 space-y-4 md:space-y-6 sm:p-8">
+              <h1 className="text-xl font-bold leading-tight tracking-tight text-gray-900 md:text-2xl dark:text-white text-center">
+                {t("two_factor_authentication")}
+              </h1>
+              {challenge === "" ? (
+                <p className="text-sm text-red-600 dark:text-red-400 text-center">
+                  {t("invalid_or_expired_challenge")}
+                </p>
+              ) : pendingLogin ? (
+                <div className="space-y-4">
+                  <p className="text-sm text-gray-700 dark:text-gray-300">
+                    {t("save_recovery_codes")}
+                  </p>
+                  <ul className="grid grid-cols-2 gap-2 font-mono text-sm text-gray-900 dark:text-white">
+                    {recoveryCodes.map((recoveryCode) => (
+                      <li key={recoveryCode}>{recoveryCode}</li>
+                    ))}
+                  </ul>
+                  <button
+                    type="button"
+                    className={buttonClass}
+                    onClick={() =>
+                      completeLogin(pendingLogin, keepSession, redirectTo)
+                    }
+                  >
+                    {t("continue")}
+                  </button>
+                </div>
+              ) : (
+                <div className="space-y-4 md:space-y-6">
+                  {enroll && (
+                    <div className="space-y-2 text-sm text-gray-700 dark:text-gray-300">
+                      <p>{t("two_factor_enrolment_required")}</p>
+                      {enrolment && (
+                        <>
+                          <a
+                            href={enrolment.uri}
+                            className="block text-primary-600 hover:underline dark:text-primary-500 break-all"
+                          >
+                            {t("open_in_authenticator_app")}
+                          </a>
+                          <p className="font-mono break-all text-gray-900 dark:text-white">
+                            {enrolment.secret}
+                          </p>
+                        </>
+                      )}
+                    </div>
+                  )}
+                  <div>
+                    <span className="block mb-2 text-sm font-medium text-gray-900 dark:text-white">
+                      {t("two_factor_code")}
+                    </span>
+                    <input
+                      type="text"
+                      id="code"
+                      autoComplete="one-time-code"
+                      className={inputClass}
+                      onChange={(e) => setCode(e.target.value)}
+                      onKeyDown={(e) => {
+                        if (e.key === "Enter") handleSubmit();
+                      }}
+                    />
+                    {!enroll && (
+                      <p className="mt-2 text-xs text-gray-500 dark:text-gray-400">
+                        {t("two_factor_code_hint")}
+                      </p>
+                    )}
+                  </div>
+                  <button
+                    onClick={handleSubmit}
+                    type="submit"
+                    disabled={isLoading}
+                    className={buttonClass}
+                  >
+                    {t("verify")}
+                  </button>
+                </div>
+              )}
+              <Link
+                to="/login"
+                className="block text-sm text-center text-primary-600 hover:underline dark:text-primary-500"
+              >
+                {t("back_to_sign_in")}
+              </Link>
+            </div>
+          </div>
+        </div>
+      </section>
+    </div>
+  );
+}
@@ -14,7 +14,10 @@ export interface User {
   admin: boolean;
   username: string;
   email: string;
-  password: string;
+  passwordSet: boolean;
+  twoFactorEnabled: boolean;
+  twoFactorRequired: boolean;
+  permissions?: string;
   createdAt: string;
   updatedAt: string;
   photo?: string;
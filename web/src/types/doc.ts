@@ -26,6 +26,178 @@ export interface Page {
   isIntroPage?: boolean;
   content?: string;
   isPage: boolean;
+  revision: number;
+  metaTitle?: string;
+  metaDescription?: string;
+  metaImage?: string;
+  canonicalURL?: string;
+  noIndex?: boolean;
+  hideSidebar?: boolean;
+  pageType?: string;
+  tags?: Tag[];
+}
+
+export interface Snippet {
+  id: number;
+  documentationId: number | null;
+  name: string;
+  content: string;
+  authorId: number;
+  lastEditorId?: number;
+  createdAt?: string;
+  updatedAt?: string;
+}
+
+export interface BlockChange {
+  blockId: string;
+  type: string;
+  change: 'added' | 'changed' | 'removed';
+  before?: string;
+  after?: string;
+}
+
+export interface PageChange {
+  fromPageId?: number;
+  toPageId?: number;
+  title: string;
+  fromTitle?: string;
+  slug: string;
+  fromPath?: string;
+  toPath?: string;
+  fromOrder?: number;
+  toOrder?: number;
+  blocks?: BlockChange[];
+}
+
+export interface VersionDetails {
+  id: number;
+  version: string;
+  clonedFrom: number | null;
+  prerelease: boolean;
+  hidden: boolean;
+  deprecated: boolean;
+  pinned: boolean;
+  default: boolean;
+  createdAt?: string;
+}
+
+export interface PageRevision {
+  id: number;
+  pageId: number;
+  revision: number;
+  title?: string;
+  authorId?: number;
+  createdAt?: string;
+}
+
+export interface MergeConflict {
+  blockId: string;
+  type?: string;
+  reason: 'changed_in_both' | 'changed_and_deleted' | 'deleted_and_changed';
+  base?: string;
+  ours?: string;
+  theirs?: string;
+}
+
+export interface PropagationResult {
+  documentationId: number;
+  version: string;
+  pageId?: number;
+  status: 'applied' | 'unchanged' | 'conflict' | 'page_not_found';
+  conflicts?: MergeConflict[];
+}
+
+export interface RenamedSlug {
+  pageId: number;
+  from: string;
+  to: string;
+}
+
+export interface TransferResult {
+  pageId?: number;
+  pageGroupId?: number;
+  renamed: RenamedSlug[];
+}
+
+export interface BatchOperation {
+  op: 'create' | 'update' | 'delete';
+  type: 'page' | 'page_group';
+  ref?: string;
+  id?: number;
+  idRef?: string;
+  documentationId?: number;
+  parentId?: number;
+  parentRef?: string;
+  revision?: number;
+  title?: string;
+  slug?: string;
+  content?: string;
+  name?: string;
+  label?: string;
+  order?: number;
+}
+
+export interface BatchResult {
+  ids: Record<string, number>;
+  results: { op: string; type: string; id: number }[];
+}
+
+export interface V2List<T> {
+  data: T[];
+  nextCursor?: string;
+}
+
+export interface V2Problem {
+  type: string;
+  title: string;
+  status: number;
+  detail?: string;
+  instance?: string;
+  code: string;
+}
+
+export interface VersionComparison {
+  fromId: number;
+  toId: number;
+  from: string;
+  to: string;
+  added: PageChange[];
+  removed: PageChange[];
+  moved: PageChange[];
+  reordered: PageChange[];
+  changed: PageChange[];
+  summary: string;
+}
+
+export interface Template {
+  id: number;
+  kind: 'page' | 'documentation';
+  name: string;
+  description?: string;
+  content?: string;
+  builtin: boolean;
+  authorId?: number;
+  createdAt?: string;
+  updatedAt?: string;
+}
+
+export interface SnippetUsage {
+  pageId: number;
+  documentationId: number;
+  title: string;
+  locale?: string;
+  snippetId: number;
+}
+
+export interface Tag {
+  id: number;
+  documentationId: number;
+  name: string;
+  slug: string;
+  category?: string;
+  description?: string;
+  createdAt?: string;
+  updatedAt?: string;
 }
 
 export interface PageGroup {
@@ -43,6 +215,7 @@ export interface PageGroup {
   updatedAt: string;
   isPageGroup: boolean;
   pageGroups: PageGroup[];
+  revision: number;
 }
 
 export type PageOrGroup = PageGroup | Page;
@@ -92,6 +265,7 @@ export interface Documentation {
   navImage: string;
   navImageDark: string;
   customCSS: string;
+  robotsTxt?: string;
   footerLabelLinks?: FooterLabelLinks[];
   moreLabelLinks?: MoreLabelLinks[];
   authorId: number;
@@ -107,9 +281,17 @@ export interface Documentation {
   gitUser: string;
   gitRepo: string;
   gitEmail: string;
-  gitPassword: string;
+  gitPasswordSet: boolean;
   gitBranch: string;
-  tokenSecret: string;
+  tokenSecretSet: boolean;
+  locales?: string;
+  defaultLocale?: string;
+  variables?: string;
+  defaultVersion?: boolean;
+  prerelease?: boolean;
+  hidden?: boolean;
+  deprecated?: boolean;
+  revision: number;
 }
 
 export interface FormField {
@@ -164,6 +346,7 @@ export interface FormData {
   organizationName: string;
   projectName: string;
   customCSS: string;
+  robotsTxt?: string;
   favicon: string;
   navImageDark: string;
   navImage: string;
@@ -173,8 +356,11 @@ export interface FormData {
   gitRepo: string | undefined;
   gitEmail: string | undefined;
   gitPassword: string | undefined;
+  gitPasswordSet?: boolean;
   gitBranch: string | undefined;
   tokenSecret: string;
+  tokenSecretSet?: boolean;
+  revision?: number;
 }
 
 export function isPage(item: PageOrGroup): item is Page {
@@ -61,6 +61,7 @@ interface CreateDocumentFormData {
   gitRepo: string | undefined;
   gitEmail: string | undefined;
   gitPassword: string | undefined;
+  gitPasswordSet?: boolean;
   gitBranch: string | undefined;
 }
 
@@ -368,6 +369,9 @@ export const validateFormData = (
     ];
 
     for (const field of gitFields) {
+      if (field === "gitPassword" && formData.gitPasswordSet) {
+        continue;
+      }
       if (!formData[field]) {
         return {
           status: true,